@@ -3,35 +3,21 @@ set -euo pipefail
 
 IMAGE_NAME=$1
 TARGET_VERSION=${2:-}
-REGISTRY=${NEXUS_REGISTRY:-nexus.gillouche.homelab}
-NAMESPACE=${NEXUS_NAMESPACE:-docker-hosted}
-
-# Using Docker Buildx (DIND Sidecar supports this)
-if [ -f "images/$IMAGE_NAME/PLATFORMS" ]; then
-    # Convert newline or space separated list to comma-separated format for buildx
-    PLATFORMS=$(tr '\n' ',' < "images/$IMAGE_NAME/PLATFORMS" | sed 's/,,*/,/g; s/^,//; s/,$//')
-else
-    PLATFORMS="linux/amd64,linux/arm64"
-fi
+FACTORY=${FACTORY:-go run ./cmd/factory}
+export FACTORY_STATE_DIR=${FACTORY_STATE_DIR:-.factory}
 
-# Check if image exists
-if [ ! -d "images/$IMAGE_NAME" ]; then
+# Resolve the image directory, repositories, platforms and variants from the
+# factory configuration (ci/factory.json). Sets REGISTRY, IMAGE_DIR,
+# FULL_IMAGE, CACHE_IMAGE, PREVIOUS_IMAGE, PLATFORMS and VARIANTS.
+if ! LOCATION=$($FACTORY locate "$IMAGE_NAME"); then
     echo "Error: Image $IMAGE_NAME not found"
     exit 1
 fi
+eval "$LOCATION"
 
-# Load Variants
-VARIANTS_FILE="images/$IMAGE_NAME/VARIANTS"
-if [ -f "$VARIANTS_FILE" ]; then
-    VARIANTS=$(cat "$VARIANTS_FILE")
-else
-    # Fallback to single version if no VARIANTS (look for legacy VERSION file)
-    if [ -f "images/$IMAGE_NAME/VERSION" ]; then
-        VARIANTS=$(cat "images/$IMAGE_NAME/VERSION")
-    else
-        echo "Error: No VARIANTS or VERSION file found for $IMAGE_NAME"
-        exit 1
-    fi
+if [ -z "$VARIANTS" ]; then
+    echo "Error: No VARIANTS or VERSION file found for $IMAGE_NAME"
+    exit 1
 fi
 
 # Default to False
@@ -43,16 +29,56 @@ if [ "$PUSH_IMAGES" = "true" ]; then
     SCAN_IMAGES="true"
 fi
 
-# Determine the highest version for the "latest" tag (semver sort)
-LATEST_VERSION=$(echo "$VARIANTS" | sort -t. -k1,1n -k2,2n -k3,3n | tail -1)
-
 # Override if specific version targeted
 if [ -n "$TARGET_VERSION" ]; then
     VARIANTS="$TARGET_VERSION"
 fi
 
-# Registry cache location
-CACHE_IMAGE="$REGISTRY/$NAMESPACE/cache/$IMAGE_NAME"
+# Record the outcome of a published build in the factory ledger (feeds the
+# scorecard). Local and branch builds are not recorded.
+record_build() {
+    if [ "$PUSH_IMAGES" != "true" ]; then
+        return 0
+    fi
+    # shellcheck disable=SC2086
+    $FACTORY ledger record -image "$IMAGE_NAME" -variant "$VERSION" -status "$1" \
+        -duration "$((SECONDS - VARIANT_START))s" "${@:2}" \
+        || echo "Warning: failed to record build in the factory ledger"
+}
+
+# A variant that aborts mid-build is recorded as a failure.
+CURRENT_VERSION=""
+VARIANT_START=$SECONDS
+SECRETS_DIR=""
+on_exit() {
+    local status=$?
+    if [ -n "$SECRETS_DIR" ]; then
+        rm -rf "$SECRETS_DIR"
+    fi
+    if [ $status -ne 0 ] && [ -n "$CURRENT_VERSION" ]; then
+        VERSION="$CURRENT_VERSION" record_build failure -offline
+    fi
+}
+trap on_exit EXIT
+
+# Credentials never go through ARG/ENV: they would end up in the image
+# history and provenance.
+if ! $FACTORY lint -select "$IMAGE_NAME"; then
+    echo "Error: $IMAGE_NAME failed lint"
+    exit 1
+fi
+
+# Provision the BuildKit secret mounts of the Dockerfile from the factory
+# credential store (ci/factory.json) into a private directory removed on exit.
+SECRETS_DIR=$(mktemp -d)
+SECRET_FLAGS=()
+if ! SECRET_LIST=$($FACTORY secrets -dir "$SECRETS_DIR" "$IMAGE_NAME"); then
+    echo "Error: failed to provision build secrets for $IMAGE_NAME"
+    exit 1
+fi
+if [ -n "$SECRET_LIST" ]; then
+    mapfile -t SECRET_FLAGS <<< "$SECRET_LIST"
+fi
 
 # ---------------------------------------------------------
 # Ensure buildx is available and builder exists (once)
@@ -65,8 +91,8 @@ fi
 
 # Build Loop
 for VERSION in $VARIANTS; do
-    # User requested docker-hosted/base/ structure
-    FULL_IMAGE="$REGISTRY/$NAMESPACE/base/$IMAGE_NAME"
+    CURRENT_VERSION="$VERSION"
+    VARIANT_START=$SECONDS
     echo "=================================================="
     echo "Building $FULL_IMAGE:$VERSION ($PLATFORMS)"
     echo "Push Enabled: $PUSH_IMAGES"
@@ -78,19 +104,34 @@ for VERSION in $VARIANTS; do
     # We use GIT_REV and GIT_DATE scoped to the image directory to ensure build reproducibility
     # when only unrelated files change in the repo.
     
-    GIT_REV=$(git log -1 --format=%H "images/$IMAGE_NAME")
+    GIT_REV=$(git log -1 --format=%H "$IMAGE_DIR")
     # Fallback to HEAD if path history is empty (e.g. new file)
     if [ -z "$GIT_REV" ]; then
         GIT_REV=$(git rev-parse HEAD)
     fi
 
-    GIT_DATE=$(git log -1 --format=%ct "images/$IMAGE_NAME")
+    GIT_DATE=$(git log -1 --format=%ct "$IMAGE_DIR")
     if [ -z "$GIT_DATE" ]; then
         GIT_DATE=$(git log -1 --format=%ct)
     fi
     
     BUILD_DATE=$(date -u -d "@$GIT_DATE" +%Y-%m-%dT%H:%M:%SZ)
 
+    # With VENDORED_BASES=true, external bases are pulled from their vendored
+    # copies ("vendor" in ci/factory.json) instead of the proxies, e.g. to
+    # rebuild after upstream deleted a digest. VENDOR_REVISION uses the bases
+    # recorded in the ledger for an earlier build of that revision.
+    CONTEXT_FLAGS=()
+    if [ "${VENDORED_BASES:-false}" = "true" ]; then
+        if ! CONTEXT_LIST=$($FACTORY vendor contexts ${VENDOR_REVISION:+-revision "$VENDOR_REVISION"} "$IMAGE_NAME" "$VERSION"); then
+            echo "Error: failed to resolve the vendored bases of $IMAGE_NAME:$VERSION"
+            exit 1
+        fi
+        if [ -n "$CONTEXT_LIST" ]; then
+            mapfile -t CONTEXT_FLAGS <<< "$CONTEXT_LIST"
+        fi
+    fi
+
     # ---------------------------------------------------------
     # 1. Pre-flight Verification (Build + Smoke Test)
     # ---------------------------------------------------------
@@ -108,18 +149,24 @@ for VERSION in $VARIANTS; do
         --cache-to "type=registry,ref=$CACHE_IMAGE:$VERSION-amd64,mode=max" \
         --build-arg VERSION="$VERSION" \
         --build-arg SOURCE_DATE_EPOCH="$GIT_DATE" \
+        ${SECRET_FLAGS[@]+"${SECRET_FLAGS[@]}"} \
+        ${CONTEXT_FLAGS[@]+"${CONTEXT_FLAGS[@]}"} \
         --tag "$LOCAL_TAG" \
-        --file "images/$IMAGE_NAME/Dockerfile" \
-        "images/$IMAGE_NAME"
+        --file "$IMAGE_DIR/Dockerfile" \
+        "$IMAGE_DIR"
 
-    # 1.1 Smoke Test (convention-based: images/$IMAGE_NAME/test.sh)
-    TEST_SCRIPT="images/$IMAGE_NAME/test.sh"
+    # 1.1 Smoke Test (convention-based: $IMAGE_DIR/test.sh). Every check is
+    #     recorded for flaky check detection; failures of checks quarantined
+    #     in ci/quarantine.json are reported but do not fail the build.
+    TEST_SCRIPT="$IMAGE_DIR/test.sh"
     if [ -f "$TEST_SCRIPT" ]; then
         if [ "${SMOKE_TEST:-true}" = "false" ]; then
             echo "Skipping smoke test ($TEST_SCRIPT) due to SMOKE_TEST=false"
         else
             echo "Running smoke test ($TEST_SCRIPT)..."
-            if bash "$TEST_SCRIPT" "$LOCAL_TAG" "$VERSION"; then
+            if $FACTORY smoke -image "$IMAGE_NAME" -variant "$VERSION" \
+                -image-id "$(docker inspect --format='{{.Id}}' "$LOCAL_TAG")" \
+                -retries "${SMOKE_RETRIES:-1}" "$LOCAL_TAG"; then
                 echo "Smoke test passed!"
             else
                 echo "Smoke test failed!"
@@ -131,8 +178,31 @@ for VERSION in $VARIANTS; do
         echo "Warning: No smoke test found for $IMAGE_NAME (no test.sh)"
     fi
 
+    # 1.2 Malware and tampering scan of the executables of every layer
+    #     (offline rules of ci/malware-rules.json), before anything is pushed.
+    if [ "$SCAN_IMAGES" = "true" ]; then
+        IMAGE_ARCHIVE=$(mktemp --suffix=.tar)
+        docker save --output "$IMAGE_ARCHIVE" "$LOCAL_TAG"
+        if ! $FACTORY malware -archive "$IMAGE_ARCHIVE"; then
+            echo "Malware scan failed!"
+            rm -f "$IMAGE_ARCHIVE"
+            docker rmi "$LOCAL_TAG" || true
+            exit 1
+        fi
+        rm -f "$IMAGE_ARCHIVE"
+    fi
+
+    # 1.3 Vulnerability report kept for the factory scorecard
+    if [ "$SCAN_IMAGES" = "true" ] && command -v trivy &> /dev/null; then
+        SCAN_REPORT="$FACTORY_STATE_DIR/scans/$IMAGE_NAME/$VERSION.json"
+        mkdir -p "$(dirname "$SCAN_REPORT")"
+        trivy image --quiet --format json --output "$SCAN_REPORT" "$LOCAL_TAG" \
+            || echo "Warning: trivy report for $LOCAL_TAG failed"
+    fi
+
     # Save local image ID for idempotency check
     LOCAL_ID=$(docker inspect --format='{{.Id}}' "$LOCAL_TAG")
+    LOCAL_SIZE=$(docker inspect --format='{{.Size}}' "$LOCAL_TAG")
     
     PUSH_NECESSARY="true"
     if [ "$PUSH_IMAGES" = "true" ] && command -v crane &> /dev/null; then
@@ -158,18 +228,17 @@ for VERSION in $VARIANTS; do
     BUILD_CMD=(docker buildx build)
     BUILD_CMD+=(--build-arg VERSION="$VERSION")
     BUILD_CMD+=(--build-arg SOURCE_DATE_EPOCH="$GIT_DATE")
+    BUILD_CMD+=(${SECRET_FLAGS[@]+"${SECRET_FLAGS[@]}"})
+    BUILD_CMD+=(${CONTEXT_FLAGS[@]+"${CONTEXT_FLAGS[@]}"})
     
     BUILD_CMD+=(--label "org.opencontainers.image.created=$BUILD_DATE")
     BUILD_CMD+=(--label "org.opencontainers.image.revision=$GIT_REV")
     BUILD_CMD+=(--tag "$FULL_IMAGE:$VERSION")
-
-    # Only tag the highest version as "latest"
-    if [ "$VERSION" = "$LATEST_VERSION" ]; then
-        BUILD_CMD+=(--tag "$FULL_IMAGE:latest")
-    fi
-    BUILD_CMD+=(--file "images/$IMAGE_NAME/Dockerfile")
+    BUILD_CMD+=(--file "$IMAGE_DIR/Dockerfile")
 
     if [ "$PUSH_IMAGES" = "true" ] && [ "$PUSH_NECESSARY" = "true" ]; then
+        ATTESTED="false"
+        SIGNED="false"
         IS_SINGLE_ARCH="false"
         if [ "$PLATFORMS" = "linux/amd64" ]; then
             IS_SINGLE_ARCH="true"
@@ -179,10 +248,6 @@ for VERSION in $VARIANTS; do
             echo "Single-arch image: reusing local build, tagging and pushing directly"
             docker tag "$LOCAL_TAG" "$FULL_IMAGE:$VERSION"
             docker push "$FULL_IMAGE:$VERSION"
-            if [ "$VERSION" = "$LATEST_VERSION" ]; then
-                docker tag "$LOCAL_TAG" "$FULL_IMAGE:latest"
-                docker push "$FULL_IMAGE:latest"
-            fi
         else
             BUILD_CMD+=(--platform "$PLATFORMS")
             BUILD_CMD+=(--push)
@@ -192,7 +257,8 @@ for VERSION in $VARIANTS; do
             BUILD_CMD+=(--cache-from "type=registry,ref=$CACHE_IMAGE:$VERSION")
             BUILD_CMD+=(--cache-to "type=registry,ref=$CACHE_IMAGE:$VERSION,mode=max")
 
-            "${BUILD_CMD[@]}" "images/$IMAGE_NAME"
+            "${BUILD_CMD[@]}" "$IMAGE_DIR"
+            ATTESTED="true"
         fi
 
         echo "Pushed $FULL_IMAGE:$VERSION"
@@ -204,26 +270,48 @@ for VERSION in $VARIANTS; do
         fi
         echo "Image Digest: $DIGEST"
 
-        # Sign images with cosign
-        if [ -n "$DIGEST" ] && command -v cosign &> /dev/null; then
-            echo "Signing $FULL_IMAGE@$DIGEST with cosign..."
-            cosign sign --yes "$FULL_IMAGE@$DIGEST"
+        # Sign with the current key of ci/trusted-keys.json ($FACTORY_SIGNING_KEY),
+        # in the formats of the image's signature label: cosign by default,
+        # Notation signatures (OCI referrers) with signature=...+notation.
+        if [ -n "$DIGEST" ] && $FACTORY keys current > /dev/null 2>&1; then
+            echo "Signing $FULL_IMAGE@$DIGEST..."
+            $FACTORY sign -image "$IMAGE_NAME" "$FULL_IMAGE@$DIGEST"
+            SIGNED="true"
+        else
+            echo "Warning: no active signing key, $FULL_IMAGE@$DIGEST is not signed"
+        fi
+
+        # An image moving to a new repository is also published to the old
+        # one until the end of its transition window ("migrations" in
+        # ci/factory.json), annotated with the new location.
+        if [ -n "$PREVIOUS_IMAGE" ] && [ -n "$DIGEST" ]; then
+            PREVIOUS_REF=$($FACTORY migrate publish "$IMAGE_NAME" "$VERSION" "$DIGEST")
+            if [ -n "$PREVIOUS_REF" ] && [ "$SIGNED" = "true" ]; then
+                $FACTORY sign -image "$IMAGE_NAME" "$PREVIOUS_REF"
+            fi
         fi
 
+        record_build success -digest "$DIGEST" -revision "$GIT_REV" -size "$LOCAL_SIZE" -pushed \
+            -signed="$SIGNED" -sbom="$ATTESTED" -provenance="$ATTESTED"
+
         # Pass outputs to GitHub Actions
         if [ -n "${GITHUB_OUTPUT:-}" ]; then
             echo "digest=$DIGEST" >> "$GITHUB_OUTPUT"
             echo "image_full=$FULL_IMAGE:$VERSION" >> "$GITHUB_OUTPUT"
+            echo "image_dir=$IMAGE_DIR" >> "$GITHUB_OUTPUT"
             echo "scan_image=$LOCAL_TAG" >> "$GITHUB_OUTPUT"
             echo "pushed=true" >> "$GITHUB_OUTPUT"
         fi
     elif [ "$PUSH_IMAGES" = "true" ] && [ "$PUSH_NECESSARY" = "false" ]; then
         # Image already in registry and matches
+        record_build success -digest "$(crane digest "$FULL_IMAGE:$VERSION" 2>/dev/null || true)" \
+            -revision "$GIT_REV" -size "$LOCAL_SIZE"
         if [ -n "${GITHUB_OUTPUT:-}" ]; then
             # We still need the digest for subsequent steps (like signing or notifications)
             DIGEST=$(crane digest "$FULL_IMAGE:$VERSION" 2>/dev/null || true)
             echo "digest=$DIGEST" >> "$GITHUB_OUTPUT"
             echo "image_full=$FULL_IMAGE:$VERSION" >> "$GITHUB_OUTPUT"
+            echo "image_dir=$IMAGE_DIR" >> "$GITHUB_OUTPUT"
             echo "scan_image=$LOCAL_TAG" >> "$GITHUB_OUTPUT"
             echo "pushed=false" >> "$GITHUB_OUTPUT"
         fi
@@ -232,9 +320,21 @@ for VERSION in $VARIANTS; do
         echo "Build Successful. Pushing disabled: $FULL_IMAGE:$VERSION"
         if [ -n "${GITHUB_OUTPUT:-}" ]; then
             echo "image_full=$FULL_IMAGE:$VERSION" >> "$GITHUB_OUTPUT"
+            echo "image_dir=$IMAGE_DIR" >> "$GITHUB_OUTPUT"
             echo "scan_image=$LOCAL_TAG" >> "$GITHUB_OUTPUT"
             echo "pushed=false" >> "$GITHUB_OUTPUT"
         fi
     fi
 
+    CURRENT_VERSION=""
 done
+
+# Floating tags (latest, major, major.minor) are never pushed by the build:
+# they move once the new digest has soaked under its exact tag (see
+# "promotion" in ci/factory.json). Images with a soak=0s label, such as
+# tls-bundle, which the next build level uses as :latest, move right away,
+# and fail the build when blocked so its dependents are not built on the
+# previous digest.
+if [ "$PUSH_IMAGES" = "true" ]; then
+    $FACTORY promote -advance -select "$IMAGE_NAME"
+fi
@@ -0,0 +1,78 @@
+package main
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"flag"
+	"fmt"
+	"os"
+	"time"
+
+	"github.com/gillouche/container-factory/internal/backstage"
+	"github.com/gillouche/container-factory/internal/eol"
+	"github.com/gillouche/container-factory/internal/github"
+)
+
+// runBackstage prints the Backstage entities of the images, writes them to
+// a file, or commits them to the branch Backstage reads them from.
+func runBackstage(args []string) error {
+	fs := flag.NewFlagSet("backstage", flag.ExitOnError)
+	out := fs.String("o", "", "write the entities to this file instead of stdout")
+	publish := fs.Bool("publish", false, "commit the entities to the configured branch of -repo")
+	repo := fs.String("repo", os.Getenv("GITHUB_REPOSITORY"), "repository (owner/name) to publish to")
+	api := fs.String("github-api", "https://api.github.com", "GitHub API root")
+	eolFile := fs.String("eol", "ci/eol.json", "end-of-life table")
+	fs.Parse(args)
+
+	cfg, cat, err := loadCatalog()
+	if err != nil {
+		return err
+	}
+	owners, err := backstage.LoadCodeowners(".")
+	if err != nil {
+		return err
+	}
+	eols, err := eol.Load(*eolFile)
+	if err != nil {
+		return err
+	}
+	entities, err := backstage.Entities(backstage.Input{
+		Config: cfg, Catalog: cat, Codeowners: owners, EOL: eols, Now: time.Now().UTC(),
+	})
+	if err != nil {
+		return err
+	}
+	var buf bytes.Buffer
+	if err := backstage.Encode(&buf, entities); err != nil {
+		return err
+	}
+
+	switch {
+	case *publish:
+		if *repo == "" {
+			return errors.New("no repository: set -repo or $GITHUB_REPOSITORY")
+		}
+		if cfg.Backstage.Branch == "" {
+			return errors.New("no backstage branch configured")
+		}
+		gh, err := githubClient(*api, github.Contents(*repo))
+		if err != nil {
+			return err
+		}
+		commit, err := backstage.Publish(context.Background(), gh, *repo, cfg.Backstage.Branch, buf.Bytes())
+		if err != nil {
+			return err
+		}
+		if commit == "" {
+			fmt.Fprintf(os.Stderr, "%d entities, %s:%s is up to date\n", len(entities), cfg.Backstage.Branch, backstage.File)
+			return nil
+		}
+		fmt.Fprintf(os.Stderr, "%d entities published to %s:%s (%.7s)\n", len(entities), cfg.Backstage.Branch, backstage.File, commit)
+		return nil
+	case *out != "":
+		return os.WriteFile(*out, buf.Bytes(), 0o644)
+	}
+	_, err = os.Stdout.Write(buf.Bytes())
+	return err
+}
@@ -0,0 +1,97 @@
+package main
+
+import (
+	"context"
+	"flag"
+	"fmt"
+	"os"
+	"slices"
+
+	"github.com/gillouche/container-factory/internal/compare"
+	"github.com/gillouche/container-factory/internal/registry"
+	"github.com/gillouche/container-factory/internal/rescan"
+)
+
+// runCompare compares every published variant with a donor stage to the
+// upstream image it is built from, and fails when a variant is not smaller
+// and leaner than its donor on every count.
+func runCompare(args []string) error {
+	fs := flag.NewFlagSet("compare", flag.ExitOnError)
+	format := fs.String("format", "markdown", "output format: markdown or json")
+	sel := fs.String("select", "", "image selector (default: all images)")
+	plat := fs.String("platform", "linux/amd64", "platform of the images to compare")
+	skipScan := fs.Bool("skip-scan", false, "do not count packages and vulnerabilities with trivy")
+	skipUpdate := fs.Bool("skip-db-update", false, "scan with the vulnerability database as it is")
+	fs.Parse(args)
+
+	if *format != "markdown" && *format != "json" {
+		return fmt.Errorf("invalid -format %q", *format)
+	}
+	platform, err := registry.ParsePlatform(*plat)
+	if err != nil {
+		return err
+	}
+	_, cat, err := loadCatalog()
+	if err != nil {
+		return err
+	}
+	images, err := selectImages(cat, *sel)
+	if err != nil {
+		return err
+	}
+
+	ctx := context.Background()
+	in := &compare.Inspector{Registry: registry.New(), Platform: platform}
+	if !*skipScan {
+		sc := rescan.Trivy{Platform: platform.String(), ListPackages: true}
+		if !*skipUpdate {
+			if err := sc.UpdateDB(ctx); err != nil {
+				return err
+			}
+		}
+		in.Scanner = sc
+	}
+
+	var comparisons []compare.Comparison
+	regressed := 0
+	for _, img := range images {
+		if !slices.Contains(img.Platforms, platform.String()) {
+			continue
+		}
+		for _, v := range img.Variants {
+			donorRef := compare.Donor(img, v)
+			if donorRef == "" {
+				continue
+			}
+			fmt.Fprintf(os.Stderr, "Comparing %s:%s with %s ...\n", img.Name, v, donorRef)
+			factory, err := in.Inspect(ctx, img.Repository+":"+v)
+			if err != nil {
+				fmt.Fprintf(os.Stderr, "  [warn] %s:%s: %v\n", img.Name, v, err)
+				continue
+			}
+			donor, err := in.Inspect(ctx, donorRef)
+			if err != nil {
+				fmt.Fprintf(os.Stderr, "  [warn] %s: %v\n", donorRef, err)
+				continue
+			}
+			c := compare.Compare(img.Name, v, platform, factory, donor)
+			if len(c.Regressions) > 0 {
+				regressed++
+			}
+			comparisons = append(comparisons, c)
+		}
+	}
+
+	if *format == "json" {
+		err = compare.JSON(os.Stdout, comparisons)
+	} else {
+		err = compare.Markdown(os.Stdout, comparisons)
+	}
+	if err != nil {
+		return err
+	}
+	if regressed > 0 {
+		return fmt.Errorf("%d variants regressed against their donor", regressed)
+	}
+	return nil
+}
@@ -0,0 +1,145 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"flag"
+	"fmt"
+	"os"
+	"path/filepath"
+	"time"
+
+	"github.com/gillouche/container-factory/internal/digest"
+	"github.com/gillouche/container-factory/internal/eol"
+	"github.com/gillouche/container-factory/internal/ledger"
+	"github.com/gillouche/container-factory/internal/notify"
+	"github.com/gillouche/container-factory/internal/smoke"
+	"github.com/gillouche/container-factory/internal/vuln"
+)
+
+func runDigest(args []string) error {
+	fs := flag.NewFlagSet("digest", flag.ExitOnError)
+	since := fs.Duration("since", 24*time.Hour, "period to summarise")
+	format := fs.String("format", "markdown", "output format: markdown or json")
+	send := fs.Bool("send", false, "deliver the digest to the configured notification sink")
+	updatesFile := fs.String("updates", filepath.Join(stateDir(), "updates.json"), "pending updates report written by the check-pinned-deps workflow")
+	eolFile := fs.String("eol", "ci/eol.json", "end-of-life table")
+	quarantineFile := fs.String("quarantine", smoke.DefaultQuarantine, "smoke check quarantine list")
+	horizon := fs.Int("horizon-days", 90, "report end of life and certificate expiry due within this many days")
+	sel := fs.String("select", "", "image selector (default: all images)")
+	fs.Parse(args)
+
+	if *format != "markdown" && *format != "json" {
+		return fmt.Errorf("invalid -format %q", *format)
+	}
+
+	cfg, cat, err := loadCatalog()
+	if err != nil {
+		return err
+	}
+	images, err := selectImages(cat, *sel)
+	if err != nil {
+		return err
+	}
+	l, err := ledger.Load(ledgerPath())
+	if err != nil {
+		return err
+	}
+	eols, err := eol.Load(*eolFile)
+	if err != nil {
+		return err
+	}
+
+	now := time.Now().UTC()
+	within := time.Duration(*horizon) * 24 * time.Hour
+	r := &digest.Report{Since: now.Add(-*since), Until: now}
+
+	selected := map[string]bool{}
+	var dirs []string
+	current := map[string][]vuln.Finding{}
+	for _, img := range images {
+		selected[img.Name] = true
+		dirs = append(dirs, img.Dir)
+		for _, v := range img.Variants {
+			if date, ok := eols.Lookup(img.Name, v); ok {
+				r.AddEOL(img.Name+":"+v, date, within)
+			}
+			scan, err := vuln.Load(vuln.Path(scansDir(), img.Name, v))
+			if os.IsNotExist(err) {
+				continue
+			}
+			if err != nil {
+				return err
+			}
+			current[img.Name+":"+v] = scan.Findings
+		}
+	}
+
+	var records []ledger.Record
+	for _, rec := range l.Records {
+		if selected[rec.Image] {
+			records = append(records, rec)
+		}
+	}
+	r.Activity(&ledger.Ledger{Records: records})
+
+	snapshotPath := filepath.Join(stateDir(), "digest-snapshot.json")
+	prev, err := digest.LoadSnapshot(snapshotPath)
+	if err != nil {
+		return err
+	}
+	r.Vulnerabilities(prev, current)
+
+	if r.Updates, err = digest.LoadUpdates(*updatesFile); err != nil {
+		return err
+	}
+	if err := r.Certificates(dirs, within); err != nil {
+		return err
+	}
+
+	h, err := smoke.Load(smokePath())
+	if err != nil {
+		return err
+	}
+	q, err := smoke.LoadQuarantine(*quarantineFile)
+	if err != nil {
+		return err
+	}
+	var checks []smoke.Record
+	for _, rec := range h.Records {
+		if selected[rec.Image] {
+			checks = append(checks, rec)
+		}
+	}
+	var entries []smoke.Entry
+	for _, e := range q.Checks {
+		if selected[e.Image] {
+			entries = append(entries, e)
+		}
+	}
+	r.Smoke(checks, &smoke.Quarantine{Checks: entries}, smoke.DefaultAnalysis)
+	r.Sort()
+
+	if *format == "json" {
+		enc := json.NewEncoder(os.Stdout)
+		enc.SetIndent("", "  ")
+		err = enc.Encode(r)
+	} else {
+		err = r.Markdown(os.Stdout)
+	}
+	if err != nil || !*send {
+		return err
+	}
+
+	sink, err := notify.New(cfg.Notify)
+	if err != nil {
+		return err
+	}
+	if err := sink.Send(context.Background(), r.Message()); err != nil {
+		return err
+	}
+	// Only a delivered digest moves the baseline, so a dry run does not
+	// swallow the next day's new and fixed CVEs; the images left out of
+	// -select keep their baseline.
+	return (&digest.Snapshot{Time: now, Findings: prev.Merge(selected, current)}).Save(snapshotPath)
+}
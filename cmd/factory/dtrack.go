@@ -0,0 +1,135 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"flag"
+	"fmt"
+	"os"
+	"sort"
+	"strings"
+
+	"github.com/gillouche/container-factory/internal/dtrack"
+	"github.com/gillouche/container-factory/internal/registry"
+	"github.com/gillouche/container-factory/internal/sbom"
+)
+
+// runDtrack uploads the CycloneDX SBOM of every published variant to its
+// Dependency-Track project, creating the project on first sight, and
+// retires the projects of variants removed from the catalog.
+func runDtrack(args []string) error {
+	fs := flag.NewFlagSet("dtrack", flag.ExitOnError)
+	sel := fs.String("select", "", "image selector (default: all images, and retire projects of removed images)")
+	server := fs.String("url", "", "Dependency-Track API server (default: dependency_track.url of the configuration)")
+	plat := fs.String("platform", "linux/amd64", "platform whose SBOM is uploaded")
+	dryRun := fs.Bool("dry-run", false, "print what would change without changing it")
+	fs.Parse(args)
+
+	cfg, cat, err := loadCatalog()
+	if err != nil {
+		return err
+	}
+	dt := cfg.DependencyTrack
+	if *server != "" {
+		dt.URL = *server
+	}
+	if dt.URL == "" {
+		return errors.New("no Dependency-Track server: set dependency_track.url or -url")
+	}
+	key := os.Getenv(dt.APIKeyEnv)
+	if key == "" {
+		return fmt.Errorf("%s is not set", dt.APIKeyEnv)
+	}
+	platform, err := registry.ParsePlatform(*plat)
+	if err != nil {
+		return err
+	}
+	sboms, err := enrichedSBOMs(cfg, cat, platform, sbom.DefaultArtifacts, true)
+	if err != nil {
+		return err
+	}
+	images, err := selectImages(cat, *sel)
+	if err != nil {
+		return err
+	}
+
+	ctx := context.Background()
+	client := registry.New()
+	var variants []dtrack.Variant
+	var names []string
+	for _, img := range images {
+		names = append(names, img.Name)
+		for _, v := range img.Variants {
+			variants = append(variants, dtrack.Variant{
+				Image:      img.Name,
+				Variant:    v,
+				Repository: img.Repository,
+				Digest:     resolve(ctx, client, img.Repository+":"+v),
+			})
+		}
+	}
+	if *sel == "" {
+		names = nil
+	}
+
+	state, err := dtrack.LoadState(dtrackStatePath())
+	if err != nil {
+		return err
+	}
+	s := &dtrack.Syncer{
+		Client: &dtrack.Client{URL: dt.URL, APIKey: key},
+		SBOMs:  sboms,
+		Tag:    dt.Tag,
+		State:  state,
+		DryRun: *dryRun,
+	}
+	res, err := s.Sync(ctx, variants, names)
+	if serr := sboms.Checksums.Save(); serr != nil && err == nil {
+		err = serr
+	}
+	if res != nil {
+		dtrackReport(res, *dryRun)
+	}
+	if err != nil {
+		return err
+	}
+	if !*dryRun {
+		if err := state.Save(dtrackStatePath()); err != nil {
+			return err
+		}
+	}
+	if len(res.Failed) > 0 {
+		return fmt.Errorf("%d projects failed to sync", len(res.Failed))
+	}
+	return nil
+}
+
+func dtrackReport(res *dtrack.Result, dryRun bool) {
+	verb := ""
+	if dryRun {
+		verb = "would be "
+	}
+	fmt.Printf("%d SBOMs %suploaded, %d unchanged, %d projects %sretired\n",
+		len(res.Uploaded), verb, len(res.Unchanged), len(res.Retired), verb)
+	for _, l := range []struct {
+		name string
+		keys []string
+	}{
+		{"created", res.Created},
+		{"reactivated", res.Reactivated},
+		{"uploaded", res.Uploaded},
+		{"retired", res.Retired},
+	} {
+		if len(l.keys) > 0 {
+			fmt.Printf("  %s%s: %s\n", verb, l.name, strings.Join(l.keys, ", "))
+		}
+	}
+	keys := make([]string, 0, len(res.Failed))
+	for k := range res.Failed {
+		keys = append(keys, k)
+	}
+	sort.Strings(keys)
+	for _, k := range keys {
+		fmt.Fprintf(os.Stderr, "  [warn] %s: %v\n", k, res.Failed[k])
+	}
+}
@@ -0,0 +1,98 @@
+package main
+
+import (
+	"errors"
+	"flag"
+	"fmt"
+	"strings"
+	"time"
+
+	"github.com/gillouche/container-factory/internal/selector"
+)
+
+func runList(args []string) error {
+	fs := flag.NewFlagSet("list", flag.ExitOnError)
+	fs.Parse(args)
+
+	_, cat, err := loadCatalog()
+	if err != nil {
+		return err
+	}
+	for _, img := range cat.Images {
+		fmt.Println(img.Name)
+	}
+	return nil
+}
+
+// runSelect prints the images matching a selector in build order, one per
+// line, for the Makefile and workflows.
+func runSelect(args []string) error {
+	fs := flag.NewFlagSet("select", flag.ExitOnError)
+	variants := fs.Bool("variants", false, "print image:variant pairs instead of image names")
+	fs.Parse(args)
+	if fs.NArg() == 0 {
+		return errors.New("usage: factory select [-variants] SELECTOR...")
+	}
+
+	_, cat, err := loadCatalog()
+	if err != nil {
+		return err
+	}
+	images, err := selector.Select(cat, strings.Join(fs.Args(), " "))
+	if err != nil {
+		return err
+	}
+	for _, img := range images {
+		if !*variants {
+			fmt.Println(img.Name)
+			continue
+		}
+		for _, v := range img.Variants {
+			fmt.Printf("%s:%s\n", img.Name, v)
+		}
+	}
+	return nil
+}
+
+// runLocate prints shell assignments describing an image, for ci/build.sh:
+//
+//	eval "$(factory locate tls-bundle)"
+func runLocate(args []string) error {
+	fs := flag.NewFlagSet("locate", flag.ExitOnError)
+	fs.Parse(args)
+	if fs.NArg() != 1 {
+		return errors.New("usage: factory locate IMAGE")
+	}
+
+	cfg, cat, err := loadCatalog()
+	if err != nil {
+		return err
+	}
+	img, ok := cat.Lookup(fs.Arg(0))
+	if !ok {
+		return fmt.Errorf("image %s not found", fs.Arg(0))
+	}
+
+	// The old repository of a migrating image, while builds still publish
+	// there.
+	previous := ""
+	if img.DualPublish(time.Now()) {
+		previous = img.Previous
+	}
+	for _, kv := range [][2]string{
+		{"REGISTRY", cfg.Registry},
+		{"IMAGE_DIR", img.Dir},
+		{"FULL_IMAGE", img.Repository},
+		{"CACHE_IMAGE", img.Cache},
+		{"PREVIOUS_IMAGE", previous},
+		{"PLATFORMS", strings.Join(img.Platforms, ",")},
+		{"VARIANTS", strings.Join(img.Variants, "\n")},
+	} {
+		fmt.Printf("%s=%s\n", kv[0], shellQuote(kv[1]))
+	}
+	return nil
+}
+
+func shellQuote(s string) string {
+	return "'" + strings.ReplaceAll(s, "'", `'\''`) + "'"
+}
@@ -0,0 +1,153 @@
+package main
+
+import (
+	"errors"
+	"flag"
+	"fmt"
+	"os"
+	"path/filepath"
+	"time"
+
+	"github.com/gillouche/container-factory/internal/config"
+	"github.com/gillouche/container-factory/internal/signing"
+)
+
+const keysUsage = "usage: factory keys generate|rotate|certify|truststore|revoke|list|current [flags]"
+
+func runKeys(args []string) error {
+	if len(args) == 0 {
+		return errors.New(keysUsage)
+	}
+	cfg, err := config.Load("")
+	if err != nil {
+		return err
+	}
+	trusted, err := signing.LoadTrusted(cfg.TrustedKeys)
+	if err != nil {
+		return err
+	}
+	now := time.Now().UTC().Truncate(time.Second)
+
+	switch args[0] {
+	case "generate", "rotate":
+		fs := flag.NewFlagSet("keys "+args[0], flag.ExitOnError)
+		days := fs.Int("days", 365, "validity of the new key in days")
+		overlap := fs.Int("overlap-days", 30, "rotate: days the previous keys keep signing and verifying")
+		fs.Parse(args[1:])
+
+		key, err := signing.Generate()
+		if err != nil {
+			return err
+		}
+		k, err := trusted.Add(&key.PublicKey, now, time.Duration(*days)*24*time.Hour)
+		if err != nil {
+			return err
+		}
+		if args[0] == "rotate" {
+			trusted.Retire(now, time.Duration(*overlap)*24*time.Hour, k.ID)
+		}
+		if _, err := trusted.Certify(key); err != nil {
+			return err
+		}
+		path, err := signing.WritePrivate(keysDir(), key)
+		if err != nil {
+			return err
+		}
+		if err := trusted.Save(cfg.TrustedKeys); err != nil {
+			return err
+		}
+		fmt.Fprintf(os.Stderr, "Generated key %s, valid until %s\n", k.ID, k.NotAfter.Format(time.DateOnly))
+		fmt.Fprintf(os.Stderr, "Private key: %s (store it as the %s secret, then delete it)\n", path, signing.KeyEnv)
+		fmt.Fprintf(os.Stderr, "Commit %s to trust it.\n", cfg.TrustedKeys)
+		return nil
+
+	case "certify":
+		// Keys made before Notation support have no certificate yet.
+		private, err := signing.LoadPrivate(keysDir())
+		if err != nil {
+			return err
+		}
+		n := 0
+		for _, key := range private {
+			k, ok := trusted.Lookup(signing.KeyID(&key.PublicKey))
+			if !ok || k.Certificate != "" || k.Status(now) != signing.StateActive {
+				continue
+			}
+			if _, err := trusted.Certify(key); err != nil {
+				return err
+			}
+			fmt.Fprintf(os.Stderr, "Issued the certificate of key %s\n", k.ID)
+			n++
+		}
+		if n == 0 {
+			return errors.New("no active key without a certificate among the private keys available")
+		}
+		return trusted.Save(cfg.TrustedKeys)
+
+	case "truststore":
+		// The notation CLI reads its trust stores from directories.
+		fs := flag.NewFlagSet("keys truststore", flag.ExitOnError)
+		dir := fs.String("dir", filepath.Join(filepath.Dir(cfg.TrustPolicy), "truststore"), "notation trust store root")
+		fs.Parse(args[1:])
+		store := filepath.Join(*dir, "x509", "ca", signing.FactoryStore)
+		if err := os.MkdirAll(store, 0o755); err != nil {
+			return err
+		}
+		for _, k := range trusted.Keys {
+			path := filepath.Join(store, k.ID+".crt")
+			if k.Revoked != nil {
+				os.Remove(path)
+				continue
+			}
+			if k.Certificate == "" {
+				continue
+			}
+			if err := os.WriteFile(path, []byte(k.Certificate), 0o644); err != nil {
+				return err
+			}
+			fmt.Println(path)
+		}
+		return nil
+
+	case "revoke":
+		fs := flag.NewFlagSet("keys revoke", flag.ExitOnError)
+		reason := fs.String("reason", "", "why the key is revoked (e.g. compromised)")
+		fs.Parse(args[1:])
+		if fs.NArg() != 1 || *reason == "" {
+			return errors.New("usage: factory keys revoke -reason TEXT KEY_ID")
+		}
+		if err := trusted.Revoke(fs.Arg(0), *reason, now); err != nil {
+			return err
+		}
+		if err := trusted.Save(cfg.TrustedKeys); err != nil {
+			return err
+		}
+		return resignHead(fs.Arg(0))
+
+	case "list":
+		for _, k := range trusted.Keys {
+			line := fmt.Sprintf("%s  %-8s %s to %s", k.ID, k.Status(now), k.NotBefore.Format(time.DateOnly), k.NotAfter.Format(time.DateOnly))
+			if k.Certificate == "" {
+				line += "  (no certificate)"
+			}
+			if k.Revoked != nil {
+				line += fmt.Sprintf("  revoked %s: %s", k.Revoked.Format(time.DateOnly), k.Reason)
+			}
+			fmt.Println(line)
+		}
+		return nil
+
+	case "current":
+		private, err := signing.LoadPrivate(keysDir())
+		if err != nil {
+			return err
+		}
+		_, k, err := trusted.Current(now, private)
+		if err != nil {
+			return err
+		}
+		fmt.Println(k.ID)
+		return nil
+	}
+	return errors.New(keysUsage)
+}
@@ -0,0 +1,93 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"flag"
+	"fmt"
+	"os"
+	"time"
+
+	"github.com/gillouche/container-factory/internal/ledger"
+	"github.com/gillouche/container-factory/internal/registry"
+)
+
+func runLedger(args []string) error {
+	if len(args) == 0 || args[0] != "record" {
+		return errors.New("usage: factory ledger record -image NAME -variant VERSION [flags]")
+	}
+	fs := flag.NewFlagSet("ledger record", flag.ExitOnError)
+	image := fs.String("image", "", "image name")
+	variant := fs.String("variant", "", "image variant (VARIANTS entry)")
+	status := fs.String("status", ledger.StatusSuccess, "build status: success or failure")
+	digest := fs.String("digest", "", "published manifest digest")
+	revision := fs.String("revision", "", "git revision the image was built from")
+	size := fs.Int64("size", 0, "image size in bytes")
+	pushed := fs.Bool("pushed", false, "the image was pushed to the registry")
+	signed := fs.Bool("signed", false, "the image was signed")
+	sbom := fs.Bool("sbom", false, "an SBOM attestation was attached")
+	provenance := fs.Bool("provenance", false, "a provenance attestation was attached")
+	duration := fs.Duration("duration", 0, "how long the build took")
+	offline := fs.Bool("offline", false, "do not resolve base image digests")
+	fs.Parse(args[1:])
+
+	if *image == "" || *variant == "" {
+		return errors.New("-image and -variant are required")
+	}
+	if *status != ledger.StatusSuccess && *status != ledger.StatusFailure {
+		return fmt.Errorf("invalid -status %q", *status)
+	}
+
+	rec := ledger.Record{
+		Image:      *image,
+		Variant:    *variant,
+		Status:     *status,
+		Time:       time.Now().UTC(),
+		Revision:   *revision,
+		Digest:     *digest,
+		Pushed:     *pushed,
+		Size:       *size,
+		Signed:     *signed,
+		SBOM:       *sbom,
+		Provenance: *provenance,
+		Duration:   duration.Seconds(),
+	}
+
+	if !*offline && rec.Status == ledger.StatusSuccess {
+		_, cat, err := loadCatalog()
+		if err != nil {
+			return err
+		}
+		img, ok := cat.Lookup(*image)
+		if !ok {
+			return fmt.Errorf("image %s not found", *image)
+		}
+		refs := img.BaseRefs(*variant)
+		current := resolveBases(context.Background(), registry.New(), refs)
+		for _, ref := range refs {
+			if d, ok := current[ref]; ok {
+				rec.Bases = append(rec.Bases, ledger.Base{Ref: ref, Digest: d})
+			}
+		}
+	}
+
+	return ledger.Append(ledgerPath(), rec)
+}
+
+// resolveBases resolves each reference to its current digest. References
+// that cannot be resolved are reported on stderr and left out.
+func resolveBases(ctx context.Context, c *registry.Client, refs []string) map[string]string {
+	out := map[string]string{}
+	for _, s := range refs {
+		ref, err := registry.ParseRef(s)
+		if err == nil {
+			var d string
+			if d, err = c.Digest(ctx, ref); err == nil {
+				out[s] = d
+				continue
+			}
+		}
+		fmt.Fprintf(os.Stderr, "  [warn] cannot resolve %s: %v\n", s, err)
+	}
+	return out
+}
@@ -0,0 +1,62 @@
+package main
+
+import (
+	"encoding/json"
+	"flag"
+	"fmt"
+	"os"
+
+	"github.com/gillouche/container-factory/internal/lint"
+)
+
+func runLint(args []string) error {
+	fs := flag.NewFlagSet("lint", flag.ExitOnError)
+	format := fs.String("format", "text", "output format: text or json")
+	sel := fs.String("select", "", "image selector (default: all images)")
+	rules := fs.Bool("rules", false, "list the rules and exit")
+	fs.Parse(args)
+
+	if *rules {
+		for _, r := range lint.Rules {
+			fmt.Printf("%-16s %s\n", r.Name, r.Summary)
+		}
+		return nil
+	}
+	if *format != "text" && *format != "json" {
+		return fmt.Errorf("invalid -format %q", *format)
+	}
+
+	_, cat, err := loadCatalog()
+	if err != nil {
+		return err
+	}
+	images, err := selectImages(cat, *sel)
+	if err != nil {
+		return err
+	}
+
+	findings := []lint.Finding{}
+	for _, img := range images {
+		f, err := lint.Check(img)
+		if err != nil {
+			return err
+		}
+		findings = append(findings, f...)
+	}
+
+	if *format == "json" {
+		enc := json.NewEncoder(os.Stdout)
+		enc.SetIndent("", "  ")
+		if err := enc.Encode(findings); err != nil {
+			return err
+		}
+	} else {
+		for _, f := range findings {
+			fmt.Println(f)
+		}
+	}
+	if len(findings) > 0 {
+		return fmt.Errorf("%d finding(s)", len(findings))
+	}
+	return nil
+}
@@ -0,0 +1,178 @@
+// Command factory is the Go tooling of the container factory. It is run from
+// the repository root, like the scripts in ci/, and keeps its state (build
+// ledger, scan reports) under $FACTORY_STATE_DIR.
+//
+// Usage:
+//
+//	go run ./cmd/factory <command> [flags]
+package main
+
+import (
+	"fmt"
+	"os"
+	"path/filepath"
+	"strconv"
+	"sync"
+
+	"github.com/gillouche/container-factory/internal/catalog"
+	"github.com/gillouche/container-factory/internal/config"
+	"github.com/gillouche/container-factory/internal/github"
+	"github.com/gillouche/container-factory/internal/httpcache"
+	"github.com/gillouche/container-factory/internal/selector"
+)
+
+type command struct {
+	name    string
+	summary string
+	run     func(args []string) error
+}
+
+var commands = []command{
+	{"list", "List the images of every configured root", runList},
+	{"select", "Resolve an image selector (globs, labels, tls-bundle+)", runSelect},
+	{"locate", "Print the directory and repositories of an image", runLocate},
+	{"matrix", "Generate the GitHub Actions build matrix", runMatrix},
+	{"lint", "Check Dockerfiles for credentials in ARG/ENV and other mistakes", runLint},
+	{"pins", "Check the commit SHAs GitHub Actions are pinned to", runPins},
+	{"upstream", "Find upstream releases whose downloads are available for every platform", runUpstream},
+	{"propose", "Open or refresh the pull request applying a pins/upstream report", runPropose},
+	{"secrets", "Provision the BuildKit secret mounts of an image", runSecrets},
+	{"ledger", "Record build results in the build ledger", runLedger},
+	{"smoke", "Run the smoke test of an image, record each check and let quarantined failures through", runSmoke},
+	{"flaky", "Report flaky smoke checks and the state of the quarantine", runFlaky},
+	{"scorecard", "Score the health of every image variant", runScorecard},
+	{"backstage", "Export the images as Backstage catalog entities", runBackstage},
+	{"compare", "Compare image variants to the upstream donor images they are built from", runCompare},
+	{"digest", "Summarise the last day of factory activity", runDigest},
+	{"sbom", "Add the artifacts Dockerfiles install outside package managers to an image SBOM", runSBOM},
+	{"dtrack", "Upload the SBOMs of published digests to Dependency-Track", runDtrack},
+	{"malware", "Scan the executables of image layers with the offline malware rule set", runMalware},
+	{"rescan", "Rescan published digests against the current vulnerability database", runRescan},
+	{"keys", "Generate, rotate, revoke and list image signing keys", runKeys},
+	{"sign", "Sign a published image with the current signing key", runSign},
+	{"verify", "Verify the signatures of a published image", runVerify},
+	{"promote", "Advance floating tags (latest, major, major.minor) after the soak period", runPromote},
+	{"vendor", "Copy the base image digests of current and past builds to the hosted vendor namespace", runVendor},
+	{"migrate", "Dual-publish images moving to a new repository and report who still pulls the old one", runMigrate},
+	{"release", "Tag published variants in git and attach their SBOM and provenance to GitHub releases", runRelease},
+	{"tlog", "Inspect the transparency log of signatures and promotions", runTlog},
+}
+
+func main() {
+	if len(os.Args) < 2 {
+		usage()
+		os.Exit(2)
+	}
+	name := os.Args[1]
+	for _, c := range commands {
+		if c.name != name {
+			continue
+		}
+		if err := c.run(os.Args[2:]); err != nil {
+			fmt.Fprintf(os.Stderr, "factory %s: %v\n", name, err)
+			os.Exit(1)
+		}
+		return
+	}
+	if name != "help" && name != "-h" && name != "--help" {
+		fmt.Fprintf(os.Stderr, "factory: unknown command %q\n\n", name)
+	}
+	usage()
+	os.Exit(2)
+}
+
+func usage() {
+	fmt.Fprintln(os.Stderr, "Usage: factory <command> [flags]")
+	fmt.Fprintln(os.Stderr)
+	fmt.Fprintln(os.Stderr, "Commands:")
+	for _, c := range commands {
+		fmt.Fprintf(os.Stderr, "  %-12s %s\n", c.name, c.summary)
+	}
+}
+
+// loadCatalog reads the factory configuration and discovers its images.
+func loadCatalog() (*config.Config, *catalog.Catalog, error) {
+	cfg, err := config.Load("")
+	if err != nil {
+		return nil, nil, err
+	}
+	cat, err := catalog.Scan(cfg)
+	if err != nil {
+		return nil, nil, err
+	}
+	return cfg, cat, nil
+}
+
+// selectImages resolves a selector flag; an empty selector means every image.
+func selectImages(cat *catalog.Catalog, expr string) ([]catalog.Image, error) {
+	if expr == "" {
+		return cat.Images, nil
+	}
+	return selector.Select(cat, expr)
+}
+
+// stateDir is where the factory keeps the data it accumulates across runs.
+// CI should point FACTORY_STATE_DIR at persistent storage.
+func stateDir() string {
+	if d := os.Getenv("FACTORY_STATE_DIR"); d != "" {
+		return d
+	}
+	return ".factory"
+}
+
+func ledgerPath() string { return filepath.Join(stateDir(), "ledger.jsonl") }
+
+func scansDir() string { return filepath.Join(stateDir(), "scans") }
+
+func rescansDir() string { return filepath.Join(stateDir(), "rescans") }
+
+func keysDir() string { return filepath.Join(stateDir(), "keys") }
+
+func tlogDir() string { return filepath.Join(stateDir(), "tlog") }
+
+func dtrackStatePath() string { return filepath.Join(stateDir(), "dtrack.json") }
+
+// transport is the HTTP layer of the upstream datasources (GitHub API,
+// registries, downloads), caching responses under the state directory.
+var transport = sync.OnceValue(func() *httpcache.Transport {
+	t := httpcache.New(filepath.Join(stateDir(), "http-cache"))
+	t.Log = os.Stderr
+	return t
+})
+
+// registryTransport is transport for registry clients, which retry
+// themselves (registry.Retry): it caches and waits for exhausted rate
+// limits to reset, but sends each request once.
+var registryTransport = sync.OnceValue(func() *httpcache.Transport {
+	t := httpcache.New(filepath.Join(stateDir(), "http-cache"))
+	t.Retries = 0
+	t.Log = os.Stderr
+	return t
+})
+
+// githubClient returns a GitHub API client limited to scope. It
+// authenticates as the GitHub App $GITHUB_APP_ID (private key in
+// $GITHUB_APP_PRIVATE_KEY, installation $GITHUB_APP_INSTALLATION_ID or
+// looked up) when set, else with $GH_TOKEN or $GITHUB_TOKEN, else
+// anonymously.
+func githubClient(api string, scope github.Scope) (*github.Client, error) {
+	c := &github.Client{API: api, HTTP: transport().Client(), Scope: scope}
+	if id := os.Getenv("GITHUB_APP_ID"); id != "" {
+		key, err := github.ParseKey([]byte(os.Getenv("GITHUB_APP_PRIVATE_KEY")))
+		if err != nil {
+			return nil, fmt.Errorf("GITHUB_APP_PRIVATE_KEY: %w", err)
+		}
+		c.App = &github.App{ID: id, Key: key}
+		if inst := os.Getenv("GITHUB_APP_INSTALLATION_ID"); inst != "" {
+			if c.App.Installation, err = strconv.ParseInt(inst, 10, 64); err != nil {
+				return nil, fmt.Errorf("GITHUB_APP_INSTALLATION_ID: %w", err)
+			}
+		}
+		return c, nil
+	}
+	c.Token = os.Getenv("GH_TOKEN")
+	if c.Token == "" {
+		c.Token = os.Getenv("GITHUB_TOKEN")
+	}
+	return c, nil
+}
@@ -0,0 +1,122 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"flag"
+	"fmt"
+	"os"
+	"slices"
+
+	"github.com/gillouche/container-factory/internal/malware"
+	"github.com/gillouche/container-factory/internal/registry"
+)
+
+// runMalware scans the executables of image layers with the offline rule
+// set: images saved with `docker save` (-archive, the pre-flight build),
+// references given as arguments, or the published variants of -select.
+func runMalware(args []string) error {
+	fs := flag.NewFlagSet("malware", flag.ExitOnError)
+	rulesFile := fs.String("rules", malware.DefaultRules, "rule set")
+	format := fs.String("format", "markdown", "output format: markdown or json")
+	archive := fs.String("archive", "", "scan the image of this `docker save` archive")
+	sel := fs.String("select", "", "scan the published variants of the selected images")
+	plat := fs.String("platform", "linux/amd64", "platform of the images pulled from the registry")
+	failOn := fs.String("fail-on", "high", "fail when a finding is at least this severe")
+	fs.Usage = func() {
+		fmt.Fprintln(os.Stderr, "Usage: factory malware [flags] [REF...]")
+		fs.PrintDefaults()
+	}
+	fs.Parse(args)
+
+	if *format != "markdown" && *format != "json" {
+		return fmt.Errorf("invalid -format %q", *format)
+	}
+	if !slices.Contains(malware.Severities, *failOn) {
+		return fmt.Errorf("invalid -fail-on %q", *failOn)
+	}
+	platform, err := registry.ParsePlatform(*plat)
+	if err != nil {
+		return err
+	}
+	rules, err := malware.LoadRules(*rulesFile)
+	if err != nil {
+		return err
+	}
+
+	refs := fs.Args()
+	if *sel != "" {
+		_, cat, err := loadCatalog()
+		if err != nil {
+			return err
+		}
+		images, err := selectImages(cat, *sel)
+		if err != nil {
+			return err
+		}
+		for _, img := range images {
+			if !slices.Contains(img.Platforms, platform.String()) {
+				continue
+			}
+			for _, v := range img.Variants {
+				refs = append(refs, img.Repository+":"+v)
+			}
+		}
+	}
+	if *archive == "" && len(refs) == 0 {
+		return errors.New("nothing to scan: give -archive, -select or references")
+	}
+
+	ctx := context.Background()
+	sc := &malware.Scanner{Rules: rules}
+	var reports []*malware.Report
+	if *archive != "" {
+		image, layers, err := malware.ArchiveLayers(*archive)
+		if err != nil {
+			return err
+		}
+		fmt.Fprintf(os.Stderr, "Scanning %s (%d layers) ...\n", image, len(layers))
+		r, err := sc.Scan(ctx, image, layers)
+		if err != nil {
+			return err
+		}
+		reports = append(reports, r)
+	}
+	client := registry.New()
+	for _, s := range refs {
+		ref, err := registry.ParseRef(s)
+		if err != nil {
+			return err
+		}
+		layers, err := malware.RegistryLayers(ctx, client, ref, platform)
+		if err != nil {
+			if *sel != "" && registry.IsNotFound(err) {
+				continue
+			}
+			return err
+		}
+		fmt.Fprintf(os.Stderr, "Scanning %s (%d layers) ...\n", s, len(layers))
+		r, err := sc.Scan(ctx, s, layers)
+		if err != nil {
+			return err
+		}
+		reports = append(reports, r)
+	}
+
+	if *format == "json" {
+		err = malware.JSON(os.Stdout, reports)
+	} else {
+		err = malware.Markdown(os.Stdout, reports)
+	}
+	if err != nil {
+		return err
+	}
+	n := 0
+	for _, r := range reports {
+		n += r.Count(*failOn)
+	}
+	if n > 0 {
+		return fmt.Errorf("%d findings of severity %s or above", n, *failOn)
+	}
+	return nil
+}
@@ -0,0 +1,173 @@
+package main
+
+import (
+	"encoding/json"
+	"flag"
+	"fmt"
+	"os"
+	"sort"
+	"time"
+
+	"github.com/gillouche/container-factory/internal/catalog"
+	"github.com/gillouche/container-factory/internal/ledger"
+	"github.com/gillouche/container-factory/internal/shard"
+)
+
+// defaultRunner is the runner label of images without a runner label.
+const defaultRunner = "container-factory-runner"
+
+type matrixEntry struct {
+	Image   string `json:"image"`
+	Version string `json:"version"`
+}
+
+type shardEntry struct {
+	Shard  string `json:"shard"`
+	Level  int    `json:"level"`
+	Builds string `json:"builds"`
+	RunsOn string `json:"runs-on"`
+	// Estimate is informational, e.g. 12m30s.
+	Estimate string `json:"estimate"`
+}
+
+func runMatrix(args []string) error {
+	fs := flag.NewFlagSet("matrix", flag.ExitOnError)
+	level := fs.Int("level", 0, "build level to output (1 = no deps, 2+ = increasing dependency depth)")
+	maxLevel := fs.Bool("max-level", false, "print the maximum build level and exit")
+	image := fs.String("image", "", "output the matrix of a single image")
+	sel := fs.String("select", "", "only include images matching this selector")
+	graph := fs.Bool("graph", false, "output the full dependency graph")
+	shards := fs.Int("shards", 0, "pack the variants of each level into at most this many jobs, balanced by past build durations")
+	plan := fs.Bool("plan", false, "with -shards, print the shards and their estimated durations instead of the matrix")
+	window := fs.Int("window", 5, "with -shards, number of recent builds a variant's duration is estimated from")
+	fallback := fs.Duration("default-duration", 10*time.Minute, "with -shards, estimate of variants never built")
+	fs.Parse(args)
+
+	_, cat, err := loadCatalog()
+	if err != nil {
+		return err
+	}
+	deps := cat.Deps()
+	levels, err := catalog.Levels(deps)
+	if err != nil {
+		return err
+	}
+	images, err := selectImages(cat, *sel)
+	if err != nil {
+		return err
+	}
+
+	if *maxLevel {
+		max := 0
+		for _, l := range levels {
+			if l > max {
+				max = l
+			}
+		}
+		fmt.Println(max)
+		return nil
+	}
+
+	if *graph {
+		type node struct {
+			Deps     []string `json:"deps"`
+			Versions []string `json:"versions"`
+			Level    int      `json:"level"`
+		}
+		out := map[string]node{}
+		for _, img := range images {
+			out[img.Name] = node{Deps: deps[img.Name], Versions: nonNil(img.Variants), Level: levels[img.Name]}
+		}
+		enc := json.NewEncoder(os.Stdout)
+		enc.SetIndent("", "  ")
+		return enc.Encode(out)
+	}
+
+	if *shards > 0 {
+		l, err := ledger.Load(ledgerPath())
+		if err != nil {
+			return err
+		}
+		est := shard.FromLedger(l, *window, *fallback)
+		byLevel := map[int][]shard.Build{}
+		for _, img := range images {
+			if *level > 0 && levels[img.Name] != *level {
+				continue
+			}
+			runner := img.Labels["runner"]
+			if runner == "" {
+				runner = defaultRunner
+			}
+			for _, v := range img.Variants {
+				byLevel[levels[img.Name]] = append(byLevel[levels[img.Name]], shard.Build{
+					Image: img.Name, Version: v, Runner: runner, Estimate: est.Estimate(img.Name, v),
+				})
+			}
+		}
+		var packed []shard.Shard
+		for lvl := 1; lvl <= len(levels); lvl++ {
+			if bs := byLevel[lvl]; len(bs) > 0 {
+				packed = append(packed, shard.Pack(lvl, bs, *shards)...)
+			}
+		}
+		if *plan {
+			printPlan(packed)
+			return nil
+		}
+		include := []shardEntry{}
+		for _, s := range packed {
+			include = append(include, shardEntry{Shard: s.Name(), Level: s.Level, Builds: s.BuildList(),
+				RunsOn: s.Runner, Estimate: s.Estimate.Round(time.Second).String()})
+		}
+		return json.NewEncoder(os.Stdout).Encode(map[string]any{"include": include})
+	}
+
+	include := []matrixEntry{}
+	for _, img := range images {
+		if *image != "" && img.Name != *image {
+			continue
+		}
+		if *level > 0 && levels[img.Name] != *level {
+			continue
+		}
+		for _, v := range img.Variants {
+			include = append(include, matrixEntry{Image: img.Name, Version: v})
+		}
+	}
+	// A single image keeps the VARIANTS order, as ci/build.sh does.
+	if *image == "" {
+		sort.Slice(include, func(i, j int) bool {
+			if include[i].Image != include[j].Image {
+				return include[i].Image < include[j].Image
+			}
+			return include[i].Version < include[j].Version
+		})
+	}
+	return json.NewEncoder(os.Stdout).Encode(map[string]any{"include": include})
+}
+
+// printPlan prints the shards level by level with their estimates.
+func printPlan(shards []shard.Shard) {
+	lvl := 0
+	for _, s := range shards {
+		if s.Level != lvl {
+			lvl = s.Level
+			var longest time.Duration
+			for _, o := range shards {
+				if o.Level == lvl {
+					longest = max(longest, o.Estimate)
+				}
+			}
+			fmt.Printf("Level %d (%s)\n", lvl, longest.Round(time.Second))
+		}
+		fmt.Printf("  %-6s %-9s %-30s %s\n", s.Name(), s.Estimate.Round(time.Second), s.Runner, s.BuildList())
+	}
+	fmt.Printf("Estimated wall time: %s\n", shard.WallTime(shards).Round(time.Second))
+}
+
+func nonNil(s []string) []string {
+	if s == nil {
+		return []string{}
+	}
+	return s
+}
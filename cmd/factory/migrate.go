@@ -0,0 +1,153 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"flag"
+	"fmt"
+	"io"
+	"os"
+	"regexp"
+	"strings"
+	"time"
+
+	"github.com/gillouche/container-factory/internal/migrate"
+	"github.com/gillouche/container-factory/internal/registry"
+)
+
+const migrateUsage = "usage: factory migrate status|publish|consumers [flags]"
+
+// runMigrate handles images moving to a new repository (the "migrations" of
+// ci/factory.json): the transition status, the copy of each build to the old
+// repository and the report of who still pulls from there.
+func runMigrate(args []string) error {
+	if len(args) == 0 {
+		return errors.New(migrateUsage)
+	}
+	_, cat, err := loadCatalog()
+	if err != nil {
+		return err
+	}
+	now := time.Now().UTC()
+
+	switch args[0] {
+	case "status":
+		for _, img := range cat.Images {
+			if img.Previous == "" {
+				continue
+			}
+			state := "dual-publish"
+			if !img.DualPublish(now) {
+				state = "ended"
+			}
+			until := img.PreviousUntil.AddDate(0, 0, -1).Format(time.DateOnly)
+			fmt.Printf("%-28s %-12s until %s  %s -> %s\n", img.Name, state, until, img.Previous, img.Repository)
+		}
+		return nil
+
+	case "publish":
+		// Called by ci/build.sh after each push; prints the reference to
+		// sign, or nothing when the image is not dual-published.
+		fs := flag.NewFlagSet("migrate publish", flag.ExitOnError)
+		fs.Parse(args[1:])
+		if fs.NArg() != 3 {
+			return errors.New("usage: factory migrate publish IMAGE TAG DIGEST")
+		}
+		img, ok := cat.Lookup(fs.Arg(0))
+		if !ok {
+			return fmt.Errorf("image %s not found", fs.Arg(0))
+		}
+		if !img.DualPublish(now) {
+			return nil
+		}
+		dst, digest, err := migrate.Publish(context.Background(), registry.New(), img, fs.Arg(2), fs.Arg(1))
+		if err != nil {
+			return err
+		}
+		fmt.Fprintf(os.Stderr, "Published %s (%s)\n", dst, short(digest))
+		fmt.Printf("%s@%s\n", dst.Name(), digest)
+		return nil
+
+	case "consumers":
+		fs := flag.NewFlagSet("migrate consumers", flag.ExitOnError)
+		since := fs.Duration("since", 30*24*time.Hour, "only count requests this recent")
+		format := fs.String("format", "text", "output format: text or json")
+		ignore := fs.String("ignore", "", "skip clients whose user or user agent matches this regexp (e.g. the CI user)")
+		fs.Parse(args[1:])
+		if *format != "text" && *format != "json" {
+			return fmt.Errorf("invalid -format %q", *format)
+		}
+		var skip *regexp.Regexp
+		if *ignore != "" {
+			if skip, err = regexp.Compile(*ignore); err != nil {
+				return fmt.Errorf("-ignore: %w", err)
+			}
+		}
+
+		old := map[string]string{}
+		for _, img := range cat.Images {
+			if img.Previous == "" {
+				continue
+			}
+			ref, err := registry.ParseRef(img.Previous)
+			if err != nil {
+				return err
+			}
+			old[ref.Repository] = img.Name
+		}
+		if len(old) == 0 {
+			return errors.New("no migrations configured")
+		}
+
+		// The request logs of the registry: Nexus writes them to
+		// $NEXUS_DATA/log/request.log. No file means stdin.
+		var readers []io.Reader
+		for _, path := range fs.Args() {
+			f, err := os.Open(path)
+			if err != nil {
+				return err
+			}
+			defer f.Close()
+			readers = append(readers, f)
+		}
+		if len(readers) == 0 {
+			readers = append(readers, os.Stdin)
+		}
+		consumers, err := migrate.Consumers(io.MultiReader(readers...), old, now.Add(-*since))
+		if err != nil {
+			return err
+		}
+		kept := consumers[:0]
+		for _, c := range consumers {
+			if skip == nil || !(skip.MatchString(c.User) || skip.MatchString(c.UserAgent)) {
+				kept = append(kept, c)
+			}
+		}
+
+		if *format == "json" {
+			enc := json.NewEncoder(os.Stdout)
+			enc.SetIndent("", "  ")
+			return enc.Encode(kept)
+		}
+		if len(kept) == 0 {
+			fmt.Println("No pulls from the old repositories.")
+			return nil
+		}
+		for _, c := range kept {
+			tags := strings.Join(c.Tags, ",")
+			if tags == "" {
+				tags = "by digest"
+			}
+			user := c.User
+			if user == "" {
+				user = "anonymous"
+			}
+			fmt.Printf("%-28s %-15s %-12s %4d requests, last %s  tags: %s  (%s)\n",
+				c.Image, c.Client, user, c.Requests, c.LastSeen.UTC().Format(time.DateTime),
+				tags, orUnknown(c.UserAgent))
+		}
+		return nil
+	}
+	return errors.New(migrateUsage)
+}
@@ -0,0 +1,42 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"flag"
+	"fmt"
+	"os"
+
+	"github.com/gillouche/container-factory/internal/github"
+	"github.com/gillouche/container-factory/internal/pins"
+)
+
+// runPins checks the GitHub Actions pinned in the workflows and prints the
+// check-pinned-deps report: pinned actions whose tag moved, actions used by
+// branch or tag (to be pinned) and those that could not be checked.
+func runPins(args []string) error {
+	fs := flag.NewFlagSet("pins", flag.ExitOnError)
+	root := fs.String("root", ".", "repository root")
+	api := fs.String("github-api", "https://api.github.com", "GitHub API root")
+	fs.Parse(args)
+
+	fmt.Fprintf(os.Stderr, "Scanning %s ...\n", *root)
+	found, err := pins.Find(*root)
+	if err != nil {
+		return err
+	}
+	gh, err := githubClient(*api, github.ReadPublic)
+	if err != nil {
+		return err
+	}
+	report := pins.Check(context.Background(), gh, found, os.Stderr)
+
+	enc := json.NewEncoder(os.Stdout)
+	enc.SetIndent("", "  ")
+	if err := enc.Encode(report); err != nil {
+		return err
+	}
+	fmt.Fprintf(os.Stderr, "\nSummary: %d update(s), %d warning(s), %d up-to-date\n",
+		len(report.Updates), len(report.Warnings), len(report.UpToDate))
+	return nil
+}
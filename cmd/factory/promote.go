@@ -0,0 +1,182 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"flag"
+	"fmt"
+	"os"
+	"sort"
+	"strings"
+	"time"
+
+	"github.com/gillouche/container-factory/internal/ledger"
+	"github.com/gillouche/container-factory/internal/migrate"
+	"github.com/gillouche/container-factory/internal/promote"
+	"github.com/gillouche/container-factory/internal/registry"
+	"github.com/gillouche/container-factory/internal/tlog"
+	"github.com/gillouche/container-factory/internal/vuln"
+)
+
+func runPromote(args []string) error {
+	fs := flag.NewFlagSet("promote", flag.ExitOnError)
+	advance := fs.Bool("advance", false, "move eligible floating tags to their candidate digest")
+	format := fs.String("format", "text", "output format: text or json")
+	sel := fs.String("select", "", "image selector (default: all images)")
+	fs.Parse(args)
+
+	if *format != "text" && *format != "json" {
+		return fmt.Errorf("invalid -format %q", *format)
+	}
+
+	cfg, cat, err := loadCatalog()
+	if err != nil {
+		return err
+	}
+	images, err := selectImages(cat, *sel)
+	if err != nil {
+		return err
+	}
+	l, err := ledger.Load(ledgerPath())
+	if err != nil {
+		return err
+	}
+	soak, _ := time.ParseDuration(cfg.Promotion.Soak)
+
+	ctx := context.Background()
+	client := registry.New()
+	digests := map[string]string{}
+	lookup := func(ref string) string {
+		if d, ok := digests[ref]; ok {
+			return d
+		}
+		digests[ref] = resolve(ctx, client, ref)
+		return digests[ref]
+	}
+	now := time.Now().UTC()
+	var tags []promote.Tag
+	immediate := map[string]bool{}
+	for _, img := range images {
+		policy := promote.Policy{Soak: soak, Block: cfg.Promotion.Block}
+		if v, ok := img.Labels["soak"]; ok {
+			if policy.Soak, err = time.ParseDuration(v); err != nil {
+				return fmt.Errorf("%s: soak label: %w", img.Name, err)
+			}
+		}
+		immediate[img.Name] = policy.Soak == 0
+
+		floating := promote.FloatingTags(img.Variants)
+		names := make([]string, 0, len(floating))
+		for name := range floating {
+			names = append(names, name)
+		}
+		sort.Strings(names)
+
+		for _, name := range names {
+			t := promote.Tag{Image: img.Name, Tag: name, Variant: floating[name]}
+			// The candidate is whatever is published under the exact tag.
+			t.Candidate = lookup(img.Repository + ":" + t.Variant)
+			t.Current = lookup(img.Repository + ":" + t.Tag)
+			scan, err := vuln.Load(vuln.Path(scansDir(), img.Name, t.Variant))
+			if err != nil && !os.IsNotExist(err) {
+				return err
+			}
+			tags = append(tags, promote.Evaluate(t, l, scan, policy, now))
+		}
+	}
+
+	var held []string
+	if *advance {
+		for i, t := range tags {
+			// Images promoted without soak are used as floating tags by the
+			// next build level, which would build on the previous digest.
+			if t.Status == promote.StatusBlocked && immediate[t.Image] {
+				held = append(held, t.Image+":"+t.Tag)
+			}
+			if t.Status != promote.StatusEligible {
+				continue
+			}
+			img, _ := cat.Lookup(t.Image)
+			if err := advanceTag(ctx, client, img.Repository, t); err != nil {
+				return err
+			}
+			// Consumers of a migrating image's old repository follow the
+			// same floating tags until the end of the transition window.
+			if img.DualPublish(now) {
+				dst, digest, err := migrate.Publish(ctx, client, img, t.Candidate, t.Tag)
+				if err != nil {
+					return err
+				}
+				fmt.Fprintf(os.Stderr, "Moved %s to %s (%s)\n", dst, short(digest), t.Variant)
+			}
+			tags[i].Status, tags[i].Current = promote.StatusCurrent, t.Candidate
+		}
+	}
+
+	if *format == "json" {
+		enc := json.NewEncoder(os.Stdout)
+		enc.SetIndent("", "  ")
+		if err := enc.Encode(tags); err != nil {
+			return err
+		}
+	} else {
+		for _, t := range tags {
+			line := fmt.Sprintf("%-32s %-12s -> %-12s %-9s %s", t.Image+":"+t.Tag, short(t.Current), t.Variant, t.Status, t.Reason)
+			fmt.Println(strings.TrimSpace(line))
+		}
+	}
+	if len(held) > 0 {
+		return fmt.Errorf("%s blocked, images built from it would use the previous digest", strings.Join(held, ", "))
+	}
+	return nil
+}
+
+// advanceTag points the floating tag at the candidate digest by copying its
+// manifest, and records the promotion in the transparency log.
+func advanceTag(ctx context.Context, client *registry.Client, repo string, t promote.Tag) error {
+	src, err := registry.ParseRef(repo + "@" + t.Candidate)
+	if err != nil {
+		return err
+	}
+	data, mediaType, _, err := client.Manifest(ctx, src)
+	if err != nil {
+		return err
+	}
+	dst := registry.Ref{Registry: src.Registry, Repository: src.Repository, Tag: t.Tag}
+	if _, err := client.PutManifest(ctx, dst, mediaType, data); err != nil {
+		return err
+	}
+	fmt.Fprintf(os.Stderr, "Moved %s to %s (%s)\n", dst, t.Candidate, t.Variant)
+
+	key, _, err := signingKey()
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "  [warn] %s: promotion not logged: %v\n", dst, err)
+		return nil
+	}
+	_, err = logEntry(key, tlog.Entry{Kind: tlog.KindPromotion, Repository: dst.Name(), Tag: t.Tag, Digest: t.Candidate})
+	return err
+}
+
+// resolve returns the digest ref points to, or "" when it does not exist or
+// cannot be resolved.
+func resolve(ctx context.Context, client *registry.Client, ref string) string {
+	r, err := registry.ParseRef(ref)
+	if err != nil {
+		return ""
+	}
+	d, err := client.Digest(ctx, r)
+	if err != nil {
+		if !registry.IsNotFound(err) {
+			fmt.Fprintf(os.Stderr, "  [warn] %s: %v\n", ref, err)
+		}
+		return ""
+	}
+	return d
+}
+
+func short(digest string) string {
+	if len(digest) < 19 {
+		return "-"
+	}
+	return digest[7:19]
+}
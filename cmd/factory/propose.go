@@ -0,0 +1,54 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"flag"
+	"fmt"
+	"os"
+
+	"github.com/gillouche/container-factory/internal/autoupdate"
+	"github.com/gillouche/container-factory/internal/github"
+)
+
+// runPropose applies the updates of a check-pinned-deps report to the
+// default branch in a commit of its own branch, opens a pull request from
+// it (or refreshes the open one) and prints the pull request URL. The
+// GitHub token only gets contents and pull request write access to repo.
+func runPropose(args []string) error {
+	fs := flag.NewFlagSet("propose", flag.ExitOnError)
+	repo := fs.String("repo", os.Getenv("GITHUB_REPOSITORY"), "repository (owner/name)")
+	api := fs.String("github-api", "https://api.github.com", "GitHub API root")
+	fs.Parse(args)
+	if fs.NArg() != 1 {
+		return errors.New("usage: factory propose [-repo OWNER/NAME] REPORT")
+	}
+	if *repo == "" {
+		return errors.New("no repository: set -repo or $GITHUB_REPOSITORY")
+	}
+
+	data, err := os.ReadFile(fs.Arg(0))
+	if err != nil {
+		return err
+	}
+	var report autoupdate.Report
+	if err := json.Unmarshal(data, &report); err != nil {
+		return fmt.Errorf("%s: %w", fs.Arg(0), err)
+	}
+	if len(report.Updates) == 0 {
+		fmt.Fprintln(os.Stderr, "No updates to apply")
+		return nil
+	}
+
+	gh, err := githubClient(*api, github.PullRequests(*repo))
+	if err != nil {
+		return err
+	}
+	pr, err := autoupdate.Propose(context.Background(), gh, *repo, report.Updates, os.Stderr)
+	if err != nil || pr == nil {
+		return err
+	}
+	fmt.Println(pr.URL)
+	return nil
+}
@@ -0,0 +1,138 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"flag"
+	"fmt"
+	"io"
+	"os"
+	"strings"
+
+	"github.com/gillouche/container-factory/internal/github"
+	"github.com/gillouche/container-factory/internal/ledger"
+	"github.com/gillouche/container-factory/internal/registry"
+	"github.com/gillouche/container-factory/internal/release"
+	"github.com/gillouche/container-factory/internal/sbom"
+)
+
+// runRelease records the last publish of every selected variant in the
+// ledger as an annotated git tag and a GitHub release. Publishes already
+// recorded are left alone.
+func runRelease(args []string) error {
+	fs := flag.NewFlagSet("release", flag.ExitOnError)
+	sel := fs.String("select", "", "image selector (default: all images)")
+	dir := fs.String("dir", ".", "clone of the repository to tag")
+	remote := fs.String("remote", "origin", "git remote the tags are pushed to")
+	repo := fs.String("repo", os.Getenv("GITHUB_REPOSITORY"), "repository (owner/name) of the releases, \"\" to only tag")
+	api := fs.String("github-api", "https://api.github.com", "GitHub API root")
+	plat := fs.String("platform", "linux/amd64", "platform whose SBOM and provenance are attached")
+	dryRun := fs.Bool("dry-run", false, "print what would be recorded without recording it")
+	fs.Parse(args)
+
+	platform, err := registry.ParsePlatform(*plat)
+	if err != nil {
+		return err
+	}
+	cfg, cat, err := loadCatalog()
+	if err != nil {
+		return err
+	}
+	images, err := selectImages(cat, *sel)
+	if err != nil {
+		return err
+	}
+	l, err := ledger.Load(ledgerPath())
+	if err != nil {
+		return err
+	}
+	sboms, err := enrichedSBOMs(cfg, cat, platform, sbom.DefaultArtifacts, true)
+	if err != nil {
+		return err
+	}
+
+	rc := &release.Recorder{
+		Git:      release.Git{Dir: *dir, Remote: *remote},
+		Repo:     *repo,
+		Registry: registry.New(),
+		Platform: platform,
+		SBOMs:    sboms,
+		DryRun:   *dryRun,
+	}
+	if *repo != "" {
+		if rc.GitHub, err = githubClient(*api, github.Contents(*repo)); err != nil {
+			return err
+		}
+	}
+	ctx := context.Background()
+	if err := rc.Git.Fetch(ctx); err != nil {
+		return err
+	}
+
+	var publishes []release.Publish
+	for _, img := range images {
+		for _, v := range img.Variants {
+			r, ok := l.LastPublish(img.Name, v)
+			if !ok || r.Revision == "" {
+				continue
+			}
+			publishes = append(publishes, release.Publish{
+				Image:      img.Name,
+				Variant:    v,
+				Dir:        img.Dir,
+				Repository: img.Repository,
+				Digest:     r.Digest,
+				Revision:   r.Revision,
+				Time:       r.Time,
+				Signed:     r.Signed,
+			})
+		}
+	}
+	if len(publishes) == 0 {
+		return errors.New("no published variant in the ledger")
+	}
+	failed := recordReleases(ctx, rc, publishes, os.Stdout)
+	if err := sboms.Checksums.Save(); err != nil {
+		return err
+	}
+	if failed > 0 {
+		return fmt.Errorf("%d of %d publishes not recorded", failed, len(publishes))
+	}
+	return nil
+}
+
+// recordReleases records each publish, printing what was done, and returns
+// the number of failures.
+func recordReleases(ctx context.Context, rc *release.Recorder, publishes []release.Publish, w io.Writer) int {
+	verb := ""
+	if rc.DryRun {
+		verb = "would be "
+	}
+	failed := 0
+	for _, p := range publishes {
+		res, err := rc.Record(ctx, p)
+		if err != nil {
+			failed++
+			fmt.Fprintf(os.Stderr, "  [warn] %s %s: %v\n", p.Image, p.Variant, err)
+			continue
+		}
+		if !res.Changed() {
+			fmt.Fprintf(w, "  %s: up to date\n", res.Tag)
+			continue
+		}
+		var done []string
+		if len(res.Tags) > 0 {
+			done = append(done, verb+"tagged "+strings.Join(res.Tags, ", "))
+		}
+		switch {
+		case res.Created && len(res.Assets) == 0:
+			done = append(done, verb+"released")
+		case res.Created:
+			done = append(done, verb+"released with "+strings.Join(res.Assets, ", "))
+		case len(res.Assets) > 0:
+			done = append(done, verb+"given "+strings.Join(res.Assets, ", "))
+		}
+		fmt.Fprintf(w, "  %s: %s\n", res.Tag, strings.Join(done, "; "))
+	}
+	return failed
+}
@@ -0,0 +1,147 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"flag"
+	"fmt"
+	"os"
+	"sort"
+	"strings"
+
+	"github.com/gillouche/container-factory/internal/notify"
+	"github.com/gillouche/container-factory/internal/promote"
+	"github.com/gillouche/container-factory/internal/registry"
+	"github.com/gillouche/container-factory/internal/rescan"
+)
+
+func runRescan(args []string) error {
+	fs := flag.NewFlagSet("rescan", flag.ExitOnError)
+	sel := fs.String("select", "", "image selector (default: all images)")
+	skipUpdate := fs.Bool("skip-db-update", false, "scan with the vulnerability database as it is")
+	format := fs.String("format", "text", "output format: text or json")
+	send := fs.Bool("send", false, "send new findings to the configured notification sink")
+	fs.Parse(args)
+
+	if *format != "text" && *format != "json" {
+		return fmt.Errorf("invalid -format %q", *format)
+	}
+
+	cfg, cat, err := loadCatalog()
+	if err != nil {
+		return err
+	}
+	images, err := selectImages(cat, *sel)
+	if err != nil {
+		return err
+	}
+
+	// Every digest currently reachable through an exact or floating tag.
+	ctx := context.Background()
+	client := registry.New()
+	var targets []rescan.Target
+	for _, img := range images {
+		byDigest := map[string]*rescan.Target{}
+		tags := append([]string(nil), img.Variants...)
+		for tag := range promote.FloatingTags(img.Variants) {
+			tags = append(tags, tag)
+		}
+		sort.Strings(tags)
+		for _, tag := range tags {
+			d := resolve(ctx, client, img.Repository+":"+tag)
+			if d == "" {
+				continue
+			}
+			t := byDigest[d]
+			if t == nil {
+				t = &rescan.Target{Image: img.Name, Repository: img.Repository, Digest: d}
+				byDigest[d] = t
+			}
+			t.Tags = append(t.Tags, tag)
+			for _, v := range img.Variants {
+				if v == tag {
+					t.Variants = append(t.Variants, v)
+				}
+			}
+		}
+		for _, t := range byDigest {
+			targets = append(targets, *t)
+		}
+	}
+	sort.Slice(targets, func(i, j int) bool { return targets[i].Ref() < targets[j].Ref() })
+
+	sc := rescan.Trivy{}
+	if !*skipUpdate {
+		if err := sc.UpdateDB(ctx); err != nil {
+			return err
+		}
+	}
+	store := rescan.Store{Dir: rescansDir(), Scans: scansDir()}
+	alerts, scans, failed := rescan.Rescan(ctx, sc, store, targets)
+	for ref, err := range failed {
+		fmt.Fprintf(os.Stderr, "  [warn] %s: %v\n", ref, err)
+	}
+
+	if *format == "json" {
+		enc := json.NewEncoder(os.Stdout)
+		enc.SetIndent("", "  ")
+		if err := enc.Encode(alerts); err != nil {
+			return err
+		}
+	} else {
+		fmt.Printf("Rescanned %d published digests, %d new findings\n", len(targets)-len(failed), len(alerts))
+		for _, a := range alerts {
+			fmt.Println("  " + alertLine(a))
+		}
+	}
+
+	if *send && len(alerts) > 0 {
+		sink, err := notify.New(cfg.Notify)
+		if err != nil {
+			return err
+		}
+		if err := sink.Send(ctx, alertMessage(alerts)); err != nil {
+			return err
+		}
+	}
+	// The new reports become the baseline only once their alerts are out.
+	for _, s := range scans {
+		if err := store.Save(s.Target, s.Data); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+func alertLine(a rescan.Alert) string {
+	f := a.Finding
+	line := fmt.Sprintf("%s %s in %s %s (%s:%s)", f.Severity, f.ID, f.Package, f.Installed, a.Image, strings.Join(a.Tags, ","))
+	if f.Fixed != "" {
+		line += ", fixed in " + f.Fixed
+	}
+	return line
+}
+
+// alertMessage groups the new findings per image.
+func alertMessage(alerts []rescan.Alert) notify.Message {
+	m := notify.Message{
+		Title:       "New vulnerabilities in published images",
+		Description: fmt.Sprintf("%d findings disclosed since these digests were last scanned.", len(alerts)),
+		Status:      notify.StatusWarning,
+	}
+	var order []string
+	lines := map[string][]string{}
+	for _, a := range alerts {
+		if a.Finding.Severity == "CRITICAL" || a.Finding.Severity == "HIGH" {
+			m.Status = notify.StatusFailure
+		}
+		if _, ok := lines[a.Image]; !ok {
+			order = append(order, a.Image)
+		}
+		lines[a.Image] = append(lines[a.Image], alertLine(a))
+	}
+	for _, image := range order {
+		m.Fields = append(m.Fields, notify.Field{Name: image, Value: strings.Join(lines[image], "\n")})
+	}
+	return m
+}
@@ -0,0 +1,148 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"flag"
+	"fmt"
+	"os"
+	"path/filepath"
+
+	"github.com/gillouche/container-factory/internal/catalog"
+	"github.com/gillouche/container-factory/internal/config"
+	"github.com/gillouche/container-factory/internal/malware"
+	"github.com/gillouche/container-factory/internal/registry"
+	"github.com/gillouche/container-factory/internal/rescan"
+	"github.com/gillouche/container-factory/internal/sbom"
+)
+
+func checksumsPath() string { return filepath.Join(stateDir(), "artifact-checksums.json") }
+
+// enrichedSBOMs generates the SBOMs of platform with Trivy and adds the
+// artifacts of the catalog images, by the rules of artifactsFile, to them.
+// The downloads unpacked in images are digested unless checksums is false.
+func enrichedSBOMs(cfg *config.Config, cat *catalog.Catalog, platform registry.Platform, artifactsFile string, checksums bool) (*sbom.Enricher, error) {
+	arts, err := sbom.LoadArtifacts(artifactsFile)
+	if err != nil {
+		return nil, err
+	}
+	e := &sbom.Enricher{
+		Base:      rescan.Trivy{Platform: platform.String()},
+		Catalog:   cat,
+		Artifacts: arts,
+		Registry:  registry.New(),
+		Platform:  platform,
+		Log:       os.Stderr,
+	}
+	if checksums {
+		e.Checksums = &sbom.Checksums{Path: checksumsPath(), Login: cfg.Secrets.Login}
+	}
+	return e, nil
+}
+
+// runSBOM writes the CycloneDX SBOM of an image variant with the artifacts
+// its Dockerfiles install outside package managers added: a published
+// reference (the SBOM generated with Trivy unless -in gives one) or an
+// image saved with `docker save` (-archive, with -in).
+func runSBOM(args []string) error {
+	fs := flag.NewFlagSet("sbom", flag.ExitOnError)
+	artifactsFile := fs.String("artifacts", sbom.DefaultArtifacts, "artifact rules")
+	name := fs.String("image", "", "catalog image (default: the owner of REF)")
+	variant := fs.String("variant", "", "variant of the image (default: the tag of REF, or the variant with its digest)")
+	plat := fs.String("platform", "linux/amd64", "platform of the image")
+	archive := fs.String("archive", "", "read the layers of this `docker save` archive instead of REF")
+	in := fs.String("in", "", "CycloneDX SBOM to enrich (default: generated with Trivy)")
+	out := fs.String("o", "", "write the SBOM to this file instead of stdout")
+	checksums := fs.Bool("checksums", true, "fetch the downloads unpacked in the image to digest them")
+	fs.Usage = func() {
+		fmt.Fprintln(os.Stderr, "Usage: factory sbom [flags] [REF]")
+		fs.PrintDefaults()
+	}
+	fs.Parse(args)
+
+	if (fs.NArg() == 1) == (*archive != "") {
+		return errors.New("give either a reference or -archive")
+	}
+	if *archive != "" && (*in == "" || *name == "" || *variant == "") {
+		return errors.New("-archive needs -in, -image and -variant")
+	}
+	platform, err := registry.ParsePlatform(*plat)
+	if err != nil {
+		return err
+	}
+	cfg, cat, err := loadCatalog()
+	if err != nil {
+		return err
+	}
+	e, err := enrichedSBOMs(cfg, cat, platform, *artifactsFile, *checksums)
+	if err != nil {
+		return err
+	}
+
+	ctx := context.Background()
+	var bom []byte
+	if *in != "" {
+		if bom, err = os.ReadFile(*in); err != nil {
+			return err
+		}
+	}
+
+	var layers []malware.Layer
+	if *archive != "" {
+		if _, layers, err = malware.ArchiveLayers(*archive); err != nil {
+			return err
+		}
+	} else {
+		ref, err := registry.ParseRef(fs.Arg(0))
+		if err != nil {
+			return err
+		}
+		if *name == "" {
+			owner, ok := cat.Owner(fs.Arg(0))
+			if !ok {
+				return fmt.Errorf("%s: no catalog image publishes it, give -image", fs.Arg(0))
+			}
+			*name = owner
+		}
+		if img, ok := cat.Lookup(*name); ok && *variant == "" {
+			if *variant, err = e.Variant(ctx, img, ref); err != nil {
+				return err
+			}
+			if *variant == "" {
+				return fmt.Errorf("%s: no variant of %s, give -variant", fs.Arg(0), *name)
+			}
+		}
+		if bom == nil {
+			if bom, err = e.Base.SBOM(ctx, fs.Arg(0)); err != nil {
+				return err
+			}
+		}
+		if layers, err = malware.RegistryLayers(ctx, e.Registry, ref, platform); err != nil {
+			return err
+		}
+	}
+	img, ok := cat.Lookup(*name)
+	if !ok {
+		return fmt.Errorf("unknown image %q", *name)
+	}
+
+	bom, found, err := e.Enrich(ctx, bom, img, *variant, layers)
+	if err != nil {
+		return err
+	}
+	if e.Checksums != nil {
+		if err := e.Checksums.Save(); err != nil {
+			return err
+		}
+	}
+	for _, a := range found {
+		if len(a.Files) > 0 {
+			fmt.Fprintf(os.Stderr, "  %s %s: %s (%d files)\n", a.Rule.Name, a.Version, a.PURL(), len(a.Files))
+		}
+	}
+	if *out == "" {
+		_, err = os.Stdout.Write(bom)
+		return err
+	}
+	return os.WriteFile(*out, bom, 0o644)
+}
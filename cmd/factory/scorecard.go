@@ -0,0 +1,103 @@
+package main
+
+import (
+	"context"
+	"flag"
+	"fmt"
+	"os"
+	"time"
+
+	"github.com/gillouche/container-factory/internal/eol"
+	"github.com/gillouche/container-factory/internal/ledger"
+	"github.com/gillouche/container-factory/internal/registry"
+	"github.com/gillouche/container-factory/internal/scorecard"
+	"github.com/gillouche/container-factory/internal/smoke"
+	"github.com/gillouche/container-factory/internal/vuln"
+)
+
+func runScorecard(args []string) error {
+	fs := flag.NewFlagSet("scorecard", flag.ExitOnError)
+	format := fs.String("format", "markdown", "output format: markdown or json")
+	sel := fs.String("select", "", "image selector (default: all images)")
+	eolFile := fs.String("eol", "ci/eol.json", "end-of-life table")
+	quarantineFile := fs.String("quarantine", smoke.DefaultQuarantine, "smoke check quarantine list")
+	offline := fs.Bool("offline", false, "do not query the registry for base image digests")
+	fs.Parse(args)
+
+	if *format != "markdown" && *format != "json" {
+		return fmt.Errorf("invalid -format %q", *format)
+	}
+
+	_, cat, err := loadCatalog()
+	if err != nil {
+		return err
+	}
+	images, err := selectImages(cat, *sel)
+	if err != nil {
+		return err
+	}
+	l, err := ledger.Load(ledgerPath())
+	if err != nil {
+		return err
+	}
+	eols, err := eol.Load(*eolFile)
+	if err != nil {
+		return err
+	}
+	q, err := smoke.LoadQuarantine(*quarantineFile)
+	if err != nil {
+		return err
+	}
+
+	ctx := context.Background()
+	client := registry.New()
+	now := time.Now().UTC()
+
+	var cards []scorecard.Card
+	for _, img := range images {
+		checks, err := img.SmokeChecks()
+		if err != nil {
+			return err
+		}
+		quarantined := 0
+		for _, e := range q.Of(img.Name) {
+			if _, ok := q.Active(e.Image, e.Check, now); ok {
+				quarantined++
+			}
+		}
+		for _, v := range img.Variants {
+			in := scorecard.Input{
+				Image:       img,
+				Variant:     v,
+				History:     l.History(img.Name, v),
+				SmokeChecks: checks,
+				Quarantined: quarantined,
+				Now:         now,
+			}
+			in.EOL, _ = eols.Lookup(img.Name, v)
+
+			if scan, err := vuln.Load(vuln.Path(scansDir(), img.Name, v)); err == nil {
+				in.Scan = scan
+			} else if !os.IsNotExist(err) {
+				return err
+			}
+
+			if last, ok := l.LastSuccess(img.Name, v); ok && !*offline {
+				var refs []string
+				for _, b := range last.Bases {
+					refs = append(refs, b.Ref)
+				}
+				fmt.Fprintf(os.Stderr, "Checking base images of %s:%s ...\n", img.Name, v)
+				in.CurrentBases = resolveBases(ctx, client, refs)
+			}
+
+			cards = append(cards, scorecard.Evaluate(in))
+		}
+	}
+	scorecard.Sort(cards)
+
+	if *format == "json" {
+		return scorecard.JSON(os.Stdout, cards)
+	}
+	return scorecard.Markdown(os.Stdout, cards)
+}
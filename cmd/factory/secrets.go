@@ -0,0 +1,45 @@
+package main
+
+import (
+	"errors"
+	"flag"
+	"fmt"
+	"os"
+
+	"github.com/gillouche/container-factory/internal/secrets"
+)
+
+// runSecrets writes the secrets mounted by an image's Dockerfile to dir and
+// prints one docker buildx --secret flag per line. Optional secrets
+// (required=false) whose credentials are not set are skipped with a warning,
+// so local builds keep working against unauthenticated proxies.
+func runSecrets(args []string) error {
+	fs := flag.NewFlagSet("secrets", flag.ExitOnError)
+	dir := fs.String("dir", "", "private directory to write the secrets to (removed by the caller)")
+	fs.Parse(args)
+	if fs.NArg() != 1 || *dir == "" {
+		return errors.New("usage: factory secrets -dir DIR IMAGE")
+	}
+
+	cfg, cat, err := loadCatalog()
+	if err != nil {
+		return err
+	}
+	img, ok := cat.Lookup(fs.Arg(0))
+	if !ok {
+		return fmt.Errorf("image %s not found", fs.Arg(0))
+	}
+
+	for _, s := range img.Secrets {
+		m, err := cfg.Secrets.Provision(*dir, s.ID)
+		if errors.Is(err, secrets.ErrUnavailable) && !s.Required {
+			fmt.Fprintf(os.Stderr, "  [warn] %s: %v, building without it\n", img.Name, err)
+			continue
+		}
+		if err != nil {
+			return fmt.Errorf("%s: %w", img.Name, err)
+		}
+		fmt.Println(m.Flag())
+	}
+	return nil
+}
@@ -0,0 +1,324 @@
+package main
+
+import (
+	"context"
+	"crypto/ecdsa"
+	"encoding/base64"
+	"errors"
+	"flag"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"slices"
+	"time"
+
+	"github.com/gillouche/container-factory/internal/config"
+	"github.com/gillouche/container-factory/internal/registry"
+	"github.com/gillouche/container-factory/internal/signing"
+	"github.com/gillouche/container-factory/internal/tlog"
+)
+
+func runSign(args []string) error {
+	fs := flag.NewFlagSet("sign", flag.ExitOnError)
+	image := fs.String("image", "", "sign in the formats of this image's signature label")
+	format := fs.String("format", "", "signature formats, e.g. cosign+notation (overrides -image)")
+	fs.Parse(args)
+	if fs.NArg() != 1 {
+		return errors.New("usage: factory sign [-image NAME] [-format FORMATS] IMAGE@DIGEST")
+	}
+	ref, err := registry.ParseRef(fs.Arg(0))
+	if err != nil {
+		return err
+	}
+	if ref.Digest == "" {
+		return fmt.Errorf("%s: sign a digest, not a tag", ref)
+	}
+	formats, err := signatureFormats(*image, *format)
+	if err != nil {
+		return err
+	}
+
+	key, k, err := signingKey()
+	if err != nil {
+		return err
+	}
+	entries, err := signImage(context.Background(), registry.New(), ref, formats, key, k)
+	if err != nil {
+		return err
+	}
+	for i, e := range entries {
+		index, err := logEntry(key, e)
+		if err != nil {
+			return fmt.Errorf("signed but not logged: %w", err)
+		}
+		fmt.Fprintf(os.Stderr, "Signed %s (%s) with key %s (transparency log entry %d)\n", ref, formats[i], k.ID, index)
+	}
+	return nil
+}
+
+// signatureFormats returns the formats of -format, else of the signature
+// label of -image, else cosign.
+func signatureFormats(image, format string) ([]string, error) {
+	if format == "" && image != "" {
+		_, cat, err := loadCatalog()
+		if err != nil {
+			return nil, err
+		}
+		img, ok := cat.Lookup(image)
+		if !ok {
+			return nil, fmt.Errorf("unknown image %q", image)
+		}
+		format = img.Labels["signature"]
+	}
+	return signing.Formats(format)
+}
+
+// signImage signs ref in each format and attaches the signatures. It
+// returns the transparency log entry of each signature, in format order.
+func signImage(ctx context.Context, client *registry.Client, ref registry.Ref, formats []string, key *ecdsa.PrivateKey, k signing.TrustedKey) ([]tlog.Entry, error) {
+	now := time.Now().UTC()
+	var entries []tlog.Entry
+	for _, f := range formats {
+		e := tlog.Entry{Kind: tlog.KindSignature, Repository: ref.Name(), Digest: ref.Digest, KeyID: k.ID}
+		switch f {
+		case signing.FormatCosign:
+			sig, err := signing.Sign(key, ref.Name(), ref.Digest, now)
+			if err != nil {
+				return nil, err
+			}
+			if err := signing.Attach(ctx, client, ref, sig); err != nil {
+				return nil, err
+			}
+			e.Signature = sig.Signature
+		default:
+			cert, err := k.Cert()
+			if err != nil {
+				return nil, err
+			}
+			target, err := signing.Target(ctx, client, ref)
+			if err != nil {
+				return nil, err
+			}
+			mediaType := signing.EnvelopeType(f)
+			envelope, err := signing.SignNotation(key, cert, target, mediaType, now)
+			if err != nil {
+				return nil, err
+			}
+			if err := signing.AttachNotation(ctx, client, ref, target, mediaType, envelope, cert, now); err != nil {
+				return nil, err
+			}
+			env, err := signing.ParseEnvelope(mediaType, envelope)
+			if err != nil {
+				return nil, err
+			}
+			e.Signature = base64.StdEncoding.EncodeToString(env.Signature)
+		}
+		entries = append(entries, e)
+	}
+	return entries, nil
+}
+
+func runVerify(args []string) error {
+	fs := flag.NewFlagSet("verify", flag.ExitOnError)
+	noLog := fs.Bool("no-tlog", false, "do not require signatures to be in the transparency log")
+	format := fs.String("format", "", "only consider signatures of these formats, e.g. notation (default all)")
+	fs.Parse(args)
+	if fs.NArg() != 1 {
+		return errors.New("usage: factory verify [-no-tlog] [-format FORMATS] IMAGE[:TAG|@DIGEST]")
+	}
+	ref, err := registry.ParseRef(fs.Arg(0))
+	if err != nil {
+		return err
+	}
+	formats := []string{signing.FormatCosign, signing.FormatNotation, signing.FormatNotationCOSE}
+	if *format != "" {
+		if formats, err = signing.Formats(*format); err != nil {
+			return err
+		}
+	}
+	cfg, err := config.Load("")
+	if err != nil {
+		return err
+	}
+	trusted, err := signing.LoadTrusted(cfg.TrustedKeys)
+	if err != nil {
+		return err
+	}
+	v := &verifier{Keys: trusted, PolicyPath: cfg.TrustPolicy}
+
+	if !*noLog {
+		log, err := tlog.Open(tlogDir())
+		if err != nil {
+			return err
+		}
+		head, err := log.Head()
+		if err != nil && !os.IsNotExist(err) {
+			return err
+		}
+		v.Logged = func(e tlog.Entry) (time.Time, error) { return logged(log, head, trusted, e) }
+	}
+
+	ctx := context.Background()
+	client := registry.New()
+	if ref.Digest, err = client.Digest(ctx, ref); err != nil {
+		return err
+	}
+	valid, found, err := v.verify(ctx, client, ref, formats, os.Stdout)
+	if err != nil {
+		return err
+	}
+	if valid == 0 {
+		return fmt.Errorf("%s: no valid signature (%d found)", ref, found)
+	}
+	return nil
+}
+
+// verifier verifies the signatures of an image in any format.
+type verifier struct {
+	Keys *signing.TrustedKeys
+	// PolicyPath is the Notation trust policy, read when the image has
+	// Notation signatures.
+	PolicyPath string
+	// Logged, when set, checks that a signature is in the transparency log
+	// and returns when it was logged.
+	Logged func(tlog.Entry) (time.Time, error)
+
+	notation *signing.NotationVerifier
+}
+
+// verify prints one line per signature of ref in formats and returns the
+// number of valid signatures and of signatures found.
+func (v *verifier) verify(ctx context.Context, client *registry.Client, ref registry.Ref, formats []string, w io.Writer) (valid, found int, err error) {
+	report := func(format string, res signing.Result, sig string) {
+		found++
+		if res.Err == nil {
+			res.Err = v.checkTime(ref, res.KeyID, sig)
+		}
+		if res.Err != nil {
+			fmt.Fprintf(w, "  [fail] %s, key %s: %v\n", format, orUnknown(res.KeyID), res.Err)
+			return
+		}
+		valid++
+		fmt.Fprintf(w, "  [ok] %s, key %s, signed %s\n", format, res.KeyID, res.SignedAt.Format(time.RFC3339))
+		for _, warn := range res.Warnings {
+			fmt.Fprintf(w, "    [warn] %s\n", warn)
+		}
+	}
+
+	if slices.Contains(formats, signing.FormatCosign) {
+		sigs, err := signing.Signatures(ctx, client, ref)
+		if err != nil {
+			return 0, 0, err
+		}
+		for _, sig := range sigs {
+			report(signing.FormatCosign, v.Keys.Verify(sig, ref.Name(), ref.Digest), sig.Signature)
+		}
+	}
+	if !slices.Contains(formats, signing.FormatNotation) && !slices.Contains(formats, signing.FormatNotationCOSE) {
+		return valid, found, nil
+	}
+
+	sigs, err := signing.NotationSignatures(ctx, client, ref)
+	if err != nil {
+		return 0, 0, err
+	}
+	var target registry.Descriptor
+	if len(sigs) > 0 {
+		if target, err = signing.Target(ctx, client, ref); err != nil {
+			return 0, 0, err
+		}
+	}
+	for _, sig := range sigs {
+		if sig.Err != nil {
+			report(signing.FormatNotation, signing.Result{Err: sig.Err}, "")
+			continue
+		}
+		format := signing.FormatNotation
+		if sig.Envelope.MediaType == signing.MediaTypeCOSE {
+			format = signing.FormatNotationCOSE
+		}
+		if !slices.Contains(formats, format) {
+			continue
+		}
+		nv, err := v.notationVerifier()
+		if err != nil {
+			report(format, signing.Result{Err: err}, "")
+			continue
+		}
+		report(format, nv.Verify(sig.Envelope, ref.Name(), target), base64.StdEncoding.EncodeToString(sig.Envelope.Signature))
+	}
+	return valid, found, nil
+}
+
+// checkTime checks a valid signature against a time its signer does not
+// control. The signing time the signature carries is the signer's word: the
+// holder of a retired key could backdate it into the key's window. With the
+// transparency log, a factory key must have been valid when the signature
+// was logged; without, it must still be valid now.
+func (v *verifier) checkTime(ref registry.Ref, keyID, sig string) error {
+	at := time.Now()
+	if v.Logged != nil {
+		var err error
+		at, err = v.Logged(tlog.Entry{
+			Kind: tlog.KindSignature, Repository: ref.Name(), Digest: ref.Digest, KeyID: keyID, Signature: sig,
+		})
+		if err != nil {
+			return err
+		}
+	}
+	// Keys of other Notation trust stores have no window of ours.
+	if _, ok := v.Keys.Lookup(keyID); !ok {
+		return nil
+	}
+	if err := v.Keys.ValidAt(keyID, at); err != nil {
+		if v.Logged != nil {
+			return fmt.Errorf("logged: %w", err)
+		}
+		return fmt.Errorf("verified without the transparency log: %w", err)
+	}
+	return nil
+}
+
+func (v *verifier) notationVerifier() (*signing.NotationVerifier, error) {
+	if v.notation != nil {
+		return v.notation, nil
+	}
+	policy, err := signing.LoadTrustPolicy(v.PolicyPath)
+	if err != nil {
+		return nil, fmt.Errorf("trust policy: %w", err)
+	}
+	v.notation = &signing.NotationVerifier{
+		Policy:   policy,
+		Keys:     v.Keys,
+		StoreDir: filepath.Join(filepath.Dir(v.PolicyPath), "truststore", "x509"),
+	}
+	return v.notation, nil
+}
+
+// logged checks that e is covered by the signed tree head of the log and
+// returns when it was logged.
+func logged(l *tlog.Log, head tlog.TreeHead, trusted *signing.TrustedKeys, e tlog.Entry) (time.Time, error) {
+	index, ok := l.Find(e)
+	if !ok {
+		return time.Time{}, errors.New("not in the transparency log")
+	}
+	if index >= head.Size {
+		return time.Time{}, fmt.Errorf("transparency log entry %d is not covered by a signed tree head", index)
+	}
+	p, err := l.Prove(index, head)
+	if err != nil {
+		return time.Time{}, err
+	}
+	if err := p.Verify(trusted); err != nil {
+		return time.Time{}, fmt.Errorf("transparency log entry %d: %w", index, err)
+	}
+	return p.Entry.Time, nil
+}
+
+func orUnknown(s string) string {
+	if s == "" {
+		return "unknown"
+	}
+	return s
+}
@@ -0,0 +1,135 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"flag"
+	"fmt"
+	"os"
+	"path/filepath"
+	"runtime"
+	"strconv"
+	"time"
+
+	"github.com/gillouche/container-factory/internal/smoke"
+)
+
+func smokePath() string { return filepath.Join(stateDir(), "smoke.jsonl") }
+
+func runSmoke(args []string) error {
+	fs := flag.NewFlagSet("smoke", flag.ExitOnError)
+	image := fs.String("image", "", "image name")
+	variant := fs.String("variant", "", "image variant (VARIANTS entry), passed to test.sh as the version")
+	platform := fs.String("platform", "linux/"+runtime.GOARCH, "platform of the image tested")
+	imageID := fs.String("image-id", "", "ID of the image tested, so retries of the same image are told apart from rebuilds")
+	retries := fs.Int("retries", 1, "run a failed test again up to this many times")
+	quarantineFile := fs.String("quarantine", smoke.DefaultQuarantine, "quarantine list")
+	fs.Parse(args)
+
+	if fs.NArg() != 1 || *image == "" || *variant == "" {
+		return errors.New("usage: factory smoke -image NAME -variant VERSION [flags] REF")
+	}
+	_, cat, err := loadCatalog()
+	if err != nil {
+		return err
+	}
+	img, ok := cat.Lookup(*image)
+	if !ok {
+		return fmt.Errorf("image %s not found", *image)
+	}
+	if img.SmokeTest == "" {
+		return fmt.Errorf("%s has no %s", *image, smoke.Script)
+	}
+	q, err := smoke.LoadQuarantine(*quarantineFile)
+	if err != nil {
+		return err
+	}
+	start := time.Now().UTC()
+	for _, e := range q.Of(*image) {
+		if !start.Before(e.Expires()) {
+			fmt.Fprintf(os.Stderr, "  [warn] quarantine of %s %s ended %s, its failures block again\n", e.Image, e.Check, e.Until)
+		}
+	}
+
+	runner := &smoke.Runner{
+		Script:  img.SmokeTest,
+		Args:    []string{fs.Arg(0), *variant},
+		Output:  os.Stdout,
+		Retries: *retries,
+	}
+	attempts, err := runner.Run(context.Background())
+	if err != nil {
+		return err
+	}
+	now := time.Now().UTC()
+	run := strconv.FormatInt(start.UnixNano(), 36)
+	if err := smoke.Append(smokePath(), smoke.Records(*image, *variant, *platform, run, *imageID, now, attempts, q)...); err != nil {
+		return err
+	}
+
+	return q.Verdict(os.Stderr, *image, attempts, now)
+}
+
+func runFlaky(args []string) error {
+	fs := flag.NewFlagSet("flaky", flag.ExitOnError)
+	format := fs.String("format", "markdown", "output format: markdown or json")
+	sel := fs.String("select", "", "image selector (default: all images)")
+	quarantineFile := fs.String("quarantine", smoke.DefaultQuarantine, "quarantine list")
+	window := fs.Int("window", smoke.DefaultAnalysis.Window, "number of most recent runs of each check analysed")
+	all := fs.Bool("all", false, "list every check, not only the flaky ones")
+	fs.Parse(args)
+
+	if *format != "markdown" && *format != "json" {
+		return fmt.Errorf("invalid -format %q", *format)
+	}
+	_, cat, err := loadCatalog()
+	if err != nil {
+		return err
+	}
+	images, err := selectImages(cat, *sel)
+	if err != nil {
+		return err
+	}
+	h, err := smoke.Load(smokePath())
+	if err != nil {
+		return err
+	}
+	q, err := smoke.LoadQuarantine(*quarantineFile)
+	if err != nil {
+		return err
+	}
+
+	selected := map[string]bool{}
+	for _, img := range images {
+		selected[img.Name] = true
+	}
+	var records []smoke.Record
+	for _, r := range h.Records {
+		if selected[r.Image] {
+			records = append(records, r)
+		}
+	}
+	now := time.Now().UTC()
+	a := smoke.DefaultAnalysis
+	a.Window = *window
+
+	r := &smoke.Report{}
+	for _, s := range a.Analyze(records) {
+		if s.Flaky || *all {
+			r.Checks = append(r.Checks, s)
+		}
+	}
+	for _, s := range q.Status(records, now) {
+		if selected[s.Image] {
+			r.Quarantine = append(r.Quarantine, s)
+		}
+	}
+
+	if *format == "json" {
+		enc := json.NewEncoder(os.Stdout)
+		enc.SetIndent("", "  ")
+		return enc.Encode(r)
+	}
+	return r.Markdown(os.Stdout, q, now)
+}
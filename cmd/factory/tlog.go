@@ -0,0 +1,180 @@
+package main
+
+import (
+	"crypto/ecdsa"
+	"encoding/json"
+	"errors"
+	"flag"
+	"fmt"
+	"os"
+	"strconv"
+	"time"
+
+	"github.com/gillouche/container-factory/internal/config"
+	"github.com/gillouche/container-factory/internal/registry"
+	"github.com/gillouche/container-factory/internal/signing"
+	"github.com/gillouche/container-factory/internal/tlog"
+)
+
+const tlogUsage = "usage: factory tlog list|head|prove INDEX|check|promote IMAGE:TAG@DIGEST"
+
+func runTlog(args []string) error {
+	if len(args) == 0 {
+		return errors.New(tlogUsage)
+	}
+	fs := flag.NewFlagSet("tlog "+args[0], flag.ExitOnError)
+	fs.Parse(args[1:])
+
+	l, err := tlog.Open(tlogDir())
+	if err != nil {
+		return err
+	}
+	enc := json.NewEncoder(os.Stdout)
+	enc.SetIndent("", "  ")
+
+	switch args[0] {
+	case "list":
+		for i, e := range l.Entries() {
+			switch e.Kind {
+			case tlog.KindSignature:
+				fmt.Printf("%6d  %s  signature  %s@%s key %s\n", i, e.Time.Format(time.RFC3339), e.Repository, e.Digest, e.KeyID)
+			default:
+				fmt.Printf("%6d  %s  %-9s  %s:%s -> %s\n", i, e.Time.Format(time.RFC3339), e.Kind, e.Repository, e.Tag, e.Digest)
+			}
+		}
+		return nil
+
+	case "head":
+		h, err := l.Head()
+		if err != nil {
+			return err
+		}
+		return enc.Encode(h)
+
+	case "prove":
+		if fs.NArg() != 1 {
+			return errors.New("usage: factory tlog prove INDEX")
+		}
+		index, err := strconv.Atoi(fs.Arg(0))
+		if err != nil {
+			return fmt.Errorf("invalid index %q", fs.Arg(0))
+		}
+		h, err := l.Head()
+		if err != nil {
+			return err
+		}
+		p, err := l.Prove(index, h)
+		if err != nil {
+			return err
+		}
+		return enc.Encode(p)
+
+	case "check":
+		trusted, err := trustedKeys()
+		if err != nil {
+			return err
+		}
+		h, err := l.Head()
+		if err != nil {
+			return err
+		}
+		if err := h.Verify(trusted); err != nil {
+			return err
+		}
+		// Proving the last entry of the head recomputes the whole tree.
+		if h.Size > 0 {
+			if _, err := l.Prove(h.Size-1, h); err != nil {
+				return err
+			}
+		}
+		fmt.Printf("tree head of %d entries signed by %s on %s; %d entries not yet covered\n",
+			h.Size, h.KeyID, h.Time.Format(time.RFC3339), l.Size()-h.Size)
+		return nil
+
+	case "promote":
+		if fs.NArg() != 1 {
+			return errors.New("usage: factory tlog promote IMAGE:TAG@DIGEST")
+		}
+		ref, err := registry.ParseRef(fs.Arg(0))
+		if err != nil {
+			return err
+		}
+		if ref.Digest == "" {
+			return fmt.Errorf("%s: a promotion needs a digest", ref)
+		}
+		key, _, err := signingKey()
+		if err != nil {
+			return err
+		}
+		index, err := logEntry(key, tlog.Entry{Kind: tlog.KindPromotion, Repository: ref.Name(), Tag: ref.Tag, Digest: ref.Digest})
+		if err != nil {
+			return err
+		}
+		fmt.Fprintf(os.Stderr, "Logged promotion of %s:%s to %s as entry %d\n", ref.Name(), ref.Tag, ref.Digest, index)
+		return nil
+	}
+	return errors.New(tlogUsage)
+}
+
+// logEntry appends e to the transparency log and signs the new tree head.
+func logEntry(key *ecdsa.PrivateKey, e tlog.Entry) (int, error) {
+	l, err := tlog.Open(tlogDir())
+	if err != nil {
+		return 0, err
+	}
+	index, err := l.Append(e)
+	if err != nil {
+		return 0, err
+	}
+	if _, err := l.Sign(key); err != nil {
+		return 0, err
+	}
+	return index, nil
+}
+
+// resignHead signs the tree head again with the current key when it was
+// signed by the revoked key, which would otherwise fail every verification
+// until the next entry is logged.
+func resignHead(revoked string) error {
+	l, err := tlog.Open(tlogDir())
+	if err != nil {
+		return err
+	}
+	h, err := l.Head()
+	if os.IsNotExist(err) || err == nil && h.KeyID != revoked {
+		return nil
+	}
+	if err != nil {
+		return err
+	}
+	key, k, err := signingKey()
+	if err != nil {
+		return fmt.Errorf("the tree head is signed by the revoked key: %w", err)
+	}
+	if h, err = l.Sign(key); err != nil {
+		return err
+	}
+	fmt.Fprintf(os.Stderr, "Signed the tree head of %d entries again with key %s\n", h.Size, k.ID)
+	return nil
+}
+
+func trustedKeys() (*signing.TrustedKeys, error) {
+	cfg, err := config.Load("")
+	if err != nil {
+		return nil, err
+	}
+	return signing.LoadTrusted(cfg.TrustedKeys)
+}
+
+// signingKey returns the current signing key and its trusted entry.
+func signingKey() (*ecdsa.PrivateKey, signing.TrustedKey, error) {
+	trusted, err := trustedKeys()
+	if err != nil {
+		return nil, signing.TrustedKey{}, err
+	}
+	private, err := signing.LoadPrivate(keysDir())
+	if err != nil {
+		return nil, signing.TrustedKey{}, err
+	}
+	return trusted.Current(time.Now().UTC(), private)
+}
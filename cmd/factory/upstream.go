@@ -0,0 +1,55 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"flag"
+	"os"
+
+	"github.com/gillouche/container-factory/internal/github"
+	"github.com/gillouche/container-factory/internal/registry"
+	"github.com/gillouche/container-factory/internal/upstream"
+)
+
+// runUpstream looks for newer upstream versions of the variants listed in
+// the upstream config and prints them as a check-pinned-deps report. A
+// version is only proposed once every file its Dockerfile downloads can be
+// retrieved for each platform of the image; otherwise it is reported as an
+// artifact_unavailable warning, so a release whose assets (or their Nexus
+// proxy) lag behind does not produce a failing update PR.
+func runUpstream(args []string) error {
+	fs := flag.NewFlagSet("upstream", flag.ExitOnError)
+	cfgPath := fs.String("config", "ci/upstream_config.json", "upstream sources, keyed by VARIANTS file")
+	api := fs.String("github-api", "https://api.github.com", "GitHub API root")
+	skip := fs.Bool("skip-artifacts", false, "propose versions without checking their downloads")
+	fs.Parse(args)
+
+	cfg, cat, err := loadCatalog()
+	if err != nil {
+		return err
+	}
+	sources, err := upstream.LoadConfig(*cfgPath)
+	if err != nil {
+		return err
+	}
+
+	gh, err := githubClient(*api, github.ReadPublic)
+	if err != nil {
+		return err
+	}
+	reg := registry.New()
+	reg.HTTP = registryTransport().Client()
+	checker := &upstream.Checker{
+		GitHub:        gh,
+		Registry:      reg,
+		HTTP:          transport().Client(),
+		Login:         cfg.Secrets.Login,
+		SkipArtifacts: *skip,
+		Log:           os.Stderr,
+	}
+	report := checker.Check(context.Background(), sources, cat)
+
+	enc := json.NewEncoder(os.Stdout)
+	enc.SetIndent("", "  ")
+	return enc.Encode(report)
+}
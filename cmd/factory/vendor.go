@@ -0,0 +1,191 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"flag"
+	"fmt"
+	"os"
+	"strings"
+
+	"github.com/gillouche/container-factory/internal/catalog"
+	"github.com/gillouche/container-factory/internal/ledger"
+	"github.com/gillouche/container-factory/internal/registry"
+	"github.com/gillouche/container-factory/internal/vendoring"
+)
+
+const vendorUsage = "usage: factory vendor list|sync|contexts [flags]"
+
+// runVendor copies the external base digests of the current builds and of
+// every build in the ledger to the hosted vendor namespace ("vendor" in
+// ci/factory.json), and prints the build contexts that make a build use
+// those copies instead of the proxies.
+func runVendor(args []string) error {
+	if len(args) == 0 {
+		return errors.New(vendorUsage)
+	}
+	cfg, cat, err := loadCatalog()
+	if err != nil {
+		return err
+	}
+	l, err := ledger.Load(ledgerPath())
+	if err != nil {
+		return err
+	}
+	ctx := context.Background()
+	client := registry.New()
+
+	switch args[0] {
+	case "list", "sync":
+		fs := flag.NewFlagSet("vendor "+args[0], flag.ExitOnError)
+		sel := fs.String("select", "", "image selector (default: all images)")
+		fs.Parse(args[1:])
+		images, err := selectImages(cat, *sel)
+		if err != nil {
+			return err
+		}
+
+		failed := 0
+		for _, b := range collectBases(ctx, client, cat, images, l) {
+			var status string
+			if args[0] == "list" {
+				loc, err := vendoring.Location(cfg, b.Ref, b.Digest)
+				if err != nil {
+					return err
+				}
+				status = "vendored"
+				if d, err := client.Digest(ctx, loc); err != nil || d != b.Digest {
+					status = "missing"
+				}
+			} else {
+				_, copied, err := vendoring.Vendor(ctx, client, cfg, b)
+				switch {
+				case registry.IsNotFound(err):
+					// Deleted upstream before it was vendored; retrying
+					// will not bring it back.
+					status = "gone"
+				case err != nil:
+					fmt.Fprintf(os.Stderr, "  [warn] %s@%s: %v\n", b.Ref, short(b.Digest), err)
+					status = "failed"
+					failed++
+				case copied:
+					status = "copied"
+				default:
+					status = "present"
+				}
+			}
+			fmt.Printf("%-9s %s@%s  (%s)\n", status, b.Ref, short(b.Digest), strings.Join(b.Images, ", "))
+		}
+		if failed > 0 {
+			return fmt.Errorf("%d base digests could not be vendored", failed)
+		}
+		return nil
+
+	case "contexts":
+		fs := flag.NewFlagSet("vendor contexts", flag.ExitOnError)
+		revision := fs.String("revision", "", "use the bases recorded for this revision in the ledger instead of the current ones")
+		fs.Parse(args[1:])
+		if fs.NArg() != 2 {
+			return errors.New("usage: factory vendor contexts [-revision REV] IMAGE VARIANT")
+		}
+		img, ok := cat.Lookup(fs.Arg(0))
+		if !ok {
+			return fmt.Errorf("image %s not found", fs.Arg(0))
+		}
+		bases, err := buildBases(ctx, client, cat, img, fs.Arg(1), l, *revision)
+		if err != nil {
+			return err
+		}
+		for _, b := range bases {
+			loc, err := vendoring.Location(cfg, b.Ref, b.Digest)
+			if err != nil {
+				return err
+			}
+			if d, err := client.Digest(ctx, loc); err != nil || d != b.Digest {
+				fmt.Fprintf(os.Stderr, "  [warn] %s@%s is not vendored, building from the proxy\n", b.Ref, short(b.Digest))
+				continue
+			}
+			fmt.Println(vendoring.ContextFlag(b.Ref, loc, b.Digest))
+		}
+		return nil
+	}
+	return errors.New(vendorUsage)
+}
+
+// collectBases returns the external base digests the current variants of
+// images resolve to, plus those recorded by their builds in the ledger.
+func collectBases(ctx context.Context, client *registry.Client, cat *catalog.Catalog, images []catalog.Image, l *ledger.Ledger) []vendoring.Base {
+	var set vendoring.Set
+	selected := map[string]bool{}
+	for _, img := range images {
+		selected[img.Name] = true
+		for _, v := range img.Variants {
+			refs := externalRefs(cat, img.BaseRefs(v))
+			for ref, d := range resolveBases(ctx, client, refs) {
+				set.Add(ref, d, img.Name)
+			}
+		}
+	}
+	for _, r := range l.Records {
+		if !selected[r.Image] {
+			continue
+		}
+		for _, b := range r.Bases {
+			if _, internal := cat.Owner(b.Ref); !internal {
+				set.Add(b.Ref, b.Digest, r.Image)
+			}
+		}
+	}
+	return set.List()
+}
+
+// buildBases returns the external bases of one build of a variant: those
+// recorded in the ledger for revision, or the current digests of its FROM
+// references. A reference that no longer resolves falls back to the digest
+// of the last successful build, which is what vendoring is for.
+func buildBases(ctx context.Context, client *registry.Client, cat *catalog.Catalog, img catalog.Image, variant string, l *ledger.Ledger, revision string) ([]ledger.Base, error) {
+	var out []ledger.Base
+	if revision != "" {
+		h := l.History(img.Name, variant)
+		for i := len(h) - 1; i >= 0; i-- {
+			if h[i].Status != ledger.StatusSuccess || !strings.HasPrefix(h[i].Revision, revision) {
+				continue
+			}
+			for _, b := range h[i].Bases {
+				if _, internal := cat.Owner(b.Ref); !internal {
+					out = append(out, b)
+				}
+			}
+			return out, nil
+		}
+		return nil, fmt.Errorf("no successful build of %s:%s at revision %s in the ledger", img.Name, variant, revision)
+	}
+
+	refs := externalRefs(cat, img.BaseRefs(variant))
+	current := resolveBases(ctx, client, refs)
+	last, _ := l.LastSuccess(img.Name, variant)
+	for _, ref := range refs {
+		if d, ok := current[ref]; ok {
+			out = append(out, ledger.Base{Ref: ref, Digest: d})
+			continue
+		}
+		for _, b := range last.Bases {
+			if b.Ref == ref {
+				fmt.Fprintf(os.Stderr, "  [warn] using %s@%s from the last build\n", ref, short(b.Digest))
+				out = append(out, b)
+			}
+		}
+	}
+	return out, nil
+}
+
+// externalRefs drops the references to images of the catalog.
+func externalRefs(cat *catalog.Catalog, refs []string) []string {
+	var out []string
+	for _, ref := range refs {
+		if _, internal := cat.Owner(ref); !internal {
+			out = append(out, ref)
+		}
+	}
+	return out
+}
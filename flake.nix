@@ -25,6 +25,7 @@
             crane
             gh
             python3
+            go
           ];
 
           shellHook = ''
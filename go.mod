@@ -0,0 +1,3 @@
+module github.com/gillouche/container-factory
+
+go 1.25
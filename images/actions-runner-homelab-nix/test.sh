@@ -14,7 +14,7 @@ run_cmd() {
     docker run --rm --platform "linux/${PLATFORM}" --entrypoint /bin/bash "$LOCAL_TAG" -c "$@"
 }
 
-# Test: non-root user
+echo "[1/7] Verifying non-root user..."
 UID_OUTPUT=$(run_cmd "id -u")
 if [ "$UID_OUTPUT" = "0" ]; then
     echo "FAIL: container runs as root (uid=0)"
@@ -22,25 +22,24 @@ if [ "$UID_OUTPUT" = "0" ]; then
 fi
 echo "PASS: non-root user (uid=$UID_OUTPUT)"
 
-# Test: nix is available and works
+echo "[2/7] Verifying nix..."
 NIX_VER=$(run_cmd "nix --version")
 echo "PASS: nix available ($NIX_VER)"
 
-# Test: nix flakes work
+echo "[3/7] Verifying nix flakes..."
 # --impure is required to access builtins.currentSystem in pure eval mode
 SYSTEM=$(run_cmd "nix eval --impure --raw --expr 'builtins.currentSystem'")
 echo "PASS: nix flakes work (system=$SYSTEM)"
 
-# Test: git is available
+echo "[4/7] Verifying git..."
 GIT_VER=$(run_cmd "git --version")
 echo "PASS: git available ($GIT_VER)"
 
-# Test: curl is available
+echo "[5/7] Verifying curl..."
 CURL_VER=$(run_cmd "curl --version" | head -1)
 echo "PASS: curl available ($CURL_VER)"
 
-# Test: Nexus CA is trusted
-echo "Testing Nexus CA trust..."
+echo "[6/7] Verifying Nexus CA trust..."
 if run_cmd "curl -sI https://nexus.gillouche.homelab/"; then
     echo "PASS: Nexus CA is trusted"
 else
@@ -48,8 +47,7 @@ else
     exit 1
 fi
 
-# Test: Java truststore with Homelab Root CA exists
-echo "Testing Java truststore..."
+echo "[7/7] Verifying Java truststore..."
 if run_cmd "test -f /etc/ssl/certs/java/cacerts"; then
     echo "PASS: Java truststore exists at /etc/ssl/certs/java/cacerts"
 else
@@ -16,7 +16,7 @@ run_cmd() {
 }
 
 echo ""
-echo "[1/9] Verifying non-root user..."
+echo "[1/10] Verifying non-root user..."
 UID_OUTPUT=$(run_cmd "id -u")
 if [ "$UID_OUTPUT" = "0" ]; then
     echo "FAIL: Container runs as root (uid=0)"
@@ -25,7 +25,7 @@ fi
 echo "PASS: Non-root user (uid=$UID_OUTPUT)"
 
 echo ""
-echo "[2/9] Verifying docker group membership..."
+echo "[2/10] Verifying docker group membership..."
 GROUPS_OUTPUT=$(run_cmd "id -Gn")
 if [[ "$GROUPS_OUTPUT" != *"docker"* ]]; then
     echo "FAIL: User not in docker group"
@@ -34,7 +34,7 @@ fi
 echo "PASS: User in docker group ($GROUPS_OUTPUT)"
 
 echo ""
-echo "[3/9] Verifying GitHub Actions Runner binary..."
+echo "[3/10] Verifying GitHub Actions Runner binary..."
 RUNNER_VERSION=$(run_cmd "/home/runner/bin/Runner.Listener --version" 2>/dev/null || echo "FAILED")
 if [[ "$RUNNER_VERSION" != *"$VERSION"* ]]; then
     echo "FAIL: Runner version mismatch. Expected $VERSION, got: $RUNNER_VERSION"
@@ -43,7 +43,7 @@ fi
 echo "PASS: Runner version ($RUNNER_VERSION)"
 
 echo ""
-echo "[4/9] Verifying Runner.Listener starts correctly..."
+echo "[4/10] Verifying Runner.Listener starts correctly..."
 RUNNER_CHECK=$(run_cmd "timeout 5 /home/runner/bin/Runner.Listener --help 2>&1 | head -3" || true)
 if [[ -z "$RUNNER_CHECK" ]]; then
     echo "FAIL: Runner.Listener did not produce output"
@@ -52,7 +52,7 @@ fi
 echo "PASS: Runner.Listener responds to --help"
 
 echo ""
-echo "[5/9] Verifying runner-container-hooks (k8s)..."
+echo "[5/10] Verifying runner-container-hooks (k8s)..."
 if ! run_cmd "test -d /home/runner/k8s && ls /home/runner/k8s/*.js >/dev/null 2>&1"; then
     echo "FAIL: k8s container hooks not found"
     exit 1
@@ -0,0 +1,3 @@
+module github.com/gillouche/container-factory/images/go-distroless/selftest
+
+go 1.25
@@ -0,0 +1,241 @@
+// Package selftest checks, from inside a running container, the assumptions
+// an application built on go-distroless makes about its environment: it
+// runs as a non-root user, trusts the system CA bundle, can load time zones,
+// and finds its filesystem writable where it should be and read-only
+// elsewhere. These are the checks the factory's smoke test runs against
+// every go-distroless build.
+//
+// The first publish of a go-distroless variant of the form x.y.z tags the
+// module images/go-distroless/selftest/vx.y.z at the revision it was built
+// from (rebuilds keep that tag, other variants get none), so an application
+// pins the checks of the image it is built on:
+//
+//	func main() {
+//		selftest.Hook(selftest.Config{Writable: []string{"/data"}})
+//		...
+//	}
+//
+// Hook runs the checks and exits when the binary is started with
+// --self-test, e.g. as a Kubernetes startup probe or before a rollout;
+// SelfTest runs them from anywhere else.
+package selftest
+
+import (
+	"crypto/x509"
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"os/user"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// Flag is the command-line argument Hook answers.
+const Flag = "--self-test"
+
+// CertFiles are the CA bundles looked for when SSL_CERT_FILE is not set, in
+// order (Debian and distroless, then RHEL and Alpine layouts).
+var CertFiles = []string{
+	"/etc/ssl/certs/ca-certificates.crt",
+	"/etc/pki/tls/certs/ca-bundle.crt",
+	"/etc/ssl/cert.pem",
+}
+
+// Config tunes the checks. The zero value checks what go-distroless
+// provides.
+type Config struct {
+	// AllowRoot accepts running as uid 0.
+	AllowRoot bool
+	// CertFile is the CA bundle that must hold trusted roots; SSL_CERT_FILE
+	// or the first of CertFiles found by default.
+	CertFile string
+	// Timezones must load; $TZ (when set) and America/New_York by default,
+	// so the check needs the zoneinfo database and not only UTC.
+	Timezones []string
+	// Writable are the directories the application writes to; the
+	// temporary directory by default.
+	Writable []string
+	// ReadOnly are the paths the application must not be able to change;
+	// / by default, unless running as root.
+	ReadOnly []string
+}
+
+// Result is the outcome of one check.
+type Result struct {
+	Check string
+	// Detail describes what was found, on success as on failure.
+	Detail string
+	Err    error
+}
+
+// Report is the outcome of every check, in the order they ran.
+type Report []Result
+
+// Err joins the errors of the failed checks, nil when all passed.
+func (r Report) Err() error {
+	var errs []error
+	for _, res := range r {
+		if res.Err != nil {
+			errs = append(errs, fmt.Errorf("%s: %w", res.Check, res.Err))
+		}
+	}
+	return errors.Join(errs...)
+}
+
+// Write prints one line per check.
+func (r Report) Write(w io.Writer) error {
+	for _, res := range r {
+		status, detail := "ok", res.Detail
+		if res.Err != nil {
+			status, detail = "FAIL", res.Err.Error()
+		}
+		if _, err := fmt.Fprintf(w, "%-4s %-10s %s\n", status, res.Check, detail); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// Run runs every check.
+func Run(cfg Config) Report {
+	checks := []struct {
+		name string
+		run  func(Config) (string, error)
+	}{
+		{"non-root", nonRoot},
+		{"tls-trust", tlsTrust},
+		{"timezone", timezones},
+		{"filesystem", filesystem},
+	}
+	var r Report
+	for _, c := range checks {
+		detail, err := c.run(cfg)
+		r = append(r, Result{Check: c.name, Detail: detail, Err: err})
+	}
+	return r
+}
+
+// SelfTest runs every check and returns the errors of those that failed.
+func SelfTest(cfg Config) error {
+	return Run(cfg).Err()
+}
+
+// Hook runs the checks when Flag is the first argument of the program,
+// prints the report to stdout and exits, with status 1 if a check failed.
+// Otherwise it returns, so it goes first in main.
+func Hook(cfg Config) {
+	if len(os.Args) < 2 || os.Args[1] != Flag {
+		return
+	}
+	r := Run(cfg)
+	r.Write(os.Stdout)
+	if r.Err() != nil {
+		os.Exit(1)
+	}
+	os.Exit(0)
+}
+
+func nonRoot(cfg Config) (string, error) {
+	uid, euid := os.Getuid(), os.Geteuid()
+	if uid == -1 {
+		return "no user ids on this platform", nil
+	}
+	detail := "uid " + strconv.Itoa(uid)
+	if u, err := user.LookupId(strconv.Itoa(uid)); err == nil {
+		detail += " (" + u.Username + ")"
+	}
+	if (uid == 0 || euid == 0) && !cfg.AllowRoot {
+		return detail, fmt.Errorf("running as root (uid=%d, euid=%d)", uid, euid)
+	}
+	return detail, nil
+}
+
+func tlsTrust(cfg Config) (string, error) {
+	file := cfg.CertFile
+	if file == "" {
+		file = os.Getenv("SSL_CERT_FILE")
+	}
+	if file == "" {
+		for _, f := range CertFiles {
+			if _, err := os.Stat(f); err == nil {
+				file = f
+				break
+			}
+		}
+	}
+	if file == "" {
+		return "", errors.New("no CA bundle (" + strings.Join(CertFiles, ", ") + ")")
+	}
+	data, err := os.ReadFile(file)
+	if err != nil {
+		return "", err
+	}
+	pool := x509.NewCertPool()
+	if !pool.AppendCertsFromPEM(data) {
+		return "", fmt.Errorf("%s holds no certificates", file)
+	}
+	roots := strings.Count(string(data), "-----BEGIN CERTIFICATE-----")
+	return fmt.Sprintf("%d roots in %s", roots, file), nil
+}
+
+func timezones(cfg Config) (string, error) {
+	zones := cfg.Timezones
+	if len(zones) == 0 {
+		zones = []string{"America/New_York"}
+		if tz := os.Getenv("TZ"); tz != "" {
+			zones = append([]string{strings.TrimPrefix(tz, ":")}, zones...)
+		}
+	}
+	for _, z := range zones {
+		if _, err := time.LoadLocation(z); err != nil {
+			return "", err
+		}
+	}
+	return "loaded " + strings.Join(zones, ", "), nil
+}
+
+func filesystem(cfg Config) (string, error) {
+	writable := cfg.Writable
+	if len(writable) == 0 {
+		writable = []string{os.TempDir()}
+	}
+	readOnly := cfg.ReadOnly
+	if len(readOnly) == 0 && os.Geteuid() != 0 {
+		readOnly = []string{"/"}
+	}
+	for _, dir := range writable {
+		if err := probe(dir); err != nil {
+			return "", fmt.Errorf("%s is not writable: %w", dir, err)
+		}
+	}
+	for _, p := range readOnly {
+		if fi, err := os.Stat(p); err == nil && !fi.IsDir() {
+			f, err := os.OpenFile(p, os.O_WRONLY, 0)
+			if err == nil {
+				f.Close()
+				return "", fmt.Errorf("%s is writable", p)
+			}
+			continue
+		}
+		if probe(p) == nil {
+			return "", fmt.Errorf("%s is writable", p)
+		}
+	}
+	detail := "writable " + strings.Join(writable, ", ")
+	if len(readOnly) > 0 {
+		detail += ", read-only " + strings.Join(readOnly, ", ")
+	}
+	return detail, nil
+}
+
+// probe creates and removes a file in dir.
+func probe(dir string) error {
+	f, err := os.CreateTemp(dir, ".selftest-*")
+	if err != nil {
+		return err
+	}
+	f.Close()
+	return os.Remove(f.Name())
+}
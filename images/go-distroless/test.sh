@@ -6,8 +6,7 @@ EXPECTED_VERSION=$2
 
 echo "Running Go runtime smoke test against $LOCAL_TAG (expected Go ${EXPECTED_VERSION})..."
 
-# 1. Non-root check
-echo "Checking non-root user..."
+echo "[1/2] Verifying non-root user..."
 CONTAINER_USER=$(docker inspect --format='{{.Config.User}}' "$LOCAL_TAG")
 if [ "$CONTAINER_USER" = "nonroot" ]; then
     echo "Non-root check passed: User=$CONTAINER_USER"
@@ -16,8 +15,9 @@ else
     exit 1
 fi
 
-# 2. Compile externally & run in distroless (uses test Dockerfile to avoid DIND volume mount issues)
-echo "Checking Go binary execution in distroless..."
+# Compile externally & run in distroless (uses test Dockerfile to avoid DIND volume mount issues).
+# The fixture runs the selftest package: non-root, TLS trust, timezone and filesystem.
+echo "[2/2] Verifying Go binary execution in distroless..."
 TEST_TAG="test-go-distroless:${EXPECTED_VERSION}"
 docker buildx build \
     --load \
@@ -25,6 +25,7 @@ docker buildx build \
     --build-arg BASE_IMAGE="$LOCAL_TAG" \
     --build-arg VERSION="$EXPECTED_VERSION" \
     --tag "$TEST_TAG" \
+    --build-context selftest=images/go-distroless/selftest \
     --file tests/go/Dockerfile.test \
     tests/go
 
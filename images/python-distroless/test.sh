@@ -6,5 +6,24 @@ EXPECTED_VERSION=$2
 
 echo "Running Python smoke test against $LOCAL_TAG (expected Python ${EXPECTED_VERSION})..."
 
+echo "[1/3] Verifying non-root user..."
+CONTAINER_USER=$(docker inspect --format='{{.Config.User}}' "$LOCAL_TAG")
+if [ "$CONTAINER_USER" = "nonroot" ]; then
+    echo "PASS: User=$CONTAINER_USER"
+else
+    echo "FAIL: expected user 'nonroot', got '$CONTAINER_USER'"
+    exit 1
+fi
+
+echo "[2/3] Verifying Python version..."
+VERSION_OUTPUT=$(docker run --rm "$LOCAL_TAG" --version)
+if [ "$VERSION_OUTPUT" = "Python ${EXPECTED_VERSION}" ]; then
+    echo "PASS: $VERSION_OUTPUT"
+else
+    echo "FAIL: expected Python ${EXPECTED_VERSION}, got: $VERSION_OUTPUT"
+    exit 1
+fi
+
 # Pipe test script into the container to avoid DIND volume mount issues
+echo "[3/3] Verifying Python script execution..."
 cat tests/python/hello.py | docker run --rm -i -e "EXPECTED_VERSION=$EXPECTED_VERSION" "$LOCAL_TAG" -
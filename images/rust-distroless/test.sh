@@ -6,8 +6,7 @@ EXPECTED_VERSION=$2
 
 echo "Running Rust runtime smoke test against $LOCAL_TAG (expected Rust ${EXPECTED_VERSION})..."
 
-# 1. Non-root check
-echo "Checking non-root user..."
+echo "[1/2] Verifying non-root user..."
 CONTAINER_USER=$(docker inspect --format='{{.Config.User}}' "$LOCAL_TAG")
 if [ "$CONTAINER_USER" = "nonroot" ]; then
     echo "Non-root check passed: User=$CONTAINER_USER"
@@ -16,8 +15,8 @@ else
     exit 1
 fi
 
-# 2. Compile externally & run in distroless (uses test Dockerfile to avoid DIND volume mount issues)
-echo "Checking Rust binary execution in distroless..."
+# Compile externally & run in distroless (uses test Dockerfile to avoid DIND volume mount issues)
+echo "[2/2] Verifying Rust binary execution in distroless..."
 TEST_TAG="test-rust-distroless:${EXPECTED_VERSION}"
 docker buildx build \
     --load \
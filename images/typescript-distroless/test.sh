@@ -6,8 +6,7 @@ EXPECTED_VERSION=$2
 
 echo "Running Node.js smoke test against $LOCAL_TAG (expected Node ${EXPECTED_VERSION})..."
 
-# 1. Node version check
-echo "Checking node version..."
+echo "[1/3] Verifying node version..."
 VERSION_OUTPUT=$(docker run --rm "$LOCAL_TAG" --version)
 if echo "$VERSION_OUTPUT" | grep -q "v${EXPECTED_VERSION}"; then
     echo "Version check passed: $VERSION_OUTPUT"
@@ -16,8 +15,7 @@ else
     exit 1
 fi
 
-# 2. Non-root check
-echo "Checking non-root user..."
+echo "[2/3] Verifying non-root user..."
 CONTAINER_USER=$(docker inspect --format='{{.Config.User}}' "$LOCAL_TAG")
 if [ "$CONTAINER_USER" = "nonroot" ]; then
     echo "Non-root check passed: User=$CONTAINER_USER"
@@ -26,8 +24,8 @@ else
     exit 1
 fi
 
-# 3. Run JS file (uses test Dockerfile to avoid DIND volume mount issues)
-echo "Checking Node.js execution..."
+# Run JS file (uses test Dockerfile to avoid DIND volume mount issues)
+echo "[3/3] Verifying Node.js execution..."
 TEST_TAG="test-typescript-distroless:${EXPECTED_VERSION}"
 docker buildx build \
     --load \
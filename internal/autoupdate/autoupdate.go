@@ -0,0 +1,161 @@
+// Package autoupdate turns the updates of a check-pinned-deps report (from
+// `factory pins` and `factory upstream`) into a pull request. The branch is
+// rebuilt from the current base on every run and committed through the API,
+// so no checkout or push credentials are involved.
+package autoupdate
+
+import (
+	"context"
+	"fmt"
+	"io"
+	"strings"
+
+	"github.com/gillouche/container-factory/internal/github"
+)
+
+// Pull request defaults.
+const (
+	Branch = "auto-update/pinned-deps"
+	Base   = "main"
+	Title  = "update: pinned dependency digests/SHAs"
+)
+
+// Update is an entry of the report's updates, with the fields of every
+// update type.
+type Update struct {
+	File           string `json:"file"`
+	Type           string `json:"type"`
+	Action         string `json:"action"`
+	Tag            string `json:"tag"`
+	CurrentSHA     string `json:"current_sha"`
+	LatestSHA      string `json:"latest_sha"`
+	CurrentVersion string `json:"current_version"`
+	LatestVersion  string `json:"latest_version"`
+	RawRef         string `json:"raw_ref"`
+}
+
+// Report is the part of the report the pull request is made from.
+type Report struct {
+	Updates []Update `json:"updates"`
+}
+
+// Apply returns content with the updates applied. Updates of the same type
+// and reference are applied once; docker digest updates are ignored, digest
+// pinning is no longer enforced.
+func Apply(content string, updates []Update) string {
+	seen := map[[2]string]bool{}
+	for _, u := range updates {
+		key := [2]string{u.Type, u.RawRef}
+		if seen[key] {
+			continue
+		}
+		seen[key] = true
+		switch u.Type {
+		case "action_pinned":
+			content = strings.ReplaceAll(content, u.CurrentSHA, u.LatestSHA)
+		case "action_unpinned":
+			// action@ref becomes action@sha # ref.
+			content = strings.ReplaceAll(content, u.RawRef, u.Action+"@"+u.LatestSHA+" # "+u.Tag)
+		case "variant_update":
+			content = strings.ReplaceAll(content, u.CurrentVersion, u.LatestVersion)
+		}
+	}
+	return content
+}
+
+// Body is the description of the pull request.
+func Body(updates []Update) string {
+	lines := []string{"## Summary", "",
+		"Automated update of pinned dependency digests and/or SHAs detected by the nightly dependency checker.", "",
+		"### Updated dependencies", ""}
+	for _, u := range updates {
+		switch u.Type {
+		case "action_pinned":
+			lines = append(lines,
+				fmt.Sprintf("- **%s@%s** in `%s`", u.Action, u.Tag, u.File),
+				fmt.Sprintf("  - `%s` -> `%s`", short(u.CurrentSHA), short(u.LatestSHA)))
+		case "action_unpinned":
+			lines = append(lines,
+				fmt.Sprintf("- **%s@%s** in `%s` (Pinned)", u.Action, u.Tag, u.File),
+				fmt.Sprintf("  - `unpinned` -> `%s`", short(u.LatestSHA)))
+		case "variant_update":
+			lines = append(lines,
+				fmt.Sprintf("- **%s** (Version Update)", u.File),
+				fmt.Sprintf("  - `%s` -> `%s`", u.CurrentVersion, u.LatestVersion))
+		}
+	}
+	lines = append(lines, "", "## Test plan", "",
+		"- [ ] Verify updated digests/SHAs resolve correctly",
+		"- [ ] Confirm nightly build passes with updated dependencies",
+		"", "Generated by the nightly pinned dependency checker")
+	return strings.Join(lines, "\n")
+}
+
+func short(sha string) string {
+	if len(sha) > 12 {
+		return sha[:12]
+	}
+	return sha
+}
+
+// Propose commits the updates on top of Base of repo to Branch and opens a
+// pull request from it, or refreshes the description of the open one. It
+// returns nil when the updates change nothing. Progress goes to log.
+func Propose(ctx context.Context, gh *github.Client, repo string, updates []Update, log io.Writer) (*github.PullRequest, error) {
+	base, err := gh.Branch(ctx, repo, Base)
+	if err != nil {
+		return nil, err
+	}
+	fmt.Fprintf(log, "Applying updates on %s (%s)...\n", Base, short(base))
+
+	var order []string
+	byFile := map[string][]Update{}
+	for _, u := range updates {
+		if _, ok := byFile[u.File]; !ok {
+			order = append(order, u.File)
+		}
+		byFile[u.File] = append(byFile[u.File], u)
+	}
+	files := map[string][]byte{}
+	for _, path := range order {
+		data, err := gh.File(ctx, repo, path, base)
+		if github.IsNotFound(err) {
+			fmt.Fprintf(log, "  [warn] %s not found, skipping\n", path)
+			continue
+		}
+		if err != nil {
+			return nil, err
+		}
+		if updated := Apply(string(data), byFile[path]); updated != string(data) {
+			files[path] = []byte(updated)
+		}
+	}
+	if len(files) == 0 {
+		fmt.Fprintln(log, "No changes to commit.")
+		return nil, nil
+	}
+
+	commit, err := gh.CommitFiles(ctx, repo, base, Title, files)
+	if err != nil {
+		return nil, err
+	}
+	fmt.Fprintf(log, "Pushing %s (%s)...\n", Branch, short(commit))
+	if err := gh.SetBranch(ctx, repo, Branch, commit); err != nil {
+		return nil, err
+	}
+
+	body := Body(updates)
+	pr, err := gh.OpenPullRequest(ctx, repo, Branch, Base)
+	if err != nil {
+		return nil, err
+	}
+	if pr != nil {
+		fmt.Fprintf(log, "PR #%d already exists, updating its description.\n", pr.Number)
+		return pr, gh.EditPullRequest(ctx, repo, pr.Number, Title, body)
+	}
+	if pr, err = gh.CreatePullRequest(ctx, repo, Branch, Base, Title, body); err != nil {
+		return nil, err
+	}
+	fmt.Fprintf(log, "Created PR #%d\n", pr.Number)
+	return pr, nil
+}
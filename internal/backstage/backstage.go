@@ -0,0 +1,187 @@
+// Package backstage exports the images of the catalog as Backstage Resource
+// entities (catalog-info.yaml), so the developer portal lists every image
+// with its owner, the images it is built from, its source and registry
+// links, and tags flagging end of life and deprecation.
+package backstage
+
+import (
+	"fmt"
+	"net/url"
+	"os"
+	"path/filepath"
+	"regexp"
+	"slices"
+	"strings"
+	"time"
+
+	"github.com/gillouche/container-factory/internal/catalog"
+	"github.com/gillouche/container-factory/internal/config"
+	"github.com/gillouche/container-factory/internal/dockerfile"
+	"github.com/gillouche/container-factory/internal/eol"
+)
+
+// Type is the spec.type of the image resources.
+const Type = "container-image"
+
+// EOLHorizon is how close to its end of life a variant gets the eol-soon
+// tag.
+const EOLHorizon = 90 * 24 * time.Hour
+
+// Annotations of the factory on its entities.
+const (
+	AnnotationRepository = "container-factory/repository"
+	AnnotationVariants   = "container-factory/variants"
+	AnnotationMovedFrom  = "container-factory/moved-from"
+)
+
+// Entity is a Backstage Resource.
+type Entity struct {
+	Name        string
+	Title       string
+	Description string
+	Annotations map[string]string
+	Tags        []string
+	Links       []Link
+	Owner       string
+	System      string
+	DependsOn   []string
+}
+
+// Link is a metadata link of an entity.
+type Link struct {
+	URL   string
+	Title string
+	Icon  string
+}
+
+// Input is what the entities are made from.
+type Input struct {
+	Config     *config.Config
+	Catalog    *catalog.Catalog
+	Codeowners Codeowners
+	EOL        eol.Table
+	Now        time.Time
+}
+
+// Entities returns one Resource per image of the catalog, sorted by name.
+func Entities(in Input) ([]Entity, error) {
+	bs := in.Config.Backstage
+	deps := in.Catalog.Deps()
+	var out []Entity
+	for _, img := range in.Catalog.Images {
+		e := Entity{
+			Name:   img.Name,
+			System: bs.System,
+			Annotations: map[string]string{
+				AnnotationRepository: img.Repository,
+				AnnotationVariants:   strings.Join(img.Variants, ", "),
+			},
+		}
+		if img.Previous != "" && img.DualPublish(in.Now) {
+			e.Annotations[AnnotationMovedFrom] = img.Previous
+		}
+
+		owners := in.Codeowners.Owners(filepath.ToSlash(filepath.Join(img.Dir, "Dockerfile")))
+		switch {
+		case len(owners) > 0:
+			e.Owner = EntityRef(owners[0])
+		case bs.Owner != "":
+			e.Owner = bs.Owner
+		default:
+			return nil, fmt.Errorf("%s: no CODEOWNERS rule and no backstage owner configured", img.Name)
+		}
+
+		for _, d := range deps[img.Name] {
+			e.DependsOn = append(e.DependsOn, "resource:"+d)
+		}
+
+		title, desc, err := describe(img)
+		if err != nil {
+			return nil, err
+		}
+		e.Title, e.Description = title, desc
+
+		if bs.SourceURL != "" {
+			src := expand(bs.SourceURL, in.Config, img)
+			e.Links = append(e.Links, Link{URL: src, Title: "Source", Icon: "github"})
+			e.Annotations["backstage.io/source-location"] = "url:" + strings.TrimSuffix(src, "/") + "/"
+		}
+		if bs.RegistryURL != "" {
+			e.Links = append(e.Links, Link{URL: expand(bs.RegistryURL, in.Config, img), Title: "Registry", Icon: "dashboard"})
+		}
+
+		e.Tags = tags(img, in.EOL, in.Now)
+		out = append(out, e)
+	}
+	return out, nil
+}
+
+func expand(tmpl string, cfg *config.Config, img catalog.Image) string {
+	path := strings.TrimPrefix(img.Repository, cfg.Registry+"/")
+	path = strings.TrimPrefix(path, cfg.Namespace+"/")
+	return strings.NewReplacer(
+		"{dir}", filepath.ToSlash(img.Dir),
+		"{registry}", cfg.Registry,
+		"{namespace}", cfg.Namespace,
+		"{repository}", img.Repository,
+		"{path}", url.PathEscape(path),
+	).Replace(tmpl)
+}
+
+var descriptionLabel = regexp.MustCompile(`org\.opencontainers\.image\.description=("([^"]*)"|(\S+))`)
+
+// describe returns the title and description of an image: the OCI
+// description label of its Dockerfile, when it has one.
+func describe(img catalog.Image) (title, desc string, err error) {
+	ins, err := dockerfile.Parse(filepath.Join(img.Dir, "Dockerfile"))
+	if err != nil && !os.IsNotExist(err) {
+		return "", "", err
+	}
+	for _, in := range ins {
+		if in.Cmd != "LABEL" {
+			continue
+		}
+		if m := descriptionLabel.FindStringSubmatch(in.Args); m != nil {
+			title = m[2] + m[3]
+		}
+	}
+	if title == "" {
+		return img.Name, "", nil
+	}
+	return title, fmt.Sprintf("%s, published as %s (%s).", title, img.Repository, strings.Join(img.Platforms, ", ")), nil
+}
+
+var tagInvalid = regexp.MustCompile(`[^a-z0-9+#]+`)
+
+// tags are the label values of the image (family, base, runtime) plus the
+// lifecycle tags: eol-soon and eol when a variant is close to or past its
+// end of life, deprecated when all of them are past it, and moving while
+// the image is dual-published to a new repository.
+func tags(img catalog.Image, eols eol.Table, now time.Time) []string {
+	var out []string
+	for _, key := range []string{"family", "base", "runtime"} {
+		if v := img.Labels[key]; v != "" {
+			out = append(out, strings.Trim(tagInvalid.ReplaceAllString(strings.ToLower(v), "-"), "-"))
+		}
+	}
+	past := 0
+	for _, v := range img.Variants {
+		date, ok := eols.Lookup(img.Name, v)
+		switch {
+		case !ok:
+		case !now.Before(date):
+			past++
+			out = append(out, "eol")
+		case date.Sub(now) <= EOLHorizon:
+			out = append(out, "eol-soon")
+		}
+	}
+	if past > 0 && past == len(img.Variants) {
+		out = append(out, "deprecated")
+	}
+	if img.DualPublish(now) {
+		out = append(out, "moving")
+	}
+	slices.Sort(out)
+	return slices.Compact(out)
+}
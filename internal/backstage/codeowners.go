@@ -0,0 +1,124 @@
+package backstage
+
+import (
+	"bufio"
+	"os"
+	"regexp"
+	"strings"
+)
+
+// CodeownersPaths are where GitHub looks for the CODEOWNERS file, in order.
+var CodeownersPaths = []string{".github/CODEOWNERS", "CODEOWNERS", "docs/CODEOWNERS"}
+
+type rule struct {
+	pattern *regexp.Regexp
+	// anchored patterns match from the repository root, others match any
+	// path component.
+	anchored bool
+	dirOnly  bool
+	owners   []string
+}
+
+// Codeowners are the rules of a CODEOWNERS file.
+type Codeowners []rule
+
+// LoadCodeowners reads the first CODEOWNERS file found below root. No file
+// means no rules.
+func LoadCodeowners(root string) (Codeowners, error) {
+	for _, p := range CodeownersPaths {
+		f, err := os.Open(root + "/" + p)
+		if os.IsNotExist(err) {
+			continue
+		}
+		if err != nil {
+			return nil, err
+		}
+		defer f.Close()
+		var c Codeowners
+		sc := bufio.NewScanner(f)
+		for sc.Scan() {
+			line, _, _ := strings.Cut(sc.Text(), "#")
+			fields := strings.Fields(line)
+			if len(fields) == 0 {
+				continue
+			}
+			c = append(c, parseRule(fields[0], fields[1:]))
+		}
+		return c, sc.Err()
+	}
+	return nil, nil
+}
+
+func parseRule(pattern string, owners []string) rule {
+	r := rule{owners: owners, dirOnly: strings.HasSuffix(pattern, "/")}
+	trimmed := strings.Trim(pattern, "/")
+	r.anchored = strings.HasPrefix(pattern, "/") || strings.Contains(trimmed, "/")
+	r.pattern = regexp.MustCompile("^" + globRegexp(trimmed) + "$")
+	return r
+}
+
+// globRegexp translates a gitignore-style glob: * and ? stay within a path
+// component, ** spans components.
+func globRegexp(glob string) string {
+	var b strings.Builder
+	for i := 0; i < len(glob); i++ {
+		switch {
+		case strings.HasPrefix(glob[i:], "**/"):
+			b.WriteString("(.*/)?")
+			i += 2
+		case strings.HasPrefix(glob[i:], "**"):
+			b.WriteString(".*")
+			i++
+		case glob[i] == '*':
+			b.WriteString("[^/]*")
+		case glob[i] == '?':
+			b.WriteString("[^/]")
+		default:
+			b.WriteString(regexp.QuoteMeta(glob[i : i+1]))
+		}
+	}
+	return b.String()
+}
+
+// Owners returns the owners of file (relative to the repository root): those
+// of the last rule matching it or one of its directories.
+func (c Codeowners) Owners(file string) []string {
+	parts := strings.Split(strings.Trim(file, "/"), "/")
+	var owners []string
+	for _, r := range c {
+		if r.matches(parts) {
+			owners = r.owners
+		}
+	}
+	return owners
+}
+
+func (r rule) matches(parts []string) bool {
+	for i := 1; i <= len(parts); i++ {
+		if r.dirOnly && i == len(parts) {
+			break
+		}
+		subject := parts[i-1]
+		if r.anchored {
+			subject = strings.Join(parts[:i], "/")
+		}
+		if r.pattern.MatchString(subject) {
+			return true
+		}
+	}
+	return false
+}
+
+// EntityRef turns a CODEOWNERS owner into a Backstage entity reference:
+// @user is a user, @org/team a group, and an email address the user named
+// by its local part.
+func EntityRef(owner string) string {
+	if name, ok := strings.CutPrefix(owner, "@"); ok {
+		if _, team, ok := strings.Cut(name, "/"); ok {
+			return "group:" + team
+		}
+		return "user:" + name
+	}
+	local, _, _ := strings.Cut(owner, "@")
+	return "user:" + local
+}
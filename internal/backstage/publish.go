@@ -0,0 +1,40 @@
+package backstage
+
+import (
+	"bytes"
+	"context"
+
+	"github.com/gillouche/container-factory/internal/github"
+)
+
+// File is the path of the entities on the publish branch, which Backstage
+// registers as a catalog location.
+const File = "catalog-info.yaml"
+
+// Publish commits data as File to branch of repo, unless it is already
+// there, and returns the new commit ("" when unchanged). The branch holds
+// nothing else: it starts with a root commit rather than from the default
+// branch. Entities of images that were removed disappear from the file, and
+// Backstage drops them as orphans.
+func Publish(ctx context.Context, gh *github.Client, repo, branch string, data []byte) (string, error) {
+	head, err := gh.Branch(ctx, repo, branch)
+	switch {
+	case github.IsNotFound(err):
+		head = ""
+	case err != nil:
+		return "", err
+	default:
+		current, err := gh.File(ctx, repo, File, head)
+		if err != nil && !github.IsNotFound(err) {
+			return "", err
+		}
+		if bytes.Equal(current, data) {
+			return "", nil
+		}
+	}
+	commit, err := gh.CommitFiles(ctx, repo, head, "backstage: update image entities", map[string][]byte{File: data})
+	if err != nil {
+		return "", err
+	}
+	return commit, gh.SetBranch(ctx, repo, branch, commit)
+}
@@ -0,0 +1,88 @@
+package backstage
+
+import (
+	"encoding/json"
+	"fmt"
+	"io"
+	"regexp"
+	"slices"
+	"strings"
+)
+
+// Header starts the generated file.
+const Header = "# Generated by `factory backstage`; do not edit.\n"
+
+// Encode writes the entities as a multi-document catalog-info.yaml.
+func Encode(w io.Writer, entities []Entity) error {
+	var b strings.Builder
+	b.WriteString(Header)
+	for _, e := range entities {
+		b.WriteString("---\n")
+		b.WriteString("apiVersion: backstage.io/v1alpha1\n")
+		b.WriteString("kind: Resource\n")
+		b.WriteString("metadata:\n")
+		fmt.Fprintf(&b, "  name: %s\n", scalar(e.Name))
+		fmt.Fprintf(&b, "  title: %s\n", scalar(e.Title))
+		if e.Description != "" {
+			fmt.Fprintf(&b, "  description: %s\n", scalar(e.Description))
+		}
+		if len(e.Annotations) > 0 {
+			b.WriteString("  annotations:\n")
+			keys := make([]string, 0, len(e.Annotations))
+			for k := range e.Annotations {
+				keys = append(keys, k)
+			}
+			slices.Sort(keys)
+			for _, k := range keys {
+				fmt.Fprintf(&b, "    %s: %s\n", k, scalar(e.Annotations[k]))
+			}
+		}
+		list(&b, "  ", "tags", e.Tags)
+		if len(e.Links) > 0 {
+			b.WriteString("  links:\n")
+			for _, l := range e.Links {
+				fmt.Fprintf(&b, "    - url: %s\n", scalar(l.URL))
+				fmt.Fprintf(&b, "      title: %s\n", scalar(l.Title))
+				if l.Icon != "" {
+					fmt.Fprintf(&b, "      icon: %s\n", scalar(l.Icon))
+				}
+			}
+		}
+		b.WriteString("spec:\n")
+		fmt.Fprintf(&b, "  type: %s\n", Type)
+		fmt.Fprintf(&b, "  owner: %s\n", scalar(e.Owner))
+		if e.System != "" {
+			fmt.Fprintf(&b, "  system: %s\n", scalar(e.System))
+		}
+		list(&b, "  ", "dependsOn", e.DependsOn)
+	}
+	_, err := io.WriteString(w, b.String())
+	return err
+}
+
+func list(b *strings.Builder, indent, key string, items []string) {
+	if len(items) == 0 {
+		return
+	}
+	fmt.Fprintf(b, "%s%s:\n", indent, key)
+	for _, item := range items {
+		fmt.Fprintf(b, "%s  - %s\n", indent, scalar(item))
+	}
+}
+
+var (
+	plain = regexp.MustCompile(`^[A-Za-z0-9][A-Za-z0-9 ._/:@+,()-]*$`)
+	// Plain scalars YAML would read as something other than a string.
+	special = regexp.MustCompile(`(?i)^(true|false|yes|no|on|off|null|~|[-+]?[0-9][0-9._:eE+-]*)$`)
+)
+
+// scalar returns s as a YAML scalar, double-quoted (JSON strings are valid
+// YAML) unless it reads back as the same string unquoted.
+func scalar(s string) string {
+	if plain.MatchString(s) && !special.MatchString(s) &&
+		!strings.Contains(s, ": ") && !strings.HasSuffix(s, ":") && !strings.HasSuffix(s, " ") {
+		return s
+	}
+	q, _ := json.Marshal(s)
+	return string(q)
+}
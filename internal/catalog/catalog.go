@@ -0,0 +1,342 @@
+// Package catalog discovers the images defined in the repository tree.
+//
+// An image is a directory containing a Dockerfile below one of the configured
+// image roots, plus the convention files read by ci/build.sh: VARIANTS (or
+// the legacy VERSION), PLATFORMS and an optional test.sh smoke test.
+package catalog
+
+import (
+	"bufio"
+	"fmt"
+	"os"
+	"path/filepath"
+	"regexp"
+	"sort"
+	"strings"
+	"time"
+
+	"github.com/gillouche/container-factory/internal/config"
+)
+
+// DefaultPlatforms mirrors the fallback used by ci/build.sh when an image has
+// no PLATFORMS file.
+var DefaultPlatforms = []string{"linux/amd64", "linux/arm64"}
+
+// Stage is a single FROM instruction of a Dockerfile.
+type Stage struct {
+	Ref   string
+	Alias string
+}
+
+// Secret is a BuildKit secret mount (RUN --mount=type=secret) of a
+// Dockerfile.
+type Secret struct {
+	ID       string
+	Required bool
+}
+
+// Image describes one buildable image directory.
+type Image struct {
+	Name string
+	Dir  string
+	// Root is the image root directory the image was found in.
+	Root string
+	// Repository and Cache are where the image and its build cache are
+	// pushed, without tag.
+	Repository string
+	Cache      string
+	// Previous is the repository the image is migrating away from, where
+	// builds keep publishing until PreviousUntil.
+	Previous      string
+	PreviousUntil time.Time
+	Variants      []string
+	Platforms     []string
+	// Labels are the LABELS entries, plus root set to the image root.
+	Labels map[string]string
+	Stages []Stage
+	// Args holds the defaults of ARG instructions declared before the first
+	// FROM, which are the only ones visible to FROM references.
+	Args map[string]string
+	// Secrets are the secret mounts used by RUN instructions, by ID.
+	Secrets   []Secret
+	SmokeTest string
+}
+
+// Catalog is every image of the configured roots, sorted by name.
+type Catalog struct {
+	Images []Image
+}
+
+// Scan discovers the images of every root in cfg. Directories without a
+// Dockerfile are ignored; image names must be unique across roots.
+func Scan(cfg *config.Config) (*Catalog, error) {
+	c := &Catalog{}
+	seen := map[string]string{}
+	for _, root := range cfg.Roots {
+		entries, err := os.ReadDir(root.Dir)
+		if err != nil {
+			return nil, fmt.Errorf("image root: %w", err)
+		}
+		for _, e := range entries {
+			dir := filepath.Join(root.Dir, e.Name())
+			if !e.IsDir() {
+				continue
+			}
+			if _, err := os.Stat(filepath.Join(dir, "Dockerfile")); err != nil {
+				continue
+			}
+			if other, ok := seen[e.Name()]; ok {
+				return nil, fmt.Errorf("image %s defined in both %s and %s", e.Name(), other, dir)
+			}
+			seen[e.Name()] = dir
+
+			img, err := Load(dir)
+			if err != nil {
+				return nil, err
+			}
+			img.Root = root.Dir
+			if _, ok := img.Labels["root"]; !ok {
+				img.Labels["root"] = filepath.Base(root.Dir)
+			}
+			img.Repository = cfg.ImageRepo(root, img.Name)
+			img.Cache = cfg.CacheRepo(root, img.Name)
+			if m, ok := cfg.Migration(img.Name); ok {
+				img.Previous, img.Repository = img.Repository, cfg.MigrationRepo(m, root)
+				img.PreviousUntil = m.UntilTime()
+			}
+			c.Images = append(c.Images, img)
+		}
+	}
+	sort.Slice(c.Images, func(i, j int) bool { return c.Images[i].Name < c.Images[j].Name })
+	return c, nil
+}
+
+// Lookup returns the image called name.
+func (c *Catalog) Lookup(name string) (Image, bool) {
+	for _, img := range c.Images {
+		if img.Name == name {
+			return img, true
+		}
+	}
+	return Image{}, false
+}
+
+// Load reads a single image directory.
+func Load(dir string) (Image, error) {
+	img := Image{
+		Name:   filepath.Base(dir),
+		Dir:    dir,
+		Args:   map[string]string{},
+		Labels: map[string]string{},
+	}
+
+	variants, err := readWords(filepath.Join(dir, "VARIANTS"))
+	if os.IsNotExist(err) {
+		variants, err = readWords(filepath.Join(dir, "VERSION"))
+	}
+	if err != nil && !os.IsNotExist(err) {
+		return img, err
+	}
+	img.Variants = variants
+
+	platforms, err := readWords(filepath.Join(dir, "PLATFORMS"))
+	if err != nil && !os.IsNotExist(err) {
+		return img, err
+	}
+	if len(platforms) == 0 {
+		platforms = DefaultPlatforms
+	}
+	img.Platforms = platforms
+
+	if err := img.parseLabels(filepath.Join(dir, "LABELS")); err != nil && !os.IsNotExist(err) {
+		return img, err
+	}
+
+	if err := img.parseDockerfile(filepath.Join(dir, "Dockerfile")); err != nil && !os.IsNotExist(err) {
+		return img, err
+	}
+
+	if _, err := os.Stat(filepath.Join(dir, "test.sh")); err == nil {
+		img.SmokeTest = filepath.Join(dir, "test.sh")
+	}
+	return img, nil
+}
+
+// DualPublish reports whether builds still publish to the Previous
+// repository at now.
+func (img Image) DualPublish(now time.Time) bool {
+	return img.Previous != "" && now.Before(img.PreviousUntil)
+}
+
+// BaseRefs returns the external images the Dockerfile builds FROM for the
+// given variant, with build args expanded. Stage aliases and scratch are
+// skipped.
+func (img Image) BaseRefs(variant string) []string {
+	aliases := map[string]bool{}
+	seen := map[string]bool{}
+	var refs []string
+	for _, st := range img.Stages {
+		ref := img.Expand(st.Ref, variant)
+		external := ref != "scratch" && !aliases[strings.ToLower(ref)] && !seen[ref]
+		if st.Alias != "" {
+			aliases[strings.ToLower(st.Alias)] = true
+		}
+		if !external {
+			continue
+		}
+		seen[ref] = true
+		refs = append(refs, ref)
+	}
+	return refs
+}
+
+// Expand substitutes ${VAR} and $VAR references using the global ARG
+// defaults, with VERSION set to the variant as ci/build.sh does.
+func (img Image) Expand(s, variant string) string {
+	return os.Expand(s, func(name string) string {
+		if name == "VERSION" && variant != "" {
+			return variant
+		}
+		return img.Args[name]
+	})
+}
+
+// checkMarker matches the ways smoke tests announce a check: numbered
+// progress lines (echo "[3/9] ...") or numbered comments (# 2. ...).
+var checkMarker = regexp.MustCompile(`^\s*(echo\s+"\[\d+/\d+\]|#\s*\d+\.\s)`)
+
+// SmokeChecks counts the individual checks in the image's test.sh.
+func (img Image) SmokeChecks() (int, error) {
+	if img.SmokeTest == "" {
+		return 0, nil
+	}
+	f, err := os.Open(img.SmokeTest)
+	if err != nil {
+		return 0, err
+	}
+	defer f.Close()
+
+	n := 0
+	sc := bufio.NewScanner(f)
+	for sc.Scan() {
+		if checkMarker.MatchString(sc.Text()) {
+			n++
+		}
+	}
+	if n == 0 {
+		// A test.sh without numbered checks still exercises the image once.
+		n = 1
+	}
+	return n, sc.Err()
+}
+
+func (img *Image) parseDockerfile(path string) error {
+	f, err := os.Open(path)
+	if err != nil {
+		return err
+	}
+	defer f.Close()
+
+	sc := bufio.NewScanner(f)
+	for sc.Scan() {
+		fields := strings.Fields(sc.Text())
+		if len(fields) < 2 {
+			continue
+		}
+		switch strings.ToUpper(fields[0]) {
+		case "ARG":
+			// Only ARGs before the first FROM are in scope for FROM lines.
+			if len(img.Stages) > 0 {
+				continue
+			}
+			name, value, _ := strings.Cut(fields[1], "=")
+			img.Args[name] = strings.Trim(value, `"'`)
+		case "FROM":
+			args := fields[1:]
+			for len(args) > 0 && strings.HasPrefix(args[0], "--") {
+				args = args[1:]
+			}
+			if len(args) == 0 {
+				return fmt.Errorf("%s: FROM without image", path)
+			}
+			st := Stage{Ref: args[0]}
+			if len(args) >= 3 && strings.EqualFold(args[1], "AS") {
+				st.Alias = args[2]
+			}
+			img.Stages = append(img.Stages, st)
+		case "RUN":
+			for _, arg := range fields[1:] {
+				opts, ok := strings.CutPrefix(arg, "--mount=")
+				if !ok {
+					break
+				}
+				if s, ok := secretMount(opts); ok {
+					img.addSecret(s)
+				}
+			}
+		}
+	}
+	return sc.Err()
+}
+
+// secretMount parses the options of a --mount flag. A secret without id
+// defaults to the basename of its target, as in BuildKit.
+func secretMount(opts string) (Secret, bool) {
+	var s Secret
+	secret := false
+	for _, opt := range strings.Split(opts, ",") {
+		key, value, _ := strings.Cut(opt, "=")
+		switch key {
+		case "type":
+			secret = value == "secret"
+		case "id":
+			s.ID = value
+		case "target", "dst", "destination":
+			if s.ID == "" {
+				s.ID = filepath.Base(value)
+			}
+		case "required":
+			s.Required = value == "" || value == "true"
+		}
+	}
+	return s, secret && s.ID != ""
+}
+
+// addSecret records a mount; a secret required by any RUN is required.
+func (img *Image) addSecret(s Secret) {
+	for i := range img.Secrets {
+		if img.Secrets[i].ID == s.ID {
+			img.Secrets[i].Required = img.Secrets[i].Required || s.Required
+			return
+		}
+	}
+	img.Secrets = append(img.Secrets, s)
+}
+
+// parseLabels reads key=value lines; blank lines and # comments are skipped.
+func (img *Image) parseLabels(path string) error {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return err
+	}
+	for i, line := range strings.Split(string(data), "\n") {
+		line = strings.TrimSpace(line)
+		if line == "" || strings.HasPrefix(line, "#") {
+			continue
+		}
+		key, value, ok := strings.Cut(line, "=")
+		if !ok || strings.TrimSpace(key) == "" {
+			return fmt.Errorf("%s:%d: expected key=value", path, i+1)
+		}
+		img.Labels[strings.TrimSpace(key)] = strings.TrimSpace(value)
+	}
+	return nil
+}
+
+func readWords(path string) ([]string, error) {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return nil, err
+	}
+	return strings.Fields(string(data)), nil
+}
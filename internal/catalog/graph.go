@@ -0,0 +1,112 @@
+package catalog
+
+import (
+	"fmt"
+	"sort"
+	"strings"
+)
+
+// Owner returns the image whose repository ref (tag and digest stripped)
+// is, either the one it is published to or the one it is migrating away
+// from.
+func (c *Catalog) Owner(ref string) (string, bool) {
+	repo := repository(ref)
+	for _, img := range c.Images {
+		if img.Repository == repo || (img.Previous != "" && img.Previous == repo) {
+			return img.Name, true
+		}
+	}
+	return "", false
+}
+
+// Deps returns, for every image, the other images of the catalog it is built
+// FROM: those owning the repository of a FROM reference.
+func (c *Catalog) Deps() map[string][]string {
+	deps := map[string][]string{}
+	for _, img := range c.Images {
+		set := map[string]bool{}
+		for _, st := range img.Stages {
+			if name, ok := c.Owner(img.Expand(st.Ref, "")); ok && name != img.Name {
+				set[name] = true
+			}
+		}
+		deps[img.Name] = sortedKeys(set)
+	}
+	return deps
+}
+
+// Dependents inverts Deps: for every image, the images built FROM it.
+func (c *Catalog) Dependents() map[string][]string {
+	sets := map[string]map[string]bool{}
+	for img, ds := range c.Deps() {
+		for _, d := range ds {
+			if sets[d] == nil {
+				sets[d] = map[string]bool{}
+			}
+			sets[d][img] = true
+		}
+	}
+	out := map[string][]string{}
+	for _, img := range c.Images {
+		out[img.Name] = sortedKeys(sets[img.Name])
+	}
+	return out
+}
+
+// Levels assigns build levels by topological sort: level 1 images have no
+// internal dependencies, level N images only depend on levels below N.
+func Levels(deps map[string][]string) (map[string]int, error) {
+	levels := map[string]int{}
+	for level := 1; len(levels) < len(deps); level++ {
+		var ready []string
+		for img, ds := range deps {
+			if _, done := levels[img]; done {
+				continue
+			}
+			ok := true
+			for _, d := range ds {
+				if _, done := levels[d]; !done {
+					ok = false
+					break
+				}
+			}
+			if ok {
+				ready = append(ready, img)
+			}
+		}
+		if len(ready) == 0 {
+			var unresolved []string
+			for img, ds := range deps {
+				if _, done := levels[img]; !done {
+					unresolved = append(unresolved, fmt.Sprintf("%s -> %v", img, ds))
+				}
+			}
+			sort.Strings(unresolved)
+			return nil, fmt.Errorf("circular or unresolvable dependencies: %s", strings.Join(unresolved, "; "))
+		}
+		for _, img := range ready {
+			levels[img] = level
+		}
+	}
+	return levels, nil
+}
+
+// repository strips the tag and digest from an image reference.
+func repository(ref string) string {
+	if i := strings.Index(ref, "@"); i >= 0 {
+		ref = ref[:i]
+	}
+	if i := strings.LastIndex(ref, ":"); i > strings.LastIndex(ref, "/") {
+		ref = ref[:i]
+	}
+	return ref
+}
+
+func sortedKeys(set map[string]bool) []string {
+	out := make([]string, 0, len(set))
+	for k := range set {
+		out = append(out, k)
+	}
+	sort.Strings(out)
+	return out
+}
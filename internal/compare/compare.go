@@ -0,0 +1,271 @@
+// Package compare measures factory images against the upstream images they
+// take their runtime from (the "donor" stage of their Dockerfile, e.g.
+// python:3.13-slim-trixie): size, package count, vulnerabilities, and the
+// shells and package managers left in the image. A factory image is
+// expected to win on every count; where it does not, the comparison lists a
+// regression.
+package compare
+
+import (
+	"archive/tar"
+	"context"
+	"fmt"
+	"io"
+	"path"
+	"slices"
+	"sort"
+	"strings"
+
+	"github.com/gillouche/container-factory/internal/catalog"
+	"github.com/gillouche/container-factory/internal/registry"
+	"github.com/gillouche/container-factory/internal/vuln"
+)
+
+// DonorStage is the alias of the Dockerfile stage an image is compared to.
+const DonorStage = "donor"
+
+// Executables looked for in the bin directories of an image.
+var (
+	Shells          = []string{"ash", "bash", "busybox", "dash", "ksh", "sh", "zsh"}
+	PackageManagers = []string{
+		"apk", "apt", "apt-get", "dnf", "dpkg", "microdnf", "rpm", "yum",
+		"cargo", "corepack", "gem", "npm", "pip", "pip3", "yarn",
+	}
+)
+
+var binDirs = []string{"bin", "sbin", "usr/bin", "usr/sbin", "usr/local/bin", "usr/local/sbin"}
+
+// Donor returns the reference of the donor stage of variant, or "" when
+// the image has none.
+func Donor(img catalog.Image, variant string) string {
+	for _, st := range img.Stages {
+		if strings.EqualFold(st.Alias, DonorStage) {
+			return img.Expand(st.Ref, variant)
+		}
+	}
+	return ""
+}
+
+// Facts are the measurements of one image for one platform.
+type Facts struct {
+	Ref string `json:"ref"`
+	// Digest is the digest of the platform's image manifest.
+	Digest string `json:"digest"`
+	// Size is the compressed size of the layers, what a pull downloads.
+	Size int64 `json:"size"`
+	// Unpacked is the size of the files of every layer.
+	Unpacked        int64    `json:"unpacked"`
+	Shells          []string `json:"shells"`
+	PackageManagers []string `json:"package_managers"`
+	// Scanned tells whether Packages and Vulnerabilities are known.
+	Scanned         bool           `json:"scanned"`
+	Packages        int            `json:"packages"`
+	Vulnerabilities map[string]int `json:"vulnerabilities"`
+}
+
+// CVEs is the number of vulnerabilities of any severity.
+func (f *Facts) CVEs() int {
+	n := 0
+	for _, c := range f.Vulnerabilities {
+		n += c
+	}
+	return n
+}
+
+// Scanner produces Trivy JSON reports listing every package
+// (rescan.Trivy with ListPackages).
+type Scanner interface {
+	Scan(ctx context.Context, ref string) ([]byte, error)
+}
+
+// Inspector measures images.
+type Inspector struct {
+	Registry *registry.Client
+	Platform registry.Platform
+	// Scanner counts packages and vulnerabilities; they are left unknown
+	// when nil.
+	Scanner Scanner
+}
+
+// Inspect measures the image ref points to.
+func (in *Inspector) Inspect(ctx context.Context, ref string) (*Facts, error) {
+	r, err := registry.ParseRef(ref)
+	if err != nil {
+		return nil, err
+	}
+	m, digest, err := in.Registry.ImageManifest(ctx, r, in.Platform)
+	if err != nil {
+		return nil, err
+	}
+	f := &Facts{Ref: ref, Digest: digest}
+
+	// Files of the lower layers, as left by the upper ones.
+	present := map[string]bool{}
+	for _, l := range m.Layers {
+		f.Size += l.Size
+		if err := in.layer(ctx, r, l, present, f); err != nil {
+			return nil, fmt.Errorf("%s: layer %s: %w", ref, l.Digest, err)
+		}
+	}
+	for p := range present {
+		name := path.Base(p)
+		switch {
+		case slices.Contains(Shells, name):
+			f.Shells = append(f.Shells, name)
+		case slices.Contains(PackageManagers, name):
+			f.PackageManagers = append(f.PackageManagers, name)
+		}
+	}
+	f.Shells = dedupe(f.Shells)
+	f.PackageManagers = dedupe(f.PackageManagers)
+
+	if in.Scanner != nil {
+		data, err := in.Scanner.Scan(ctx, r.Name()+"@"+digest)
+		if err != nil {
+			return nil, err
+		}
+		report, err := vuln.Parse(data)
+		if err != nil {
+			return nil, fmt.Errorf("%s: scan: %w", ref, err)
+		}
+		f.Scanned = true
+		f.Packages = report.Packages
+		f.Vulnerabilities = map[string]int{}
+		for _, finding := range report.Findings {
+			f.Vulnerabilities[finding.Severity]++
+		}
+	}
+	return f, nil
+}
+
+// layer applies one layer to present, which only tracks the executables of
+// interest, and adds its file sizes to f.Unpacked.
+func (in *Inspector) layer(ctx context.Context, ref registry.Ref, l registry.Descriptor, present map[string]bool, f *Facts) error {
+	blob, err := in.Registry.OpenBlob(ctx, ref, l.Digest)
+	if err != nil {
+		return err
+	}
+	defer blob.Close()
+
+	stream, err := registry.Uncompressed(blob)
+	if err != nil {
+		return err
+	}
+	defer stream.Close()
+
+	// Whiteouts only hide files of the lower layers, so the layer's own
+	// files are added once it is read.
+	added := map[string]bool{}
+	tr := tar.NewReader(stream)
+	for {
+		hdr, err := tr.Next()
+		if err == io.EOF {
+			break
+		}
+		if err != nil {
+			return err
+		}
+		name := strings.TrimPrefix(path.Clean("/"+hdr.Name), "/")
+		dir, base := path.Split(name)
+		dir = strings.TrimSuffix(dir, "/")
+		switch {
+		case base == ".wh..wh..opq":
+			removeTree(present, dir)
+		case strings.HasPrefix(base, ".wh."):
+			removeTree(present, path.Join(dir, strings.TrimPrefix(base, ".wh.")))
+		default:
+			if hdr.Typeflag == tar.TypeReg {
+				f.Unpacked += hdr.Size
+			}
+			if tracked(dir, base, hdr.Typeflag) {
+				added[name] = true
+			}
+		}
+	}
+	for name := range added {
+		present[name] = true
+	}
+	return nil
+}
+
+func tracked(dir, base string, typ byte) bool {
+	if typ != tar.TypeReg && typ != tar.TypeSymlink && typ != tar.TypeLink {
+		return false
+	}
+	return slices.Contains(binDirs, dir) &&
+		(slices.Contains(Shells, base) || slices.Contains(PackageManagers, base))
+}
+
+// removeTree removes name and everything below it.
+func removeTree(present map[string]bool, name string) {
+	for p := range present {
+		if p == name || strings.HasPrefix(p, name+"/") || name == "" {
+			delete(present, p)
+		}
+	}
+}
+
+func dedupe(s []string) []string {
+	if s == nil {
+		return []string{}
+	}
+	sort.Strings(s)
+	return slices.Compact(s)
+}
+
+// Comparison is one variant of a factory image against its donor.
+type Comparison struct {
+	Image    string `json:"image"`
+	Variant  string `json:"variant"`
+	Platform string `json:"platform"`
+	Factory  *Facts `json:"factory"`
+	Donor    *Facts `json:"donor"`
+	// Regressions are the counts where the factory image is not better
+	// than its donor.
+	Regressions []string `json:"regressions"`
+}
+
+// Compare compares the facts of a factory image to those of its donor.
+func Compare(image, variant string, platform registry.Platform, factory, donor *Facts) Comparison {
+	c := Comparison{Image: image, Variant: variant, Platform: platform.String(),
+		Factory: factory, Donor: donor, Regressions: []string{}}
+	if factory.Size > donor.Size {
+		c.Regressions = append(c.Regressions,
+			fmt.Sprintf("larger than the donor (%s vs %s)", HumanBytes(factory.Size), HumanBytes(donor.Size)))
+	}
+	if factory.Scanned && donor.Scanned {
+		if factory.Packages > donor.Packages {
+			c.Regressions = append(c.Regressions,
+				fmt.Sprintf("more packages than the donor (%d vs %d)", factory.Packages, donor.Packages))
+		}
+		if factory.CVEs() > donor.CVEs() {
+			c.Regressions = append(c.Regressions,
+				fmt.Sprintf("more vulnerabilities than the donor (%d vs %d)", factory.CVEs(), donor.CVEs()))
+		}
+	}
+	for _, s := range factory.Shells {
+		if !slices.Contains(donor.Shells, s) {
+			c.Regressions = append(c.Regressions, fmt.Sprintf("shell %s, absent from the donor", s))
+		}
+	}
+	for _, pm := range factory.PackageManagers {
+		if !slices.Contains(donor.PackageManagers, pm) {
+			c.Regressions = append(c.Regressions, fmt.Sprintf("package manager %s, absent from the donor", pm))
+		}
+	}
+	return c
+}
+
+// HumanBytes formats a size in binary units.
+func HumanBytes(n int64) string {
+	const unit = 1024
+	if n < unit {
+		return fmt.Sprintf("%d B", n)
+	}
+	div, exp := int64(unit), 0
+	for m := n / unit; m >= unit; m /= unit {
+		div *= unit
+		exp++
+	}
+	return fmt.Sprintf("%.1f %ciB", float64(n)/float64(div), "KMGTPE"[exp])
+}
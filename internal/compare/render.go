@@ -0,0 +1,79 @@
+package compare
+
+import (
+	"encoding/json"
+	"fmt"
+	"io"
+	"strings"
+
+	"github.com/gillouche/container-factory/internal/vuln"
+)
+
+// JSON writes the comparisons as an indented JSON document.
+func JSON(w io.Writer, comparisons []Comparison) error {
+	enc := json.NewEncoder(w)
+	enc.SetIndent("", "  ")
+	return enc.Encode(map[string]any{"variants": comparisons})
+}
+
+// Markdown writes a factory-versus-donor table followed by the regressions.
+func Markdown(w io.Writer, comparisons []Comparison) error {
+	var b strings.Builder
+	b.WriteString("# Factory images vs upstream donors\n\n")
+	b.WriteString("Each cell is factory / donor.\n\n")
+	b.WriteString("| Image | Variant | Donor | Size | Packages | CVEs (C/H/M/L) | Shells | Package managers |\n")
+	b.WriteString("|---|---|---|---:|---:|---:|---|---|\n")
+	for _, c := range comparisons {
+		f, d := c.Factory, c.Donor
+		fmt.Fprintf(&b, "| %s | %s | `%s` | %s / %s | %s / %s | %s / %s | %s / %s | %s / %s |\n",
+			c.Image, c.Variant, d.Ref,
+			HumanBytes(f.Size), HumanBytes(d.Size),
+			packages(f), packages(d),
+			cves(f), cves(d),
+			list(f.Shells), list(d.Shells),
+			list(f.PackageManagers), list(d.PackageManagers))
+	}
+
+	regressed := false
+	for _, c := range comparisons {
+		if len(c.Regressions) == 0 {
+			continue
+		}
+		if !regressed {
+			b.WriteString("\n## Regressions\n")
+			regressed = true
+		}
+		fmt.Fprintf(&b, "\n### %s:%s (%s)\n\n", c.Image, c.Variant, c.Platform)
+		for _, r := range c.Regressions {
+			fmt.Fprintf(&b, "- %s\n", r)
+		}
+	}
+
+	_, err := io.WriteString(w, b.String())
+	return err
+}
+
+func packages(f *Facts) string {
+	if !f.Scanned {
+		return "n/a"
+	}
+	return fmt.Sprint(f.Packages)
+}
+
+func cves(f *Facts) string {
+	if !f.Scanned {
+		return "n/a"
+	}
+	var counts []string
+	for _, sev := range vuln.Severities[:4] {
+		counts = append(counts, fmt.Sprint(f.Vulnerabilities[sev]))
+	}
+	return strings.Join(counts, "/")
+}
+
+func list(s []string) string {
+	if len(s) == 0 {
+		return "none"
+	}
+	return strings.Join(s, ", ")
+}
@@ -0,0 +1,267 @@
+// Package config loads ci/factory.json, which tells the factory tooling where
+// images live in the tree and where they are published:
+//
+//	{
+//	    "registry": "nexus.gillouche.homelab",
+//	    "namespace": "docker-hosted",
+//	    "roots": [
+//	        {"dir": "images", "path": "base"},
+//	        {"dir": "bootstrap", "path": "bootstrap"}
+//	    ],
+//	    "notify": {"type": "discord", "webhook_env": "DISCORD_WEBHOOK"},
+//	    "dependency_track": {"url": "https://dtrack.example.com", "api_key_env": "DTRACK_API_KEY"},
+//	    "secrets": [{"id": "nexus-netrc", "type": "netrc", "host": "nexus.gillouche.homelab"}],
+//	    "migrations": [{"image": "python-distroless", "to": "{registry}/{namespace}/runtimes/{image}", "until": "2027-01-31"}]
+//	}
+//
+// Other repositories reuse the tooling by pointing FACTORY_CONFIG at their own
+// file. NEXUS_REGISTRY and NEXUS_NAMESPACE override the registry and namespace,
+// as they always have for ci/build.sh.
+package config
+
+import (
+	"encoding/json"
+	"fmt"
+	"os"
+	"strings"
+	"time"
+
+	"github.com/gillouche/container-factory/internal/notify"
+	"github.com/gillouche/container-factory/internal/secrets"
+)
+
+// DefaultPath is where the configuration lives relative to the repo root.
+const DefaultPath = "ci/factory.json"
+
+// Root is a directory whose subdirectories are images.
+type Root struct {
+	// Dir is the directory relative to the repository root.
+	Dir string `json:"dir"`
+	// Path is the repository segment images of this root are published
+	// under, substituted for {path} in the layout.
+	Path string `json:"path"`
+}
+
+// Layout holds the repository templates. Placeholders: {registry},
+// {namespace}, {path} and {image}.
+type Layout struct {
+	Image string `json:"image"`
+	Cache string `json:"cache"`
+}
+
+// Config is the factory configuration.
+type Config struct {
+	Registry  string        `json:"registry"`
+	Namespace string        `json:"namespace"`
+	Roots     []Root        `json:"roots"`
+	Layout    Layout        `json:"layout"`
+	Notify    notify.Config `json:"notify"`
+	Secrets   secrets.Store `json:"secrets"`
+	// TrustedKeys is the file listing the image signing keys.
+	TrustedKeys string `json:"trusted_keys"`
+	// TrustPolicy is the Notation trust policy applied to Notation
+	// signatures; its trust stores other than ca:factory are read from
+	// the truststore directory next to it.
+	TrustPolicy string      `json:"trust_policy"`
+	Promotion   Promotion   `json:"promotion"`
+	Migrations  []Migration `json:"migrations"`
+	Vendor      Vendor      `json:"vendor"`
+	Backstage   Backstage   `json:"backstage"`
+	// DependencyTrack is where `factory dtrack` uploads image SBOMs.
+	DependencyTrack DependencyTrack `json:"dependency_track"`
+}
+
+// DependencyTrack configures the Dependency-Track server fed the SBOMs of
+// the published images.
+type DependencyTrack struct {
+	// URL is the API server root.
+	URL string `json:"url"`
+	// APIKeyEnv names the environment variable holding the API key.
+	APIKeyEnv string `json:"api_key_env"`
+	// Tag marks the projects of the factory, which are retired once their
+	// variant leaves the catalog.
+	Tag string `json:"tag"`
+}
+
+// Backstage configures the catalog-info.yaml entities exported to the
+// developer portal.
+type Backstage struct {
+	// System is the Backstage system the image resources belong to.
+	System string `json:"system"`
+	// Owner owns the images no CODEOWNERS rule covers, as an entity
+	// reference (e.g. group:platform).
+	Owner string `json:"owner"`
+	// SourceURL and RegistryURL are the link templates of an image.
+	// Placeholders: {dir}, the image directory; {registry}; {namespace};
+	// {repository}, the full repository; and {path}, the repository below
+	// the namespace, path-escaped.
+	SourceURL   string `json:"source_url"`
+	RegistryURL string `json:"registry_url"`
+	// Branch is where `factory backstage -publish` commits the entities.
+	Branch string `json:"branch"`
+}
+
+// Vendor configures the hosted copies of the base images builds depend on,
+// which outlive the proxy caches they are pulled through.
+type Vendor struct {
+	// Repository is the template of the vendored copy of a base repository.
+	// Placeholders: {registry}, {namespace} and {source}, the base
+	// repository without registry host (e.g. docker-hub/golang).
+	Repository string `json:"repository"`
+}
+
+// Migration moves an image to a new repository. Until the end of the
+// transition window, builds publish to both the new repository and the one
+// the layout gives, which is annotated with the new location.
+type Migration struct {
+	Image string `json:"image"`
+	// To is the new repository, a layout template such as
+	// "{registry}/{namespace}/runtimes/{image}".
+	To string `json:"to"`
+	// Until is the last day (YYYY-MM-DD) the old repository is published.
+	Until string `json:"until"`
+}
+
+// UntilTime returns the end of the transition window: the end of the
+// Until day, UTC.
+func (m Migration) UntilTime() time.Time {
+	t, _ := time.Parse(time.DateOnly, m.Until)
+	return t.AddDate(0, 0, 1)
+}
+
+// Promotion configures when floating tags move to a new digest. Images
+// override the soak period with a soak=<duration> label.
+type Promotion struct {
+	// Soak is how long a digest must be published under its exact tag.
+	Soak string `json:"soak"`
+	// Block lists the vulnerability severities that prevent a promotion.
+	Block []string `json:"block_severities"`
+}
+
+// Default is the layout the factory has always used.
+func Default() *Config {
+	return &Config{
+		Registry:  "nexus.gillouche.homelab",
+		Namespace: "docker-hosted",
+		Roots:     []Root{{Dir: "images", Path: "base"}},
+		Layout: Layout{
+			Image: "{registry}/{namespace}/{path}/{image}",
+			Cache: "{registry}/{namespace}/cache/{image}",
+		},
+		TrustedKeys: "ci/trusted-keys.json",
+		TrustPolicy: "ci/notation/trustpolicy.json",
+		Promotion:   Promotion{Soak: "72h", Block: []string{"CRITICAL"}},
+		Vendor:      Vendor{Repository: "{registry}/{namespace}/vendor/{source}"},
+		Backstage:   Backstage{System: "container-factory", Branch: "backstage"},
+		DependencyTrack: DependencyTrack{
+			APIKeyEnv: "DTRACK_API_KEY",
+			Tag:       "container-factory",
+		},
+	}
+}
+
+// Load reads the configuration at path, or $FACTORY_CONFIG, or DefaultPath,
+// in that order. A missing default file yields Default.
+func Load(path string) (*Config, error) {
+	explicit := path != ""
+	if path == "" {
+		path = os.Getenv("FACTORY_CONFIG")
+		explicit = path != ""
+	}
+	if path == "" {
+		path = DefaultPath
+	}
+
+	cfg := Default()
+	data, err := os.ReadFile(path)
+	switch {
+	case os.IsNotExist(err) && !explicit:
+	case err != nil:
+		return nil, err
+	default:
+		if err := json.Unmarshal(data, cfg); err != nil {
+			return nil, fmt.Errorf("%s: %w", path, err)
+		}
+	}
+
+	if v := os.Getenv("NEXUS_REGISTRY"); v != "" {
+		cfg.Registry = v
+	}
+	if v := os.Getenv("NEXUS_NAMESPACE"); v != "" {
+		cfg.Namespace = v
+	}
+	if len(cfg.Roots) == 0 {
+		return nil, fmt.Errorf("%s: no image roots configured", path)
+	}
+	for _, r := range cfg.Roots {
+		if r.Dir == "" {
+			return nil, fmt.Errorf("%s: image root without dir", path)
+		}
+	}
+	if _, err := time.ParseDuration(cfg.Promotion.Soak); err != nil {
+		return nil, fmt.Errorf("%s: promotion soak: %w", path, err)
+	}
+	for _, m := range cfg.Migrations {
+		if m.Image == "" || m.To == "" {
+			return nil, fmt.Errorf("%s: migration without image or to", path)
+		}
+		if _, err := time.Parse(time.DateOnly, m.Until); err != nil {
+			return nil, fmt.Errorf("%s: migration of %s: until: %w", path, m.Image, err)
+		}
+	}
+	return cfg, nil
+}
+
+// Root returns the root whose directory is dir.
+func (c *Config) Root(dir string) (Root, bool) {
+	for _, r := range c.Roots {
+		if r.Dir == dir {
+			return r, true
+		}
+	}
+	return Root{}, false
+}
+
+// ImageRepo returns the repository an image of root is published to.
+func (c *Config) ImageRepo(root Root, image string) string {
+	return c.expand(c.Layout.Image, root, image)
+}
+
+// Migration returns the migration of image, if any.
+func (c *Config) Migration(image string) (Migration, bool) {
+	for _, m := range c.Migrations {
+		if m.Image == image {
+			return m, true
+		}
+	}
+	return Migration{}, false
+}
+
+// MigrationRepo returns the repository an image of root is migrating to.
+func (c *Config) MigrationRepo(m Migration, root Root) string {
+	return c.expand(m.To, root, m.Image)
+}
+
+// VendorRepo returns the repository vendored copies of the base repository
+// source are kept in.
+func (c *Config) VendorRepo(source string) string {
+	return strings.NewReplacer(
+		"{registry}", c.Registry,
+		"{namespace}", c.Namespace,
+		"{source}", source,
+	).Replace(c.Vendor.Repository)
+}
+
+// CacheRepo returns the repository holding the build cache of an image.
+func (c *Config) CacheRepo(root Root, image string) string {
+	return c.expand(c.Layout.Cache, root, image)
+}
+
+func (c *Config) expand(tmpl string, root Root, image string) string {
+	return strings.NewReplacer(
+		"{registry}", c.Registry,
+		"{namespace}", c.Namespace,
+		"{path}", root.Path,
+		"{image}", image,
+	).Replace(tmpl)
+}
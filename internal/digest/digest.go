@@ -0,0 +1,298 @@
+// Package digest builds the daily summary of the factory's state: what was
+// published or failed, how vulnerability findings moved, which updates are
+// pending, which smoke checks are flaky or quarantined and what is about to
+// expire.
+package digest
+
+import (
+	"crypto/x509"
+	"encoding/json"
+	"encoding/pem"
+	"fmt"
+	"io/fs"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+	"time"
+
+	"github.com/gillouche/container-factory/internal/ledger"
+	"github.com/gillouche/container-factory/internal/smoke"
+	"github.com/gillouche/container-factory/internal/vuln"
+)
+
+// Change is a vulnerability that appeared in or disappeared from a variant.
+type Change struct {
+	Image    string `json:"image"`
+	Variant  string `json:"variant"`
+	ID       string `json:"id"`
+	Package  string `json:"package"`
+	Severity string `json:"severity"`
+}
+
+// Update is a pending update from the dependency and upstream checkers
+// (the report.json produced by the check-pinned-deps workflow).
+type Update struct {
+	File           string `json:"file"`
+	Type           string `json:"type"`
+	Action         string `json:"action,omitempty"`
+	Tag            string `json:"tag,omitempty"`
+	CurrentSHA     string `json:"current_sha,omitempty"`
+	LatestSHA      string `json:"latest_sha,omitempty"`
+	CurrentVersion string `json:"current_version,omitempty"`
+	LatestVersion  string `json:"latest_version,omitempty"`
+}
+
+// Expiry is something with a deadline: a variant's end of life or a
+// certificate's notAfter.
+type Expiry struct {
+	Name string    `json:"name"`
+	Date time.Time `json:"date"`
+	Days int       `json:"days"`
+}
+
+// Report is the digest of one period.
+type Report struct {
+	Since     time.Time       `json:"since"`
+	Until     time.Time       `json:"until"`
+	Published []ledger.Record `json:"published"`
+	Failed    []ledger.Record `json:"failed"`
+	NewCVEs   []Change        `json:"new_cves"`
+	FixedCVEs []Change        `json:"fixed_cves"`
+	Updates   []Update        `json:"updates"`
+	EOLs      []Expiry        `json:"eols"`
+	Certs     []Expiry        `json:"certificates"`
+	// Flaky lists the flaky smoke checks, Quarantined the whole
+	// quarantine list.
+	Flaky       []smoke.Stats  `json:"flaky_checks"`
+	Quarantined []smoke.Status `json:"quarantined_checks"`
+}
+
+// Snapshot is the set of findings seen by the previous digest, keyed by
+// image:variant, so the next one can tell which are new and which are fixed.
+type Snapshot struct {
+	Time     time.Time                 `json:"time"`
+	Findings map[string][]vuln.Finding `json:"findings"`
+}
+
+// LoadSnapshot reads a snapshot; a missing file yields nil.
+func LoadSnapshot(path string) (*Snapshot, error) {
+	data, err := os.ReadFile(path)
+	if os.IsNotExist(err) {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+	var s Snapshot
+	if err := json.Unmarshal(data, &s); err != nil {
+		return nil, fmt.Errorf("%s: %w", path, err)
+	}
+	return &s, nil
+}
+
+// Merge returns the findings of the snapshot with those of the given images
+// replaced by current, so a digest of some images keeps the baseline of the
+// others.
+func (s *Snapshot) Merge(images map[string]bool, current map[string][]vuln.Finding) map[string][]vuln.Finding {
+	merged := map[string][]vuln.Finding{}
+	if s != nil {
+		for key, findings := range s.Findings {
+			image, _, _ := strings.Cut(key, ":")
+			if !images[image] {
+				merged[key] = findings
+			}
+		}
+	}
+	for key, findings := range current {
+		merged[key] = findings
+	}
+	return merged
+}
+
+// Save writes the snapshot to path.
+func (s *Snapshot) Save(path string) error {
+	if err := os.MkdirAll(filepath.Dir(path), 0o755); err != nil {
+		return err
+	}
+	data, err := json.MarshalIndent(s, "", "  ")
+	if err != nil {
+		return err
+	}
+	return os.WriteFile(path, data, 0o644)
+}
+
+// Activity fills in the builds recorded in the ledger during the period.
+func (r *Report) Activity(l *ledger.Ledger) {
+	for _, rec := range l.Records {
+		if rec.Time.Before(r.Since) || rec.Time.After(r.Until) {
+			continue
+		}
+		switch {
+		case rec.Status == ledger.StatusFailure:
+			r.Failed = append(r.Failed, rec)
+		case rec.Pushed:
+			r.Published = append(r.Published, rec)
+		}
+	}
+}
+
+// Vulnerabilities compares the current findings with the previous snapshot.
+// Without a previous snapshot nothing is reported, rather than every
+// existing finding showing up as new.
+func (r *Report) Vulnerabilities(prev *Snapshot, current map[string][]vuln.Finding) {
+	if prev == nil {
+		return
+	}
+	for key, findings := range current {
+		old, ok := prev.Findings[key]
+		if !ok {
+			// A variant scanned for the first time is not news.
+			continue
+		}
+		r.NewCVEs = append(r.NewCVEs, diff(key, findings, old)...)
+	}
+	for key, findings := range prev.Findings {
+		if cur, ok := current[key]; ok {
+			r.FixedCVEs = append(r.FixedCVEs, diff(key, findings, cur)...)
+		}
+	}
+	sortChanges(r.NewCVEs)
+	sortChanges(r.FixedCVEs)
+}
+
+// LoadUpdates reads the pending updates from a checker report; a missing file
+// yields none.
+func LoadUpdates(path string) ([]Update, error) {
+	data, err := os.ReadFile(path)
+	if os.IsNotExist(err) {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+	var report struct {
+		Updates []Update `json:"updates"`
+	}
+	if err := json.Unmarshal(data, &report); err != nil {
+		return nil, fmt.Errorf("%s: %w", path, err)
+	}
+	return report.Updates, nil
+}
+
+// AddEOL records a variant's end of life if it falls within horizon.
+func (r *Report) AddEOL(name string, date time.Time, horizon time.Duration) {
+	if e, ok := expiry(name, date, r.Until, horizon); ok {
+		r.EOLs = append(r.EOLs, e)
+	}
+}
+
+// Certificates records every PEM certificate below the given directories
+// that expires within horizon.
+func (r *Report) Certificates(dirs []string, horizon time.Duration) error {
+	for _, dir := range dirs {
+		err := filepath.WalkDir(dir, func(path string, d fs.DirEntry, err error) error {
+			if err != nil {
+				return err
+			}
+			if d.IsDir() || !(strings.HasSuffix(path, ".crt") || strings.HasSuffix(path, ".pem")) {
+				return nil
+			}
+			data, err := os.ReadFile(path)
+			if err != nil {
+				return err
+			}
+			for block, rest := pem.Decode(data); block != nil; block, rest = pem.Decode(rest) {
+				if block.Type != "CERTIFICATE" {
+					continue
+				}
+				cert, err := x509.ParseCertificate(block.Bytes)
+				if err != nil {
+					return fmt.Errorf("%s: %w", path, err)
+				}
+				name := fmt.Sprintf("%s (%s)", path, cert.Subject.CommonName)
+				if e, ok := expiry(name, cert.NotAfter, r.Until, horizon); ok {
+					r.Certs = append(r.Certs, e)
+				}
+			}
+			return nil
+		})
+		if err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// Smoke fills in the flaky smoke checks of records, however old, and
+// where the quarantine stands.
+func (r *Report) Smoke(records []smoke.Record, q *smoke.Quarantine, a smoke.Analysis) {
+	for _, s := range a.Analyze(records) {
+		if s.Flaky {
+			r.Flaky = append(r.Flaky, s)
+		}
+	}
+	r.Quarantined = q.Status(records, r.Until)
+}
+
+// Sort orders the deadlines soonest first.
+func (r *Report) Sort() {
+	for _, list := range [][]Expiry{r.EOLs, r.Certs} {
+		sort.Slice(list, func(i, j int) bool { return list[i].Date.Before(list[j].Date) })
+	}
+}
+
+// Empty reports whether nothing happened and nothing is pending.
+func (r *Report) Empty() bool {
+	return len(r.Published)+len(r.Failed)+len(r.NewCVEs)+len(r.FixedCVEs)+
+		len(r.Updates)+len(r.EOLs)+len(r.Certs)+len(r.Flaky)+len(r.Quarantined) == 0
+}
+
+func expiry(name string, date, now time.Time, horizon time.Duration) (Expiry, bool) {
+	if date.Sub(now) > horizon {
+		return Expiry{}, false
+	}
+	return Expiry{Name: name, Date: date, Days: int(date.Sub(now).Hours() / 24)}, true
+}
+
+// diff returns the findings of a that are not in b.
+func diff(key string, a, b []vuln.Finding) []Change {
+	image, variant, _ := strings.Cut(key, ":")
+	in := map[string]bool{}
+	for _, f := range b {
+		in[f.ID+"/"+f.Package] = true
+	}
+	seen := map[string]bool{}
+	var out []Change
+	for _, f := range a {
+		k := f.ID + "/" + f.Package
+		if in[k] || seen[k] {
+			continue
+		}
+		seen[k] = true
+		out = append(out, Change{Image: image, Variant: variant, ID: f.ID, Package: f.Package, Severity: f.Severity})
+	}
+	return out
+}
+
+var severityRank = map[string]int{"CRITICAL": 0, "HIGH": 1, "MEDIUM": 2, "LOW": 3}
+
+func sortChanges(c []Change) {
+	sort.Slice(c, func(i, j int) bool {
+		ri, ok := severityRank[c[i].Severity]
+		if !ok {
+			ri = len(severityRank)
+		}
+		rj, ok := severityRank[c[j].Severity]
+		if !ok {
+			rj = len(severityRank)
+		}
+		if ri != rj {
+			return ri < rj
+		}
+		if c[i].Image+c[i].Variant != c[j].Image+c[j].Variant {
+			return c[i].Image+":"+c[i].Variant < c[j].Image+":"+c[j].Variant
+		}
+		return c[i].ID < c[j].ID
+	})
+}
@@ -0,0 +1,167 @@
+package digest
+
+import (
+	"fmt"
+	"io"
+	"strings"
+
+	"github.com/gillouche/container-factory/internal/ledger"
+	"github.com/gillouche/container-factory/internal/notify"
+	"github.com/gillouche/container-factory/internal/smoke"
+)
+
+// section is one titled list of the digest, shared by both renderings.
+type section struct {
+	title string
+	lines []string
+}
+
+func (r *Report) sections() []section {
+	var s []section
+	add := func(title string, lines []string) {
+		if len(lines) > 0 {
+			s = append(s, section{fmt.Sprintf("%s (%d)", title, len(lines)), lines})
+		}
+	}
+
+	add("Published", builds(r.Published, func(rec ledger.Record) string {
+		return fmt.Sprintf("%s:%s `%s`", rec.Image, rec.Variant, short(rec.Digest, 19))
+	}))
+	add("Failed builds", builds(r.Failed, func(rec ledger.Record) string {
+		return fmt.Sprintf("%s:%s at %s", rec.Image, rec.Variant, rec.Time.Format("15:04 MST"))
+	}))
+
+	var cves []string
+	for _, c := range r.NewCVEs {
+		cves = append(cves, fmt.Sprintf("%s %s in %s (%s:%s)", c.Severity, c.ID, c.Package, c.Image, c.Variant))
+	}
+	add("New CVEs", cves)
+	cves = nil
+	for _, c := range r.FixedCVEs {
+		cves = append(cves, fmt.Sprintf("%s %s in %s (%s:%s)", c.Severity, c.ID, c.Package, c.Image, c.Variant))
+	}
+	add("Fixed CVEs", cves)
+
+	var updates []string
+	for _, u := range r.Updates {
+		switch {
+		case u.CurrentVersion != "" || u.LatestVersion != "":
+			updates = append(updates, fmt.Sprintf("`%s`: %s -> %s", u.File, u.CurrentVersion, u.LatestVersion))
+		case u.Action != "":
+			updates = append(updates, fmt.Sprintf("%s@%s: `%s` -> `%s`", u.Action, u.Tag, short(u.CurrentSHA, 12), short(u.LatestSHA, 12)))
+		default:
+			updates = append(updates, fmt.Sprintf("`%s`: %s", u.File, u.Type))
+		}
+	}
+	add("Pending updates", updates)
+
+	var checks []string
+	for _, c := range r.Flaky {
+		checks = append(checks, fmt.Sprintf("%s `%s`: %s", c.Image, c.Check, c.Reason))
+	}
+	add("Flaky smoke checks", checks)
+	checks = nil
+	for _, q := range r.Quarantined {
+		checks = append(checks, fmt.Sprintf("%s `%s` until %s: %s (%s)", q.Image, q.Check, q.Until, q.State(), q.Reason))
+	}
+	add("Quarantined smoke checks", checks)
+
+	add("Upcoming end of life", expiries(r.EOLs))
+	add("Expiring certificates", expiries(r.Certs))
+	return s
+}
+
+// Markdown writes the digest as a markdown document.
+func (r *Report) Markdown(w io.Writer) error {
+	var b strings.Builder
+	fmt.Fprintf(&b, "# Factory digest %s\n\n", r.Until.Format("2006-01-02"))
+	fmt.Fprintf(&b, "Period: %s to %s\n", r.Since.Format("2006-01-02 15:04 MST"), r.Until.Format("2006-01-02 15:04 MST"))
+	if r.Empty() {
+		b.WriteString("\nNothing to report.\n")
+	}
+	for _, s := range r.sections() {
+		fmt.Fprintf(&b, "\n## %s\n\n", s.title)
+		for _, l := range s.lines {
+			fmt.Fprintf(&b, "- %s\n", l)
+		}
+	}
+	_, err := io.WriteString(w, b.String())
+	return err
+}
+
+// Message renders the digest as a single notification.
+func (r *Report) Message() notify.Message {
+	m := notify.Message{
+		Title:  "Factory digest " + r.Until.Format("2006-01-02"),
+		Status: notify.StatusSuccess,
+	}
+	switch {
+	case len(r.Failed) > 0 || hasSeverity(r.NewCVEs, "CRITICAL", "HIGH") || overdue(r.EOLs) || overdue(r.Certs):
+		m.Status = notify.StatusFailure
+	case len(r.NewCVEs) > 0 || len(r.EOLs) > 0 || len(r.Certs) > 0 || len(r.Flaky) > 0 || expired(r.Quarantined):
+		m.Status = notify.StatusWarning
+	}
+
+	m.Description = fmt.Sprintf("Last %.0f hours: %d published, %d failed, %d new and %d fixed CVEs, %d pending updates.",
+		r.Until.Sub(r.Since).Hours(), len(r.Published), len(r.Failed), len(r.NewCVEs), len(r.FixedCVEs), len(r.Updates))
+	for _, s := range r.sections() {
+		m.Fields = append(m.Fields, notify.Field{Name: s.title, Value: strings.Join(s.lines, "\n")})
+	}
+	return m
+}
+
+func builds(recs []ledger.Record, format func(ledger.Record) string) []string {
+	var out []string
+	for _, r := range recs {
+		out = append(out, format(r))
+	}
+	return out
+}
+
+func expiries(list []Expiry) []string {
+	var out []string
+	for _, e := range list {
+		if e.Days < 0 {
+			out = append(out, fmt.Sprintf("%s: expired %s", e.Name, e.Date.Format("2006-01-02")))
+		} else {
+			out = append(out, fmt.Sprintf("%s: %s (%d days)", e.Name, e.Date.Format("2006-01-02"), e.Days))
+		}
+	}
+	return out
+}
+
+func hasSeverity(changes []Change, severities ...string) bool {
+	for _, c := range changes {
+		for _, s := range severities {
+			if c.Severity == s {
+				return true
+			}
+		}
+	}
+	return false
+}
+
+func expired(list []smoke.Status) bool {
+	for _, s := range list {
+		if s.Expired {
+			return true
+		}
+	}
+	return false
+}
+
+func overdue(list []Expiry) bool {
+	for _, e := range list {
+		if e.Days < 0 {
+			return true
+		}
+	}
+	return false
+}
+
+func short(s string, n int) string {
+	if len(s) <= n {
+		return s
+	}
+	return s[:n]
+}
@@ -0,0 +1,51 @@
+// Package dockerfile reads Dockerfiles instruction by instruction, for the
+// checks that need more than the FROM lines the catalog looks at.
+package dockerfile
+
+import (
+	"bufio"
+	"os"
+	"strings"
+)
+
+// Instruction is a Dockerfile instruction with its continuation lines joined.
+type Instruction struct {
+	Line int
+	Cmd  string
+	Args string
+}
+
+// Parse reads the instructions of a Dockerfile. Comments and blank lines
+// inside a continued instruction are skipped, as BuildKit does.
+func Parse(path string) ([]Instruction, error) {
+	f, err := os.Open(path)
+	if err != nil {
+		return nil, err
+	}
+	defer f.Close()
+
+	var out []Instruction
+	var cur *Instruction
+	n := 0
+	sc := bufio.NewScanner(f)
+	sc.Buffer(nil, 1<<20)
+	for sc.Scan() {
+		n++
+		line := strings.TrimSpace(sc.Text())
+		if line == "" || strings.HasPrefix(line, "#") {
+			continue
+		}
+		text, more := strings.CutSuffix(line, `\`)
+		if cur == nil {
+			cmd, args, _ := strings.Cut(text, " ")
+			out = append(out, Instruction{Line: n, Cmd: strings.ToUpper(cmd), Args: strings.TrimSpace(args)})
+			cur = &out[len(out)-1]
+		} else {
+			cur.Args = strings.TrimSpace(cur.Args + " " + text)
+		}
+		if !more {
+			cur = nil
+		}
+	}
+	return out, sc.Err()
+}
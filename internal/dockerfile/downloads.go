@@ -0,0 +1,123 @@
+package dockerfile
+
+import (
+	"regexp"
+	"strings"
+)
+
+var (
+	urlPattern = regexp.MustCompile(`https?://[^\s"'\\|;&)]+`)
+	varPattern = regexp.MustCompile(`\$\{(\w+)\}|\$(\w+)`)
+	// assignment matches NAME="value" at the start of a shell command.
+	assignment = regexp.MustCompile(`^(\w+)=("[^"]*"|'[^']*'|\S*)$`)
+	// remap matches the arch translations used in RUN instructions:
+	// if [ "$ARCH" = "amd64" ]; then ARCH="x64"; fi
+	remap = regexp.MustCompile(`^if \[ "\$\{?(\w+)\}?" = "([^"]*)" \]; then (\w+)="([^"]*)"; fi$`)
+	// fetch matches a curl or wget command, after any variable assignments.
+	fetch = regexp.MustCompile(`^(?:\w+=\S*\s+)*(?:curl|wget)\s`)
+	// shellSplit separates the commands of a RUN line.
+	shellSplit = regexp.MustCompile(`\s*(?:&&|\|\||\|)\s*`)
+)
+
+// Download is a URL fetched by a RUN instruction.
+type Download struct {
+	Line int
+	// Raw is the URL as written, URL with variables expanded.
+	Raw string
+	URL string
+	// Unresolved lists the variables that could not be expanded.
+	Unresolved []string
+}
+
+// Downloads returns the URLs fetched by curl and wget in RUN instructions and
+// by ADD, expanding ARG and ENV values and the simple shell variables RUN
+// lines derive from them (NAME="${TARGETARCH}" followed by if/then remaps). vars seeds the build
+// args, e.g. VERSION and TARGETARCH; they take precedence over ARG defaults.
+func Downloads(ins []Instruction, vars map[string]string) []Download {
+	env := map[string]string{}
+	for k, v := range vars {
+		env[k] = v
+	}
+	var out []Download
+	for _, in := range ins {
+		switch in.Cmd {
+		case "ARG", "ENV":
+			for _, f := range strings.Fields(in.Args) {
+				name, value, ok := strings.Cut(f, "=")
+				if _, fixed := vars[name]; !ok || fixed {
+					continue
+				}
+				env[name] = expand(strings.Trim(value, `"'`), env)
+			}
+		case "RUN":
+			shell := map[string]string{}
+			for k, v := range env {
+				shell[k] = v
+			}
+			for _, cmd := range shellSplit.Split(runCommand(in.Args), -1) {
+				cmd = strings.TrimSpace(cmd)
+				if m := assignment.FindStringSubmatch(cmd); m != nil {
+					shell[m[1]] = expand(strings.Trim(m[2], `"'`), shell)
+					continue
+				}
+				if m := remap.FindStringSubmatch(cmd); m != nil {
+					if shell[m[1]] == m[2] {
+						shell[m[3]] = m[4]
+					}
+					continue
+				}
+				if fetch.MatchString(cmd) {
+					out = appendURLs(out, in.Line, cmd, shell)
+				}
+			}
+		case "ADD":
+			out = appendURLs(out, in.Line, in.Args, env)
+		}
+	}
+	return out
+}
+
+func appendURLs(out []Download, line int, s string, env map[string]string) []Download {
+	for _, raw := range urlPattern.FindAllString(s, -1) {
+		d := Download{Line: line, Raw: raw, URL: expand(raw, env)}
+		for _, m := range varPattern.FindAllStringSubmatch(d.URL, -1) {
+			d.Unresolved = append(d.Unresolved, m[1]+m[2])
+		}
+		out = append(out, d)
+	}
+	return out
+}
+
+// runCommand strips the --mount and other flags of a RUN instruction.
+func runCommand(args string) string {
+	for strings.HasPrefix(args, "--") {
+		_, args, _ = strings.Cut(args, " ")
+		args = strings.TrimSpace(args)
+	}
+	return args
+}
+
+// expand substitutes ${NAME} and $NAME, leaving unknown variables in place.
+func expand(s string, env map[string]string) string {
+	return varPattern.ReplaceAllStringFunc(s, func(m string) string {
+		name := strings.Trim(m, "${}")
+		if v, ok := env[name]; ok {
+			return v
+		}
+		return m
+	})
+}
+
+// BuildArgs are the build args of a build of version for platform, such
+// as linux/arm64.
+func BuildArgs(platform, version string) map[string]string {
+	goos, arch, _ := strings.Cut(platform, "/")
+	arch, variant, _ := strings.Cut(arch, "/")
+	return map[string]string{
+		"VERSION":        version,
+		"TARGETPLATFORM": platform,
+		"TARGETOS":       goos,
+		"TARGETARCH":     arch,
+		"TARGETVARIANT":  variant,
+	}
+}
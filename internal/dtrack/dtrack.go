@@ -0,0 +1,173 @@
+// Package dtrack feeds the SBOMs of the published images to
+// Dependency-Track, one project per image variant (project name the image,
+// version the variant), so base images are tracked next to the
+// applications built on them.
+package dtrack
+
+import (
+	"bytes"
+	"context"
+	"encoding/base64"
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/http"
+	"net/url"
+	"strconv"
+	"strings"
+)
+
+// Classifier is the classifier of the image projects.
+const Classifier = "CONTAINER"
+
+// Client calls the Dependency-Track REST API with an API key of a team
+// holding the BOM_UPLOAD, PORTFOLIO_MANAGEMENT and VIEW_PORTFOLIO
+// permissions.
+type Client struct {
+	// URL is the API server root, e.g. https://dtrack.example.com.
+	URL    string
+	APIKey string
+	HTTP   *http.Client
+}
+
+// Tag is a project tag.
+type Tag struct {
+	Name string `json:"name"`
+}
+
+// Project is a Dependency-Track project.
+type Project struct {
+	UUID        string `json:"uuid,omitempty"`
+	Name        string `json:"name"`
+	Version     string `json:"version,omitempty"`
+	Classifier  string `json:"classifier,omitempty"`
+	Description string `json:"description,omitempty"`
+	Active      bool   `json:"active"`
+	Tags        []Tag  `json:"tags,omitempty"`
+}
+
+// StatusError is an unexpected API response.
+type StatusError struct {
+	Method string
+	Path   string
+	Status string
+	Code   int
+	Body   string
+}
+
+func (e *StatusError) Error() string {
+	if e.Body != "" {
+		return fmt.Sprintf("%s %s: %s: %s", e.Method, e.Path, e.Status, e.Body)
+	}
+	return fmt.Sprintf("%s %s: %s", e.Method, e.Path, e.Status)
+}
+
+// IsNotFound reports whether err is a 404 response.
+func IsNotFound(err error) bool {
+	se, ok := err.(*StatusError)
+	return ok && se.Code == http.StatusNotFound
+}
+
+// Lookup returns the project name at version, or nil when there is none.
+func (c *Client) Lookup(ctx context.Context, name, version string) (*Project, error) {
+	q := url.Values{"name": {name}, "version": {version}}
+	var p Project
+	_, err := c.do(ctx, http.MethodGet, "/api/v1/project/lookup?"+q.Encode(), nil, &p)
+	if IsNotFound(err) {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+	return &p, nil
+}
+
+// CreateProject creates p and returns it as stored, with its UUID.
+func (c *Client) CreateProject(ctx context.Context, p Project) (*Project, error) {
+	var out Project
+	if _, err := c.do(ctx, http.MethodPut, "/api/v1/project", p, &out); err != nil {
+		return nil, err
+	}
+	return &out, nil
+}
+
+// SetActive activates or retires a project. Retired projects keep their
+// history but leave the portfolio metrics.
+func (c *Client) SetActive(ctx context.Context, uuid string, active bool) error {
+	_, err := c.do(ctx, http.MethodPatch, "/api/v1/project/"+url.PathEscape(uuid), map[string]bool{"active": active}, nil)
+	return err
+}
+
+// TaggedProjects returns every project tagged tag, active or not.
+func (c *Client) TaggedProjects(ctx context.Context, tag string) ([]Project, error) {
+	const pageSize = 100
+	var out []Project
+	for page := 1; ; page++ {
+		q := url.Values{"pageSize": {strconv.Itoa(pageSize)}, "pageNumber": {strconv.Itoa(page)}}
+		var batch []Project
+		hdr, err := c.do(ctx, http.MethodGet, "/api/v1/project/tag/"+url.PathEscape(tag)+"?"+q.Encode(), nil, &batch)
+		if err != nil {
+			return nil, err
+		}
+		out = append(out, batch...)
+		total, err := strconv.Atoi(hdr.Get("X-Total-Count"))
+		if err != nil || len(batch) < pageSize || len(out) >= total {
+			return out, nil
+		}
+	}
+}
+
+// UploadBOM uploads a CycloneDX document to a project and returns the token
+// of its (asynchronous) processing.
+func (c *Client) UploadBOM(ctx context.Context, uuid string, bom []byte) (string, error) {
+	in := map[string]string{"project": uuid, "bom": base64.StdEncoding.EncodeToString(bom)}
+	var out struct {
+		Token string `json:"token"`
+	}
+	if _, err := c.do(ctx, http.MethodPut, "/api/v1/bom", in, &out); err != nil {
+		return "", err
+	}
+	return out.Token, nil
+}
+
+func (c *Client) do(ctx context.Context, method, path string, in, v any) (http.Header, error) {
+	var body io.Reader
+	if in != nil {
+		data, err := json.Marshal(in)
+		if err != nil {
+			return nil, err
+		}
+		body = bytes.NewReader(data)
+	}
+	req, err := http.NewRequestWithContext(ctx, method, strings.TrimSuffix(c.URL, "/")+path, body)
+	if err != nil {
+		return nil, err
+	}
+	req.Header.Set("Accept", "application/json")
+	req.Header.Set("X-Api-Key", c.APIKey)
+	if in != nil {
+		req.Header.Set("Content-Type", "application/json")
+	}
+	hc := c.HTTP
+	if hc == nil {
+		hc = http.DefaultClient
+	}
+	resp, err := hc.Do(req)
+	if err != nil {
+		return nil, err
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode < 200 || resp.StatusCode > 299 {
+		msg, _ := io.ReadAll(io.LimitReader(resp.Body, 512))
+		p, _, _ := strings.Cut(path, "?")
+		return nil, &StatusError{Method: method, Path: p, Status: resp.Status, Code: resp.StatusCode,
+			Body: strings.TrimSpace(string(msg))}
+	}
+	if v == nil {
+		return resp.Header, nil
+	}
+	if err := json.NewDecoder(resp.Body).Decode(v); err != nil {
+		return nil, fmt.Errorf("%s %s: %w", method, path, err)
+	}
+	return resp.Header, nil
+}
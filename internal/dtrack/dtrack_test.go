@@ -0,0 +1,260 @@
+package dtrack
+
+import (
+	"context"
+	"encoding/base64"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"strconv"
+	"sync"
+	"testing"
+)
+
+const testKey = "odt_test"
+
+// fakeServer is the project and BOM API of Dependency-Track, holding
+// projects and the BOMs uploaded to them in memory.
+type fakeServer struct {
+	mu       sync.Mutex
+	projects []*Project
+	boms     map[string][]string
+}
+
+func (f *fakeServer) handler() http.Handler {
+	mux := http.NewServeMux()
+	mux.HandleFunc("GET /api/v1/project/lookup", func(w http.ResponseWriter, r *http.Request) {
+		if p := f.find(r.URL.Query().Get("name"), r.URL.Query().Get("version")); p != nil {
+			json.NewEncoder(w).Encode(p)
+			return
+		}
+		http.Error(w, "The project could not be found.", http.StatusNotFound)
+	})
+	mux.HandleFunc("PUT /api/v1/project", func(w http.ResponseWriter, r *http.Request) {
+		var p Project
+		json.NewDecoder(r.Body).Decode(&p)
+		if f.find(p.Name, p.Version) != nil {
+			http.Error(w, "A project with the specified name and version already exists.", http.StatusConflict)
+			return
+		}
+		p.UUID = fmt.Sprintf("uuid-%d", len(f.projects)+1)
+		f.projects = append(f.projects, &p)
+		w.WriteHeader(http.StatusCreated)
+		json.NewEncoder(w).Encode(p)
+	})
+	mux.HandleFunc("PATCH /api/v1/project/{uuid}", func(w http.ResponseWriter, r *http.Request) {
+		p := f.byUUID(r.PathValue("uuid"))
+		if p == nil {
+			http.NotFound(w, r)
+			return
+		}
+		json.NewDecoder(r.Body).Decode(p)
+		json.NewEncoder(w).Encode(p)
+	})
+	mux.HandleFunc("GET /api/v1/project/tag/{tag}", func(w http.ResponseWriter, r *http.Request) {
+		var tagged []*Project
+		for _, p := range f.projects {
+			for _, t := range p.Tags {
+				if t.Name == r.PathValue("tag") {
+					tagged = append(tagged, p)
+				}
+			}
+		}
+		size, _ := strconv.Atoi(r.URL.Query().Get("pageSize"))
+		page, _ := strconv.Atoi(r.URL.Query().Get("pageNumber"))
+		start, end := min((page-1)*size, len(tagged)), min(page*size, len(tagged))
+		w.Header().Set("X-Total-Count", strconv.Itoa(len(tagged)))
+		json.NewEncoder(w).Encode(tagged[start:end])
+	})
+	mux.HandleFunc("PUT /api/v1/bom", func(w http.ResponseWriter, r *http.Request) {
+		var in struct{ Project, BOM string }
+		json.NewDecoder(r.Body).Decode(&in)
+		bom, err := base64.StdEncoding.DecodeString(in.BOM)
+		if err != nil || f.byUUID(in.Project) == nil {
+			http.Error(w, "invalid upload", http.StatusBadRequest)
+			return
+		}
+		if f.boms == nil {
+			f.boms = map[string][]string{}
+		}
+		f.boms[in.Project] = append(f.boms[in.Project], string(bom))
+		fmt.Fprintf(w, `{"token": "token-%d"}`, len(f.boms[in.Project]))
+	})
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.Header.Get("X-Api-Key") != testKey {
+			http.Error(w, "Unauthorized", http.StatusUnauthorized)
+			return
+		}
+		f.mu.Lock()
+		defer f.mu.Unlock()
+		mux.ServeHTTP(w, r)
+	})
+}
+
+func (f *fakeServer) find(name, version string) *Project {
+	for _, p := range f.projects {
+		if p.Name == name && p.Version == version {
+			return p
+		}
+	}
+	return nil
+}
+
+func (f *fakeServer) byUUID(uuid string) *Project {
+	for _, p := range f.projects {
+		if p.UUID == uuid {
+			return p
+		}
+	}
+	return nil
+}
+
+func serve(t *testing.T, f *fakeServer) *Client {
+	t.Helper()
+	srv := httptest.NewServer(f.handler())
+	t.Cleanup(srv.Close)
+	return &Client{URL: srv.URL + "/", APIKey: testKey}
+}
+
+func TestClient(t *testing.T) {
+	ctx := context.Background()
+	f := &fakeServer{}
+	c := serve(t, f)
+
+	p, err := c.Lookup(ctx, "go-distroless", "1.26.0")
+	if err != nil || p != nil {
+		t.Fatalf("lookup of a missing project: %v, %v", p, err)
+	}
+	created, err := c.CreateProject(ctx, Project{Name: "go-distroless", Version: "1.26.0", Active: true, Tags: []Tag{{"factory"}}})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if created.UUID == "" {
+		t.Fatal("created project has no UUID")
+	}
+	if p, err = c.Lookup(ctx, "go-distroless", "1.26.0"); err != nil || p == nil || p.UUID != created.UUID {
+		t.Fatalf("lookup %+v, %v, want %+v", p, err, created)
+	}
+	if _, err := c.CreateProject(ctx, Project{Name: "go-distroless", Version: "1.26.0"}); err == nil {
+		t.Error("created a project twice")
+	}
+
+	token, err := c.UploadBOM(ctx, created.UUID, []byte(`{"bomFormat":"CycloneDX"}`))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if token != "token-1" || f.boms[created.UUID][0] != `{"bomFormat":"CycloneDX"}` {
+		t.Errorf("upload token %q, BOMs %q", token, f.boms[created.UUID])
+	}
+
+	if _, err := c.CreateProject(ctx, Project{Name: "go-distroless", Version: "1.25.0", Active: true, Tags: []Tag{{"factory"}}}); err != nil {
+		t.Fatal(err)
+	}
+	tagged, err := c.TaggedProjects(ctx, "factory")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(tagged) != 2 {
+		t.Errorf("%d tagged projects, want 2", len(tagged))
+	}
+
+	bad := &Client{URL: c.URL, APIKey: "wrong"}
+	_, err = bad.Lookup(ctx, "go-distroless", "1.26.0")
+	if se, ok := err.(*StatusError); !ok || se.Code != http.StatusUnauthorized || se.Path != "/api/v1/project/lookup" {
+		t.Errorf("lookup with a wrong API key: %v, want a 401", err)
+	}
+}
+
+type testSBOMs map[string]string
+
+func (s testSBOMs) SBOM(_ context.Context, ref string) ([]byte, error) {
+	bom, ok := s[ref]
+	if !ok {
+		return nil, fmt.Errorf("no SBOM of %s", ref)
+	}
+	return []byte(bom), nil
+}
+
+// TestSync syncs the projects of a catalog as it changes: variants are
+// published, rebuilt, removed and published again.
+func TestSync(t *testing.T) {
+	ctx := context.Background()
+	f := &fakeServer{}
+	s := &Syncer{
+		Client: serve(t, f),
+		SBOMs: testSBOMs{
+			"registry.test/go@sha256:1": "go 1",
+			"registry.test/go@sha256:2": "go 2",
+			"registry.test/py@sha256:3": "py 3",
+		},
+		Tag:   "factory",
+		State: State{},
+	}
+	goVariant := Variant{Image: "go", Variant: "1.26.0", Repository: "registry.test/go", Digest: "sha256:1"}
+	pyVariant := Variant{Image: "py", Variant: "3.14", Repository: "registry.test/py", Digest: "sha256:3"}
+	unpublished := Variant{Image: "go", Variant: "1.27.0", Repository: "registry.test/go"}
+
+	run := func(variants ...Variant) *Result {
+		t.Helper()
+		res, err := s.Sync(ctx, variants, nil)
+		if err != nil {
+			t.Fatal(err)
+		}
+		for key, err := range res.Failed {
+			t.Errorf("%s: %v", key, err)
+		}
+		return res
+	}
+	expect := func(name string, got []string, want ...string) {
+		t.Helper()
+		if fmt.Sprint(got) != fmt.Sprint(want) {
+			t.Errorf("%s %v, want %v", name, got, want)
+		}
+	}
+
+	res := run(goVariant, pyVariant, unpublished)
+	expect("created", res.Created, "go:1.26.0", "py:3.14")
+	expect("uploaded", res.Uploaded, "go:1.26.0", "py:3.14")
+	goProject := f.find("go", "1.26.0")
+	if goProject == nil || goProject.Classifier != Classifier || goProject.Description != "registry.test/go:1.26.0" {
+		t.Fatalf("go project %+v", goProject)
+	}
+	if f.find("go", "1.27.0") != nil {
+		t.Error("project created for an unpublished variant")
+	}
+
+	res = run(goVariant, pyVariant)
+	expect("unchanged", res.Unchanged, "go:1.26.0", "py:3.14")
+	expect("uploaded", res.Uploaded)
+
+	goVariant.Digest = "sha256:2"
+	res = run(goVariant, pyVariant)
+	expect("uploaded", res.Uploaded, "go:1.26.0")
+	expect("go BOMs", f.boms[goProject.UUID], "go 1", "go 2")
+
+	// A partial sync of go leaves py alone, a full one retires it.
+	if res, err := s.Sync(ctx, []Variant{goVariant}, []string{"go"}); err != nil || len(res.Retired) != 0 {
+		t.Errorf("partial sync retired %v, %v", res.Retired, err)
+	}
+	res = run(goVariant)
+	expect("retired", res.Retired, "py:3.14")
+	if f.find("py", "3.14").Active {
+		t.Error("py project still active")
+	}
+
+	// Published again, py is reactivated and given its SBOM again.
+	s.DryRun = true
+	res = run(goVariant, pyVariant)
+	expect("reactivated", res.Reactivated, "py:3.14")
+	if f.find("py", "3.14").Active {
+		t.Error("dry run reactivated py")
+	}
+	s.DryRun = false
+	res = run(goVariant, pyVariant)
+	expect("reactivated", res.Reactivated, "py:3.14")
+	expect("uploaded", res.Uploaded, "py:3.14")
+	if !f.find("py", "3.14").Active || len(f.boms[f.find("py", "3.14").UUID]) != 2 {
+		t.Error("py not reactivated with its SBOM")
+	}
+}
@@ -0,0 +1,179 @@
+package dtrack
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"os"
+	"path/filepath"
+	"slices"
+)
+
+// Variant is one image variant of the catalog.
+type Variant struct {
+	Image      string
+	Variant    string
+	Repository string
+	// Digest is the published manifest of the variant, "" when it is not
+	// published.
+	Digest string
+}
+
+// Key names the project of the variant.
+func (v Variant) Key() string { return v.Image + ":" + v.Variant }
+
+// Generator produces CycloneDX SBOMs of images.
+type Generator interface {
+	SBOM(ctx context.Context, ref string) ([]byte, error)
+}
+
+// State maps each project (image:variant) to the digest whose SBOM it was
+// last given, so unchanged digests are not uploaded again.
+type State map[string]string
+
+// LoadState reads the state at path. A missing file is an empty state.
+func LoadState(path string) (State, error) {
+	data, err := os.ReadFile(path)
+	if os.IsNotExist(err) {
+		return State{}, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+	s := State{}
+	if err := json.Unmarshal(data, &s); err != nil {
+		return nil, fmt.Errorf("%s: %w", path, err)
+	}
+	return s, nil
+}
+
+// Save writes the state to path.
+func (s State) Save(path string) error {
+	data, err := json.MarshalIndent(s, "", "  ")
+	if err != nil {
+		return err
+	}
+	if err := os.MkdirAll(filepath.Dir(path), 0o755); err != nil {
+		return err
+	}
+	return os.WriteFile(path, append(data, '\n'), 0o644)
+}
+
+// Result is what a sync did, by project key.
+type Result struct {
+	Created     []string
+	Reactivated []string
+	Uploaded    []string
+	Unchanged   []string
+	Retired     []string
+	// Failed variants are left as they were and retried on the next sync.
+	Failed map[string]error
+}
+
+// Syncer keeps the Dependency-Track projects of the factory in step with
+// the catalog.
+type Syncer struct {
+	Client *Client
+	SBOMs  Generator
+	// Tag marks the projects of the factory. A tagged project matching no
+	// variant of the catalog is retired.
+	Tag   string
+	State State
+	// DryRun only reads from Dependency-Track: the result tells what a sync
+	// would do.
+	DryRun bool
+}
+
+// Sync creates a project for every published variant lacking one, uploads
+// the SBOM of the digests the projects have not seen yet, and retires the
+// tagged projects of removed variants. Only the projects of images are
+// retired, or of any image when images is nil, so a partial sync does not
+// retire what it did not look at.
+func (s *Syncer) Sync(ctx context.Context, variants []Variant, images []string) (*Result, error) {
+	res := &Result{Failed: map[string]error{}}
+	known := map[string]bool{}
+	for _, v := range variants {
+		known[v.Key()] = true
+		if v.Digest == "" {
+			continue
+		}
+		if err := s.variant(ctx, v, res); err != nil {
+			res.Failed[v.Key()] = err
+		}
+	}
+
+	tagged, err := s.Client.TaggedProjects(ctx, s.Tag)
+	if err != nil {
+		return res, err
+	}
+	for _, p := range tagged {
+		key := p.Name + ":" + p.Version
+		if !p.Active || known[key] || (images != nil && !slices.Contains(images, p.Name)) {
+			continue
+		}
+		if !s.DryRun {
+			if err := s.Client.SetActive(ctx, p.UUID, false); err != nil {
+				res.Failed[key] = err
+				continue
+			}
+			delete(s.State, key)
+		}
+		res.Retired = append(res.Retired, key)
+	}
+	return res, nil
+}
+
+func (s *Syncer) variant(ctx context.Context, v Variant, res *Result) error {
+	key := v.Key()
+	p, err := s.Client.Lookup(ctx, v.Image, v.Variant)
+	if err != nil {
+		return err
+	}
+	switch {
+	case p == nil:
+		res.Created = append(res.Created, key)
+		if s.DryRun {
+			res.Uploaded = append(res.Uploaded, key)
+			return nil
+		}
+		p, err = s.Client.CreateProject(ctx, Project{
+			Name:        v.Image,
+			Version:     v.Variant,
+			Classifier:  Classifier,
+			Description: v.Repository + ":" + v.Variant,
+			Active:      true,
+			Tags:        []Tag{{Name: s.Tag}},
+		})
+		if err != nil {
+			return err
+		}
+		// A new project has no SBOM, whatever the state says.
+		delete(s.State, key)
+	case !p.Active:
+		res.Reactivated = append(res.Reactivated, key)
+		if !s.DryRun {
+			if err := s.Client.SetActive(ctx, p.UUID, true); err != nil {
+				return err
+			}
+		}
+	}
+
+	if s.State[key] == v.Digest {
+		res.Unchanged = append(res.Unchanged, key)
+		return nil
+	}
+	if s.DryRun {
+		res.Uploaded = append(res.Uploaded, key)
+		return nil
+	}
+	bom, err := s.SBOMs.SBOM(ctx, v.Repository+"@"+v.Digest)
+	if err != nil {
+		return err
+	}
+	if _, err := s.Client.UploadBOM(ctx, p.UUID, bom); err != nil {
+		return err
+	}
+	s.State[key] = v.Digest
+	res.Uploaded = append(res.Uploaded, key)
+	return nil
+}
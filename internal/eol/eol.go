@@ -0,0 +1,61 @@
+// Package eol reads the end-of-life table kept in ci/eol.json, which maps
+// each image to the release cycles of its upstream runtime and the date each
+// cycle stops receiving fixes:
+//
+//	{"python-distroless": {"3.12": "2028-10-31", "3.13": "2029-10-31"}}
+package eol
+
+import (
+	"encoding/json"
+	"fmt"
+	"os"
+	"strings"
+	"time"
+)
+
+// Table maps image name to release cycle to end-of-life date.
+type Table map[string]map[string]time.Time
+
+// Load reads the table at path. A missing file is an empty table.
+func Load(path string) (Table, error) {
+	data, err := os.ReadFile(path)
+	if os.IsNotExist(err) {
+		return Table{}, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+	var raw map[string]map[string]string
+	if err := json.Unmarshal(data, &raw); err != nil {
+		return nil, fmt.Errorf("%s: %w", path, err)
+	}
+
+	t := Table{}
+	for image, cycles := range raw {
+		t[image] = map[string]time.Time{}
+		for cycle, date := range cycles {
+			d, err := time.Parse(time.DateOnly, date)
+			if err != nil {
+				return nil, fmt.Errorf("%s: %s %s: %w", path, image, cycle, err)
+			}
+			t[image][cycle] = d
+		}
+	}
+	return t, nil
+}
+
+// Lookup returns the end-of-life date of the cycle a variant belongs to.
+// The longest cycle that equals the variant or prefixes it at a dot
+// boundary wins, so "3.12.13" matches "3.12" rather than "3".
+func (t Table) Lookup(image, variant string) (time.Time, bool) {
+	best, date := "", time.Time{}
+	for cycle, d := range t[image] {
+		if variant != cycle && !strings.HasPrefix(variant, cycle+".") {
+			continue
+		}
+		if len(cycle) > len(best) {
+			best, date = cycle, d
+		}
+	}
+	return date, best != ""
+}
@@ -0,0 +1,201 @@
+package github
+
+import (
+	"context"
+	"crypto"
+	"crypto/rand"
+	"crypto/rsa"
+	"crypto/sha256"
+	"crypto/x509"
+	"encoding/base64"
+	"encoding/json"
+	"encoding/pem"
+	"errors"
+	"fmt"
+	"net/http"
+	"slices"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+)
+
+// Scope is what an installation token grants: the permissions of the app
+// (e.g. "contents": "write") on the repositories (owner/name). An empty
+// field keeps what the installation has.
+type Scope struct {
+	Repositories []string
+	Permissions  map[string]string
+}
+
+func (s Scope) key() string {
+	repos := slices.Sorted(slices.Values(s.Repositories))
+	perms := make([]string, 0, len(s.Permissions))
+	for p, level := range s.Permissions {
+		perms = append(perms, p+"="+level)
+	}
+	slices.Sort(perms)
+	return strings.Join(repos, ",") + ";" + strings.Join(perms, ",")
+}
+
+// ReadPublic is the scope of the dependency checks, which read public
+// repositories (releases, tags, commits): the token only lifts the rate
+// limit, so it gets nothing beyond metadata.
+var ReadPublic = Scope{Permissions: map[string]string{"metadata": "read"}}
+
+// PullRequests is the scope needed to push a branch of repo and open a pull
+// request from it. Pins updates change workflow files, which GitHub only
+// lets a token with the workflows permission write.
+func PullRequests(repo string) Scope {
+	return Scope{
+		Repositories: []string{repo},
+		Permissions:  map[string]string{"contents": "write", "pull_requests": "write", "workflows": "write"},
+	}
+}
+
+// Contents is the scope needed to commit to a branch of repo.
+func Contents(repo string) Scope {
+	return Scope{
+		Repositories: []string{repo},
+		Permissions:  map[string]string{"contents": "write"},
+	}
+}
+
+// App authenticates as an installation of a GitHub App: a JWT signed with
+// the app's private key is exchanged for installation tokens, which last an
+// hour and are kept until shortly before they expire.
+type App struct {
+	// ID is the app ID or its client ID.
+	ID  string
+	Key *rsa.PrivateKey
+	// Installation is the installation ID. When zero, it is looked up from
+	// the first repository of the scope, or must be the app's only
+	// installation.
+	Installation int64
+
+	mu     sync.Mutex
+	tokens map[string]installationToken
+}
+
+type installationToken struct {
+	token   string
+	expires time.Time
+}
+
+// ParseKey parses the PEM private key GitHub generates for an app (PKCS #1)
+// or its PKCS #8 form.
+func ParseKey(data []byte) (*rsa.PrivateKey, error) {
+	block, _ := pem.Decode(data)
+	if block == nil {
+		return nil, errors.New("app private key: no PEM block")
+	}
+	if key, err := x509.ParsePKCS1PrivateKey(block.Bytes); err == nil {
+		return key, nil
+	}
+	key, err := x509.ParsePKCS8PrivateKey(block.Bytes)
+	if err != nil {
+		return nil, fmt.Errorf("app private key: %w", err)
+	}
+	rsaKey, ok := key.(*rsa.PrivateKey)
+	if !ok {
+		return nil, errors.New("app private key: not an RSA key")
+	}
+	return rsaKey, nil
+}
+
+// JWT returns the token authenticating as the app itself, valid for ten
+// minutes. It is backdated a minute against clock drift, as GitHub
+// recommends.
+func (a *App) JWT(now time.Time) (string, error) {
+	var iss any = a.ID
+	if id, err := strconv.ParseInt(a.ID, 10, 64); err == nil {
+		iss = id
+	}
+	header, _ := json.Marshal(map[string]string{"alg": "RS256", "typ": "JWT"})
+	claims, err := json.Marshal(map[string]any{
+		"iat": now.Add(-time.Minute).Unix(),
+		"exp": now.Add(9 * time.Minute).Unix(),
+		"iss": iss,
+	})
+	if err != nil {
+		return "", err
+	}
+	enc := base64.RawURLEncoding
+	signed := enc.EncodeToString(header) + "." + enc.EncodeToString(claims)
+	sum := sha256.Sum256([]byte(signed))
+	sig, err := rsa.SignPKCS1v15(rand.Reader, a.Key, crypto.SHA256, sum[:])
+	if err != nil {
+		return "", err
+	}
+	return signed + "." + enc.EncodeToString(sig), nil
+}
+
+// token returns an installation token granting scope, exchanging a JWT for
+// a new one when none is cached.
+func (a *App) token(ctx context.Context, c *Client, scope Scope) (string, error) {
+	a.mu.Lock()
+	defer a.mu.Unlock()
+	key := scope.key()
+	if t, ok := a.tokens[key]; ok && time.Until(t.expires) > 5*time.Minute {
+		return t.token, nil
+	}
+
+	jwt, err := a.JWT(time.Now())
+	if err != nil {
+		return "", err
+	}
+	if a.Installation == 0 {
+		if a.Installation, err = a.installation(ctx, c, jwt, scope); err != nil {
+			return "", err
+		}
+	}
+
+	var req struct {
+		Repositories []string          `json:"repositories,omitempty"`
+		Permissions  map[string]string `json:"permissions,omitempty"`
+	}
+	req.Permissions = scope.Permissions
+	for _, repo := range scope.Repositories {
+		// Installation tokens name repositories of the installation's
+		// account without the owner.
+		_, name, _ := strings.Cut(repo, "/")
+		req.Repositories = append(req.Repositories, name)
+	}
+	var resp struct {
+		Token     string    `json:"token"`
+		ExpiresAt time.Time `json:"expires_at"`
+	}
+	path := fmt.Sprintf("/app/installations/%d/access_tokens", a.Installation)
+	if err := c.send(ctx, http.MethodPost, path, jwt, req, &resp); err != nil {
+		return "", fmt.Errorf("installation token: %w", err)
+	}
+	if a.tokens == nil {
+		a.tokens = map[string]installationToken{}
+	}
+	a.tokens[key] = installationToken{resp.Token, resp.ExpiresAt}
+	return resp.Token, nil
+}
+
+// installation looks up the installation of the app on the first repository
+// of scope, or its only installation.
+func (a *App) installation(ctx context.Context, c *Client, jwt string, scope Scope) (int64, error) {
+	if len(scope.Repositories) > 0 {
+		var inst struct {
+			ID int64 `json:"id"`
+		}
+		if err := c.send(ctx, http.MethodGet, "/repos/"+scope.Repositories[0]+"/installation", jwt, nil, &inst); err != nil {
+			return 0, fmt.Errorf("app installation: %w", err)
+		}
+		return inst.ID, nil
+	}
+	var insts []struct {
+		ID int64 `json:"id"`
+	}
+	if err := c.send(ctx, http.MethodGet, "/app/installations", jwt, nil, &insts); err != nil {
+		return 0, fmt.Errorf("app installations: %w", err)
+	}
+	if len(insts) != 1 {
+		return 0, fmt.Errorf("app has %d installations, set the installation ID", len(insts))
+	}
+	return insts[0].ID, nil
+}
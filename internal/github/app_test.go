@@ -0,0 +1,182 @@
+package github
+
+import (
+	"context"
+	"crypto"
+	"crypto/rand"
+	"crypto/rsa"
+	"crypto/sha256"
+	"encoding/base64"
+	"encoding/json"
+	"maps"
+	"net/http"
+	"net/http/httptest"
+	"slices"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+)
+
+func testApp(t *testing.T) *App {
+	t.Helper()
+	key, err := rsa.GenerateKey(rand.Reader, 2048)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return &App{ID: "1234", Key: key}
+}
+
+// verifyJWT checks the signature of token with the app's key and returns
+// its claims.
+func verifyJWT(t *testing.T, a *App, token string) map[string]any {
+	t.Helper()
+	parts := strings.Split(token, ".")
+	if len(parts) != 3 {
+		t.Fatalf("JWT %q has %d parts", token, len(parts))
+	}
+	enc := base64.RawURLEncoding
+	sig, err := enc.DecodeString(parts[2])
+	if err != nil {
+		t.Fatal(err)
+	}
+	sum := sha256.Sum256([]byte(parts[0] + "." + parts[1]))
+	if err := rsa.VerifyPKCS1v15(&a.Key.PublicKey, crypto.SHA256, sum[:], sig); err != nil {
+		t.Fatalf("JWT signature: %v", err)
+	}
+	var header map[string]string
+	var claims map[string]any
+	for i, v := range []any{&header, &claims} {
+		data, err := enc.DecodeString(parts[i])
+		if err != nil {
+			t.Fatal(err)
+		}
+		if err := json.Unmarshal(data, v); err != nil {
+			t.Fatal(err)
+		}
+	}
+	if header["alg"] != "RS256" || header["typ"] != "JWT" {
+		t.Errorf("JWT header %v", header)
+	}
+	return claims
+}
+
+func TestJWT(t *testing.T) {
+	a := testApp(t)
+	now := time.Unix(1_800_000_000, 0)
+	token, err := a.JWT(now)
+	if err != nil {
+		t.Fatal(err)
+	}
+	claims := verifyJWT(t, a, token)
+	// A numeric app ID is a number claim, a client ID a string.
+	if claims["iss"] != float64(1234) {
+		t.Errorf("iss %v, want 1234", claims["iss"])
+	}
+	if claims["iat"] != float64(now.Unix()-60) || claims["exp"] != float64(now.Unix()+540) {
+		t.Errorf("iat %v and exp %v, want a minute before and nine minutes after %d", claims["iat"], claims["exp"], now.Unix())
+	}
+
+	a.ID = "Iv23liExample"
+	if token, err = a.JWT(now); err != nil {
+		t.Fatal(err)
+	}
+	if iss := verifyJWT(t, a, token)["iss"]; iss != "Iv23liExample" {
+		t.Errorf("iss %v, want the client ID", iss)
+	}
+}
+
+// fakeApp is the part of the GitHub API exchanging app JWTs for
+// installation tokens, and a repository API checking them.
+type fakeApp struct {
+	t   *testing.T
+	app *App
+
+	mu sync.Mutex
+	// exchanges are the access token requests made.
+	exchanges []tokenRequest
+	// tokens are the scopes of the tokens issued.
+	tokens map[string]tokenRequest
+}
+
+type tokenRequest struct {
+	Repositories []string          `json:"repositories"`
+	Permissions  map[string]string `json:"permissions"`
+}
+
+func (f *fakeApp) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	auth := strings.TrimPrefix(r.Header.Get("Authorization"), "Bearer ")
+	switch {
+	case r.Method == http.MethodGet && r.URL.Path == "/repos/owner/repo/installation":
+		verifyJWT(f.t, f.app, auth)
+		w.Write([]byte(`{"id": 42}`))
+	case r.Method == http.MethodPost && r.URL.Path == "/app/installations/42/access_tokens":
+		verifyJWT(f.t, f.app, auth)
+		var req tokenRequest
+		if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+			http.Error(w, err.Error(), http.StatusBadRequest)
+			return
+		}
+		f.exchanges = append(f.exchanges, req)
+		if f.tokens == nil {
+			f.tokens = map[string]tokenRequest{}
+		}
+		token := "ghs_" + string(rune('a'+len(f.tokens)))
+		f.tokens[token] = req
+		json.NewEncoder(w).Encode(map[string]any{"token": token, "expires_at": time.Now().Add(time.Hour)})
+	case r.Method == http.MethodGet && r.URL.Path == "/repos/owner/repo/commits/main":
+		req, ok := f.tokens[auth]
+		if !ok || !slices.Contains(req.Repositories, "repo") {
+			http.Error(w, `{"message": "Bad credentials"}`, http.StatusUnauthorized)
+			return
+		}
+		w.Write([]byte(`{"sha": "abc123"}`))
+	default:
+		http.NotFound(w, r)
+	}
+}
+
+// TestAppToken exchanges JWTs for installation tokens scoped to the
+// repositories and permissions of each client, and reuses them.
+func TestAppToken(t *testing.T) {
+	ctx := context.Background()
+	f := &fakeApp{t: t, app: testApp(t)}
+	srv := httptest.NewServer(f)
+	defer srv.Close()
+	c := &Client{API: srv.URL, App: f.app}
+
+	pr := c.Scoped(PullRequests("owner/repo"))
+	for range 2 {
+		sha, err := pr.Commit(ctx, "owner/repo", "main")
+		if err != nil {
+			t.Fatal(err)
+		}
+		if sha != "abc123" {
+			t.Errorf("commit %s, want abc123", sha)
+		}
+	}
+	if len(f.exchanges) != 1 {
+		t.Fatalf("%d token exchanges, want the token reused", len(f.exchanges))
+	}
+	if f.app.Installation != 42 {
+		t.Errorf("installation %d, want the one of owner/repo", f.app.Installation)
+	}
+	want := tokenRequest{
+		Repositories: []string{"repo"},
+		Permissions:  map[string]string{"contents": "write", "pull_requests": "write", "workflows": "write"},
+	}
+	if got := f.exchanges[0]; !slices.Equal(got.Repositories, want.Repositories) || !maps.Equal(got.Permissions, want.Permissions) {
+		t.Errorf("token requested for %+v, want %+v", got, want)
+	}
+
+	// Another scope gets a token of its own, which the repository API
+	// refuses since it names no repository.
+	if _, err := c.Scoped(ReadPublic).Commit(ctx, "owner/repo", "main"); err == nil {
+		t.Error("a metadata token read the repository")
+	}
+	if len(f.exchanges) != 2 || f.exchanges[1].Repositories != nil || f.exchanges[1].Permissions["metadata"] != "read" {
+		t.Errorf("token requests %+v, want a second one for metadata: read", f.exchanges)
+	}
+}
@@ -0,0 +1,124 @@
+package github
+
+import (
+	"context"
+	"encoding/base64"
+	"fmt"
+	"maps"
+	"net/http"
+	"net/url"
+	"slices"
+)
+
+// File returns the content of path in repo at ref.
+func (c *Client) File(ctx context.Context, repo, path, ref string) ([]byte, error) {
+	var f struct {
+		Content  string `json:"content"`
+		Encoding string `json:"encoding"`
+	}
+	if err := c.get(ctx, "/repos/"+repo+"/contents/"+path+"?ref="+url.QueryEscape(ref), &f); err != nil {
+		return nil, err
+	}
+	if f.Encoding != "base64" {
+		return nil, fmt.Errorf("%s: unsupported content encoding %q", path, f.Encoding)
+	}
+	return base64.StdEncoding.DecodeString(f.Content)
+}
+
+// Branch returns the commit branch of repo points to.
+func (c *Client) Branch(ctx context.Context, repo, branch string) (string, error) {
+	var ref struct {
+		Object struct {
+			SHA string `json:"sha"`
+		} `json:"object"`
+	}
+	if err := c.get(ctx, "/repos/"+repo+"/git/ref/heads/"+branch, &ref); err != nil {
+		return "", err
+	}
+	return ref.Object.SHA, nil
+}
+
+// SetBranch points branch of repo at commit sha, creating the branch if
+// needed. An existing branch is force-updated.
+func (c *Client) SetBranch(ctx context.Context, repo, branch, sha string) error {
+	_, err := c.Branch(ctx, repo, branch)
+	switch {
+	case IsNotFound(err):
+		return c.do(ctx, http.MethodPost, "/repos/"+repo+"/git/refs",
+			map[string]string{"ref": "refs/heads/" + branch, "sha": sha}, nil)
+	case err != nil:
+		return err
+	}
+	return c.do(ctx, http.MethodPatch, "/repos/"+repo+"/git/refs/heads/"+branch,
+		map[string]any{"sha": sha, "force": true}, nil)
+}
+
+// CommitFiles commits files on top of parent, with the rest of the tree
+// unchanged, and returns the new commit. An empty parent makes a root
+// commit holding only files. Files keep the mode of the file they replace
+// (an executable script stays executable); new ones are regular files.
+// GitHub signs the commits of App installation tokens and GITHUB_TOKEN,
+// not those of a personal access token.
+func (c *Client) CommitFiles(ctx context.Context, repo, parent, message string, files map[string][]byte) (string, error) {
+	treeReq := map[string]any{}
+	parents := []string{}
+	modes := map[string]string{}
+	if parent != "" {
+		var base struct {
+			Tree struct {
+				SHA string `json:"sha"`
+			} `json:"tree"`
+		}
+		if err := c.get(ctx, "/repos/"+repo+"/git/commits/"+parent, &base); err != nil {
+			return "", err
+		}
+		treeReq["base_tree"] = base.Tree.SHA
+		parents = append(parents, parent)
+
+		var baseTree struct {
+			Tree []struct {
+				Path string `json:"path"`
+				Mode string `json:"mode"`
+			} `json:"tree"`
+		}
+		if err := c.get(ctx, "/repos/"+repo+"/git/trees/"+base.Tree.SHA+"?recursive=1", &baseTree); err != nil {
+			return "", err
+		}
+		for _, e := range baseTree.Tree {
+			if _, ok := files[e.Path]; ok {
+				modes[e.Path] = e.Mode
+			}
+		}
+	}
+
+	type entry struct {
+		Path    string `json:"path"`
+		Mode    string `json:"mode"`
+		Type    string `json:"type"`
+		Content string `json:"content"`
+	}
+	var entries []entry
+	for _, path := range slices.Sorted(maps.Keys(files)) {
+		mode := modes[path]
+		if mode == "" {
+			mode = "100644"
+		}
+		entries = append(entries, entry{path, mode, "blob", string(files[path])})
+	}
+	treeReq["tree"] = entries
+	var tree struct {
+		SHA string `json:"sha"`
+	}
+	if err := c.do(ctx, http.MethodPost, "/repos/"+repo+"/git/trees", treeReq, &tree); err != nil {
+		return "", err
+	}
+
+	var commit struct {
+		SHA string `json:"sha"`
+	}
+	if err := c.do(ctx, http.MethodPost, "/repos/"+repo+"/git/commits",
+		map[string]any{"message": message, "tree": tree.SHA, "parents": parents}, &commit); err != nil {
+		return "", err
+	}
+	return commit.SHA, nil
+}
@@ -0,0 +1,227 @@
+package github
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"maps"
+	"net/http"
+	"net/http/httptest"
+	"slices"
+	"strings"
+	"sync"
+	"testing"
+)
+
+// fakeGit is the git data and pulls API of owner/repo, with commits
+// holding the tree they were given.
+type fakeGit struct {
+	mu      sync.Mutex
+	trees   []map[string]any
+	commits map[string]map[string]any
+	refs    map[string]string
+	forced  bool
+	pulls   []map[string]string
+}
+
+func newFakeGit() *fakeGit {
+	return &fakeGit{
+		commits: map[string]map[string]any{"base": {"tree": map[string]string{"sha": "base-tree"}}},
+		refs:    map[string]string{"main": "base"},
+	}
+}
+
+func (f *fakeGit) handler() http.Handler {
+	mux := http.NewServeMux()
+	mux.HandleFunc("GET /repos/owner/repo/git/commits/{sha}", func(w http.ResponseWriter, r *http.Request) {
+		c, ok := f.commits[r.PathValue("sha")]
+		if !ok {
+			http.NotFound(w, r)
+			return
+		}
+		json.NewEncoder(w).Encode(c)
+	})
+	mux.HandleFunc("GET /repos/owner/repo/git/trees/base-tree", func(w http.ResponseWriter, r *http.Request) {
+		if r.URL.Query().Get("recursive") == "" {
+			http.Error(w, "not recursive", http.StatusBadRequest)
+			return
+		}
+		fmt.Fprint(w, `{"sha": "base-tree", "tree": [
+			{"path": "ci", "mode": "040000", "type": "tree"},
+			{"path": "ci/build.sh", "mode": "100755", "type": "blob"},
+			{"path": "ci/pins.json", "mode": "100644", "type": "blob"}
+		]}`)
+	})
+	mux.HandleFunc("POST /repos/owner/repo/git/trees", func(w http.ResponseWriter, r *http.Request) {
+		var tree map[string]any
+		json.NewDecoder(r.Body).Decode(&tree)
+		f.trees = append(f.trees, tree)
+		w.WriteHeader(http.StatusCreated)
+		fmt.Fprintf(w, `{"sha": "tree-%d"}`, len(f.trees))
+	})
+	mux.HandleFunc("POST /repos/owner/repo/git/commits", func(w http.ResponseWriter, r *http.Request) {
+		var c map[string]any
+		json.NewDecoder(r.Body).Decode(&c)
+		sha := fmt.Sprintf("commit-%d", len(f.commits))
+		c["tree"] = map[string]any{"sha": c["tree"]}
+		f.commits[sha] = c
+		w.WriteHeader(http.StatusCreated)
+		fmt.Fprintf(w, `{"sha": %q}`, sha)
+	})
+	mux.HandleFunc("GET /repos/owner/repo/git/ref/heads/{branch...}", func(w http.ResponseWriter, r *http.Request) {
+		sha, ok := f.refs[r.PathValue("branch")]
+		if !ok {
+			http.Error(w, `{"message": "Not Found"}`, http.StatusNotFound)
+			return
+		}
+		fmt.Fprintf(w, `{"object": {"sha": %q}}`, sha)
+	})
+	mux.HandleFunc("POST /repos/owner/repo/git/refs", func(w http.ResponseWriter, r *http.Request) {
+		var ref struct{ Ref, SHA string }
+		json.NewDecoder(r.Body).Decode(&ref)
+		branch, ok := strings.CutPrefix(ref.Ref, "refs/heads/")
+		if _, exists := f.refs[branch]; !ok || exists {
+			http.Error(w, `{"message": "Reference already exists"}`, http.StatusUnprocessableEntity)
+			return
+		}
+		f.refs[branch] = ref.SHA
+		w.WriteHeader(http.StatusCreated)
+	})
+	mux.HandleFunc("PATCH /repos/owner/repo/git/refs/heads/{branch...}", func(w http.ResponseWriter, r *http.Request) {
+		var ref struct {
+			SHA   string
+			Force bool
+		}
+		json.NewDecoder(r.Body).Decode(&ref)
+		f.refs[r.PathValue("branch")], f.forced = ref.SHA, ref.Force
+	})
+	mux.HandleFunc("GET /repos/owner/repo/pulls", func(w http.ResponseWriter, r *http.Request) {
+		q := r.URL.Query()
+		var out []map[string]any
+		for i, pr := range f.pulls {
+			if q.Get("state") == "open" && "owner:"+pr["head"] == q.Get("head") && pr["base"] == q.Get("base") {
+				out = append(out, map[string]any{"number": i + 1, "html_url": fmt.Sprintf("https://github.invalid/pull/%d", i+1)})
+			}
+		}
+		json.NewEncoder(w).Encode(out)
+	})
+	mux.HandleFunc("POST /repos/owner/repo/pulls", func(w http.ResponseWriter, r *http.Request) {
+		var pr map[string]string
+		json.NewDecoder(r.Body).Decode(&pr)
+		f.pulls = append(f.pulls, pr)
+		w.WriteHeader(http.StatusCreated)
+		fmt.Fprintf(w, `{"number": %d, "html_url": "https://github.invalid/pull/%d"}`, len(f.pulls), len(f.pulls))
+	})
+	mux.HandleFunc("PATCH /repos/owner/repo/pulls/{number}", func(w http.ResponseWriter, r *http.Request) {
+		var n int
+		fmt.Sscan(r.PathValue("number"), &n)
+		if n < 1 || n > len(f.pulls) {
+			http.NotFound(w, r)
+			return
+		}
+		var edit map[string]string
+		json.NewDecoder(r.Body).Decode(&edit)
+		maps.Copy(f.pulls[n-1], edit)
+	})
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		f.mu.Lock()
+		defer f.mu.Unlock()
+		mux.ServeHTTP(w, r)
+	})
+}
+
+// TestPullRequestFlow commits files on top of main, keeping the mode of
+// the files they replace, points a branch at the commit, creating then
+// force-updating it, and opens then refreshes the pull request of the
+// branch.
+func TestPullRequestFlow(t *testing.T) {
+	ctx := context.Background()
+	f := newFakeGit()
+	srv := httptest.NewServer(f.handler())
+	defer srv.Close()
+	c := &Client{API: srv.URL, Token: "token"}
+	const repo, branch = "owner/repo", "factory/update"
+
+	parent, err := c.Branch(ctx, repo, "main")
+	if err != nil {
+		t.Fatal(err)
+	}
+	sha, err := c.CommitFiles(ctx, repo, parent, "Update pins", map[string][]byte{
+		"ci/pins.json":                 []byte("{}\n"),
+		"ci/build.sh":                  []byte("#!/bin/sh\n"),
+		".github/workflows/build.yaml": []byte("on: push\n"),
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	tree := f.trees[0]
+	if tree["base_tree"] != "base-tree" {
+		t.Errorf("tree based on %v, want the tree of the parent", tree["base_tree"])
+	}
+	var paths []string
+	for _, e := range tree["tree"].([]any) {
+		e := e.(map[string]any)
+		mode := "100644"
+		if e["path"] == "ci/build.sh" {
+			mode = "100755"
+		}
+		if e["mode"] != mode || e["type"] != "blob" {
+			t.Errorf("%v: mode %v, type %v", e["path"], e["mode"], e["type"])
+		}
+		paths = append(paths, e["path"].(string))
+	}
+	if want := []string{".github/workflows/build.yaml", "ci/build.sh", "ci/pins.json"}; !slices.Equal(paths, want) {
+		t.Errorf("tree entries %v, want %v", paths, want)
+	}
+	if parents := f.commits[sha]["parents"]; fmt.Sprint(parents) != "[base]" {
+		t.Errorf("commit parents %v, want [base]", parents)
+	}
+
+	if err := c.SetBranch(ctx, repo, branch, sha); err != nil {
+		t.Fatal(err)
+	}
+	if f.refs[branch] != sha || f.forced {
+		t.Errorf("branch at %s (forced %t), want created at %s", f.refs[branch], f.forced, sha)
+	}
+	again, err := c.CommitFiles(ctx, repo, parent, "Update pins", map[string][]byte{"ci/pins.json": []byte("[]\n")})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := c.SetBranch(ctx, repo, branch, again); err != nil {
+		t.Fatal(err)
+	}
+	if f.refs[branch] != again || !f.forced {
+		t.Errorf("branch at %s (forced %t), want force-updated to %s", f.refs[branch], f.forced, again)
+	}
+
+	pr, err := c.OpenPullRequest(ctx, repo, branch, "main")
+	if err != nil || pr != nil {
+		t.Fatalf("open pull request %v, %v before any was created", pr, err)
+	}
+	created, err := c.CreatePullRequest(ctx, repo, branch, "main", "Update pins", "first")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if pr, err = c.OpenPullRequest(ctx, repo, branch, "main"); err != nil {
+		t.Fatal(err)
+	}
+	if pr == nil || pr.Number != created.Number || pr.URL != created.URL {
+		t.Fatalf("open pull request %+v, want %+v", pr, created)
+	}
+	if err := c.EditPullRequest(ctx, repo, pr.Number, "Update pins", "second"); err != nil {
+		t.Fatal(err)
+	}
+	if body := f.pulls[0]["body"]; body != "second" {
+		t.Errorf("pull request body %q, want it replaced", body)
+	}
+
+	err = c.EditPullRequest(ctx, repo, 99, "x", "y")
+	if !IsNotFound(fmt.Errorf("edit: %w", err)) {
+		t.Errorf("editing a missing pull request: %v, want a wrapped 404", err)
+	}
+	var se *StatusError
+	if !errors.As(err, &se) || se.Method != http.MethodPatch || se.Path != "/repos/owner/repo/pulls/99" {
+		t.Errorf("error %v does not name the request", err)
+	}
+}
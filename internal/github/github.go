@@ -0,0 +1,192 @@
+// Package github is a small GitHub REST API client covering the calls the
+// factory makes: the dependency checks, the update pull requests and the
+// release records of published images.
+//
+// Requests are authenticated with a token (a fine-grained personal access
+// token, or the workflow's GITHUB_TOKEN) or as an installation of a GitHub
+// App, in which case every operation gets a short-lived installation token
+// restricted to the repositories and permissions it needs (see Scoped).
+package github
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"strings"
+)
+
+// Client calls the GitHub REST API. The zero value is anonymous and talks
+// to api.github.com.
+type Client struct {
+	// API is the API root, https://api.github.com by default.
+	API   string
+	Token string
+	// App, when set, takes precedence over Token: requests use installation
+	// tokens of the app limited to Scope.
+	App   *App
+	Scope Scope
+	HTTP  *http.Client
+}
+
+// StatusError is an unexpected API response.
+type StatusError struct {
+	Method string
+	Path   string
+	Status string
+	Code   int
+	// Message is the error message GitHub returned, if any.
+	Message string
+}
+
+func (e *StatusError) Error() string {
+	if e.Message != "" {
+		return fmt.Sprintf("%s %s: %s: %s", e.Method, e.Path, e.Status, e.Message)
+	}
+	return fmt.Sprintf("%s %s: %s", e.Method, e.Path, e.Status)
+}
+
+// IsNotFound reports whether err is a 404 response.
+func IsNotFound(err error) bool {
+	var se *StatusError
+	return errors.As(err, &se) && se.Code == http.StatusNotFound
+}
+
+// Scoped returns a copy of c whose App installation tokens only grant s.
+// Tokens cannot be narrowed after they are issued, so a client using Token
+// is returned as is: give a fine-grained token only what the workflow using
+// it needs.
+func (c *Client) Scoped(s Scope) *Client {
+	scoped := *c
+	scoped.Scope = s
+	return &scoped
+}
+
+func (c *Client) api() string {
+	if c.API == "" {
+		return "https://api.github.com"
+	}
+	return strings.TrimSuffix(c.API, "/")
+}
+
+func (c *Client) token(ctx context.Context) (string, error) {
+	if c.App != nil {
+		return c.App.token(ctx, c, c.Scope)
+	}
+	return c.Token, nil
+}
+
+func (c *Client) get(ctx context.Context, path string, v any) error {
+	return c.do(ctx, http.MethodGet, path, nil, v)
+}
+
+// do sends in (JSON encoded, when not nil) to path and decodes the JSON
+// response into v, when not nil. Any status but 200, 201 and 204 is a
+// StatusError.
+func (c *Client) do(ctx context.Context, method, path string, in, v any) error {
+	token, err := c.token(ctx)
+	if err != nil {
+		return err
+	}
+	return c.send(ctx, method, path, token, in, v)
+}
+
+// send is do with an explicit bearer token.
+func (c *Client) send(ctx context.Context, method, path, token string, in, v any) error {
+	var body []byte
+	contentType := ""
+	if in != nil {
+		data, err := json.Marshal(in)
+		if err != nil {
+			return err
+		}
+		body, contentType = data, "application/json"
+	}
+	return c.exchange(ctx, method, c.api()+path, path, token, contentType, body, v)
+}
+
+// exchange sends body (when not nil) to url and decodes the JSON response
+// into v, when not nil. path names the request in errors.
+func (c *Client) exchange(ctx context.Context, method, url, path, token, contentType string, body []byte, v any) error {
+	var r io.Reader
+	if body != nil {
+		r = bytes.NewReader(body)
+	}
+	req, err := http.NewRequestWithContext(ctx, method, url, r)
+	if err != nil {
+		return err
+	}
+	req.Header.Set("Accept", "application/vnd.github+json")
+	req.Header.Set("X-GitHub-Api-Version", "2022-11-28")
+	if contentType != "" {
+		req.Header.Set("Content-Type", contentType)
+	}
+	if token != "" {
+		req.Header.Set("Authorization", "Bearer "+token)
+	}
+	client := c.HTTP
+	if client == nil {
+		client = http.DefaultClient
+	}
+	resp, err := client.Do(req)
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+	switch resp.StatusCode {
+	case http.StatusOK, http.StatusCreated:
+	case http.StatusNoContent:
+		return nil
+	default:
+		se := &StatusError{Method: method, Path: path, Status: resp.Status, Code: resp.StatusCode}
+		var msg struct {
+			Message string `json:"message"`
+		}
+		if json.NewDecoder(io.LimitReader(resp.Body, 64<<10)).Decode(&msg) == nil {
+			se.Message = msg.Message
+		}
+		return se
+	}
+	if v == nil {
+		return nil
+	}
+	if err := json.NewDecoder(resp.Body).Decode(v); err != nil {
+		return fmt.Errorf("%s %s: %w", method, path, err)
+	}
+	return nil
+}
+
+// Releases returns the versions of the latest 30 published, non-prerelease
+// releases of repo whose tag starts with prefix, with the prefix removed.
+func (c *Client) Releases(ctx context.Context, repo, prefix string) ([]string, error) {
+	var releases []struct {
+		TagName    string `json:"tag_name"`
+		Draft      bool   `json:"draft"`
+		Prerelease bool   `json:"prerelease"`
+	}
+	if err := c.get(ctx, "/repos/"+repo+"/releases?per_page=30", &releases); err != nil {
+		return nil, err
+	}
+	var versions []string
+	for _, r := range releases {
+		if r.Draft || r.Prerelease || !strings.HasPrefix(r.TagName, prefix) {
+			continue
+		}
+		versions = append(versions, strings.TrimPrefix(r.TagName, prefix))
+	}
+	return versions, nil
+}
+
+// Commit resolves ref (a branch, tag or SHA) of repo to a commit SHA.
+func (c *Client) Commit(ctx context.Context, repo, ref string) (string, error) {
+	var commit struct {
+		SHA string `json:"sha"`
+	}
+	if err := c.get(ctx, "/repos/"+repo+"/commits/"+ref, &commit); err != nil {
+		return "", err
+	}
+	return commit.SHA, nil
+}
@@ -0,0 +1,186 @@
+// Package memory is an in-process stand-in for the GitHub releases API,
+// holding releases and their assets in memory, so release records can be
+// exercised without GitHub. Assets are uploaded to the same server, under
+// /uploads/.
+package memory
+
+import (
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/http"
+	"strconv"
+	"strings"
+	"sync"
+
+	"github.com/gillouche/container-factory/internal/github"
+)
+
+// Releases serves the releases of any repository. The zero value is ready
+// to use.
+type Releases struct {
+	mu       sync.Mutex
+	releases []*github.Release
+	repos    map[int64]string
+	assets   map[int64]map[string][]byte
+	nextID   int64
+}
+
+// Release returns the release of tag in repo, nil if there is none.
+func (s *Releases) Release(repo, tag string) *github.Release {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return s.find(repo, tag)
+}
+
+// Asset returns the content of the asset name of the release id.
+func (s *Releases) Asset(id int64, name string) ([]byte, bool) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	data, ok := s.assets[id][name]
+	return data, ok
+}
+
+// Count returns the number of releases of repo.
+func (s *Releases) Count(repo string) int {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	n := 0
+	for _, r := range s.releases {
+		if s.repos[r.ID] == repo {
+			n++
+		}
+	}
+	return n
+}
+
+func (s *Releases) find(repo, tag string) *github.Release {
+	for _, r := range s.releases {
+		if s.repos[r.ID] == repo && r.TagName == tag {
+			return r
+		}
+	}
+	return nil
+}
+
+// ServeHTTP implements /repos/{owner}/{name}/releases[/tags/{tag}|/{id}]
+// and asset uploads to /uploads/{id}?name=.
+func (s *Releases) ServeHTTP(w http.ResponseWriter, req *http.Request) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if s.repos == nil {
+		s.repos = map[int64]string{}
+		s.assets = map[int64]map[string][]byte{}
+	}
+
+	if id, ok := strings.CutPrefix(req.URL.Path, "/uploads/"); ok {
+		s.upload(w, req, id)
+		return
+	}
+	parts := strings.SplitN(strings.TrimPrefix(req.URL.Path, "/repos/"), "/", 4)
+	if len(parts) < 3 || parts[2] != "releases" {
+		writeError(w, http.StatusNotFound, "Not Found")
+		return
+	}
+	repo := parts[0] + "/" + parts[1]
+	rest := ""
+	if len(parts) == 4 {
+		rest = parts[3]
+	}
+
+	switch {
+	case rest == "" && req.Method == http.MethodPost:
+		var r github.Release
+		if err := json.NewDecoder(req.Body).Decode(&r); err != nil {
+			writeError(w, http.StatusBadRequest, err.Error())
+			return
+		}
+		if s.find(repo, r.TagName) != nil {
+			writeError(w, http.StatusUnprocessableEntity, "Validation Failed")
+			return
+		}
+		s.nextID++
+		r.ID = s.nextID
+		r.HTMLURL = fmt.Sprintf("http://%s/%s/releases/tag/%s", req.Host, repo, r.TagName)
+		r.UploadURL = fmt.Sprintf("http://%s/uploads/%d{?name,label}", req.Host, r.ID)
+		s.releases = append(s.releases, &r)
+		s.repos[r.ID] = repo
+		writeJSON(w, http.StatusCreated, r)
+	case strings.HasPrefix(rest, "tags/") && req.Method == http.MethodGet:
+		r := s.find(repo, strings.TrimPrefix(rest, "tags/"))
+		if r == nil {
+			writeError(w, http.StatusNotFound, "Not Found")
+			return
+		}
+		writeJSON(w, http.StatusOK, r)
+	case rest != "" && req.Method == http.MethodPatch:
+		id, _ := strconv.ParseInt(rest, 10, 64)
+		r := s.byID(id)
+		if r == nil || s.repos[id] != repo {
+			writeError(w, http.StatusNotFound, "Not Found")
+			return
+		}
+		var edit struct {
+			Name *string `json:"name"`
+			Body *string `json:"body"`
+		}
+		if err := json.NewDecoder(req.Body).Decode(&edit); err != nil {
+			writeError(w, http.StatusBadRequest, err.Error())
+			return
+		}
+		if edit.Name != nil {
+			r.Name = *edit.Name
+		}
+		if edit.Body != nil {
+			r.Body = *edit.Body
+		}
+		writeJSON(w, http.StatusOK, r)
+	default:
+		writeError(w, http.StatusNotFound, "Not Found")
+	}
+}
+
+func (s *Releases) byID(id int64) *github.Release {
+	for _, r := range s.releases {
+		if r.ID == id {
+			return r
+		}
+	}
+	return nil
+}
+
+func (s *Releases) upload(w http.ResponseWriter, req *http.Request, id string) {
+	n, _ := strconv.ParseInt(id, 10, 64)
+	r := s.byID(n)
+	name := req.URL.Query().Get("name")
+	switch {
+	case req.Method != http.MethodPost || r == nil:
+		writeError(w, http.StatusNotFound, "Not Found")
+		return
+	case name == "" || r.HasAsset(name):
+		writeError(w, http.StatusUnprocessableEntity, "Validation Failed")
+		return
+	}
+	data, err := io.ReadAll(req.Body)
+	if err != nil {
+		writeError(w, http.StatusBadRequest, err.Error())
+		return
+	}
+	if s.assets[n] == nil {
+		s.assets[n] = map[string][]byte{}
+	}
+	s.assets[n][name] = data
+	a := github.Asset{ID: int64(len(s.assets[n])), Name: name, Size: int64(len(data))}
+	r.Assets = append(r.Assets, a)
+	writeJSON(w, http.StatusCreated, a)
+}
+
+func writeJSON(w http.ResponseWriter, status int, v any) {
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(status)
+	json.NewEncoder(w).Encode(v)
+}
+
+func writeError(w http.ResponseWriter, status int, message string) {
+	writeJSON(w, status, map[string]string{"message": message})
+}
@@ -0,0 +1,47 @@
+package github
+
+import (
+	"context"
+	"fmt"
+	"net/http"
+	"net/url"
+	"strings"
+)
+
+// PullRequest is an open pull request.
+type PullRequest struct {
+	Number int    `json:"number"`
+	URL    string `json:"html_url"`
+}
+
+// OpenPullRequest returns the open pull request of repo from head (a branch
+// of repo) into base, or nil.
+func (c *Client) OpenPullRequest(ctx context.Context, repo, head, base string) (*PullRequest, error) {
+	owner, _, _ := strings.Cut(repo, "/")
+	q := url.Values{"state": {"open"}, "head": {owner + ":" + head}, "base": {base}}
+	var prs []PullRequest
+	if err := c.get(ctx, "/repos/"+repo+"/pulls?"+q.Encode(), &prs); err != nil {
+		return nil, err
+	}
+	if len(prs) == 0 {
+		return nil, nil
+	}
+	return &prs[0], nil
+}
+
+// CreatePullRequest opens a pull request of repo from head into base.
+func (c *Client) CreatePullRequest(ctx context.Context, repo, head, base, title, body string) (*PullRequest, error) {
+	var pr PullRequest
+	err := c.do(ctx, http.MethodPost, "/repos/"+repo+"/pulls",
+		map[string]string{"title": title, "body": body, "head": head, "base": base}, &pr)
+	if err != nil {
+		return nil, err
+	}
+	return &pr, nil
+}
+
+// EditPullRequest replaces the title and body of pull request number.
+func (c *Client) EditPullRequest(ctx context.Context, repo string, number int, title, body string) error {
+	return c.do(ctx, http.MethodPatch, fmt.Sprintf("/repos/%s/pulls/%d", repo, number),
+		map[string]string{"title": title, "body": body}, nil)
+}
@@ -0,0 +1,91 @@
+package github
+
+import (
+	"context"
+	"fmt"
+	"net/http"
+	"net/url"
+	"strconv"
+	"strings"
+)
+
+// Release is a GitHub release.
+type Release struct {
+	ID      int64  `json:"id,omitempty"`
+	TagName string `json:"tag_name"`
+	// Target is the commit the tag is created on when it does not exist.
+	Target string `json:"target_commitish,omitempty"`
+	Name   string `json:"name"`
+	Body   string `json:"body"`
+	// MakeLatest is "true", "false" or "legacy" (latest by date and
+	// version), GitHub's default.
+	MakeLatest string  `json:"make_latest,omitempty"`
+	HTMLURL    string  `json:"html_url,omitempty"`
+	UploadURL  string  `json:"upload_url,omitempty"`
+	Assets     []Asset `json:"assets,omitempty"`
+}
+
+// Asset is a file attached to a release.
+type Asset struct {
+	ID   int64  `json:"id"`
+	Name string `json:"name"`
+	Size int64  `json:"size"`
+}
+
+// HasAsset reports whether the release has an asset named name.
+func (r *Release) HasAsset(name string) bool {
+	for _, a := range r.Assets {
+		if a.Name == name {
+			return true
+		}
+	}
+	return false
+}
+
+// ReleaseByTag returns the release of tag in repo, drafts excluded.
+func (c *Client) ReleaseByTag(ctx context.Context, repo, tag string) (*Release, error) {
+	var r Release
+	if err := c.get(ctx, "/repos/"+repo+"/releases/tags/"+tag, &r); err != nil {
+		return nil, err
+	}
+	return &r, nil
+}
+
+// CreateRelease publishes r in repo and returns it as created.
+func (c *Client) CreateRelease(ctx context.Context, repo string, r *Release) (*Release, error) {
+	var created Release
+	if err := c.do(ctx, http.MethodPost, "/repos/"+repo+"/releases", r, &created); err != nil {
+		return nil, err
+	}
+	return &created, nil
+}
+
+// EditRelease updates the name and body of the release r.ID of repo.
+func (c *Client) EditRelease(ctx context.Context, repo string, r *Release) (*Release, error) {
+	var edited Release
+	err := c.do(ctx, http.MethodPatch, "/repos/"+repo+"/releases/"+strconv.FormatInt(r.ID, 10),
+		map[string]string{"name": r.Name, "body": r.Body}, &edited)
+	if err != nil {
+		return nil, err
+	}
+	return &edited, nil
+}
+
+// UploadAsset attaches data to the release r as name. Assets go to the
+// upload URL GitHub returned with the release, not to the API root.
+func (c *Client) UploadAsset(ctx context.Context, r *Release, name, contentType string, data []byte) (*Asset, error) {
+	base, _, _ := strings.Cut(r.UploadURL, "{")
+	if base == "" {
+		return nil, fmt.Errorf("release %s: no upload URL", r.TagName)
+	}
+	token, err := c.token(ctx)
+	if err != nil {
+		return nil, err
+	}
+	var a Asset
+	path := "release " + r.TagName + " asset " + name
+	if err := c.exchange(ctx, http.MethodPost, base+"?name="+url.QueryEscape(name), path, token, contentType, data, &a); err != nil {
+		return nil, err
+	}
+	return &a, nil
+}
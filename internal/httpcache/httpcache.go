@@ -0,0 +1,319 @@
+// Package httpcache is the HTTP layer shared by the upstream datasources
+// (GitHub, registries, download mirrors). It revalidates GET responses kept
+// on disk with ETag and Last-Modified, so unchanged answers cost a 304 that
+// GitHub does not count against the rate limit; waits out rate limits the
+// server announces; and retries transient failures with backoff.
+//
+// Clients with a retry policy of their own, like registry.Client, get a
+// Transport with no Retries, so that a request is not retried by both.
+package httpcache
+
+import (
+	"bufio"
+	"bytes"
+	"context"
+	"crypto/sha256"
+	"encoding/hex"
+	"fmt"
+	"io"
+	"net/http"
+	"os"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+)
+
+// Transport is an http.RoundTripper adding caching, rate-limit handling and
+// retries to Base.
+type Transport struct {
+	// Dir holds the cached responses. Empty disables caching.
+	Dir string
+	// Base sends the requests; http.DefaultTransport when nil.
+	Base http.RoundTripper
+	// Retries is how many times a GET or HEAD failing with a network error
+	// or a 5xx status is retried, waiting Backoff, then twice as long, and
+	// so on. Rate-limit rejections are retried after the wait the server
+	// asks for, within the same count. Zero leaves retries to the caller:
+	// failures and rejections are returned as they are.
+	Retries int
+	Backoff time.Duration
+	// MaxWait is the longest the transport waits for a rate limit to reset;
+	// longer limits are returned to the caller as they are.
+	MaxWait time.Duration
+	// Log receives a line for every wait, when set.
+	Log io.Writer
+
+	mu sync.Mutex
+	// blocked holds, per host, when its exhausted rate limit resets.
+	blocked map[string]time.Time
+}
+
+// New returns a transport caching in dir with the factory's defaults.
+func New(dir string) *Transport {
+	return &Transport{Dir: dir, Retries: 3, Backoff: time.Second, MaxWait: 2 * time.Minute}
+}
+
+// Client returns an http.Client using t.
+func (t *Transport) Client() *http.Client {
+	return &http.Client{Transport: t}
+}
+
+// RoundTrip implements http.RoundTripper.
+func (t *Transport) RoundTrip(req *http.Request) (*http.Response, error) {
+	cacheable := t.Dir != "" && req.Method == http.MethodGet && req.Header.Get("Range") == ""
+	var cached *http.Response
+	if cacheable {
+		cached = t.load(req)
+		if cached != nil {
+			req = req.Clone(req.Context())
+			if etag := cached.Header.Get("ETag"); etag != "" {
+				req.Header.Set("If-None-Match", etag)
+			}
+			if lm := cached.Header.Get("Last-Modified"); lm != "" {
+				req.Header.Set("If-Modified-Since", lm)
+			}
+		}
+	}
+
+	resp, err := t.send(req)
+	if err != nil {
+		return nil, err
+	}
+	switch {
+	case resp.StatusCode == http.StatusNotModified && cached != nil:
+		resp.Body.Close()
+		cached.Request = req
+		cached.Header.Del(varyHeader)
+		return cached, nil
+	case cacheable && resp.StatusCode == http.StatusOK &&
+		(resp.Header.Get("ETag") != "" || resp.Header.Get("Last-Modified") != ""):
+		return t.store(req, resp)
+	}
+	return resp, nil
+}
+
+// send sends req, waiting for rate limits and retrying transient failures.
+func (t *Transport) send(req *http.Request) (*http.Response, error) {
+	base := t.Base
+	if base == nil {
+		base = http.DefaultTransport
+	}
+	retryable := req.Method == http.MethodGet || req.Method == http.MethodHead
+	backoff := t.Backoff
+	for attempt := 0; ; attempt++ {
+		if until, ok := t.blockedUntil(req.URL.Host); ok {
+			if err := t.wait(req.Context(), time.Until(until), "rate limit of "+req.URL.Host); err != nil {
+				return nil, err
+			}
+		}
+
+		resp, err := base.RoundTrip(req)
+		if err == nil {
+			if wait, limited := t.rateLimited(req, resp); limited && wait <= t.MaxWait && retryable && attempt < t.Retries {
+				resp.Body.Close()
+				if err := t.wait(req.Context(), wait, "rate limit of "+req.URL.Host); err != nil {
+					return nil, err
+				}
+				continue
+			}
+			if resp.StatusCode < 500 || !retryable || attempt >= t.Retries {
+				return resp, nil
+			}
+			resp.Body.Close()
+			err = fmt.Errorf("%s", resp.Status)
+		}
+		if !retryable || attempt >= t.Retries || req.Context().Err() != nil {
+			return nil, err
+		}
+		if err := t.wait(req.Context(), backoff, fmt.Sprintf("%s %s: %v, retrying", req.Method, req.URL.Redacted(), err)); err != nil {
+			return nil, err
+		}
+		backoff *= 2
+	}
+}
+
+// rateLimited reads the rate-limit headers of resp. It records hosts whose
+// quota is exhausted, and reports how long to wait when resp itself is a
+// rate-limit rejection: a 429, or a 403 from GitHub with no quota left or a
+// Retry-After.
+func (t *Transport) rateLimited(req *http.Request, resp *http.Response) (time.Duration, bool) {
+	var reset time.Time
+	if resp.Header.Get("X-RateLimit-Remaining") == "0" {
+		if secs, err := strconv.ParseInt(resp.Header.Get("X-RateLimit-Reset"), 10, 64); err == nil {
+			reset = time.Unix(secs, 0)
+			t.block(req.URL.Host, reset)
+		}
+	}
+	if resp.StatusCode != http.StatusTooManyRequests && resp.StatusCode != http.StatusForbidden {
+		return 0, false
+	}
+	if ra := resp.Header.Get("Retry-After"); ra != "" {
+		if secs, err := strconv.Atoi(ra); err == nil {
+			return time.Duration(secs) * time.Second, true
+		}
+		if at, err := http.ParseTime(ra); err == nil {
+			return time.Until(at), true
+		}
+	}
+	if !reset.IsZero() {
+		return time.Until(reset), true
+	}
+	if resp.StatusCode == http.StatusTooManyRequests {
+		return t.Backoff, true
+	}
+	return 0, false
+}
+
+func (t *Transport) block(host string, until time.Time) {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	if t.blocked == nil {
+		t.blocked = map[string]time.Time{}
+	}
+	t.blocked[host] = until
+}
+
+func (t *Transport) blockedUntil(host string) (time.Time, bool) {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	until, ok := t.blocked[host]
+	if !ok || !time.Now().Before(until) {
+		delete(t.blocked, host)
+		return time.Time{}, false
+	}
+	if time.Until(until) > t.MaxWait {
+		// Let the request through: the server answers with the limit
+		// and the caller reports it.
+		return time.Time{}, false
+	}
+	return until, true
+}
+
+func (t *Transport) wait(ctx context.Context, d time.Duration, why string) error {
+	if d <= 0 {
+		return nil
+	}
+	if t.Log != nil {
+		fmt.Fprintf(t.Log, "  [wait] %s: %s\n", why, d.Round(time.Second))
+	}
+	timer := time.NewTimer(d)
+	defer timer.Stop()
+	select {
+	case <-ctx.Done():
+		return ctx.Err()
+	case <-timer.C:
+		return nil
+	}
+}
+
+// varyHeader records, in a cached response, the request headers it was the
+// answer to (see varies).
+const varyHeader = "X-Httpcache-Vary"
+
+// path is where the response to req is cached. Responses depend on the
+// Accept header (registries return indexes or manifests accordingly) and on
+// the credentials (a token sees private repositories and its own quota),
+// so both are part of the key.
+func (t *Transport) path(req *http.Request) string {
+	sum := sha256.Sum256([]byte(req.URL.String() + "\n" + req.Header.Get("Accept") + "\n" + identity(req)))
+	return filepath.Join(t.Dir, hex.EncodeToString(sum[:]))
+}
+
+// identity names the credentials of req in cache keys: their scheme, and
+// the user of basic credentials. Tokens are not part of it, since every
+// process mints its own (GitHub App installation tokens, registry bearer
+// tokens) and would never find the answers of the previous run; a cached
+// answer is only reused once the server revalidated it for the current
+// token.
+func identity(req *http.Request) string {
+	auth := req.Header.Get("Authorization")
+	if auth == "" {
+		return "anonymous"
+	}
+	if user, _, ok := req.BasicAuth(); ok {
+		return "basic " + user
+	}
+	scheme, _, _ := strings.Cut(auth, " ")
+	return strings.ToLower(scheme)
+}
+
+// varies returns the digest of the values in req of the headers resp
+// varies on, the identity standing for Authorization, and false when it
+// varies on anything ("*").
+func varies(req *http.Request, resp *http.Response) (string, bool) {
+	h := sha256.New()
+	for _, v := range resp.Header.Values("Vary") {
+		for _, name := range strings.Split(v, ",") {
+			name = http.CanonicalHeaderKey(strings.TrimSpace(name))
+			if name == "*" {
+				return "", false
+			}
+			values := req.Header.Values(name)
+			if name == "Authorization" {
+				values = []string{identity(req)}
+			}
+			fmt.Fprintf(h, "%s: %q\n", name, values)
+		}
+	}
+	return hex.EncodeToString(h.Sum(nil)), true
+}
+
+// load returns the cached response to req, or nil when there is none or
+// it was the answer to different values of the headers it varies on.
+func (t *Transport) load(req *http.Request) *http.Response {
+	data, err := os.ReadFile(t.path(req))
+	if err != nil {
+		return nil
+	}
+	resp, err := http.ReadResponse(bufio.NewReader(bytes.NewReader(data)), req)
+	if err != nil {
+		return nil
+	}
+	if vary, ok := varies(req, resp); !ok || vary != resp.Header.Get(varyHeader) {
+		resp.Body.Close()
+		return nil
+	}
+	return resp
+}
+
+// store reads resp, saves it and returns an equivalent response.
+func (t *Transport) store(req *http.Request, resp *http.Response) (*http.Response, error) {
+	body, err := io.ReadAll(resp.Body)
+	resp.Body.Close()
+	if err != nil {
+		return nil, err
+	}
+	resp.Body = io.NopCloser(bytes.NewReader(body))
+	vary, ok := varies(req, resp)
+	if !ok {
+		return resp, nil
+	}
+
+	// Saved in the wire format, without what only made sense for the
+	// original transfer.
+	saved := *resp
+	saved.Header = resp.Header.Clone()
+	for _, h := range []string{"Set-Cookie", "Transfer-Encoding", "Content-Encoding"} {
+		saved.Header.Del(h)
+	}
+	saved.Header.Set(varyHeader, vary)
+	saved.Body = io.NopCloser(bytes.NewReader(body))
+	saved.ContentLength = int64(len(body))
+	saved.TransferEncoding = nil
+	saved.Uncompressed = false
+
+	var buf bytes.Buffer
+	if err := saved.Write(&buf); err != nil {
+		return resp, nil
+	}
+	if err := os.MkdirAll(t.Dir, 0o700); err != nil {
+		return resp, nil
+	}
+	tmp := t.path(req) + ".tmp"
+	if err := os.WriteFile(tmp, buf.Bytes(), 0o600); err == nil {
+		os.Rename(tmp, t.path(req))
+	}
+	return resp, nil
+}
@@ -0,0 +1,270 @@
+package httpcache
+
+import (
+	"encoding/base64"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"strconv"
+	"sync/atomic"
+	"testing"
+	"time"
+)
+
+// get fetches url through t and returns the status and body.
+func get(tb testing.TB, t *Transport, url string, header http.Header) (int, string) {
+	tb.Helper()
+	req, err := http.NewRequest(http.MethodGet, url, nil)
+	if err != nil {
+		tb.Fatal(err)
+	}
+	for k, v := range header {
+		req.Header[k] = v
+	}
+	resp, err := t.Client().Do(req)
+	if err != nil {
+		tb.Fatal(err)
+	}
+	defer resp.Body.Close()
+	body, err := io.ReadAll(resp.Body)
+	if err != nil {
+		tb.Fatal(err)
+	}
+	return resp.StatusCode, string(body)
+}
+
+// TestRevalidate reuses a cached response the server answers 304 to.
+func TestRevalidate(t *testing.T) {
+	var sent, conditional atomic.Int32
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		sent.Add(1)
+		w.Header().Set("ETag", `"v1"`)
+		if r.Header.Get("If-None-Match") == `"v1"` {
+			conditional.Add(1)
+			w.WriteHeader(http.StatusNotModified)
+			return
+		}
+		w.Write([]byte("releases"))
+	}))
+	defer srv.Close()
+	tr := &Transport{Dir: t.TempDir()}
+
+	for i := range 3 {
+		if code, body := get(t, tr, srv.URL, nil); code != http.StatusOK || body != "releases" {
+			t.Fatalf("request %d: %d %q, want the releases", i, code, body)
+		}
+	}
+	if sent.Load() != 3 || conditional.Load() != 2 {
+		t.Errorf("%d requests, %d conditional, want 3 with the last 2 revalidating", sent.Load(), conditional.Load())
+	}
+}
+
+// TestCacheKey keeps the responses to different credentials (anonymous, a
+// token, basic users), Accept headers or headers the response varies on
+// apart.
+func TestCacheKey(t *testing.T) {
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		body := r.Header.Get("Authorization") + "|" + r.Header.Get("Accept") + "|" + r.Header.Get("X-Variant")
+		w.Header().Set("ETag", `"v1"`)
+		w.Header().Set("Vary", "Accept, Authorization, X-Variant")
+		// Every variant has the same ETag: only the key tells them apart.
+		if r.Header.Get("If-None-Match") == `"v1"` {
+			w.WriteHeader(http.StatusNotModified)
+			return
+		}
+		w.Write([]byte(body))
+	}))
+	defer srv.Close()
+	tr := &Transport{Dir: t.TempDir()}
+
+	for _, h := range []http.Header{
+		{},
+		{"Authorization": {"Bearer private"}},
+		{"Authorization": {"Basic " + base64.StdEncoding.EncodeToString([]byte("reader:secret"))}},
+		{"Authorization": {"Basic " + base64.StdEncoding.EncodeToString([]byte("writer:secret"))}},
+		{"Accept": {"application/json"}},
+		{"X-Variant": {"a"}},
+		{"X-Variant": {"b"}},
+	} {
+		want := h.Get("Authorization") + "|" + h.Get("Accept") + "|" + h.Get("X-Variant")
+		// The second time is answered from the cache, or the cache of
+		// another request when the key is wrong.
+		for range 2 {
+			if _, body := get(t, tr, srv.URL, h); body != want {
+				t.Errorf("%v: got %q, want %q", h, body, want)
+			}
+		}
+	}
+}
+
+// TestNewToken revalidates the answer to an earlier token in a new process:
+// installation and registry tokens change with every run.
+func TestNewToken(t *testing.T) {
+	var conditional atomic.Int32
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("ETag", `"v1"`)
+		w.Header().Set("Vary", "Accept, Authorization")
+		if r.Header.Get("If-None-Match") == `"v1"` {
+			conditional.Add(1)
+			w.WriteHeader(http.StatusNotModified)
+			return
+		}
+		w.Write([]byte("releases"))
+	}))
+	defer srv.Close()
+	dir := t.TempDir()
+
+	for _, token := range []string{"Bearer ghs_first", "Bearer ghs_second"} {
+		tr := &Transport{Dir: dir}
+		if code, body := get(t, tr, srv.URL, http.Header{"Authorization": {token}}); code != http.StatusOK || body != "releases" {
+			t.Fatalf("%s: %d %q, want the releases", token, code, body)
+		}
+	}
+	if conditional.Load() != 1 {
+		t.Errorf("%d conditional requests, want the second token to revalidate", conditional.Load())
+	}
+}
+
+// TestVaryAll does not cache responses varying on anything.
+func TestVaryAll(t *testing.T) {
+	var conditional atomic.Int32
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.Header.Get("If-None-Match") != "" {
+			conditional.Add(1)
+		}
+		w.Header().Set("ETag", `"v1"`)
+		w.Header().Set("Vary", "*")
+		w.Write([]byte("anything"))
+	}))
+	defer srv.Close()
+	tr := &Transport{Dir: t.TempDir()}
+	get(t, tr, srv.URL, nil)
+	get(t, tr, srv.URL, nil)
+	if conditional.Load() != 0 {
+		t.Error("a response varying on * was revalidated")
+	}
+}
+
+// limitedServer rejects the first request with status and headers, and
+// records when the requests came.
+func limitedServer(status int, header func() http.Header) (*httptest.Server, *[]time.Time) {
+	var times []time.Time
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		times = append(times, time.Now())
+		if len(times) == 1 {
+			for k, v := range header() {
+				w.Header()[k] = v
+			}
+			w.WriteHeader(status)
+			return
+		}
+		w.Write([]byte("ok"))
+	}))
+	return srv, &times
+}
+
+func TestRateLimit(t *testing.T) {
+	tests := []struct {
+		name    string
+		status  int
+		header  func() http.Header
+		maxWait time.Duration
+		want    time.Duration // least wait before the retry, -1 for none
+	}{
+		{"retry-after", http.StatusTooManyRequests, func() http.Header {
+			return http.Header{"Retry-After": {"1"}}
+		}, time.Minute, time.Second},
+		{"rate-limit-reset", http.StatusForbidden, func() http.Header {
+			reset := time.Now().Add(time.Second).Truncate(time.Second).Add(time.Second)
+			return http.Header{"X-Ratelimit-Remaining": {"0"}, "X-Ratelimit-Reset": {strconv.FormatInt(reset.Unix(), 10)}}
+		}, time.Minute, time.Second},
+		{"beyond-max-wait", http.StatusTooManyRequests, func() http.Header {
+			return http.Header{"Retry-After": {"3600"}}
+		}, time.Minute, -1},
+		{"forbidden", http.StatusForbidden, func() http.Header { return nil }, time.Minute, -1},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			srv, times := limitedServer(tt.status, tt.header)
+			defer srv.Close()
+			tr := &Transport{Retries: 3, Backoff: 10 * time.Millisecond, MaxWait: tt.maxWait}
+			code, _ := get(t, tr, srv.URL, nil)
+			if tt.want < 0 {
+				if code != tt.status || len(*times) != 1 {
+					t.Errorf("%d after %d requests, want the %d returned as is", code, len(*times), tt.status)
+				}
+				return
+			}
+			if code != http.StatusOK || len(*times) != 2 {
+				t.Fatalf("%d after %d requests, want a retry passing", code, len(*times))
+			}
+			if wait := (*times)[1].Sub((*times)[0]); wait < tt.want-50*time.Millisecond {
+				t.Errorf("retried after %s, want %s", wait, tt.want)
+			}
+		})
+	}
+}
+
+// TestRateLimitNoRetries returns rate-limit rejections to callers that
+// retry themselves.
+func TestRateLimitNoRetries(t *testing.T) {
+	srv, times := limitedServer(http.StatusTooManyRequests, func() http.Header {
+		return http.Header{"Retry-After": {"1"}}
+	})
+	defer srv.Close()
+	tr := &Transport{MaxWait: time.Minute}
+	if code, _ := get(t, tr, srv.URL, nil); code != http.StatusTooManyRequests || len(*times) != 1 {
+		t.Errorf("%d after %d requests, want the 429 returned as is", code, len(*times))
+	}
+}
+
+func TestBackoff(t *testing.T) {
+	for _, retries := range []int{0, 1, 3} {
+		var times []time.Time
+		srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			times = append(times, time.Now())
+			if len(times) <= 2 {
+				w.WriteHeader(http.StatusServiceUnavailable)
+				return
+			}
+			w.Write([]byte("ok"))
+		}))
+		tr := &Transport{Retries: retries, Backoff: 20 * time.Millisecond}
+		code, _ := get(t, tr, srv.URL, nil)
+		srv.Close()
+
+		want, sends := http.StatusOK, 3
+		if retries < 2 {
+			want, sends = http.StatusServiceUnavailable, retries+1
+		}
+		if code != want || len(times) != sends {
+			t.Errorf("retries %d: %d after %d requests, want %d after %d", retries, code, len(times), want, sends)
+			continue
+		}
+		// The waits double: 20ms, then 40ms.
+		for i := 1; i < len(times); i++ {
+			if wait, least := times[i].Sub(times[i-1]), 20*time.Millisecond<<(i-1); wait < least {
+				t.Errorf("retries %d: retry %d after %s, want %s", retries, i, wait, least)
+			}
+		}
+	}
+}
+
+// TestNoRetryPost sends requests that are not idempotent once.
+func TestNoRetryPost(t *testing.T) {
+	var sent atomic.Int32
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		sent.Add(1)
+		w.WriteHeader(http.StatusBadGateway)
+	}))
+	defer srv.Close()
+	tr := &Transport{Retries: 3, Backoff: time.Millisecond}
+	resp, err := tr.Client().Post(srv.URL, "application/json", nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	resp.Body.Close()
+	if resp.StatusCode != http.StatusBadGateway || sent.Load() != 1 {
+		t.Errorf("%d after %d requests, want the 502 of a single POST", resp.StatusCode, sent.Load())
+	}
+}
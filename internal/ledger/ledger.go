@@ -0,0 +1,134 @@
+// Package ledger stores the outcome of every factory build as an append-only
+// JSON Lines file, so reports can look back at what was built and published.
+package ledger
+
+import (
+	"bufio"
+	"encoding/json"
+	"fmt"
+	"os"
+	"path/filepath"
+	"sort"
+	"time"
+)
+
+// Build statuses.
+const (
+	StatusSuccess = "success"
+	StatusFailure = "failure"
+)
+
+// Base is an external image a build was made FROM, pinned to the digest it
+// resolved to at build time.
+type Base struct {
+	Ref    string `json:"ref"`
+	Digest string `json:"digest"`
+}
+
+// Record is one build of one image variant.
+type Record struct {
+	Image      string    `json:"image"`
+	Variant    string    `json:"variant"`
+	Status     string    `json:"status"`
+	Time       time.Time `json:"time"`
+	Revision   string    `json:"revision,omitempty"`
+	Digest     string    `json:"digest,omitempty"`
+	Pushed     bool      `json:"pushed"`
+	Size       int64     `json:"size,omitempty"`
+	Bases      []Base    `json:"bases,omitempty"`
+	Signed     bool      `json:"signed"`
+	SBOM       bool      `json:"sbom"`
+	Provenance bool      `json:"provenance"`
+	// Duration is how long the build of the variant took, in seconds.
+	Duration float64 `json:"duration_seconds,omitempty"`
+}
+
+// Ledger is the loaded history, oldest record first.
+type Ledger struct {
+	Records []Record
+}
+
+// Load reads the ledger at path. A missing file is an empty ledger.
+func Load(path string) (*Ledger, error) {
+	f, err := os.Open(path)
+	if os.IsNotExist(err) {
+		return &Ledger{}, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+	defer f.Close()
+
+	l := &Ledger{}
+	sc := bufio.NewScanner(f)
+	sc.Buffer(make([]byte, 0, 64*1024), 4*1024*1024)
+	for line := 1; sc.Scan(); line++ {
+		if len(sc.Bytes()) == 0 {
+			continue
+		}
+		var r Record
+		if err := json.Unmarshal(sc.Bytes(), &r); err != nil {
+			return nil, fmt.Errorf("%s:%d: %w", path, line, err)
+		}
+		l.Records = append(l.Records, r)
+	}
+	if err := sc.Err(); err != nil {
+		return nil, err
+	}
+	sort.SliceStable(l.Records, func(i, j int) bool { return l.Records[i].Time.Before(l.Records[j].Time) })
+	return l, nil
+}
+
+// Append adds a record to the ledger at path, creating it if needed.
+func Append(path string, r Record) error {
+	if err := os.MkdirAll(filepath.Dir(path), 0o755); err != nil {
+		return err
+	}
+	data, err := json.Marshal(r)
+	if err != nil {
+		return err
+	}
+	f, err := os.OpenFile(path, os.O_CREATE|os.O_APPEND|os.O_WRONLY, 0o644)
+	if err != nil {
+		return err
+	}
+	if _, err := f.Write(append(data, '\n')); err != nil {
+		f.Close()
+		return err
+	}
+	return f.Close()
+}
+
+// History returns the records of one image variant, oldest first.
+func (l *Ledger) History(image, variant string) []Record {
+	var out []Record
+	for _, r := range l.Records {
+		if r.Image == image && r.Variant == variant {
+			out = append(out, r)
+		}
+	}
+	return out
+}
+
+// LastSuccess returns the most recent successful build of a variant.
+func (l *Ledger) LastSuccess(image, variant string) (Record, bool) {
+	h := l.History(image, variant)
+	for i := len(h) - 1; i >= 0; i-- {
+		if h[i].Status == StatusSuccess {
+			return h[i], true
+		}
+	}
+	return Record{}, false
+}
+
+// LastPublish returns the most recent successful build of a variant that
+// pushed a digest.
+func (l *Ledger) LastPublish(image, variant string) (Record, bool) {
+	h := l.History(image, variant)
+	for i := len(h) - 1; i >= 0; i-- {
+		if h[i].Status == StatusSuccess && h[i].Pushed && h[i].Digest != "" {
+			return h[i], true
+		}
+	}
+	return Record{}, false
+}
@@ -0,0 +1,53 @@
+// Package lint checks image directories for mistakes a successful build
+// would not reveal.
+package lint
+
+import (
+	"fmt"
+	"path/filepath"
+
+	"github.com/gillouche/container-factory/internal/catalog"
+	"github.com/gillouche/container-factory/internal/dockerfile"
+)
+
+// Finding is one problem reported by a rule.
+type Finding struct {
+	Image   string `json:"image"`
+	File    string `json:"file"`
+	Line    int    `json:"line"`
+	Rule    string `json:"rule"`
+	Message string `json:"message"`
+}
+
+func (f Finding) String() string {
+	return fmt.Sprintf("%s:%d: %s [%s]", f.File, f.Line, f.Message, f.Rule)
+}
+
+// Rule checks the instructions of one Dockerfile.
+type Rule struct {
+	Name    string
+	Summary string
+	Check   func(ins []dockerfile.Instruction) []Finding
+}
+
+// Rules are the checks run by Check, in order.
+var Rules = []Rule{
+	{"no-credentials", "Credentials must come from secret mounts, not ARG or ENV", noCredentials},
+}
+
+// Check runs every rule against the Dockerfile of img.
+func Check(img catalog.Image) ([]Finding, error) {
+	path := filepath.Join(img.Dir, "Dockerfile")
+	ins, err := dockerfile.Parse(path)
+	if err != nil {
+		return nil, err
+	}
+	var out []Finding
+	for _, r := range Rules {
+		for _, f := range r.Check(ins) {
+			f.Image, f.File, f.Rule = img.Name, path, r.Name
+			out = append(out, f)
+		}
+	}
+	return out, nil
+}
@@ -0,0 +1,148 @@
+package malware
+
+import (
+	"archive/tar"
+	"bytes"
+	"context"
+	"encoding/json"
+	"fmt"
+	"io"
+	"os"
+	"strings"
+
+	"github.com/gillouche/container-factory/internal/registry"
+)
+
+// imageConfig holds the history of an image config, one entry per
+// instruction; the entries that made no layer are flagged empty.
+type imageConfig struct {
+	History []struct {
+		CreatedBy  string `json:"created_by"`
+		EmptyLayer bool   `json:"empty_layer"`
+	} `json:"history"`
+}
+
+// createdBy returns the instruction of each of the n layers, or nothing
+// when the history does not account for them all.
+func createdBy(config []byte, n int) []string {
+	var c imageConfig
+	if json.Unmarshal(config, &c) != nil {
+		return nil
+	}
+	var out []string
+	for _, h := range c.History {
+		if !h.EmptyLayer {
+			out = append(out, strings.TrimSpace(strings.TrimSuffix(h.CreatedBy, "# buildkit")))
+		}
+	}
+	if len(out) != n {
+		return nil
+	}
+	return out
+}
+
+// RegistryLayers returns the layers of the platform image of ref.
+func RegistryLayers(ctx context.Context, c *registry.Client, ref registry.Ref, platform registry.Platform) ([]Layer, error) {
+	m, _, err := c.ImageManifest(ctx, ref, platform)
+	if err != nil {
+		return nil, err
+	}
+	config, err := c.Blob(ctx, ref, m.Config.Digest)
+	if err != nil {
+		return nil, fmt.Errorf("%s: config: %w", ref, err)
+	}
+	history := createdBy(config, len(m.Layers))
+	var layers []Layer
+	for i, d := range m.Layers {
+		l := Layer{Index: i, Digest: d.Digest, open: func() (io.ReadCloser, error) {
+			return c.OpenBlob(ctx, ref, d.Digest)
+		}}
+		if history != nil {
+			l.CreatedBy = history[i]
+		}
+		layers = append(layers, l)
+	}
+	return layers, nil
+}
+
+// ArchiveLayers returns the layers of the image saved at path by
+// `docker save` (both the legacy layout and the OCI one of Docker 25+,
+// which keep a manifest.json). The archive must hold a single image.
+func ArchiveLayers(path string) (image string, layers []Layer, err error) {
+	data, err := archiveFile(path, "manifest.json")
+	if err != nil {
+		return "", nil, err
+	}
+	var manifest []struct {
+		Config   string   `json:"Config"`
+		RepoTags []string `json:"RepoTags"`
+		Layers   []string `json:"Layers"`
+	}
+	if err := json.Unmarshal(data, &manifest); err != nil {
+		return "", nil, fmt.Errorf("%s: manifest.json: %w", path, err)
+	}
+	if len(manifest) != 1 {
+		return "", nil, fmt.Errorf("%s: %d images, want 1", path, len(manifest))
+	}
+	m := manifest[0]
+	image = path
+	if len(m.RepoTags) > 0 {
+		image = m.RepoTags[0]
+	}
+	var history []string
+	if config, err := archiveFile(path, m.Config); err == nil {
+		history = createdBy(config, len(m.Layers))
+	}
+	for i, name := range m.Layers {
+		digest := name
+		if hex, ok := strings.CutPrefix(name, "blobs/sha256/"); ok {
+			digest = "sha256:" + hex
+		}
+		l := Layer{Index: i, Digest: digest, open: func() (io.ReadCloser, error) {
+			return openArchiveFile(path, name)
+		}}
+		if history != nil {
+			l.CreatedBy = history[i]
+		}
+		layers = append(layers, l)
+	}
+	return image, layers, nil
+}
+
+func archiveFile(archive, name string) ([]byte, error) {
+	rc, err := openArchiveFile(archive, name)
+	if err != nil {
+		return nil, err
+	}
+	defer rc.Close()
+	var buf bytes.Buffer
+	_, err = io.Copy(&buf, rc)
+	return buf.Bytes(), err
+}
+
+// openArchiveFile streams one file of a tar archive. Seeking over the
+// entries before it keeps opening every layer in turn cheap.
+func openArchiveFile(archive, name string) (io.ReadCloser, error) {
+	f, err := os.Open(archive)
+	if err != nil {
+		return nil, err
+	}
+	tr := tar.NewReader(f)
+	for {
+		hdr, err := tr.Next()
+		if err == io.EOF {
+			f.Close()
+			return nil, fmt.Errorf("%s: no %s", archive, name)
+		}
+		if err != nil {
+			f.Close()
+			return nil, fmt.Errorf("%s: %w", archive, err)
+		}
+		if strings.TrimPrefix(hdr.Name, "./") == name {
+			return struct {
+				io.Reader
+				io.Closer
+			}{tr, f}, nil
+		}
+	}
+}
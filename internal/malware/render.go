@@ -0,0 +1,64 @@
+package malware
+
+import (
+	"encoding/json"
+	"fmt"
+	"io"
+	"strings"
+)
+
+// JSON writes the reports as an indented JSON document.
+func JSON(w io.Writer, reports []*Report) error {
+	enc := json.NewEncoder(w)
+	enc.SetIndent("", "  ")
+	return enc.Encode(map[string]any{"images": reports})
+}
+
+// Markdown writes, per image, a table of its layers followed by the
+// findings of each layer.
+func Markdown(w io.Writer, reports []*Report) error {
+	var b strings.Builder
+	b.WriteString("# Malware scan\n")
+	for _, r := range reports {
+		fmt.Fprintf(&b, "\n## %s\n\n", r.Image)
+		b.WriteString("| Layer | Digest | Executables | Findings | Created by |\n")
+		b.WriteString("|---:|---|---:|---:|---|\n")
+		for _, l := range r.Layers {
+			fmt.Fprintf(&b, "| %d | `%s` | %d | %d | %s |\n",
+				l.Index, shortDigest(l.Digest), l.Executables, len(l.Findings), instruction(l.CreatedBy))
+		}
+		for _, l := range r.Layers {
+			if len(l.Findings) == 0 && len(l.Skipped) == 0 {
+				continue
+			}
+			fmt.Fprintf(&b, "\n### Layer %d (`%s`)\n\n", l.Index, shortDigest(l.Digest))
+			for _, f := range l.Findings {
+				fmt.Fprintf(&b, "- **%s** `%s` %s: %s (%s)\n", strings.ToUpper(f.Severity), f.Path, f.Rule, f.Description, f.Detail)
+			}
+			for _, p := range l.Skipped {
+				fmt.Fprintf(&b, "- skipped `%s`: too large to scan\n", p)
+			}
+		}
+	}
+	_, err := io.WriteString(w, b.String())
+	return err
+}
+
+func shortDigest(d string) string {
+	if _, hex, ok := strings.Cut(d, ":"); ok && len(hex) > 12 {
+		return d[:len(d)-len(hex)] + hex[:12]
+	}
+	return d
+}
+
+// instruction shortens a history entry for a table cell.
+func instruction(s string) string {
+	s = strings.Join(strings.Fields(s), " ")
+	if len(s) > 80 {
+		s = s[:77] + "..."
+	}
+	if s == "" {
+		return ""
+	}
+	return "`" + strings.ReplaceAll(s, "|", `\|`) + "`"
+}
@@ -0,0 +1,150 @@
+// Package malware scans the executables of image layers with an offline
+// rule set: byte patterns and strings known from malware (crypto-miner
+// pools, reverse shells, rootkit hooks) and the marks packed or tampered
+// binaries leave in their ELF structure. It complements the checksums of
+// the downloads: a binary swapped upstream or in the proxy, together with
+// its checksum file, still has to get past the rules.
+//
+// Every layer is scanned on its own, so a file dropped by a layer and
+// deleted by a later one is still reported.
+package malware
+
+import (
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"os"
+	"path"
+	"slices"
+	"strings"
+)
+
+// DefaultRules is where the rule set lives relative to the repo root.
+const DefaultRules = "ci/malware-rules.json"
+
+// Rule kinds.
+const (
+	// KindString matches an ASCII string, ignoring case.
+	KindString = "string"
+	// KindBytes matches a byte sequence given in hex.
+	KindBytes = "bytes"
+	// KindSection matches ELF files with one of the named sections.
+	KindSection = "elf-section"
+	// KindNoSections matches ELF files without section headers, which
+	// linkers always write and packers strip.
+	KindNoSections = "elf-no-sections"
+	// KindEntropy matches ELF files whose executable code (the whole file
+	// without section headers) is at least Threshold bits of entropy per
+	// byte: compressed or encrypted, not machine code.
+	KindEntropy = "elf-entropy"
+)
+
+// Severities, most severe first.
+var Severities = []string{"critical", "high", "medium", "low"}
+
+// Rule is one check of the rule set.
+type Rule struct {
+	ID          string `json:"id"`
+	Description string `json:"description"`
+	Severity    string `json:"severity"`
+	Kind        string `json:"kind"`
+	// Pattern is the string of KindString and the hex bytes of KindBytes.
+	Pattern string `json:"pattern"`
+	// Sections are the section names of KindSection.
+	Sections []string `json:"sections"`
+	// Threshold is the entropy of KindEntropy.
+	Threshold float64 `json:"threshold"`
+	// Except are globs (path.Match, against the path in the layer) of the
+	// files the rule does not apply to, e.g. the dynamic loader for
+	// /etc/ld.so.preload.
+	Except []string `json:"except"`
+
+	needle []byte
+}
+
+// Rules is a rule set.
+type Rules []Rule
+
+// LoadRules reads and checks the rule set at path.
+func LoadRules(path string) (Rules, error) {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return nil, err
+	}
+	var file struct {
+		Rules Rules `json:"rules"`
+	}
+	if err := json.Unmarshal(data, &file); err != nil {
+		return nil, fmt.Errorf("%s: %w", path, err)
+	}
+	seen := map[string]bool{}
+	for i := range file.Rules {
+		r := &file.Rules[i]
+		if err := r.compile(); err != nil {
+			return nil, fmt.Errorf("%s: rule %q: %w", path, r.ID, err)
+		}
+		if seen[r.ID] {
+			return nil, fmt.Errorf("%s: duplicate rule %q", path, r.ID)
+		}
+		seen[r.ID] = true
+	}
+	return file.Rules, nil
+}
+
+func (r *Rule) compile() error {
+	if r.ID == "" {
+		return fmt.Errorf("no id")
+	}
+	if !slices.Contains(Severities, r.Severity) {
+		return fmt.Errorf("severity %q is not one of %s", r.Severity, strings.Join(Severities, ", "))
+	}
+	for _, g := range r.Except {
+		if _, err := path.Match(g, ""); err != nil {
+			return fmt.Errorf("except %q: %w", g, err)
+		}
+	}
+	switch r.Kind {
+	case KindString:
+		if r.Pattern == "" {
+			return fmt.Errorf("no pattern")
+		}
+		r.needle = []byte(strings.ToLower(r.Pattern))
+	case KindBytes:
+		b, err := hex.DecodeString(strings.ReplaceAll(r.Pattern, " ", ""))
+		if err != nil || len(b) == 0 {
+			return fmt.Errorf("pattern %q is not hex bytes", r.Pattern)
+		}
+		r.needle = b
+	case KindSection:
+		if len(r.Sections) == 0 {
+			return fmt.Errorf("no sections")
+		}
+	case KindNoSections:
+	case KindEntropy:
+		if r.Threshold <= 0 || r.Threshold > 8 {
+			return fmt.Errorf("threshold %v is not in (0, 8]", r.Threshold)
+		}
+	default:
+		return fmt.Errorf("unknown kind %q", r.Kind)
+	}
+	return nil
+}
+
+// applies tells whether the rule checks the file at name.
+func (r *Rule) applies(name string) bool {
+	for _, g := range r.Except {
+		if ok, _ := path.Match(g, name); ok {
+			return false
+		}
+		if ok, _ := path.Match(g, path.Base(name)); ok && !strings.Contains(g, "/") {
+			return false
+		}
+	}
+	return true
+}
+
+// AtLeast reports whether severity is at least as severe as min.
+func AtLeast(severity, min string) bool {
+	i, j := slices.Index(Severities, severity), slices.Index(Severities, min)
+	return i >= 0 && j >= 0 && i <= j
+}
@@ -0,0 +1,271 @@
+package malware
+
+import (
+	"archive/tar"
+	"bytes"
+	"context"
+	"debug/elf"
+	"fmt"
+	"io"
+	"math"
+	"path"
+	"sort"
+	"strings"
+
+	"github.com/gillouche/container-factory/internal/registry"
+)
+
+// DefaultMaxSize is the largest executable read; larger ones are listed as
+// skipped.
+const DefaultMaxSize = 512 << 20
+
+// Layer is one layer of an image, oldest first.
+type Layer struct {
+	Index  int
+	Digest string
+	// CreatedBy is the history entry of the layer, the instruction that
+	// made it.
+	CreatedBy string
+	open      func() (io.ReadCloser, error)
+}
+
+// Open returns the layer blob as stored, compressed or not.
+func (l Layer) Open() (io.ReadCloser, error) { return l.open() }
+
+// Finding is a rule matching a file of a layer.
+type Finding struct {
+	Path        string `json:"path"`
+	Rule        string `json:"rule"`
+	Severity    string `json:"severity"`
+	Description string `json:"description"`
+	// Detail locates the match: an offset, a section, an entropy.
+	Detail string `json:"detail,omitempty"`
+}
+
+// LayerReport is the scan of one layer.
+type LayerReport struct {
+	Index       int       `json:"index"`
+	Digest      string    `json:"digest"`
+	CreatedBy   string    `json:"created_by,omitempty"`
+	Executables int       `json:"executables"`
+	Skipped     []string  `json:"skipped"`
+	Findings    []Finding `json:"findings"`
+}
+
+// Report is the scan of an image.
+type Report struct {
+	Image  string        `json:"image"`
+	Layers []LayerReport `json:"layers"`
+}
+
+// Count returns the number of findings at least as severe as min.
+func (r *Report) Count(min string) int {
+	n := 0
+	for _, l := range r.Layers {
+		for _, f := range l.Findings {
+			if AtLeast(f.Severity, min) {
+				n++
+			}
+		}
+	}
+	return n
+}
+
+// Scanner applies a rule set to the executables of layers.
+type Scanner struct {
+	Rules Rules
+	// MaxSize is the largest file read, DefaultMaxSize by default.
+	MaxSize int64
+}
+
+// Scan scans every layer of image.
+func (s *Scanner) Scan(ctx context.Context, image string, layers []Layer) (*Report, error) {
+	r := &Report{Image: image}
+	for _, l := range layers {
+		if err := ctx.Err(); err != nil {
+			return nil, err
+		}
+		lr, err := s.layer(l)
+		if err != nil {
+			return nil, fmt.Errorf("%s: layer %d (%s): %w", image, l.Index, l.Digest, err)
+		}
+		r.Layers = append(r.Layers, lr)
+	}
+	return r, nil
+}
+
+func (s *Scanner) layer(l Layer) (LayerReport, error) {
+	lr := LayerReport{Index: l.Index, Digest: l.Digest, CreatedBy: l.CreatedBy, Skipped: []string{}, Findings: []Finding{}}
+	blob, err := l.Open()
+	if err != nil {
+		return lr, err
+	}
+	defer blob.Close()
+	stream, err := registry.Uncompressed(blob)
+	if err != nil {
+		return lr, err
+	}
+	defer stream.Close()
+
+	max := s.MaxSize
+	if max == 0 {
+		max = DefaultMaxSize
+	}
+	tr := tar.NewReader(stream)
+	for {
+		hdr, err := tr.Next()
+		if err == io.EOF {
+			break
+		}
+		if err != nil {
+			return lr, err
+		}
+		if hdr.Typeflag != tar.TypeReg || hdr.Size < 4 {
+			continue
+		}
+		name := strings.TrimPrefix(path.Clean("/"+hdr.Name), "/")
+		head := make([]byte, 4)
+		if _, err := io.ReadFull(tr, head); err != nil {
+			return lr, err
+		}
+		isELF := string(head) == elf.ELFMAG
+		if !isELF && hdr.Mode&0o111 == 0 {
+			continue
+		}
+		lr.Executables++
+		if hdr.Size > max {
+			lr.Skipped = append(lr.Skipped, name)
+			continue
+		}
+		data := make([]byte, hdr.Size)
+		copy(data, head)
+		if _, err := io.ReadFull(tr, data[4:]); err != nil {
+			return lr, err
+		}
+		lr.Findings = append(lr.Findings, s.File(name, data)...)
+	}
+	sort.SliceStable(lr.Findings, func(i, j int) bool {
+		return severityRank(lr.Findings[i].Severity) < severityRank(lr.Findings[j].Severity)
+	})
+	return lr, nil
+}
+
+// File applies the rules to the executable at name.
+func (s *Scanner) File(name string, data []byte) []Finding {
+	var lower []byte
+	var ef *elf.File
+	if bytes.HasPrefix(data, []byte(elf.ELFMAG)) {
+		// A corrupt ELF is left to the string and byte rules.
+		ef, _ = elf.NewFile(bytes.NewReader(data))
+	}
+
+	var out []Finding
+	for i := range s.Rules {
+		r := &s.Rules[i]
+		if !r.applies(name) {
+			continue
+		}
+		var detail string
+		switch r.Kind {
+		case KindString:
+			if lower == nil {
+				lower = bytes.ToLower(data)
+			}
+			if at := bytes.Index(lower, r.needle); at >= 0 {
+				detail = fmt.Sprintf("%q at offset %#x", r.Pattern, at)
+			}
+		case KindBytes:
+			if at := bytes.Index(data, r.needle); at >= 0 {
+				detail = fmt.Sprintf("bytes %s at offset %#x", r.Pattern, at)
+			}
+		case KindSection:
+			if ef != nil {
+				for _, sec := range ef.Sections {
+					if containsFold(r.Sections, sec.Name) {
+						detail = "section " + sec.Name
+						break
+					}
+				}
+			}
+		case KindNoSections:
+			if ef != nil && len(ef.Sections) == 0 {
+				detail = "e_shnum 0"
+			}
+		case KindEntropy:
+			if ef != nil {
+				if e := codeEntropy(ef, data); e >= r.Threshold {
+					detail = fmt.Sprintf("code entropy %.2f bits/byte", e)
+				}
+			}
+		}
+		if detail != "" {
+			out = append(out, Finding{Path: name, Rule: r.ID, Severity: r.Severity, Description: r.Description, Detail: detail})
+		}
+	}
+	return out
+}
+
+func containsFold(names []string, name string) bool {
+	for _, n := range names {
+		if strings.EqualFold(n, name) {
+			return true
+		}
+	}
+	return false
+}
+
+// codeEntropy is the entropy of the executable sections of f, or of the
+// whole file when it has no section headers.
+func codeEntropy(f *elf.File, data []byte) float64 {
+	if len(f.Sections) == 0 {
+		return entropy(data)
+	}
+	var counts [256]int
+	total := 0
+	for _, sec := range f.Sections {
+		if sec.Flags&elf.SHF_EXECINSTR == 0 || sec.Type == elf.SHT_NOBITS {
+			continue
+		}
+		b, err := sec.Data()
+		if err != nil {
+			continue
+		}
+		for _, c := range b {
+			counts[c]++
+		}
+		total += len(b)
+	}
+	return shannon(counts, total)
+}
+
+func entropy(data []byte) float64 {
+	var counts [256]int
+	for _, c := range data {
+		counts[c]++
+	}
+	return shannon(counts, len(data))
+}
+
+func shannon(counts [256]int, total int) float64 {
+	if total == 0 {
+		return 0
+	}
+	e := 0.0
+	for _, n := range counts {
+		if n == 0 {
+			continue
+		}
+		p := float64(n) / float64(total)
+		e -= p * math.Log2(p)
+	}
+	return e
+}
+
+func severityRank(s string) int {
+	for i, sev := range Severities {
+		if sev == s {
+			return i
+		}
+	}
+	return len(Severities)
+}
@@ -0,0 +1,122 @@
+package migrate
+
+import (
+	"bufio"
+	"io"
+	"net/url"
+	"regexp"
+	"sort"
+	"strings"
+	"time"
+)
+
+var (
+	// requestLine matches the start of a Nexus request.log line, in the
+	// common log format:
+	// 10.0.0.5 - ci [17/Oct/2026:07:01:02 +0000] "GET /v2/... HTTP/1.1" 200 ...
+	requestLine = regexp.MustCompile(`^(\S+) \S+ (\S+) \[([^\]]+)\] "(\S+) (\S+)[^"]*" (\d{3}) `)
+	// userAgent is the last quoted field, before the optional [thread].
+	userAgent = regexp.MustCompile(`"([^"]*)"(?:\s+\[[^\]]*\])?\s*$`)
+	// manifestPath matches a manifest request, on a connector port
+	// (/v2/<repo>/manifests/<ref>) or through the repository path
+	// (/repository/<nexus repo>/v2/<repo>/manifests/<ref>).
+	manifestPath = regexp.MustCompile(`^(?:/repository/([^/]+))?/v2/(.+)/manifests/([^/?]+)`)
+)
+
+const logTime = "02/Jan/2006:15:04:05 -0700"
+
+// Consumer is a client that pulled from an old repository.
+type Consumer struct {
+	Image      string `json:"image"`
+	Repository string `json:"repository"`
+	Client     string `json:"client"`
+	User       string `json:"user,omitempty"`
+	UserAgent  string `json:"user_agent,omitempty"`
+	// Tags are the tags requested; pulls by digest only count as requests.
+	Tags      []string  `json:"tags"`
+	Requests  int       `json:"requests"`
+	FirstSeen time.Time `json:"first_seen"`
+	LastSeen  time.Time `json:"last_seen"`
+}
+
+// Consumers reads a registry request log and returns, per image, address,
+// user and user agent, the successful manifest requests (HEAD or GET) made
+// to one of the old repositories since the given time. old maps repository
+// paths, without registry host, to image names. Lines that are not requests
+// are skipped.
+func Consumers(r io.Reader, old map[string]string, since time.Time) ([]Consumer, error) {
+	byKey := map[string]*Consumer{}
+	tags := map[string]map[string]bool{}
+	sc := bufio.NewScanner(r)
+	sc.Buffer(make([]byte, 64*1024), 1024*1024)
+	for sc.Scan() {
+		line := sc.Text()
+		m := requestLine.FindStringSubmatch(line)
+		if m == nil || (m[4] != "GET" && m[4] != "HEAD") || !strings.HasPrefix(m[6], "2") {
+			continue
+		}
+		at, err := time.Parse(logTime, m[3])
+		if err != nil || at.Before(since) {
+			continue
+		}
+		path, err := url.PathUnescape(m[5])
+		if err != nil {
+			continue
+		}
+		p := manifestPath.FindStringSubmatch(path)
+		if p == nil {
+			continue
+		}
+		repo := p[2]
+		image, ok := old[repo]
+		if !ok && p[1] != "" {
+			repo = p[1] + "/" + p[2]
+			image, ok = old[repo]
+		}
+		if !ok {
+			continue
+		}
+
+		c := Consumer{Image: image, Repository: repo, Client: m[1], User: m[2]}
+		if c.User == "-" {
+			c.User = ""
+		}
+		if ua := userAgent.FindStringSubmatch(line[len(m[0]):]); ua != nil && ua[1] != "-" {
+			c.UserAgent = ua[1]
+		}
+		key := strings.Join([]string{c.Image, c.Client, c.User, c.UserAgent}, "\x00")
+		if byKey[key] == nil {
+			c.FirstSeen = at
+			byKey[key] = &c
+			tags[key] = map[string]bool{}
+		}
+		e := byKey[key]
+		e.Requests++
+		if at.Before(e.FirstSeen) {
+			e.FirstSeen = at
+		}
+		if at.After(e.LastSeen) {
+			e.LastSeen = at
+		}
+		if ref := p[3]; !strings.Contains(ref, ":") && !tags[key][ref] {
+			tags[key][ref] = true
+			e.Tags = append(e.Tags, ref)
+		}
+	}
+	if err := sc.Err(); err != nil {
+		return nil, err
+	}
+
+	out := make([]Consumer, 0, len(byKey))
+	for _, c := range byKey {
+		sort.Strings(c.Tags)
+		out = append(out, *c)
+	}
+	sort.Slice(out, func(i, j int) bool {
+		if out[i].Image != out[j].Image {
+			return out[i].Image < out[j].Image
+		}
+		return out[i].LastSeen.After(out[j].LastSeen)
+	})
+	return out, nil
+}
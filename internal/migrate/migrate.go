@@ -0,0 +1,40 @@
+// Package migrate supports moving an image to a new repository: during the
+// transition window every build is also published to the old repository,
+// annotated with the new location, and the registry request log tells who
+// still pulls from there.
+package migrate
+
+import (
+	"context"
+	"time"
+
+	"github.com/gillouche/container-factory/internal/catalog"
+	"github.com/gillouche/container-factory/internal/registry"
+)
+
+// Annotations set on the manifests published to the old repository.
+const (
+	AnnotationMovedTo    = "factory.moved-to"
+	AnnotationMovedUntil = "factory.moved-until"
+)
+
+// Publish copies img's digest from its repository to its previous one under
+// tag, annotated with the new repository and the end of the transition
+// window. The annotations are the same for every copy of a digest, so tags
+// pointing to the same digest in the new repository also share one in the
+// old repository.
+func Publish(ctx context.Context, c *registry.Client, img catalog.Image, digest, tag string) (registry.Ref, string, error) {
+	src, err := registry.ParseRef(img.Repository + "@" + digest)
+	if err != nil {
+		return registry.Ref{}, "", err
+	}
+	dst, err := registry.ParseRef(img.Previous + ":" + tag)
+	if err != nil {
+		return registry.Ref{}, "", err
+	}
+	d, err := c.Copy(ctx, src, dst, map[string]string{
+		AnnotationMovedTo:    img.Repository,
+		AnnotationMovedUntil: img.PreviousUntil.AddDate(0, 0, -1).Format(time.DateOnly),
+	})
+	return dst, d, err
+}
@@ -0,0 +1,167 @@
+// Package notify delivers factory reports to the configured notification
+// sink. The sink is selected in ci/factory.json; secrets such as webhook URLs
+// are read from the environment variable the configuration names:
+//
+//	"notify": {"type": "discord", "webhook_env": "DISCORD_WEBHOOK"}
+package notify
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/http"
+	"os"
+	"unicode/utf8"
+)
+
+// Statuses, matching the ones used by the homelab-ci discord-notify action.
+const (
+	StatusSuccess = "success"
+	StatusInfo    = "info"
+	StatusWarning = "warning"
+	StatusFailure = "failure"
+)
+
+// Field is a titled block of a message.
+type Field struct {
+	Name   string `json:"name"`
+	Value  string `json:"value"`
+	Inline bool   `json:"inline"`
+}
+
+// Message is a single notification.
+type Message struct {
+	Title       string
+	Description string
+	Status      string
+	URL         string
+	Fields      []Field
+}
+
+// Config selects and configures a sink.
+type Config struct {
+	// Type is "discord" or "stdout".
+	Type string `json:"type"`
+	// WebhookEnv names the environment variable holding the webhook URL.
+	WebhookEnv string `json:"webhook_env"`
+	// Username overrides the webhook's display name.
+	Username string `json:"username"`
+}
+
+// Sink delivers messages.
+type Sink interface {
+	Send(ctx context.Context, m Message) error
+}
+
+// New returns the sink described by cfg. An empty type prints to stdout.
+func New(cfg Config) (Sink, error) {
+	switch cfg.Type {
+	case "", "stdout":
+		return Writer{W: os.Stdout}, nil
+	case "discord":
+		url := os.Getenv(cfg.WebhookEnv)
+		if url == "" {
+			return nil, fmt.Errorf("notify: %s is not set", cfg.WebhookEnv)
+		}
+		return &Discord{URL: url, Username: cfg.Username}, nil
+	}
+	return nil, fmt.Errorf("notify: unknown sink type %q", cfg.Type)
+}
+
+// Writer prints messages as plain text.
+type Writer struct {
+	W io.Writer
+}
+
+func (w Writer) Send(_ context.Context, m Message) error {
+	var b bytes.Buffer
+	fmt.Fprintf(&b, "[%s] %s\n", m.Status, m.Title)
+	if m.Description != "" {
+		fmt.Fprintf(&b, "%s\n", m.Description)
+	}
+	for _, f := range m.Fields {
+		fmt.Fprintf(&b, "\n%s\n%s\n", f.Name, f.Value)
+	}
+	_, err := w.W.Write(b.Bytes())
+	return err
+}
+
+// Discord posts messages to a Discord webhook as a single embed.
+type Discord struct {
+	URL      string
+	Username string
+	HTTP     *http.Client
+}
+
+// Discord embed limits.
+const (
+	maxFields      = 25
+	maxFieldValue  = 1024
+	maxDescription = 4096
+)
+
+var colors = map[string]int{
+	StatusSuccess: 0x2ecc71,
+	StatusInfo:    0x3498db,
+	StatusWarning: 0xf1c40f,
+	StatusFailure: 0xe74c3c,
+}
+
+func (d *Discord) Send(ctx context.Context, m Message) error {
+	fields := append([]Field(nil), m.Fields...)
+	if len(fields) > maxFields {
+		fields = fields[:maxFields]
+	}
+	for i := range fields {
+		fields[i].Value = truncate(fields[i].Value, maxFieldValue)
+	}
+	payload := map[string]any{
+		"embeds": []map[string]any{{
+			"title":       m.Title,
+			"description": truncate(m.Description, maxDescription),
+			"url":         m.URL,
+			"color":       colors[m.Status],
+			"fields":      fields,
+		}},
+	}
+	if d.Username != "" {
+		payload["username"] = d.Username
+	}
+	body, err := json.Marshal(payload)
+	if err != nil {
+		return err
+	}
+
+	req, err := http.NewRequestWithContext(ctx, http.MethodPost, d.URL, bytes.NewReader(body))
+	if err != nil {
+		return err
+	}
+	req.Header.Set("Content-Type", "application/json")
+	client := d.HTTP
+	if client == nil {
+		client = http.DefaultClient
+	}
+	resp, err := client.Do(req)
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode >= 300 {
+		msg, _ := io.ReadAll(io.LimitReader(resp.Body, 1024))
+		return fmt.Errorf("discord webhook: %s: %s", resp.Status, bytes.TrimSpace(msg))
+	}
+	return nil
+}
+
+func truncate(s string, n int) string {
+	if len(s) <= n {
+		return s
+	}
+	cut := n - len("…")
+	for cut > 0 && !utf8.RuneStart(s[cut]) {
+		cut--
+	}
+	return s[:cut] + "…"
+}
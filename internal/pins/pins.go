@@ -0,0 +1,183 @@
+// Package pins checks the GitHub Actions used by the workflows: actions
+// pinned to a commit SHA (with the tag as a comment) are compared to the
+// commit their tag points to now, and actions used by branch or tag are
+// reported so they get pinned.
+package pins
+
+import (
+	"context"
+	"fmt"
+	"io"
+	"io/fs"
+	"os"
+	"path/filepath"
+	"regexp"
+	"strings"
+
+	"github.com/gillouche/container-factory/internal/github"
+)
+
+// Ignored lists actions allowed to use branch references (e.g. @main)
+// without a warning. Entries are prefixes, so "gillouche/homelab-ci" covers
+// gillouche/homelab-ci/actions/discord-notify.
+var Ignored = []string{
+	"gillouche/homelab-ci",
+}
+
+// Report types.
+const (
+	TypePinned   = "action_pinned"
+	TypeUnpinned = "action_unpinned"
+	TypeNoTag    = "action_no_tag"
+)
+
+var (
+	uses       = regexp.MustCompile(`(?m)^\s*-?\s*uses:\s+([^@\s]+)@(\S+)(.*)$`)
+	tagComment = regexp.MustCompile(`#\s*(\S+)`)
+	sha        = regexp.MustCompile(`^[0-9a-f]{40}$`)
+)
+
+// Pin is one `uses:` reference of a workflow.
+type Pin struct {
+	File   string
+	Action string
+	// SHA is the pinned commit, empty when the action is used by branch or
+	// tag.
+	SHA string
+	// Tag is the tag comment of a pinned action, or the ref it is used by.
+	Tag string
+	Raw string
+}
+
+// Find returns the action references of the workflows and composite
+// actions below root/.github. Local actions and Ignored ones are skipped.
+func Find(root string) ([]Pin, error) {
+	var pins []Pin
+	err := filepath.WalkDir(filepath.Join(root, ".github"), func(path string, d fs.DirEntry, err error) error {
+		if err != nil {
+			return err
+		}
+		if d.IsDir() || (filepath.Ext(path) != ".yaml" && filepath.Ext(path) != ".yml") {
+			return nil
+		}
+		data, err := os.ReadFile(path)
+		if err != nil {
+			return err
+		}
+		rel, _ := filepath.Rel(root, path)
+		for _, m := range uses.FindAllStringSubmatch(string(data), -1) {
+			action, ref := m[1], m[2]
+			if strings.HasPrefix(action, "./") || ignored(action) {
+				continue
+			}
+			p := Pin{File: rel, Action: action, Raw: action + "@" + ref}
+			if sha.MatchString(ref) {
+				p.SHA = ref
+				if t := tagComment.FindStringSubmatch(m[3]); t != nil {
+					p.Tag = t[1]
+				}
+			} else {
+				p.Tag = ref
+			}
+			pins = append(pins, p)
+		}
+		return nil
+	})
+	if os.IsNotExist(err) {
+		return nil, nil
+	}
+	return pins, err
+}
+
+func ignored(action string) bool {
+	for _, prefix := range Ignored {
+		if strings.HasPrefix(action, prefix) {
+			return true
+		}
+	}
+	return false
+}
+
+// Repo is the repository of an action, which may live in a subdirectory
+// (owner/repo/path).
+func (p Pin) Repo() string {
+	parts := strings.SplitN(p.Action, "/", 3)
+	if len(parts) < 2 {
+		return p.Action
+	}
+	return parts[0] + "/" + parts[1]
+}
+
+// Entry is an update, warning or up-to-date entry of the check-pinned-deps
+// report.
+type Entry struct {
+	File       string `json:"file"`
+	Action     string `json:"action"`
+	Tag        string `json:"tag,omitempty"`
+	Ref        string `json:"ref,omitempty"`
+	CurrentSHA string `json:"current_sha,omitempty"`
+	LatestSHA  string `json:"latest_sha,omitempty"`
+	SHA        string `json:"sha,omitempty"`
+	Reason     string `json:"reason,omitempty"`
+	Type       string `json:"type"`
+	RawRef     string `json:"raw_ref,omitempty"`
+}
+
+// Report is the check-pinned-deps report.
+type Report struct {
+	Updates  []Entry `json:"updates"`
+	Warnings []Entry `json:"warnings"`
+	UpToDate []Entry `json:"up_to_date"`
+}
+
+// Check resolves the tag (or ref) of every pin to its current commit.
+// Progress goes to log.
+func Check(ctx context.Context, gh *github.Client, pins []Pin, log io.Writer) *Report {
+	r := &Report{Updates: []Entry{}, Warnings: []Entry{}, UpToDate: []Entry{}}
+	// Workflows share actions; each repository and ref is resolved once.
+	type result struct {
+		sha string
+		err error
+	}
+	resolved := map[string]result{}
+	for _, p := range pins {
+		if p.SHA != "" && p.Tag == "" {
+			r.Warnings = append(r.Warnings, Entry{
+				File: p.File, Action: p.Action, CurrentSHA: p.SHA,
+				Reason: "SHA-pinned action without tag comment", Type: TypeNoTag,
+			})
+			continue
+		}
+
+		key := p.Repo() + "@" + p.Tag
+		res, ok := resolved[key]
+		if !ok {
+			fmt.Fprintf(log, "  Checking %s@%s ...\n", p.Action, p.Tag)
+			res.sha, res.err = gh.Commit(ctx, p.Repo(), p.Tag)
+			resolved[key] = res
+		}
+		latest, err := res.sha, res.err
+		typ := TypePinned
+		if p.SHA == "" {
+			typ = TypeUnpinned
+		}
+		switch {
+		case err != nil:
+			fmt.Fprintf(log, "  [warn] %s@%s: %v\n", p.Action, p.Tag, err)
+			r.Warnings = append(r.Warnings, Entry{
+				File: p.File, Action: p.Action, Ref: p.Tag,
+				Reason: fmt.Sprintf("Could not check update for %s@%s", p.Action, p.Tag), Type: typ,
+			})
+		case p.SHA == "" || latest != p.SHA:
+			r.Updates = append(r.Updates, Entry{
+				File: p.File, Action: p.Action, Tag: p.Tag, CurrentSHA: p.SHA, LatestSHA: latest,
+				Type: typ, RawRef: p.Raw,
+			})
+		default:
+			r.UpToDate = append(r.UpToDate, Entry{
+				File: p.File, Action: p.Action, Tag: p.Tag, SHA: p.SHA, Type: TypePinned, RawRef: p.Raw,
+			})
+		}
+	}
+	return r
+}
@@ -0,0 +1,158 @@
+// Package promote decides when floating tags (latest, major, major.minor)
+// may move to a new digest. A digest first soaks under its exact tag; the
+// floating tags follow once the soak period has passed without failing
+// checks.
+package promote
+
+import (
+	"fmt"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/gillouche/container-factory/internal/ledger"
+	"github.com/gillouche/container-factory/internal/vuln"
+)
+
+// Tag states.
+const (
+	StatusCurrent  = "current"
+	StatusEligible = "eligible"
+	StatusSoaking  = "soaking"
+	StatusBlocked  = "blocked"
+)
+
+// Policy is what a digest must satisfy before floating tags move to it.
+type Policy struct {
+	Soak time.Duration
+	// Block lists the severities that keep a digest from being promoted.
+	Block []string
+}
+
+// Tag is the evaluation of one floating tag.
+type Tag struct {
+	Image   string `json:"image"`
+	Tag     string `json:"tag"`
+	Variant string `json:"variant"`
+	// Current is the digest the floating tag points to now, Candidate the
+	// one of the exact variant tag.
+	Current   string    `json:"current,omitempty"`
+	Candidate string    `json:"candidate,omitempty"`
+	Since     time.Time `json:"since,omitzero"`
+	Eligible  time.Time `json:"eligible_at,omitzero"`
+	Status    string    `json:"status"`
+	Reason    string    `json:"reason,omitempty"`
+}
+
+// FloatingTags maps each floating tag of an image to the variant it should
+// follow: latest to the highest variant, "3" and "3.12" to the highest
+// 3.x and 3.12.x. Tags that are themselves a variant are left alone.
+func FloatingTags(variants []string) map[string]string {
+	sorted := append([]string(nil), variants...)
+	sort.Slice(sorted, func(i, j int) bool { return Compare(sorted[i], sorted[j]) < 0 })
+	exact := map[string]bool{}
+	for _, v := range variants {
+		exact[v] = true
+	}
+
+	tags := map[string]string{}
+	for _, v := range sorted {
+		parts := strings.Split(v, ".")
+		for n := 1; n < len(parts) && n <= 2; n++ {
+			if t := strings.Join(parts[:n], "."); !exact[t] {
+				tags[t] = v
+			}
+		}
+	}
+	if len(sorted) > 0 {
+		tags["latest"] = sorted[len(sorted)-1]
+	}
+	return tags
+}
+
+// Compare orders versions by their dot-separated numeric components, as
+// ci/build.sh sorts VARIANTS; non-numeric components compare as strings.
+func Compare(a, b string) int {
+	pa, pb := strings.Split(a, "."), strings.Split(b, ".")
+	for i := 0; i < len(pa) && i < len(pb); i++ {
+		na, ea := strconv.Atoi(pa[i])
+		nb, eb := strconv.Atoi(pb[i])
+		switch {
+		case ea == nil && eb == nil && na != nb:
+			if na < nb {
+				return -1
+			}
+			return 1
+		case (ea != nil || eb != nil) && pa[i] != pb[i]:
+			return strings.Compare(pa[i], pb[i])
+		}
+	}
+	return len(pa) - len(pb)
+}
+
+// Evaluate decides whether t may move to t.Candidate at now. The soak starts
+// when the ledger first recorded the candidate digest. A failed build since
+// then blocks the promotion when it is of the candidate (its digest or
+// revision) and the candidate has not been built successfully since, or
+// when it is the latest record of the variant. A finding of a blocking
+// severity in the latest scan blocks it too.
+func Evaluate(t Tag, l *ledger.Ledger, scan *vuln.Report, p Policy, now time.Time) Tag {
+	switch {
+	case t.Candidate == "":
+		t.Status, t.Reason = StatusBlocked, fmt.Sprintf("%s:%s is not published", t.Image, t.Variant)
+		return t
+	case t.Candidate == t.Current:
+		t.Status = StatusCurrent
+		return t
+	}
+
+	history := l.History(t.Image, t.Variant)
+	var revision string
+	for _, r := range history {
+		if r.Status == ledger.StatusSuccess && r.Digest == t.Candidate {
+			t.Since, revision = r.Time, r.Revision
+			break
+		}
+	}
+	if t.Since.IsZero() {
+		t.Status, t.Reason = StatusBlocked, "digest not recorded in the build ledger"
+		return t
+	}
+	t.Eligible = t.Since.Add(p.Soak)
+
+	var failed *ledger.Record
+	for i, r := range history {
+		if !r.Time.After(t.Since) {
+			continue
+		}
+		ofCandidate := r.Digest == t.Candidate || (r.Digest == "" && revision != "" && r.Revision == revision)
+		switch {
+		case r.Status == ledger.StatusSuccess && r.Digest == t.Candidate:
+			failed = nil
+		case r.Status == ledger.StatusFailure && (ofCandidate || i == len(history)-1):
+			failed = &history[i]
+		}
+	}
+	if failed != nil {
+		t.Status, t.Reason = StatusBlocked, "build failed on "+failed.Time.Format(time.RFC3339)
+		return t
+	}
+	if scan != nil {
+		counts := scan.Counts()
+		for _, sev := range p.Block {
+			if counts[sev] > 0 {
+				t.Status, t.Reason = StatusBlocked, fmt.Sprintf("%d %s finding(s)", counts[sev], sev)
+				return t
+			}
+		}
+	}
+
+	if now.Before(t.Eligible) {
+		t.Status = StatusSoaking
+		t.Reason = fmt.Sprintf("%s left", t.Eligible.Sub(now).Round(time.Minute))
+		return t
+	}
+	t.Status = StatusEligible
+	return t
+}
@@ -0,0 +1,47 @@
+package promote
+
+import (
+	"testing"
+	"time"
+
+	"github.com/gillouche/container-factory/internal/ledger"
+)
+
+func TestEvaluateFailures(t *testing.T) {
+	start := time.Date(2026, 10, 1, 0, 0, 0, 0, time.UTC)
+	at := func(hours int) time.Time { return start.Add(time.Duration(hours) * time.Hour) }
+	success := func(hours int, revision, digest string) ledger.Record {
+		return ledger.Record{Status: ledger.StatusSuccess, Time: at(hours), Revision: revision, Digest: digest}
+	}
+	failure := func(hours int, revision, digest string) ledger.Record {
+		return ledger.Record{Status: ledger.StatusFailure, Time: at(hours), Revision: revision, Digest: digest}
+	}
+
+	tests := []struct {
+		name    string
+		records []ledger.Record
+		want    string
+	}{
+		{"clean", []ledger.Record{success(0, "r1", "sha256:a")}, StatusEligible},
+		{"latest-failed", []ledger.Record{success(0, "r1", "sha256:a"), failure(10, "r2", "")}, StatusBlocked},
+		{"other-revision-fixed", []ledger.Record{success(0, "r1", "sha256:a"), failure(10, "r2", ""), success(20, "r3", "sha256:b")}, StatusEligible},
+		{"candidate-revision-failed", []ledger.Record{success(0, "r1", "sha256:a"), failure(10, "r1", ""), success(20, "r3", "sha256:b")}, StatusBlocked},
+		{"candidate-digest-failed", []ledger.Record{success(0, "r1", "sha256:a"), failure(10, "r2", "sha256:a"), success(20, "r3", "sha256:b")}, StatusBlocked},
+		{"candidate-rebuilt", []ledger.Record{success(0, "r1", "sha256:a"), failure(10, "r1", ""), success(20, "r1", "sha256:a")}, StatusEligible},
+		{"failed-before", []ledger.Record{failure(-10, "r0", ""), success(0, "r1", "sha256:a")}, StatusEligible},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			l := &ledger.Ledger{}
+			for _, r := range tt.records {
+				r.Image, r.Variant = "python", "3.14.4"
+				l.Records = append(l.Records, r)
+			}
+			tag := Tag{Image: "python", Tag: "3.14", Variant: "3.14.4", Current: "sha256:old", Candidate: "sha256:a"}
+			got := Evaluate(tag, l, nil, Policy{Soak: 72 * time.Hour}, at(100))
+			if got.Status != tt.want {
+				t.Errorf("%s (%s), want %s", got.Status, got.Reason, tt.want)
+			}
+		})
+	}
+}
@@ -0,0 +1,88 @@
+package registry
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"strings"
+)
+
+// BuildKit stores the attestations of a pushed image (--sbom,
+// --provenance) in its index: one manifest per platform image, annotated
+// as an attestation of that image, with one in-toto statement per layer.
+const (
+	AnnotationReferenceType   = "vnd.docker.reference.type"
+	AnnotationReferenceDigest = "vnd.docker.reference.digest"
+	AnnotationPredicateType   = "in-toto.io/predicate-type"
+
+	ReferenceTypeAttestation = "attestation-manifest"
+)
+
+// PredicateSPDX is the predicate type of BuildKit's SBOM attestations.
+const PredicateSPDX = "https://spdx.dev/Document"
+
+// Attestation is an in-toto statement attached to an image.
+type Attestation struct {
+	PredicateType string
+	// Statement is the statement as stored in the registry.
+	Statement []byte
+}
+
+// IsProvenance reports whether a is SLSA provenance, of any version.
+func (a Attestation) IsProvenance() bool {
+	return strings.HasPrefix(a.PredicateType, "https://slsa.dev/provenance/")
+}
+
+// Attestations returns the attestations of the platform image of ref.
+// Images pushed without attestations, single-platform manifests among
+// them, have none.
+func (c *Client) Attestations(ctx context.Context, ref Ref, platform Platform) ([]Attestation, error) {
+	data, _, _, err := c.Manifest(ctx, ref)
+	if err != nil {
+		return nil, err
+	}
+	var index Index
+	if err := json.Unmarshal(data, &index); err != nil {
+		return nil, fmt.Errorf("%s: %w", ref, err)
+	}
+	image := ""
+	for _, d := range index.Manifests {
+		p := d.Platform
+		if p != nil && p.OS == platform.OS && p.Architecture == platform.Architecture &&
+			(platform.Variant == "" || p.Variant == platform.Variant) {
+			image = d.Digest
+			break
+		}
+	}
+	if image == "" {
+		return nil, nil
+	}
+
+	var out []Attestation
+	for _, d := range index.Manifests {
+		if d.Annotations[AnnotationReferenceType] != ReferenceTypeAttestation || d.Annotations[AnnotationReferenceDigest] != image {
+			continue
+		}
+		child := Ref{Registry: ref.Registry, Repository: ref.Repository, Digest: d.Digest}
+		data, _, _, err := c.Manifest(ctx, child)
+		if err != nil {
+			return nil, err
+		}
+		var m Manifest
+		if err := json.Unmarshal(data, &m); err != nil {
+			return nil, fmt.Errorf("%s: %w", child, err)
+		}
+		for _, l := range m.Layers {
+			predicate := l.Annotations[AnnotationPredicateType]
+			if predicate == "" {
+				continue
+			}
+			statement, err := c.Blob(ctx, child, l.Digest)
+			if err != nil {
+				return nil, err
+			}
+			out = append(out, Attestation{PredicateType: predicate, Statement: statement})
+		}
+	}
+	return out, nil
+}
@@ -0,0 +1,142 @@
+package registry
+
+import (
+	"context"
+	"encoding/base64"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"net/url"
+	"os"
+	"path/filepath"
+	"strings"
+)
+
+// DockerCredentials looks up credentials for host in the Docker CLI config
+// written by `docker login` ($DOCKER_CONFIG/config.json or
+// ~/.docker/config.json). Credential helpers are not supported.
+func DockerCredentials(host string) (user, pass string) {
+	dir := os.Getenv("DOCKER_CONFIG")
+	if dir == "" {
+		home, err := os.UserHomeDir()
+		if err != nil {
+			return "", ""
+		}
+		dir = filepath.Join(home, ".docker")
+	}
+	data, err := os.ReadFile(filepath.Join(dir, "config.json"))
+	if err != nil {
+		return "", ""
+	}
+	var cfg struct {
+		Auths map[string]struct {
+			Auth string `json:"auth"`
+		} `json:"auths"`
+	}
+	if json.Unmarshal(data, &cfg) != nil {
+		return "", ""
+	}
+
+	keys := []string{host, "https://" + host}
+	if host == "docker.io" {
+		keys = append(keys, "https://index.docker.io/v1/", "index.docker.io")
+	}
+	for _, k := range keys {
+		entry, ok := cfg.Auths[k]
+		if !ok || entry.Auth == "" {
+			continue
+		}
+		raw, err := base64.StdEncoding.DecodeString(entry.Auth)
+		if err != nil {
+			continue
+		}
+		user, pass, _ = strings.Cut(string(raw), ":")
+		return user, pass
+	}
+	return "", ""
+}
+
+// authorize answers a WWW-Authenticate challenge and returns the
+// Authorization header value to use for subsequent requests.
+func (c *Client) authorize(ctx context.Context, registry, challenge string) (string, error) {
+	scheme, params := parseChallenge(challenge)
+	user, pass := "", ""
+	if c.Credentials != nil {
+		user, pass = c.Credentials(registry)
+	}
+
+	switch strings.ToLower(scheme) {
+	case "basic":
+		if user == "" {
+			return "", fmt.Errorf("%s requires credentials", registry)
+		}
+		return "Basic " + base64.StdEncoding.EncodeToString([]byte(user+":"+pass)), nil
+	case "bearer":
+		realm, err := url.Parse(params["realm"])
+		if err != nil || realm.Host == "" {
+			return "", fmt.Errorf("%s: invalid token realm %q", registry, params["realm"])
+		}
+		q := realm.Query()
+		for _, k := range []string{"service", "scope"} {
+			if v := params[k]; v != "" {
+				q.Set(k, v)
+			}
+		}
+		realm.RawQuery = q.Encode()
+
+		req, err := http.NewRequestWithContext(ctx, http.MethodGet, realm.String(), nil)
+		if err != nil {
+			return "", err
+		}
+		if user != "" {
+			req.SetBasicAuth(user, pass)
+		}
+		resp, err := c.http().Do(req)
+		if err != nil {
+			return "", err
+		}
+		defer resp.Body.Close()
+		if resp.StatusCode != http.StatusOK {
+			return "", fmt.Errorf("%s: token request: %s", registry, resp.Status)
+		}
+		var tok struct {
+			Token       string `json:"token"`
+			AccessToken string `json:"access_token"`
+		}
+		if err := json.NewDecoder(resp.Body).Decode(&tok); err != nil {
+			return "", fmt.Errorf("%s: token response: %w", registry, err)
+		}
+		if tok.Token == "" {
+			tok.Token = tok.AccessToken
+		}
+		return "Bearer " + tok.Token, nil
+	}
+	return "", fmt.Errorf("%s: unsupported auth challenge %q", registry, challenge)
+}
+
+// parseChallenge splits `Bearer realm="...",service="...",scope="a:b:pull,push"`
+// into its scheme and parameters. Quoted values may contain commas.
+func parseChallenge(h string) (string, map[string]string) {
+	scheme, rest, _ := strings.Cut(strings.TrimSpace(h), " ")
+	params := map[string]string{}
+	for rest != "" {
+		rest = strings.TrimLeft(rest, ", ")
+		key, after, ok := strings.Cut(rest, "=")
+		if !ok {
+			break
+		}
+		var value string
+		if strings.HasPrefix(after, `"`) {
+			end := strings.Index(after[1:], `"`)
+			if end < 0 {
+				value, rest = after[1:], ""
+			} else {
+				value, rest = after[1:end+1], after[end+2:]
+			}
+		} else {
+			value, rest, _ = strings.Cut(after, ",")
+		}
+		params[strings.ToLower(strings.TrimSpace(key))] = value
+	}
+	return scheme, params
+}
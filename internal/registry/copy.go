@@ -0,0 +1,174 @@
+package registry
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"net/http"
+)
+
+// Copy copies the manifest src points to, with the manifests and blobs it
+// references, to dst and returns the digest published under dst. Blobs are
+// mounted from src's repository when the registry allows it.
+//
+// When annotations are given they are added to the top-level manifest, so
+// the digest under dst differs from src. Docker manifests have no
+// annotations; they are wrapped in an OCI index carrying them instead.
+func (c *Client) Copy(ctx context.Context, src, dst Ref, annotations map[string]string) (string, error) {
+	data, mediaType, digest, err := c.Manifest(ctx, src)
+	if err != nil {
+		return "", err
+	}
+	if mediaType == "" {
+		var m struct {
+			MediaType string `json:"mediaType"`
+		}
+		json.Unmarshal(data, &m)
+		mediaType = m.MediaType
+	}
+	if err := c.copyChildren(ctx, src, dst, mediaType, data); err != nil {
+		return "", err
+	}
+	if len(annotations) == 0 {
+		return c.PutManifest(ctx, dst, mediaType, data)
+	}
+
+	switch mediaType {
+	case MediaTypeManifest, MediaTypeIndex:
+		if data, err = annotate(data, annotations); err != nil {
+			return "", fmt.Errorf("%s: %w", src, err)
+		}
+	default:
+		if data, err = c.wrap(ctx, src, dst, mediaType, data, digest, annotations); err != nil {
+			return "", err
+		}
+		mediaType = MediaTypeIndex
+	}
+	return c.PutManifest(ctx, dst, mediaType, data)
+}
+
+// copyChildren copies what a manifest references: the manifests of an index,
+// or the config and layers of an image manifest.
+func (c *Client) copyChildren(ctx context.Context, src, dst Ref, mediaType string, data []byte) error {
+	var m struct {
+		Manifests []Descriptor `json:"manifests"`
+		Config    Descriptor   `json:"config"`
+		Layers    []Descriptor `json:"layers"`
+	}
+	if err := json.Unmarshal(data, &m); err != nil {
+		return fmt.Errorf("%s: %w", src, err)
+	}
+	for _, child := range m.Manifests {
+		from := Ref{Registry: src.Registry, Repository: src.Repository, Digest: child.Digest}
+		to := Ref{Registry: dst.Registry, Repository: dst.Repository, Digest: child.Digest}
+		if _, err := c.Copy(ctx, from, to, nil); err != nil {
+			return err
+		}
+	}
+	blobs := m.Layers
+	if m.Config.Digest != "" {
+		blobs = append([]Descriptor{m.Config}, blobs...)
+	}
+	for _, b := range blobs {
+		if err := c.copyBlob(ctx, src, dst, b); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// copyBlob mounts a blob from src's repository into dst's, falling back to
+// downloading and uploading it.
+func (c *Client) copyBlob(ctx context.Context, src, dst Ref, b Descriptor) error {
+	if src.Registry == dst.Registry {
+		path := "/blobs/uploads/?mount=" + b.Digest + "&from=" + src.Repository
+		resp, err := c.do(ctx, http.MethodPost, dst, path, nil, nil)
+		if err != nil {
+			return err
+		}
+		resp.Body.Close()
+		if resp.StatusCode == http.StatusCreated {
+			return nil
+		}
+	}
+	data, err := c.Blob(ctx, src, b.Digest)
+	if err != nil {
+		return err
+	}
+	_, err = c.PutBlob(ctx, dst, b.MediaType, data)
+	return err
+}
+
+// annotate merges annotations into the annotations of a manifest or index.
+// Keys are re-encoded in sorted order, so the result only depends on the
+// input and the annotations.
+func annotate(data []byte, annotations map[string]string) ([]byte, error) {
+	var m map[string]json.RawMessage
+	if err := json.Unmarshal(data, &m); err != nil {
+		return nil, err
+	}
+	merged := map[string]string{}
+	if raw, ok := m["annotations"]; ok {
+		if err := json.Unmarshal(raw, &merged); err != nil {
+			return nil, err
+		}
+	}
+	for k, v := range annotations {
+		merged[k] = v
+	}
+	raw, err := json.Marshal(merged)
+	if err != nil {
+		return nil, err
+	}
+	m["annotations"] = raw
+	return json.Marshal(m)
+}
+
+// wrap returns an OCI index holding the docker manifest (or manifest list)
+// already copied to dst, with the annotations.
+func (c *Client) wrap(ctx context.Context, src, dst Ref, mediaType string, data []byte, digest string, annotations map[string]string) ([]byte, error) {
+	var children []Descriptor
+	if mediaType == "application/vnd.docker.distribution.manifest.list.v2+json" {
+		var list struct {
+			Manifests []Descriptor `json:"manifests"`
+		}
+		if err := json.Unmarshal(data, &list); err != nil {
+			return nil, fmt.Errorf("%s: %w", src, err)
+		}
+		children = list.Manifests
+	} else {
+		platform, err := c.platform(ctx, src, data)
+		if err != nil {
+			return nil, err
+		}
+		children = []Descriptor{{MediaType: mediaType, Digest: digest, Size: int64(len(data)), Platform: platform}}
+		// The wrapped manifest is referenced by digest only.
+		to := Ref{Registry: dst.Registry, Repository: dst.Repository, Digest: digest}
+		if _, err := c.PutManifest(ctx, to, mediaType, data); err != nil {
+			return nil, err
+		}
+	}
+	return json.Marshal(struct {
+		SchemaVersion int               `json:"schemaVersion"`
+		MediaType     string            `json:"mediaType"`
+		Manifests     []Descriptor      `json:"manifests"`
+		Annotations   map[string]string `json:"annotations"`
+	}{2, MediaTypeIndex, children, annotations})
+}
+
+// platform reads the os and architecture of an image manifest's config.
+func (c *Client) platform(ctx context.Context, ref Ref, data []byte) (*Platform, error) {
+	var m Manifest
+	if err := json.Unmarshal(data, &m); err != nil {
+		return nil, fmt.Errorf("%s: %w", ref, err)
+	}
+	blob, err := c.Blob(ctx, ref, m.Config.Digest)
+	if err != nil {
+		return nil, err
+	}
+	var p Platform
+	if err := json.Unmarshal(blob, &p); err != nil {
+		return nil, fmt.Errorf("%s: config: %w", ref, err)
+	}
+	return &p, nil
+}
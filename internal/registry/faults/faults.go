@@ -0,0 +1,315 @@
+// Package faults wraps a registry, the in-memory one in tests, to inject
+// the failures registries produce under load or during maintenance: 5xx
+// responses, 429 with Retry-After, blobs cut short, slow responses, bearer
+// tokens expiring mid-push and responses lost after the request took
+// effect. Faults apply to the requests matching a method and path glob, a
+// number of times, so clients can be shown to retry, re-authenticate and
+// resume pushes correctly. It is imported by tests only.
+package faults
+
+import (
+	"bytes"
+	"crypto/rand"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"regexp"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+)
+
+// Fault kinds.
+const (
+	// Status answers with Fault.Status (500, 502, 503...).
+	Status = "status"
+	// Throttle answers 429 with a Retry-After of Fault.Delay.
+	Throttle = "throttle"
+	// Truncate sends half of the response body, with the Content-Length of
+	// all of it.
+	Truncate = "truncate"
+	// Slow waits Fault.Delay before handling the request.
+	Slow = "slow"
+	// Expire revokes every bearer token and answers 401, as when a token
+	// expires mid-push. It needs Injector.Auth.
+	Expire = "expire"
+	// Lost handles the request, then answers 502 instead, as a proxy
+	// losing the registry's response does: the client retries a request
+	// that already took effect.
+	Lost = "lost"
+)
+
+// Fault is a failure injected into the requests it matches.
+type Fault struct {
+	// Method matches the request method, any when empty.
+	Method string
+	// Path is a glob of the URL path, where * matches any run of
+	// characters, slashes included: /v2/*/manifests/*.
+	Path   string
+	Kind   string
+	Status int
+	Delay  time.Duration
+	// Times is the number of matching requests that fail, every one when
+	// zero.
+	Times int
+
+	re   *regexp.Regexp
+	hits int
+}
+
+var times = regexp.MustCompile(`^(.+)x(\d+)$`)
+
+// Parse parses a fault spec, [METHOD ]GLOB=KIND[xTIMES] where KIND is a
+// status code (503), 429[:RETRY-AFTER], truncate, slow:DELAY, expire or
+// lost:
+//
+//	PUT /v2/*/manifests/*=503x2
+//	/v2/*/blobs/sha256:*=truncate
+//	*=429:2s
+func Parse(spec string) (*Fault, error) {
+	match, kind, ok := strings.Cut(spec, "=")
+	if !ok || match == "" || kind == "" {
+		return nil, fmt.Errorf("fault %q: want [METHOD ]GLOB=KIND[xTIMES]", spec)
+	}
+	f := &Fault{Path: match}
+	if method, glob, ok := strings.Cut(match, " "); ok {
+		f.Method, f.Path = strings.ToUpper(method), strings.TrimSpace(glob)
+	}
+	if m := times.FindStringSubmatch(kind); m != nil {
+		n, err := strconv.Atoi(m[2])
+		if err != nil || n < 1 {
+			return nil, fmt.Errorf("fault %q: invalid count %q", spec, m[2])
+		}
+		f.Times, kind = n, m[1]
+	}
+	name, arg, _ := strings.Cut(kind, ":")
+	var err error
+	switch {
+	case name == Truncate || name == Expire || name == Lost:
+		f.Kind = name
+	case name == "slow":
+		f.Kind = Slow
+		if f.Delay, err = time.ParseDuration(arg); err != nil {
+			return nil, fmt.Errorf("fault %q: %w", spec, err)
+		}
+	case name == "429":
+		f.Kind = Throttle
+		if arg != "" {
+			if f.Delay, err = time.ParseDuration(arg); err != nil {
+				return nil, fmt.Errorf("fault %q: %w", spec, err)
+			}
+		}
+	default:
+		code, err := strconv.Atoi(name)
+		if err != nil || code < 400 || code > 599 {
+			return nil, fmt.Errorf("fault %q: unknown kind %q", spec, name)
+		}
+		f.Kind, f.Status = Status, code
+	}
+	return f, nil
+}
+
+// String returns f as a spec Parse reads back.
+func (f *Fault) String() string {
+	kind := f.Kind
+	switch f.Kind {
+	case Status:
+		kind = strconv.Itoa(f.Status)
+	case Throttle:
+		kind = "429:" + f.Delay.String()
+	case Slow:
+		kind = "slow:" + f.Delay.String()
+	}
+	s := f.Path + "=" + kind
+	if f.Method != "" {
+		s = f.Method + " " + s
+	}
+	if f.Times > 0 {
+		s += "x" + strconv.Itoa(f.Times)
+	}
+	return s
+}
+
+func (f *Fault) matches(method, path string) bool {
+	if f.Method != "" && f.Method != method {
+		return false
+	}
+	if f.re == nil {
+		parts := strings.Split(f.Path, "*")
+		for i, p := range parts {
+			parts[i] = regexp.QuoteMeta(p)
+		}
+		f.re = regexp.MustCompile("^" + strings.Join(parts, ".*") + "$")
+	}
+	return f.re.MatchString(path)
+}
+
+// Request is a request the injector saw.
+type Request struct {
+	Method string
+	Path   string
+	Time   time.Time
+	// Fault is the kind of the fault injected, "" when none was.
+	Fault string
+}
+
+// Injector serves Next, injecting Faults. The first fault matching a
+// request, with failures left, applies.
+type Injector struct {
+	Next   http.Handler
+	Faults []*Fault
+	// Auth requires bearer tokens under /v2/, issued by /token to anyone,
+	// so Expire can revoke them.
+	Auth bool
+
+	mu       sync.Mutex
+	tokens   map[string]bool
+	requests []Request
+}
+
+// Requests returns the requests seen so far, token requests included.
+func (in *Injector) Requests() []Request {
+	in.mu.Lock()
+	defer in.mu.Unlock()
+	return append([]Request(nil), in.requests...)
+}
+
+// Count returns the number of requests of method (any when empty) whose
+// path matches glob.
+func (in *Injector) Count(method, glob string) int {
+	f := &Fault{Method: method, Path: glob}
+	n := 0
+	for _, r := range in.Requests() {
+		if f.matches(r.Method, r.Path) {
+			n++
+		}
+	}
+	return n
+}
+
+// Pending returns the faults with failures left to inject.
+func (in *Injector) Pending() []*Fault {
+	in.mu.Lock()
+	defer in.mu.Unlock()
+	var out []*Fault
+	for _, f := range in.Faults {
+		if f.Times == 0 || f.hits < f.Times {
+			out = append(out, f)
+		}
+	}
+	return out
+}
+
+func (in *Injector) ServeHTTP(w http.ResponseWriter, req *http.Request) {
+	in.mu.Lock()
+	var fault *Fault
+	for _, f := range in.Faults {
+		if (f.Times == 0 || f.hits < f.Times) && f.matches(req.Method, req.URL.Path) {
+			f.hits++
+			fault = f
+			break
+		}
+	}
+	r := Request{Method: req.Method, Path: req.URL.Path, Time: time.Now()}
+	if fault != nil {
+		r.Fault = fault.Kind
+	}
+	in.requests = append(in.requests, r)
+	in.mu.Unlock()
+
+	if in.Auth && req.URL.Path == "/token" {
+		in.issue(w)
+		return
+	}
+	if fault != nil {
+		switch fault.Kind {
+		case Status:
+			writeError(w, fault.Status, "UNAVAILABLE", "injected fault")
+			return
+		case Throttle:
+			w.Header().Set("Retry-After", strconv.Itoa(int(fault.Delay.Round(time.Second)/time.Second)))
+			writeError(w, http.StatusTooManyRequests, "TOOMANYREQUESTS", "injected fault")
+			return
+		case Expire:
+			in.mu.Lock()
+			in.tokens = nil
+			in.mu.Unlock()
+			in.challenge(w, req)
+			return
+		case Slow:
+			t := time.NewTimer(fault.Delay)
+			select {
+			case <-req.Context().Done():
+				t.Stop()
+				return
+			case <-t.C:
+			}
+		}
+	}
+	if in.Auth && strings.HasPrefix(req.URL.Path, "/v2/") && !in.authorized(req) {
+		in.challenge(w, req)
+		return
+	}
+	if fault != nil && fault.Kind == Lost {
+		in.Next.ServeHTTP(&recorder{header: http.Header{}}, req)
+		writeError(w, http.StatusBadGateway, "UNAVAILABLE", "injected fault")
+		return
+	}
+	if fault != nil && fault.Kind == Truncate {
+		rec := &recorder{header: http.Header{}, status: http.StatusOK}
+		in.Next.ServeHTTP(rec, req)
+		for k, v := range rec.header {
+			w.Header()[k] = v
+		}
+		w.Header().Set("Content-Length", strconv.Itoa(rec.body.Len()))
+		w.WriteHeader(rec.status)
+		w.Write(rec.body.Bytes()[:rec.body.Len()/2])
+		return
+	}
+	in.Next.ServeHTTP(w, req)
+}
+
+func (in *Injector) issue(w http.ResponseWriter) {
+	b := make([]byte, 16)
+	rand.Read(b)
+	token := hex.EncodeToString(b)
+	in.mu.Lock()
+	if in.tokens == nil {
+		in.tokens = map[string]bool{}
+	}
+	in.tokens[token] = true
+	in.mu.Unlock()
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(map[string]any{"token": token, "expires_in": 300})
+}
+
+func (in *Injector) authorized(req *http.Request) bool {
+	token, ok := strings.CutPrefix(req.Header.Get("Authorization"), "Bearer ")
+	in.mu.Lock()
+	defer in.mu.Unlock()
+	return ok && in.tokens[token]
+}
+
+func (in *Injector) challenge(w http.ResponseWriter, req *http.Request) {
+	w.Header().Set("WWW-Authenticate", fmt.Sprintf(`Bearer realm="http://%s/token",service="faults"`, req.Host))
+	writeError(w, http.StatusUnauthorized, "UNAUTHORIZED", "authentication required")
+}
+
+// recorder buffers a response so it can be cut short.
+type recorder struct {
+	header http.Header
+	status int
+	body   bytes.Buffer
+}
+
+func (r *recorder) Header() http.Header         { return r.header }
+func (r *recorder) WriteHeader(status int)      { r.status = status }
+func (r *recorder) Write(b []byte) (int, error) { return r.body.Write(b) }
+
+func writeError(w http.ResponseWriter, status int, code, message string) {
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(status)
+	json.NewEncoder(w).Encode(map[string]any{"errors": []map[string]string{{"code": code, "message": message}}})
+}
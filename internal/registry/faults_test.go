@@ -0,0 +1,284 @@
+package registry_test
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"fmt"
+	"net/http"
+	"testing"
+	"time"
+
+	"github.com/gillouche/container-factory/internal/registry"
+	"github.com/gillouche/container-factory/internal/registry/faults"
+	"github.com/gillouche/container-factory/internal/registry/memory"
+	"github.com/gillouche/container-factory/internal/registry/registrytest"
+	"github.com/gillouche/container-factory/internal/signing"
+)
+
+// TestFaults pushes, pulls, copies and signs images through a registry
+// injecting failures, and checks that transient ones are retried, that
+// the rest fail cleanly and that interrupted pushes resume.
+func TestFaults(t *testing.T) {
+	tests := []struct {
+		name  string
+		specs []string
+		auth  bool
+		run   func(ctx context.Context, in *faults.Injector, client *registry.Client, repo string) error
+	}{
+		{"server-error", []string{"PUT /v2/*/manifests/*=503x2"}, false, func(ctx context.Context, in *faults.Injector, client *registry.Client, repo string) error {
+			if _, err := registrytest.PushImage(ctx, client, repo, "1.0"); err != nil {
+				return err
+			}
+			return expectCount(in, "PUT", "/v2/*/manifests/*", 3)
+		}},
+		{"client-error", []string{"PUT /v2/*/manifests/*=400x1"}, false, func(ctx context.Context, in *faults.Injector, client *registry.Client, repo string) error {
+			if _, err := registrytest.PushImage(ctx, client, repo, "1.0"); err == nil {
+				return errors.New("push succeeded despite a 400")
+			}
+			return expectCount(in, "PUT", "/v2/*/manifests/*", 1)
+		}},
+		{"interrupted-push", []string{"PUT /v2/*/manifests/*=500"}, false, func(ctx context.Context, in *faults.Injector, client *registry.Client, repo string) error {
+			if _, err := registrytest.PushImage(ctx, client, repo, "1.0"); err == nil {
+				return errors.New("push succeeded through a registry failing every manifest")
+			}
+			if err := expectCount(in, "PUT", "/v2/*/manifests/*", client.Retry.Attempts); err != nil {
+				return err
+			}
+			uploads := in.Count("POST", "/v2/*/blobs/uploads/")
+			in.Faults = nil
+			first, err := registrytest.PushImage(ctx, client, repo, "1.0")
+			if err != nil {
+				return fmt.Errorf("resumed push: %w", err)
+			}
+			again, err := registrytest.PushImage(ctx, client, repo, "1.0")
+			switch {
+			case err != nil:
+				return fmt.Errorf("repeated push: %w", err)
+			case again.Digest != first.Digest:
+				return fmt.Errorf("repeated push made %s, then %s", first.Digest, again.Digest)
+			}
+			return expectCount(in, "POST", "/v2/*/blobs/uploads/", uploads)
+		}},
+		{"lost-response", []string{"PUT /v2/*/blobs/uploads/*=lostx1", "PUT /v2/*/manifests/*=lostx1"}, false, func(ctx context.Context, in *faults.Injector, client *registry.Client, repo string) error {
+			ref, err := registrytest.PushImage(ctx, client, repo, "1.0")
+			if err != nil {
+				return err
+			}
+			tagged, err := client.Digest(ctx, registry.Ref{Registry: ref.Registry, Repository: ref.Repository, Tag: "1.0"})
+			if err == nil && tagged != ref.Digest {
+				err = fmt.Errorf("1.0 is %s, pushed %s", tagged, ref.Digest)
+			}
+			return err
+		}},
+		{"throttled", []string{"GET /v2/*/manifests/*=429:1sx1"}, false, func(ctx context.Context, in *faults.Injector, client *registry.Client, repo string) error {
+			ref, err := registrytest.PushImage(ctx, client, repo, "1.0")
+			if err != nil {
+				return err
+			}
+			if _, _, _, err := client.Manifest(ctx, ref); err != nil {
+				return err
+			}
+			var throttled, next time.Time
+			for _, r := range in.Requests() {
+				switch {
+				case r.Fault == faults.Throttle:
+					throttled = r.Time
+				case !throttled.IsZero() && next.IsZero():
+					next = r.Time
+				}
+			}
+			if wait := next.Sub(throttled); wait < time.Second {
+				return fmt.Errorf("retried %s after a 429 with Retry-After: 1", wait.Round(time.Millisecond))
+			}
+			return nil
+		}},
+		{"truncated-blob", []string{"GET /v2/*/blobs/*=truncatex1"}, false, func(ctx context.Context, in *faults.Injector, client *registry.Client, repo string) error {
+			ref, err := registrytest.PushImage(ctx, client, repo, "1.0")
+			if err != nil {
+				return err
+			}
+			m, _, err := client.ImageManifest(ctx, ref, registry.Platform{OS: "linux", Architecture: "amd64"})
+			if err != nil {
+				return err
+			}
+			data, err := client.Blob(ctx, ref, m.Layers[0].Digest)
+			switch {
+			case err != nil:
+				return err
+			case !bytes.Equal(data, []byte("1.0")):
+				return fmt.Errorf("blob is %q after a truncated download", data)
+			}
+			return expectCount(in, "GET", "/v2/*/blobs/*", 2)
+		}},
+		{"truncated-always", []string{"GET /v2/*/blobs/*=truncate"}, false, func(ctx context.Context, in *faults.Injector, client *registry.Client, repo string) error {
+			ref, err := registrytest.PushImage(ctx, client, repo, "1.0")
+			if err != nil {
+				return err
+			}
+			m, _, err := client.ImageManifest(ctx, ref, registry.Platform{OS: "linux", Architecture: "amd64"})
+			if err != nil {
+				return err
+			}
+			if data, err := client.Blob(ctx, ref, m.Config.Digest); err == nil {
+				return fmt.Errorf("read %q from a registry cutting every blob short", data)
+			}
+			return expectCount(in, "GET", "/v2/*/blobs/*", client.Retry.Attempts)
+		}},
+		{"truncated-then-unavailable", []string{"GET /v2/*/blobs/*=truncatex1", "GET /v2/*/blobs/*=503"}, false, func(ctx context.Context, in *faults.Injector, client *registry.Client, repo string) error {
+			ref, err := registrytest.PushImage(ctx, client, repo, "1.0")
+			if err != nil {
+				return err
+			}
+			m, _, err := client.ImageManifest(ctx, ref, registry.Platform{OS: "linux", Architecture: "amd64"})
+			if err != nil {
+				return err
+			}
+			if _, err := client.Blob(ctx, ref, m.Config.Digest); err == nil {
+				return errors.New("read a blob from a registry answering 503")
+			}
+			// Reads cut short and server errors share the attempts.
+			return expectCount(in, "GET", "/v2/*/blobs/*", client.Retry.Attempts)
+		}},
+		{"slow", []string{"GET /v2/*/manifests/*=slow:2sx1"}, false, func(ctx context.Context, in *faults.Injector, client *registry.Client, repo string) error {
+			ref, err := registrytest.PushImage(ctx, client, repo, "1.0")
+			if err != nil {
+				return err
+			}
+			_, _, _, err = client.Manifest(ctx, ref)
+			return err
+		}},
+		{"auth-expiry", []string{"PUT /v2/*/manifests/*=expirex1"}, true, func(ctx context.Context, in *faults.Injector, client *registry.Client, repo string) error {
+			if _, err := registrytest.PushImage(ctx, client, repo, "1.0"); err != nil {
+				return err
+			}
+			if n := in.Count("GET", "/token"); n < 2 {
+				return fmt.Errorf("%d token requests, want a new token after the expiry", n)
+			}
+			return nil
+		}},
+		{"copy", []string{"GET /v2/*/blobs/*=truncatex1", "PUT /v2/*/manifests/*=502x1", "HEAD *=503x1"}, false, func(ctx context.Context, in *faults.Injector, client *registry.Client, repo string) error {
+			src, err := registrytest.PushImage(ctx, client, repo, "1.0")
+			if err != nil {
+				return err
+			}
+			dst, err := registry.ParseRef(repo + "-copy:1.0")
+			if err != nil {
+				return err
+			}
+			digest, err := client.Copy(ctx, src, dst, nil)
+			if err == nil && digest != src.Digest {
+				err = fmt.Errorf("copied %s as %s", src.Digest, digest)
+			}
+			return err
+		}},
+		{"sign", []string{"PUT *=502x3", "GET /v2/*/referrers/*=503x1"}, false, func(ctx context.Context, in *faults.Injector, client *registry.Client, repo string) error {
+			ref, err := registrytest.PushImage(ctx, client, repo, "1.0")
+			if err != nil {
+				return err
+			}
+			return signAndVerify(ctx, client, ref)
+		}},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			in := &faults.Injector{Next: memory.New(), Auth: tt.auth}
+			for _, s := range tt.specs {
+				f, err := faults.Parse(s)
+				if err != nil {
+					t.Fatal(err)
+				}
+				in.Faults = append(in.Faults, f)
+			}
+			repo := registrytest.Serve(t, in)
+			// Quick retries, and a timeout short enough for slow responses
+			// to count as failures.
+			client := &registry.Client{
+				HTTP:  &http.Client{Timeout: 500 * time.Millisecond},
+				Retry: registry.Retry{Attempts: 4, Backoff: 10 * time.Millisecond, MaxWait: 2 * time.Second},
+			}
+			if err := tt.run(context.Background(), in, client, repo); err != nil {
+				t.Fatal(err)
+			}
+			for _, f := range in.Pending() {
+				if f.Times > 0 {
+					t.Errorf("fault %s was not injected", f)
+				}
+			}
+		})
+	}
+}
+
+// signAndVerify signs ref in the cosign and Notation formats and checks
+// that both signatures verify.
+func signAndVerify(ctx context.Context, client *registry.Client, ref registry.Ref) error {
+	key, err := signing.Generate()
+	if err != nil {
+		return err
+	}
+	trusted := &signing.TrustedKeys{}
+	if _, err := trusted.Add(&key.PublicKey, time.Now().Add(-time.Hour), 24*time.Hour); err != nil {
+		return err
+	}
+	k, err := trusted.Certify(key)
+	if err != nil {
+		return err
+	}
+	cert, err := k.Cert()
+	if err != nil {
+		return err
+	}
+	now := time.Now().UTC()
+
+	sig, err := signing.Sign(key, ref.Name(), ref.Digest, now)
+	if err != nil {
+		return err
+	}
+	if err := signing.Attach(ctx, client, ref, sig); err != nil {
+		return err
+	}
+	target, err := signing.Target(ctx, client, ref)
+	if err != nil {
+		return err
+	}
+	envelope, err := signing.SignNotation(key, cert, target, signing.MediaTypeJWS, now)
+	if err != nil {
+		return err
+	}
+	if err := signing.AttachNotation(ctx, client, ref, target, signing.MediaTypeJWS, envelope, cert, now); err != nil {
+		return err
+	}
+
+	sigs, err := signing.Signatures(ctx, client, ref)
+	if err != nil {
+		return err
+	}
+	if len(sigs) != 1 {
+		return fmt.Errorf("%d cosign signatures, want 1", len(sigs))
+	}
+	if res := trusted.Verify(sigs[0], ref.Name(), ref.Digest); res.Err != nil {
+		return res.Err
+	}
+	notations, err := signing.NotationSignatures(ctx, client, ref)
+	if err != nil {
+		return err
+	}
+	if len(notations) != 1 || notations[0].Err != nil {
+		return fmt.Errorf("Notation signatures %+v, want 1", notations)
+	}
+	rule := signing.TrustPolicyRule{
+		Name: "test", RegistryScopes: []string{"*"},
+		TrustStores: []string{"ca:" + signing.FactoryStore}, TrustedIdentities: []string{"*"},
+	}
+	rule.SignatureVerification.Level = signing.LevelStrict
+	nv := &signing.NotationVerifier{Policy: &signing.TrustPolicy{Version: "1.0", Policies: []signing.TrustPolicyRule{rule}}, Keys: trusted}
+	return nv.Verify(notations[0].Envelope, ref.Name(), target).Err
+}
+
+func expectCount(in *faults.Injector, method, glob string, want int) error {
+	if n := in.Count(method, glob); n != want {
+		return fmt.Errorf("%d %s %s requests, want %d", n, method, glob, want)
+	}
+	return nil
+}
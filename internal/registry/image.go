@@ -0,0 +1,90 @@
+package registry
+
+import (
+	"bufio"
+	"bytes"
+	"compress/gzip"
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"strings"
+)
+
+// ParsePlatform parses os/arch[/variant].
+func ParsePlatform(s string) (Platform, error) {
+	parts := strings.Split(s, "/")
+	if len(parts) < 2 || len(parts) > 3 || parts[0] == "" || parts[1] == "" {
+		return Platform{}, fmt.Errorf("invalid platform %q", s)
+	}
+	p := Platform{OS: parts[0], Architecture: parts[1]}
+	if len(parts) == 3 {
+		p.Variant = parts[2]
+	}
+	return p, nil
+}
+
+func (p Platform) String() string {
+	if p.Variant != "" {
+		return p.OS + "/" + p.Architecture + "/" + p.Variant
+	}
+	return p.OS + "/" + p.Architecture
+}
+
+// ImageManifest returns the image manifest of ref for platform, following
+// ref's index when it is multi-arch, and the digest of that manifest.
+func (c *Client) ImageManifest(ctx context.Context, ref Ref, platform Platform) (*Manifest, string, error) {
+	data, _, digest, err := c.Manifest(ctx, ref)
+	if err != nil {
+		return nil, "", err
+	}
+	var m struct {
+		Manifest
+		Manifests []Descriptor `json:"manifests"`
+	}
+	if err := json.Unmarshal(data, &m); err != nil {
+		return nil, "", fmt.Errorf("%s: %w", ref, err)
+	}
+	if m.Manifests == nil {
+		return &m.Manifest, digest, nil
+	}
+	for _, d := range m.Manifests {
+		p := d.Platform
+		if p == nil || p.OS != platform.OS || p.Architecture != platform.Architecture ||
+			(platform.Variant != "" && p.Variant != platform.Variant) {
+			continue
+		}
+		child := Ref{Registry: ref.Registry, Repository: ref.Repository, Digest: d.Digest}
+		return c.ImageManifest(ctx, child, platform)
+	}
+	return nil, "", fmt.Errorf("%s: no %s image", ref, platform)
+}
+
+// OpenBlob streams a blob of ref's repository. Unlike Blob, the content is
+// not checked against the digest.
+func (c *Client) OpenBlob(ctx context.Context, ref Ref, digest string) (io.ReadCloser, error) {
+	resp, err := c.do(ctx, http.MethodGet, ref, "/blobs/"+digest, nil, nil)
+	if err != nil {
+		return nil, err
+	}
+	if resp.StatusCode != http.StatusOK {
+		defer resp.Body.Close()
+		return nil, statusError(ref, resp)
+	}
+	return resp.Body, nil
+}
+
+// Uncompressed returns the tar stream of a layer, gzipped or not.
+func Uncompressed(r io.Reader) (io.ReadCloser, error) {
+	br := bufio.NewReader(r)
+	magic, _ := br.Peek(4)
+	switch {
+	case bytes.HasPrefix(magic, []byte{0x1f, 0x8b}):
+		return gzip.NewReader(br)
+	case bytes.Equal(magic, []byte{0x28, 0xb5, 0x2f, 0xfd}):
+		return nil, errors.New("zstd layers are not supported")
+	}
+	return io.NopCloser(br), nil
+}
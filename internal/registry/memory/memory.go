@@ -0,0 +1,248 @@
+// Package memory is an in-process OCI registry holding everything in
+// memory. It serves the parts of the distribution API the factory uses
+// (manifests, blobs, monolithic and chunked uploads, tag lists and,
+// optionally, the referrers API), so signing and publishing can be
+// exercised without Nexus.
+package memory
+
+import (
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/http"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+
+	"github.com/gillouche/container-factory/internal/registry"
+)
+
+// Registry is an in-memory registry. The zero value is not usable, see New.
+type Registry struct {
+	// Referrers enables the referrers API. Without it clients fall back to
+	// the referrers tag, as with Nexus.
+	Referrers bool
+
+	mu        sync.Mutex
+	blobs     map[string][]byte
+	manifests map[string]manifest // by repository@digest
+	tags      map[string]map[string]string
+	sessions  map[string][]byte
+	uploads   int
+}
+
+type manifest struct {
+	mediaType string
+	data      []byte
+}
+
+// New returns an empty registry.
+func New() *Registry {
+	return &Registry{
+		blobs:     map[string][]byte{},
+		manifests: map[string]manifest{},
+		tags:      map[string]map[string]string{},
+		sessions:  map[string][]byte{},
+	}
+}
+
+// ServeHTTP implements the distribution API under /v2/.
+func (r *Registry) ServeHTTP(w http.ResponseWriter, req *http.Request) {
+	path, ok := strings.CutPrefix(req.URL.Path, "/v2/")
+	if !ok {
+		writeError(w, http.StatusNotFound, "NOT_FOUND", "not a registry path")
+		return
+	}
+	if path == "" {
+		w.WriteHeader(http.StatusOK)
+		return
+	}
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	for _, route := range []struct {
+		sep     string
+		handler func(http.ResponseWriter, *http.Request, string, string)
+	}{
+		{"/manifests/", r.manifest},
+		{"/blobs/uploads/", r.upload},
+		{"/blobs/", r.blob},
+		{"/referrers/", r.referrers},
+		{"/tags/", r.tagList},
+	} {
+		if i := strings.LastIndex(path, route.sep); i > 0 {
+			route.handler(w, req, path[:i], path[i+len(route.sep):])
+			return
+		}
+	}
+	writeError(w, http.StatusNotFound, "NOT_FOUND", "unknown endpoint")
+}
+
+func (r *Registry) manifest(w http.ResponseWriter, req *http.Request, repo, reference string) {
+	switch req.Method {
+	case http.MethodGet, http.MethodHead:
+		digest := reference
+		if !strings.Contains(reference, ":") {
+			digest = r.tags[repo][reference]
+		}
+		m, ok := r.manifests[repo+"@"+digest]
+		if !ok {
+			writeError(w, http.StatusNotFound, "MANIFEST_UNKNOWN", "manifest unknown")
+			return
+		}
+		w.Header().Set("Content-Type", m.mediaType)
+		w.Header().Set("Docker-Content-Digest", digest)
+		w.Header().Set("Content-Length", strconv.Itoa(len(m.data)))
+		w.WriteHeader(http.StatusOK)
+		if req.Method == http.MethodGet {
+			w.Write(m.data)
+		}
+	case http.MethodPut:
+		data, err := io.ReadAll(req.Body)
+		if err != nil {
+			writeError(w, http.StatusBadRequest, "MANIFEST_INVALID", err.Error())
+			return
+		}
+		digest := registry.DigestOf(data)
+		if strings.Contains(reference, ":") && reference != digest {
+			writeError(w, http.StatusBadRequest, "DIGEST_INVALID", "digest does not match the manifest")
+			return
+		}
+		var parsed registry.Manifest
+		if err := json.Unmarshal(data, &parsed); err != nil {
+			writeError(w, http.StatusBadRequest, "MANIFEST_INVALID", err.Error())
+			return
+		}
+		r.manifests[repo+"@"+digest] = manifest{mediaType: req.Header.Get("Content-Type"), data: data}
+		if !strings.Contains(reference, ":") {
+			if r.tags[repo] == nil {
+				r.tags[repo] = map[string]string{}
+			}
+			r.tags[repo][reference] = digest
+		}
+		if parsed.Subject != nil && r.Referrers {
+			w.Header().Set("OCI-Subject", parsed.Subject.Digest)
+		}
+		w.Header().Set("Docker-Content-Digest", digest)
+		w.WriteHeader(http.StatusCreated)
+	default:
+		writeError(w, http.StatusMethodNotAllowed, "UNSUPPORTED", req.Method)
+	}
+}
+
+func (r *Registry) blob(w http.ResponseWriter, req *http.Request, repo, digest string) {
+	data, ok := r.blobs[repo+"@"+digest]
+	if !ok {
+		writeError(w, http.StatusNotFound, "BLOB_UNKNOWN", "blob unknown")
+		return
+	}
+	w.Header().Set("Docker-Content-Digest", digest)
+	w.Header().Set("Content-Length", strconv.Itoa(len(data)))
+	w.WriteHeader(http.StatusOK)
+	if req.Method == http.MethodGet {
+		w.Write(data)
+	}
+}
+
+// upload accepts monolithic uploads (POST then PUT with the content) and
+// chunked ones (POST, PATCH chunks, PUT).
+func (r *Registry) upload(w http.ResponseWriter, req *http.Request, repo, id string) {
+	location := func(id string) {
+		w.Header().Set("Location", fmt.Sprintf("/v2/%s/blobs/uploads/%s", repo, id))
+		w.Header().Set("Docker-Upload-UUID", id)
+		w.Header().Set("Range", fmt.Sprintf("0-%d", max(len(r.sessions[id])-1, 0)))
+	}
+	switch req.Method {
+	case http.MethodPost:
+		r.uploads++
+		id := strconv.Itoa(r.uploads)
+		r.sessions[id] = nil
+		location(id)
+		w.WriteHeader(http.StatusAccepted)
+	case http.MethodPatch, http.MethodPut:
+		chunk, err := io.ReadAll(req.Body)
+		if err != nil {
+			writeError(w, http.StatusBadRequest, "BLOB_UPLOAD_INVALID", err.Error())
+			return
+		}
+		data, ok := r.sessions[id]
+		if !ok {
+			writeError(w, http.StatusNotFound, "BLOB_UPLOAD_UNKNOWN", "upload unknown")
+			return
+		}
+		data = append(data, chunk...)
+		if req.Method == http.MethodPatch {
+			r.sessions[id] = data
+			location(id)
+			w.WriteHeader(http.StatusAccepted)
+			return
+		}
+		digest := req.URL.Query().Get("digest")
+		if registry.DigestOf(data) != digest {
+			writeError(w, http.StatusBadRequest, "DIGEST_INVALID", "digest does not match the content")
+			return
+		}
+		delete(r.sessions, id)
+		r.blobs[repo+"@"+digest] = data
+		w.Header().Set("Docker-Content-Digest", digest)
+		w.WriteHeader(http.StatusCreated)
+	default:
+		writeError(w, http.StatusMethodNotAllowed, "UNSUPPORTED", req.Method)
+	}
+}
+
+func (r *Registry) referrers(w http.ResponseWriter, req *http.Request, repo, digest string) {
+	if !r.Referrers {
+		writeError(w, http.StatusNotFound, "NOT_FOUND", "referrers API not supported")
+		return
+	}
+	artifactType := req.URL.Query().Get("artifactType")
+	index := registry.Index{SchemaVersion: 2, MediaType: registry.MediaTypeIndex, Manifests: []registry.Descriptor{}}
+	for key, m := range r.manifests {
+		if !strings.HasPrefix(key, repo+"@") {
+			continue
+		}
+		var parsed registry.Manifest
+		if json.Unmarshal(m.data, &parsed) != nil || parsed.Subject == nil || parsed.Subject.Digest != digest {
+			continue
+		}
+		at := parsed.ArtifactType
+		if at == "" {
+			at = parsed.Config.MediaType
+		}
+		if artifactType != "" && at != artifactType {
+			continue
+		}
+		index.Manifests = append(index.Manifests, registry.Descriptor{
+			MediaType: m.mediaType, Digest: strings.TrimPrefix(key, repo+"@"), Size: int64(len(m.data)),
+			ArtifactType: at, Annotations: parsed.Annotations,
+		})
+	}
+	sort.Slice(index.Manifests, func(i, j int) bool { return index.Manifests[i].Digest < index.Manifests[j].Digest })
+	if artifactType != "" {
+		w.Header().Set("OCI-Filters-Applied", "artifactType")
+	}
+	w.Header().Set("Content-Type", registry.MediaTypeIndex)
+	json.NewEncoder(w).Encode(index)
+}
+
+func (r *Registry) tagList(w http.ResponseWriter, req *http.Request, repo, rest string) {
+	if rest != "list" {
+		writeError(w, http.StatusNotFound, "NOT_FOUND", "unknown endpoint")
+		return
+	}
+	tags := []string{}
+	for t := range r.tags[repo] {
+		tags = append(tags, t)
+	}
+	sort.Strings(tags)
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(map[string]any{"name": repo, "tags": tags})
+}
+
+func writeError(w http.ResponseWriter, status int, code, message string) {
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(status)
+	json.NewEncoder(w).Encode(map[string]any{"errors": []map[string]string{{"code": code, "message": message}}})
+}
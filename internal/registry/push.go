@@ -0,0 +1,154 @@
+package registry
+
+import (
+	"context"
+	"crypto/sha256"
+	"encoding/hex"
+	"fmt"
+	"net/http"
+	"net/url"
+	"strings"
+)
+
+// Media types of the manifests the factory writes itself.
+const (
+	MediaTypeManifest = "application/vnd.oci.image.manifest.v1+json"
+	MediaTypeIndex    = "application/vnd.oci.image.index.v1+json"
+)
+
+// Descriptor points to a blob or manifest.
+type Descriptor struct {
+	MediaType    string            `json:"mediaType"`
+	Digest       string            `json:"digest"`
+	Size         int64             `json:"size"`
+	ArtifactType string            `json:"artifactType,omitempty"`
+	Annotations  map[string]string `json:"annotations,omitempty"`
+	Platform     *Platform         `json:"platform,omitempty"`
+}
+
+// Platform is the platform of an index entry. Image configs carry the same
+// fields.
+type Platform struct {
+	OS           string `json:"os"`
+	Architecture string `json:"architecture"`
+	Variant      string `json:"variant,omitempty"`
+}
+
+// Manifest is an OCI image manifest.
+type Manifest struct {
+	SchemaVersion int               `json:"schemaVersion"`
+	MediaType     string            `json:"mediaType"`
+	ArtifactType  string            `json:"artifactType,omitempty"`
+	Config        Descriptor        `json:"config"`
+	Layers        []Descriptor      `json:"layers"`
+	Subject       *Descriptor       `json:"subject,omitempty"`
+	Annotations   map[string]string `json:"annotations,omitempty"`
+}
+
+// DigestOf returns the sha256 digest of data.
+func DigestOf(data []byte) string {
+	sum := sha256.Sum256(data)
+	return "sha256:" + hex.EncodeToString(sum[:])
+}
+
+// Manifest fetches the manifest ref points to, with its media type and digest.
+func (c *Client) Manifest(ctx context.Context, ref Ref) (data []byte, mediaType, digest string, err error) {
+	hdr := http.Header{"Accept": {strings.Join(append([]string{MediaTypeManifest}, ManifestTypes...), ", ")}}
+	var verify func([]byte) error
+	if ref.Digest != "" {
+		verify = func(data []byte) error {
+			if DigestOf(data) != ref.Digest {
+				return fmt.Errorf("%s: manifest digest mismatch", ref)
+			}
+			return nil
+		}
+	}
+	data, resp, err := c.fetch(ctx, ref, "/manifests/"+ref.Reference(), hdr, verify)
+	if err != nil {
+		return nil, "", "", err
+	}
+	digest = resp.Header.Get("Docker-Content-Digest")
+	if digest == "" {
+		digest = DigestOf(data)
+	}
+	return data, resp.Header.Get("Content-Type"), digest, nil
+}
+
+// PutManifest uploads a manifest under ref's tag (or digest) and returns its
+// digest.
+func (c *Client) PutManifest(ctx context.Context, ref Ref, mediaType string, data []byte) (string, error) {
+	hdr := http.Header{"Content-Type": {mediaType}}
+	resp, err := c.do(ctx, http.MethodPut, ref, "/manifests/"+ref.Reference(), hdr, data)
+	if err != nil {
+		return "", err
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode != http.StatusCreated && resp.StatusCode != http.StatusOK {
+		return "", statusError(ref, resp)
+	}
+	return DigestOf(data), nil
+}
+
+// Blob downloads a blob of ref's repository.
+func (c *Client) Blob(ctx context.Context, ref Ref, digest string) ([]byte, error) {
+	data, _, err := c.fetch(ctx, ref, "/blobs/"+digest, nil, func(data []byte) error {
+		if DigestOf(data) != digest {
+			return fmt.Errorf("%s: blob %s: digest mismatch", ref.Name(), digest)
+		}
+		return nil
+	})
+	return data, err
+}
+
+// PutBlob uploads data to ref's repository unless it is already there, and
+// returns its descriptor.
+func (c *Client) PutBlob(ctx context.Context, ref Ref, mediaType string, data []byte) (Descriptor, error) {
+	desc := Descriptor{MediaType: mediaType, Digest: DigestOf(data), Size: int64(len(data))}
+
+	resp, err := c.do(ctx, http.MethodHead, ref, "/blobs/"+desc.Digest, nil, nil)
+	if err != nil {
+		return Descriptor{}, err
+	}
+	resp.Body.Close()
+	if resp.StatusCode == http.StatusOK {
+		return desc, nil
+	}
+
+	resp, err = c.do(ctx, http.MethodPost, ref, "/blobs/uploads/", nil, nil)
+	if err != nil {
+		return Descriptor{}, err
+	}
+	resp.Body.Close()
+	if resp.StatusCode != http.StatusAccepted {
+		return Descriptor{}, statusError(ref, resp)
+	}
+	loc, err := url.Parse(resp.Header.Get("Location"))
+	if err != nil {
+		return Descriptor{}, fmt.Errorf("%s: invalid upload location: %w", ref.Name(), err)
+	}
+	base, _ := url.Parse(c.url(ref, "/"))
+	upload := base.ResolveReference(loc)
+	q := upload.Query()
+	q.Set("digest", desc.Digest)
+	upload.RawQuery = q.Encode()
+
+	hdr := http.Header{"Content-Type": {"application/octet-stream"}}
+	resp, err = c.do(ctx, http.MethodPut, ref, upload.String(), hdr, data)
+	if err != nil {
+		return Descriptor{}, err
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode != http.StatusCreated {
+		// A retry of an upload whose response was lost finds the session
+		// closed: the blob may be there all the same.
+		err := statusError(ref, resp)
+		if check, herr := c.do(ctx, http.MethodHead, ref, "/blobs/"+desc.Digest, nil, nil); herr == nil {
+			check.Body.Close()
+			if check.StatusCode == http.StatusOK {
+				return desc, nil
+			}
+		}
+		return Descriptor{}, err
+	}
+	return desc, nil
+}
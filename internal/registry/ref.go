@@ -0,0 +1,80 @@
+package registry
+
+import (
+	"fmt"
+	"strings"
+)
+
+// Ref is a parsed image reference such as
+// nexus.gillouche.homelab/docker-hosted/base/tls-bundle:latest.
+type Ref struct {
+	Registry   string
+	Repository string
+	Tag        string
+	Digest     string
+}
+
+// ParseRef parses an image reference, applying the Docker Hub defaults for
+// references without a registry host.
+func ParseRef(s string) (Ref, error) {
+	var r Ref
+	name := s
+	if i := strings.Index(name, "@"); i >= 0 {
+		r.Digest = name[i+1:]
+		name = name[:i]
+	}
+	if i := strings.LastIndex(name, ":"); i > strings.LastIndex(name, "/") {
+		r.Tag = name[i+1:]
+		name = name[:i]
+	}
+
+	first, rest, ok := strings.Cut(name, "/")
+	switch {
+	case ok && (strings.ContainsAny(first, ".:") || first == "localhost"):
+		r.Registry, r.Repository = first, rest
+	case ok:
+		r.Registry, r.Repository = "docker.io", name
+	default:
+		r.Registry, r.Repository = "docker.io", "library/"+name
+	}
+
+	if r.Repository == "" || strings.ContainsAny(r.Repository, "${} ") {
+		return Ref{}, fmt.Errorf("invalid image reference %q", s)
+	}
+	if r.Tag == "" && r.Digest == "" {
+		r.Tag = "latest"
+	}
+	return r, nil
+}
+
+// Name returns registry/repository without tag or digest.
+func (r Ref) Name() string {
+	return r.Registry + "/" + r.Repository
+}
+
+// Reference returns the digest if set, otherwise the tag.
+func (r Ref) Reference() string {
+	if r.Digest != "" {
+		return r.Digest
+	}
+	return r.Tag
+}
+
+func (r Ref) String() string {
+	s := r.Name()
+	if r.Tag != "" {
+		s += ":" + r.Tag
+	}
+	if r.Digest != "" {
+		s += "@" + r.Digest
+	}
+	return s
+}
+
+// apiHost maps the Docker Hub alias to the host serving the registry API.
+func apiHost(registry string) string {
+	if registry == "docker.io" {
+		return "registry-1.docker.io"
+	}
+	return registry
+}
@@ -0,0 +1,157 @@
+package registry
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/http"
+	"net/url"
+	"strings"
+)
+
+// MediaTypeEmpty is the config of artifacts without one, such as
+// signatures stored as referrers.
+const MediaTypeEmpty = "application/vnd.oci.empty.v1+json"
+
+// EmptyConfig is the content of an empty config blob.
+var EmptyConfig = []byte("{}")
+
+// Index is an OCI image index, the form referrers are listed in.
+type Index struct {
+	SchemaVersion int          `json:"schemaVersion"`
+	MediaType     string       `json:"mediaType"`
+	Manifests     []Descriptor `json:"manifests"`
+}
+
+// ReferrersTag returns the tag registries without the referrers API list
+// the referrers of digest under, as an index.
+func ReferrersTag(digest string) string {
+	return strings.Replace(digest, ":", "-", 1)
+}
+
+// Referrers lists the manifests whose subject is ref's digest, limited to
+// artifactType unless it is empty. Registries without the referrers API
+// (Nexus among them) are read through the fallback tag.
+func (c *Client) Referrers(ctx context.Context, ref Ref, artifactType string) ([]Descriptor, error) {
+	if ref.Digest == "" {
+		return nil, fmt.Errorf("%s: referrers need a digest reference", ref)
+	}
+	path := "/referrers/" + ref.Digest
+	if artifactType != "" {
+		path += "?artifactType=" + url.QueryEscape(artifactType)
+	}
+	hdr := http.Header{"Accept": {MediaTypeIndex}}
+	resp, err := c.do(ctx, http.MethodGet, ref, path, hdr, nil)
+	if err != nil {
+		return nil, err
+	}
+	defer resp.Body.Close()
+
+	var index Index
+	switch {
+	case resp.StatusCode == http.StatusOK:
+		data, err := io.ReadAll(resp.Body)
+		if err != nil {
+			return nil, err
+		}
+		if err := json.Unmarshal(data, &index); err != nil {
+			return nil, fmt.Errorf("%s: referrers: %w", ref, err)
+		}
+		if resp.Header.Get("OCI-Filters-Applied") == "" {
+			index.Manifests = filterArtifacts(index.Manifests, artifactType)
+		}
+		return index.Manifests, nil
+	case resp.StatusCode == http.StatusNotFound:
+		fallback, err := c.fallbackReferrers(ctx, ref)
+		if err != nil || fallback == nil {
+			return nil, err
+		}
+		return filterArtifacts(fallback.Manifests, artifactType), nil
+	default:
+		return nil, statusError(ref, resp)
+	}
+}
+
+// PutReferrer uploads m, whose subject is ref's digest, by digest. When the
+// registry does not index the subject itself the manifest is added to the
+// fallback tag.
+func (c *Client) PutReferrer(ctx context.Context, ref Ref, m *Manifest) (Descriptor, error) {
+	if m.Subject == nil {
+		return Descriptor{}, fmt.Errorf("%s: referrer without a subject", ref)
+	}
+	data, err := json.Marshal(m)
+	if err != nil {
+		return Descriptor{}, err
+	}
+	desc := Descriptor{MediaType: MediaTypeManifest, Digest: DigestOf(data), Size: int64(len(data)),
+		ArtifactType: m.ArtifactType, Annotations: m.Annotations}
+	if desc.ArtifactType == "" {
+		desc.ArtifactType = m.Config.MediaType
+	}
+
+	target := Ref{Registry: ref.Registry, Repository: ref.Repository, Digest: desc.Digest}
+	hdr := http.Header{"Content-Type": {MediaTypeManifest}}
+	resp, err := c.do(ctx, http.MethodPut, target, "/manifests/"+desc.Digest, hdr, data)
+	if err != nil {
+		return Descriptor{}, err
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode != http.StatusCreated && resp.StatusCode != http.StatusOK {
+		return Descriptor{}, statusError(target, resp)
+	}
+	if resp.Header.Get("OCI-Subject") != "" {
+		return desc, nil
+	}
+
+	index, err := c.fallbackReferrers(ctx, ref)
+	if err != nil {
+		return Descriptor{}, err
+	}
+	if index == nil {
+		index = &Index{SchemaVersion: 2, MediaType: MediaTypeIndex}
+	}
+	for _, d := range index.Manifests {
+		if d.Digest == desc.Digest {
+			return desc, nil
+		}
+	}
+	index.Manifests = append(index.Manifests, desc)
+	if data, err = json.Marshal(index); err != nil {
+		return Descriptor{}, err
+	}
+	tag := Ref{Registry: ref.Registry, Repository: ref.Repository, Tag: ReferrersTag(ref.Digest)}
+	if _, err := c.PutManifest(ctx, tag, MediaTypeIndex, data); err != nil {
+		return Descriptor{}, err
+	}
+	return desc, nil
+}
+
+func (c *Client) fallbackReferrers(ctx context.Context, ref Ref) (*Index, error) {
+	tag := Ref{Registry: ref.Registry, Repository: ref.Repository, Tag: ReferrersTag(ref.Digest)}
+	data, _, _, err := c.Manifest(ctx, tag)
+	if IsNotFound(err) {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+	var index Index
+	if err := json.Unmarshal(data, &index); err != nil {
+		return nil, fmt.Errorf("%s: %w", tag, err)
+	}
+	return &index, nil
+}
+
+func filterArtifacts(ds []Descriptor, artifactType string) []Descriptor {
+	if artifactType == "" {
+		return ds
+	}
+	var out []Descriptor
+	for _, d := range ds {
+		if d.ArtifactType == artifactType {
+			out = append(out, d)
+		}
+	}
+	return out
+}
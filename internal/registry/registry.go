@@ -0,0 +1,228 @@
+// Package registry is a small OCI distribution API client covering the calls
+// the factory makes against Nexus and the upstream proxies it fronts.
+package registry
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"strings"
+	"sync"
+)
+
+// ManifestTypes is the Accept list sent when reading manifests, so both
+// multi-arch indexes and single-platform manifests are returned as stored.
+var ManifestTypes = []string{
+	"application/vnd.oci.image.index.v1+json",
+	"application/vnd.docker.distribution.manifest.list.v2+json",
+	"application/vnd.oci.image.manifest.v1+json",
+	"application/vnd.docker.distribution.manifest.v2+json",
+}
+
+// Client talks to OCI registries. The zero value is usable and anonymous.
+type Client struct {
+	HTTP *http.Client
+	// Credentials returns the username and password for a registry host.
+	Credentials func(registry string) (user, pass string)
+	// PlainHTTP lists registry hosts reached over http instead of https.
+	PlainHTTP map[string]bool
+	// Retry is the retry policy of transient failures, DefaultRetry when
+	// zero.
+	Retry Retry
+
+	mu   sync.Mutex
+	auth map[string]string
+}
+
+// New returns a client using the Docker CLI credentials.
+func New() *Client {
+	return &Client{Credentials: DockerCredentials}
+}
+
+// Digest resolves ref to the digest of the manifest (or index) it points to.
+func (c *Client) Digest(ctx context.Context, ref Ref) (string, error) {
+	if ref.Digest != "" {
+		return ref.Digest, nil
+	}
+	hdr := http.Header{"Accept": {strings.Join(ManifestTypes, ", ")}}
+	resp, err := c.do(ctx, http.MethodHead, ref, "/manifests/"+ref.Reference(), hdr, nil)
+	if err != nil {
+		return "", err
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode != http.StatusOK {
+		return "", statusError(ref, resp)
+	}
+	d := resp.Header.Get("Docker-Content-Digest")
+	if d == "" {
+		return "", fmt.Errorf("%s: registry returned no digest", ref)
+	}
+	return d, nil
+}
+
+func (c *Client) http() *http.Client {
+	if c.HTTP != nil {
+		return c.HTTP
+	}
+	return http.DefaultClient
+}
+
+func (c *Client) url(ref Ref, path string) string {
+	scheme := "https"
+	if c.PlainHTTP[ref.Registry] || isLoopback(ref.Registry) {
+		scheme = "http"
+	}
+	return scheme + "://" + apiHost(ref.Registry) + "/v2/" + ref.Repository + path
+}
+
+// isLoopback reports whether registry is on this machine, which Docker also
+// reaches over plain http.
+func isLoopback(registry string) bool {
+	host, _, _ := strings.Cut(registry, ":")
+	return host == "localhost" || host == "127.0.0.1"
+}
+
+// do sends a request for ref's repository, answering one auth challenge
+// and caching the resulting credentials per repository, and retries it
+// while it fails transiently. path is relative to the repository, or an
+// absolute URL such as a blob upload location.
+func (c *Client) do(ctx context.Context, method string, ref Ref, path string, hdr http.Header, body []byte) (*http.Response, error) {
+	return c.request(ctx, method, ref, path, hdr, body, nil)
+}
+
+// request is do, with read (when not nil) reading the body of a 200
+// response. A read that fails, as a download cut short does, is retried
+// like any transient failure, within the same attempts.
+func (c *Client) request(ctx context.Context, method string, ref Ref, path string, hdr http.Header, body []byte, read func(*http.Response) error) (*http.Response, error) {
+	target := path
+	if !strings.HasPrefix(path, "http://") && !strings.HasPrefix(path, "https://") {
+		target = c.url(ref, path)
+	}
+	policy := c.retry()
+	for attempt := 1; ; attempt++ {
+		resp, err := c.send(ctx, method, ref, target, hdr, body)
+		if err == nil && read != nil && resp.StatusCode == http.StatusOK {
+			err = read(resp)
+			resp.Body.Close()
+			if err != nil {
+				resp = nil
+			}
+		}
+		wait, ok := policy.next(ctx, attempt, resp, err)
+		if !ok {
+			return resp, err
+		}
+		if resp != nil {
+			resp.Body.Close()
+		}
+		if err := sleep(ctx, wait); err != nil {
+			return nil, err
+		}
+	}
+}
+
+// send sends one request to target, authenticating when challenged.
+func (c *Client) send(ctx context.Context, method string, ref Ref, target string, hdr http.Header, body []byte) (*http.Response, error) {
+	key := ref.Name()
+	for attempt := 0; ; attempt++ {
+		req, err := http.NewRequestWithContext(ctx, method, target, bytes.NewReader(body))
+		if err != nil {
+			return nil, err
+		}
+		for k, v := range hdr {
+			req.Header[k] = v
+		}
+		c.mu.Lock()
+		if a := c.auth[key]; a != "" {
+			req.Header.Set("Authorization", a)
+		}
+		c.mu.Unlock()
+
+		resp, err := c.http().Do(req)
+		if err != nil {
+			return nil, err
+		}
+		if resp.StatusCode != http.StatusUnauthorized || attempt > 0 {
+			return resp, nil
+		}
+
+		challenge := resp.Header.Get("WWW-Authenticate")
+		resp.Body.Close()
+		a, err := c.authorize(ctx, ref.Registry, challenge)
+		if err != nil {
+			return nil, err
+		}
+		c.mu.Lock()
+		if c.auth == nil {
+			c.auth = map[string]string{}
+		}
+		c.auth[key] = a
+		c.mu.Unlock()
+	}
+}
+
+// fetch GETs path and reads the whole response, retrying responses cut
+// short or failing verify (when not nil). Any status but 200 is an error.
+func (c *Client) fetch(ctx context.Context, ref Ref, path string, hdr http.Header, verify func([]byte) error) ([]byte, *http.Response, error) {
+	var data []byte
+	resp, err := c.request(ctx, http.MethodGet, ref, path, hdr, nil, func(resp *http.Response) error {
+		var err error
+		if data, err = io.ReadAll(resp.Body); err != nil {
+			return fmt.Errorf("%s: %s: %w", ref.Name(), path, err)
+		}
+		if verify != nil {
+			return verify(data)
+		}
+		return nil
+	})
+	if err != nil {
+		return nil, nil, err
+	}
+	if resp.StatusCode != http.StatusOK {
+		defer resp.Body.Close()
+		return nil, nil, statusError(ref, resp)
+	}
+	return data, resp, nil
+}
+
+// StatusError is an unexpected registry response.
+type StatusError struct {
+	Ref     Ref
+	Status  string
+	Code    int
+	Message string
+}
+
+func (e *StatusError) Error() string {
+	if e.Message != "" {
+		return fmt.Sprintf("%s: %s: %s", e.Ref, e.Status, e.Message)
+	}
+	return fmt.Sprintf("%s: %s", e.Ref, e.Status)
+}
+
+// IsNotFound reports whether err is a 404 from the registry.
+func IsNotFound(err error) bool {
+	var se *StatusError
+	return errors.As(err, &se) && se.Code == http.StatusNotFound
+}
+
+// statusError turns a non-success response into an error, including the
+// first message of an OCI error body when present.
+func statusError(ref Ref, resp *http.Response) error {
+	var body struct {
+		Errors []struct {
+			Code    string `json:"code"`
+			Message string `json:"message"`
+		} `json:"errors"`
+	}
+	e := &StatusError{Ref: ref, Status: resp.Status, Code: resp.StatusCode}
+	data, _ := io.ReadAll(io.LimitReader(resp.Body, 64*1024))
+	if json.Unmarshal(data, &body) == nil && len(body.Errors) > 0 {
+		e.Message = body.Errors[0].Message
+	}
+	return e
+}
@@ -0,0 +1,54 @@
+// Package registrytest serves registries to tests and pushes images to
+// them. It is imported by tests only.
+package registrytest
+
+import (
+	"context"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"testing"
+
+	"github.com/gillouche/container-factory/internal/registry"
+)
+
+// Serve serves h, an in-memory registry or one wrapped in faults, until
+// the end of the test and returns the reference prefix of its "test/image"
+// repository.
+func Serve(t testing.TB, h http.Handler) string {
+	t.Helper()
+	srv := httptest.NewServer(h)
+	t.Cleanup(srv.Close)
+	u, err := url.Parse(srv.URL)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return u.Host + "/test/image"
+}
+
+// PushImage pushes under tag a linux/amd64 image whose one layer is the
+// tag, and returns its digest reference.
+func PushImage(ctx context.Context, client *registry.Client, repo, tag string) (registry.Ref, error) {
+	ref, err := registry.ParseRef(repo + ":" + tag)
+	if err != nil {
+		return registry.Ref{}, err
+	}
+	config, err := client.PutBlob(ctx, ref, "application/vnd.oci.image.config.v1+json",
+		[]byte(`{"architecture":"amd64","os":"linux","rootfs":{"type":"layers","diff_ids":[]}}`))
+	if err != nil {
+		return registry.Ref{}, err
+	}
+	layer, err := client.PutBlob(ctx, ref, "application/vnd.oci.image.layer.v1.tar", []byte(tag))
+	if err != nil {
+		return registry.Ref{}, err
+	}
+	m := fmt.Sprintf(`{"schemaVersion":2,"mediaType":%q,"config":{"mediaType":%q,"digest":%q,"size":%d},"layers":[{"mediaType":%q,"digest":%q,"size":%d}]}`,
+		registry.MediaTypeManifest, config.MediaType, config.Digest, config.Size, layer.MediaType, layer.Digest, layer.Size)
+	digest, err := client.PutManifest(ctx, ref, registry.MediaTypeManifest, []byte(m))
+	if err != nil {
+		return registry.Ref{}, err
+	}
+	ref.Tag, ref.Digest = "", digest
+	return ref, nil
+}
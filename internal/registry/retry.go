@@ -0,0 +1,92 @@
+package registry
+
+import (
+	"context"
+	"net/http"
+	"strconv"
+	"time"
+)
+
+// Retry is how a client retries requests that failed transiently:
+// connection errors and timeouts, 429 (after its Retry-After), 500, 502,
+// 503 and 504 responses, and downloads cut short. Requests are retried
+// as sent, which is safe for everything the client sends: reads, blob and
+// manifest PUTs of content-addressed data, and upload sessions, of which
+// an abandoned one is only garbage for the registry.
+type Retry struct {
+	// Attempts is the number of attempts of a request, 1 to never retry.
+	Attempts int
+	// Backoff is the wait before the second attempt, doubled before each
+	// next one.
+	Backoff time.Duration
+	// MaxWait caps the waits, Retry-After included.
+	MaxWait time.Duration
+}
+
+// DefaultRetry is the policy of clients whose Retry is zero.
+var DefaultRetry = Retry{Attempts: 4, Backoff: time.Second, MaxWait: 30 * time.Second}
+
+func (c *Client) retry() Retry {
+	if c.Retry.Attempts == 0 {
+		return DefaultRetry
+	}
+	return c.Retry
+}
+
+// backoff returns the wait after the failed attempt (1-based).
+func (r Retry) backoff(attempt int) time.Duration {
+	wait := r.Backoff << (attempt - 1)
+	if r.MaxWait > 0 && (wait > r.MaxWait || wait <= 0) {
+		wait = r.MaxWait
+	}
+	return wait
+}
+
+// next returns the wait before the next attempt, and false when the
+// outcome of attempt is final.
+func (r Retry) next(ctx context.Context, attempt int, resp *http.Response, err error) (time.Duration, bool) {
+	if attempt >= r.Attempts || ctx.Err() != nil {
+		return 0, false
+	}
+	if err != nil {
+		return r.backoff(attempt), true
+	}
+	switch resp.StatusCode {
+	case http.StatusTooManyRequests:
+		if after, ok := retryAfter(resp.Header.Get("Retry-After")); ok {
+			if r.MaxWait > 0 && after > r.MaxWait {
+				after = r.MaxWait
+			}
+			return after, true
+		}
+		return r.backoff(attempt), true
+	case http.StatusInternalServerError, http.StatusBadGateway, http.StatusServiceUnavailable, http.StatusGatewayTimeout:
+		return r.backoff(attempt), true
+	}
+	return 0, false
+}
+
+// retryAfter parses a Retry-After header: seconds or an HTTP date.
+func retryAfter(h string) (time.Duration, bool) {
+	if h == "" {
+		return 0, false
+	}
+	if s, err := strconv.Atoi(h); err == nil && s >= 0 {
+		return time.Duration(s) * time.Second, true
+	}
+	if t, err := http.ParseTime(h); err == nil {
+		return max(time.Until(t), 0), true
+	}
+	return 0, false
+}
+
+func sleep(ctx context.Context, d time.Duration) error {
+	t := time.NewTimer(d)
+	defer t.Stop()
+	select {
+	case <-ctx.Done():
+		return ctx.Err()
+	case <-t.C:
+		return nil
+	}
+}
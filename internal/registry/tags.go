@@ -0,0 +1,68 @@
+package registry
+
+import (
+	"context"
+	"encoding/json"
+	"net/http"
+	"net/url"
+)
+
+// Tags lists the tags of ref's repository, following pagination.
+func (c *Client) Tags(ctx context.Context, ref Ref) ([]string, error) {
+	var tags []string
+	path := "/tags/list?n=1000"
+	for path != "" {
+		resp, err := c.do(ctx, http.MethodGet, ref, path, nil, nil)
+		if err != nil {
+			return nil, err
+		}
+		var page struct {
+			Tags []string `json:"tags"`
+		}
+		if resp.StatusCode != http.StatusOK {
+			err = statusError(ref, resp)
+		} else {
+			err = json.NewDecoder(resp.Body).Decode(&page)
+		}
+		link := resp.Header.Get("Link")
+		resp.Body.Close()
+		if err != nil {
+			return nil, err
+		}
+		tags = append(tags, page.Tags...)
+		path = nextLink(c.url(ref, "/"), link)
+	}
+	return tags, nil
+}
+
+// nextLink resolves the target of the pagination Link header, such as
+// </v2/library/python/tags/list?last=3.9&n=1000>; rel="next", against base.
+func nextLink(base, link string) string {
+	if link == "" {
+		return ""
+	}
+	start, end := 0, 0
+	for i, r := range link {
+		switch r {
+		case '<':
+			start = i + 1
+		case '>':
+			end = i
+		}
+		if end > start {
+			break
+		}
+	}
+	if end <= start {
+		return ""
+	}
+	b, err := url.Parse(base)
+	if err != nil {
+		return ""
+	}
+	next, err := url.Parse(link[start:end])
+	if err != nil {
+		return ""
+	}
+	return b.ResolveReference(next).String()
+}
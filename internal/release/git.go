@@ -0,0 +1,104 @@
+package release
+
+import (
+	"bytes"
+	"context"
+	"fmt"
+	"os"
+	"os/exec"
+	"path"
+	"strings"
+)
+
+// Git creates and pushes tags in a clone of the factory repository with
+// the git command.
+type Git struct {
+	// Dir is the clone, the working directory by default.
+	Dir string
+	// Remote the tags are fetched from and pushed to, origin by default.
+	Remote string
+	// Env is added to the environment of git, e.g. the committer
+	// identity of the tags (GIT_COMMITTER_NAME, GIT_COMMITTER_EMAIL).
+	Env []string
+	Bin string
+}
+
+func (g Git) remote() string {
+	if g.Remote != "" {
+		return g.Remote
+	}
+	return "origin"
+}
+
+// Run runs git with args in the clone and returns its output.
+func (g Git) Run(ctx context.Context, args ...string) (string, error) {
+	bin := g.Bin
+	if bin == "" {
+		bin = "git"
+	}
+	cmd := exec.CommandContext(ctx, bin, args...)
+	cmd.Dir = g.Dir
+	cmd.Env = append(os.Environ(), g.Env...)
+	var stdout, stderr bytes.Buffer
+	cmd.Stdout, cmd.Stderr = &stdout, &stderr
+	if err := cmd.Run(); err != nil {
+		return "", fmt.Errorf("git %s: %w: %s", args[0], err, strings.TrimSpace(stderr.String()))
+	}
+	return stdout.String(), nil
+}
+
+// Fetch updates the local tags from the remote, so tags pushed by other
+// runs are seen.
+func (g Git) Fetch(ctx context.Context) error {
+	_, err := g.Run(ctx, "fetch", "--quiet", "--tags", g.remote())
+	return err
+}
+
+// TagMessage returns the message of the annotated tag name, and whether
+// the tag exists.
+func (g Git) TagMessage(ctx context.Context, name string) (string, bool, error) {
+	out, err := g.Run(ctx, "for-each-ref", "--format=%(objecttype) %(contents)", "refs/tags/"+name)
+	if err != nil || out == "" {
+		return "", false, err
+	}
+	kind, message, _ := strings.Cut(out, " ")
+	if kind != "tag" {
+		return "", true, nil
+	}
+	return strings.TrimSpace(message), true, nil
+}
+
+// Tag creates the annotated tag name on revision.
+func (g Git) Tag(ctx context.Context, name, revision, message string) error {
+	_, err := g.Run(ctx, "tag", "--annotate", "--message", message, name, revision+"^{commit}")
+	return err
+}
+
+// Push pushes tags to the remote. Existing remote tags are never moved.
+func (g Git) Push(ctx context.Context, tags ...string) error {
+	if len(tags) == 0 {
+		return nil
+	}
+	args := []string{"push", "--quiet", g.remote()}
+	for _, t := range tags {
+		args = append(args, "refs/tags/"+t)
+	}
+	_, err := g.Run(ctx, args...)
+	return err
+}
+
+// Modules returns the directories of the Go modules under dir at
+// revision.
+func (g Git) Modules(ctx context.Context, revision, dir string) ([]string, error) {
+	out, err := g.Run(ctx, "ls-tree", "-r", "--name-only", revision, "--", dir)
+	if err != nil {
+		return nil, err
+	}
+	var modules []string
+	for _, f := range strings.Fields(out) {
+		if path.Base(f) == "go.mod" {
+			modules = append(modules, path.Dir(f))
+		}
+	}
+	return modules, nil
+}
@@ -0,0 +1,309 @@
+// Package release records every publish of an image variant in git and on
+// GitHub: an annotated tag (go-distroless/1.26.0) naming the digest that
+// was published and the revision it was built from, and a release on that
+// tag with notes and the SBOM and provenance of the image as assets.
+//
+// Variants are rebuilt (nightly, on base image updates) under the same
+// version. The first publish of a version gets the plain tag, each later
+// publish of a different digest the next of go-distroless/1.26.0+2, +3...
+// Publishing the same digest again records nothing new, so the records
+// can be brought up to date as often as needed.
+package release
+
+import (
+	"context"
+	"fmt"
+	"regexp"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/gillouche/container-factory/internal/github"
+	"github.com/gillouche/container-factory/internal/registry"
+)
+
+// Publish is one publish of an image variant.
+type Publish struct {
+	Image   string
+	Variant string
+	// Dir is the image directory in the repository. Go modules under it
+	// are tagged with the variant as their version.
+	Dir        string
+	Repository string
+	Digest     string
+	Revision   string
+	Time       time.Time
+	Signed     bool
+}
+
+// Ref is the published image, by digest.
+func (p Publish) Ref() string { return p.Repository + "@" + p.Digest }
+
+// Generator produces CycloneDX SBOMs of images that have no SBOM
+// attestation.
+type Generator interface {
+	SBOM(ctx context.Context, ref string) ([]byte, error)
+}
+
+// Recorder tags publishes and creates their releases.
+type Recorder struct {
+	Git Git
+	// GitHub and Repo (owner/name) are where releases are created. With
+	// no GitHub client only tags are created.
+	GitHub *github.Client
+	Repo   string
+	// Registry reads the attestations of the images of Platform.
+	Registry *registry.Client
+	Platform registry.Platform
+	// SBOMs, when set, generates the SBOM of images without an SBOM
+	// attestation (single-platform images are pushed without).
+	SBOMs Generator
+	// DryRun reports what would be recorded without recording it.
+	DryRun bool
+}
+
+// Result is what recording a publish did, or would do.
+type Result struct {
+	Tag string
+	// Tags are the tags created: Tag unless it already existed, and the
+	// tags of the Go modules of the image.
+	Tags []string
+	// Release is the URL of the release, "" without GitHub or in a dry
+	// run of a new release.
+	Release string
+	// Created is set when the release was created.
+	Created bool
+	// Assets are the assets uploaded.
+	Assets []string
+}
+
+// Changed reports whether anything was recorded.
+func (r *Result) Changed() bool { return len(r.Tags) > 0 || r.Created || len(r.Assets) > 0 }
+
+// Record tags p unless its digest already is, pushes the new tags and
+// creates or completes the release of the tag.
+func (rc *Recorder) Record(ctx context.Context, p Publish) (*Result, error) {
+	tag, exists, err := rc.tag(ctx, p)
+	if err != nil {
+		return nil, err
+	}
+	res := &Result{Tag: tag}
+	if !exists {
+		res.Tags = append(res.Tags, tag)
+		if !rc.DryRun {
+			if err := rc.Git.Tag(ctx, tag, p.Revision, Message(p)); err != nil {
+				return nil, err
+			}
+		}
+		// Module versions are immutable: a rebuild of the version keeps
+		// the module tag of its first publish.
+		modules, err := rc.moduleTags(ctx, p)
+		if err != nil {
+			return nil, err
+		}
+		for _, m := range modules {
+			res.Tags = append(res.Tags, m)
+			if !rc.DryRun {
+				if err := rc.Git.Tag(ctx, m, p.Revision, fmt.Sprintf("%s module of %s %s", m, p.Image, p.Variant)); err != nil {
+					return nil, err
+				}
+			}
+		}
+		if !rc.DryRun {
+			if err := rc.Git.Push(ctx, res.Tags...); err != nil {
+				return nil, err
+			}
+		}
+	}
+	if rc.GitHub == nil {
+		return res, nil
+	}
+	return res, rc.release(ctx, p, res)
+}
+
+// tag returns the tag recording the publish of p, and whether it exists.
+func (rc *Recorder) tag(ctx context.Context, p Publish) (string, bool, error) {
+	base := p.Image + "/" + p.Variant
+	for n := 1; ; n++ {
+		name := base
+		if n > 1 {
+			name += "+" + strconv.Itoa(n)
+		}
+		message, ok, err := rc.Git.TagMessage(ctx, name)
+		if err != nil {
+			return "", false, err
+		}
+		if !ok {
+			return name, false, nil
+		}
+		if Field(message, "Digest") == p.Digest {
+			return name, true, nil
+		}
+	}
+}
+
+var semver = regexp.MustCompile(`^\d+\.\d+\.\d+$`)
+
+// moduleTags returns the tags to create for the Go modules of p's image
+// directory. Variants that are not a semantic version are no module
+// version.
+func (rc *Recorder) moduleTags(ctx context.Context, p Publish) ([]string, error) {
+	if p.Dir == "" || !semver.MatchString(p.Variant) {
+		return nil, nil
+	}
+	dirs, err := rc.Git.Modules(ctx, p.Revision, p.Dir)
+	if err != nil {
+		return nil, err
+	}
+	var tags []string
+	for _, d := range dirs {
+		name := d + "/v" + p.Variant
+		_, ok, err := rc.Git.TagMessage(ctx, name)
+		if err != nil {
+			return nil, err
+		}
+		if !ok {
+			tags = append(tags, name)
+		}
+	}
+	return tags, nil
+}
+
+// release creates the release of res.Tag, or uploads the assets an
+// existing one lacks.
+func (rc *Recorder) release(ctx context.Context, p Publish, res *Result) error {
+	rel, err := rc.GitHub.ReleaseByTag(ctx, rc.Repo, res.Tag)
+	switch {
+	case github.IsNotFound(err):
+		rel = nil
+	case err != nil:
+		return err
+	case len(rel.Assets) > 0:
+		res.Release = rel.HTMLURL
+		return nil
+	}
+
+	assets, err := rc.assets(ctx, p)
+	if err != nil {
+		return err
+	}
+	if rel == nil {
+		res.Created = true
+		if rc.DryRun {
+			for _, a := range assets {
+				res.Assets = append(res.Assets, a.Name)
+			}
+			return nil
+		}
+		rel, err = rc.GitHub.CreateRelease(ctx, rc.Repo, &github.Release{
+			TagName:    res.Tag,
+			Target:     p.Revision,
+			Name:       p.Image + " " + p.Variant,
+			Body:       Notes(p, assets),
+			MakeLatest: "false",
+		})
+		if err != nil {
+			return err
+		}
+	}
+	res.Release = rel.HTMLURL
+	for _, a := range assets {
+		if rel.HasAsset(a.Name) {
+			continue
+		}
+		res.Assets = append(res.Assets, a.Name)
+		if rc.DryRun {
+			continue
+		}
+		if _, err := rc.GitHub.UploadAsset(ctx, rel, a.Name, "application/json", a.Data); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// Asset is a file of a release.
+type Asset struct {
+	Name string
+	// Kind describes the content in the release notes.
+	Kind string
+	Data []byte
+}
+
+// assets returns the SBOM and provenance of p's image: its BuildKit
+// attestations, else an SBOM from the generator.
+func (rc *Recorder) assets(ctx context.Context, p Publish) ([]Asset, error) {
+	ref, err := registry.ParseRef(p.Ref())
+	if err != nil {
+		return nil, err
+	}
+	attestations, err := rc.Registry.Attestations(ctx, ref, rc.Platform)
+	if err != nil {
+		return nil, err
+	}
+	prefix := p.Image + "-" + p.Variant
+	var sbom, provenance *Asset
+	for _, a := range attestations {
+		switch {
+		case a.PredicateType == registry.PredicateSPDX && sbom == nil:
+			sbom = &Asset{Name: prefix + ".spdx.json", Kind: "SBOM (SPDX, in-toto statement)", Data: a.Statement}
+		case a.IsProvenance() && provenance == nil:
+			provenance = &Asset{Name: prefix + ".provenance.json", Kind: "SLSA provenance (in-toto statement)", Data: a.Statement}
+		}
+	}
+	if sbom == nil && rc.SBOMs != nil {
+		data, err := rc.SBOMs.SBOM(ctx, p.Ref())
+		if err != nil {
+			return nil, err
+		}
+		sbom = &Asset{Name: prefix + ".cdx.json", Kind: "SBOM (CycloneDX)", Data: data}
+	}
+	var out []Asset
+	for _, a := range []*Asset{sbom, provenance} {
+		if a != nil {
+			out = append(out, *a)
+		}
+	}
+	return out, nil
+}
+
+// Message is the message of the tag of p. Its Key: value fields are read
+// back with Field.
+func Message(p Publish) string {
+	return fmt.Sprintf("%s %s\n\nImage: %s:%s\nDigest: %s\nRevision: %s\nPublished: %s\n",
+		p.Image, p.Variant, p.Repository, p.Variant, p.Digest, p.Revision, p.Time.UTC().Format(time.RFC3339))
+}
+
+// Field returns the value of the Key: value line key of a tag message.
+func Field(message, key string) string {
+	for _, line := range strings.Split(message, "\n") {
+		if v, ok := strings.CutPrefix(line, key+": "); ok {
+			return strings.TrimSpace(v)
+		}
+	}
+	return ""
+}
+
+// Notes returns the release notes of p, listing its assets.
+func Notes(p Publish, assets []Asset) string {
+	var b strings.Builder
+	fmt.Fprintf(&b, "%s %s published as `%s`, built from %s.\n\n", p.Image, p.Variant, p.Digest, p.Revision)
+	fmt.Fprintf(&b, "| | |\n|---|---|\n")
+	fmt.Fprintf(&b, "| Image | `%s:%s` |\n", p.Repository, p.Variant)
+	fmt.Fprintf(&b, "| Digest | `%s` |\n", p.Digest)
+	fmt.Fprintf(&b, "| Revision | %s |\n", p.Revision)
+	fmt.Fprintf(&b, "| Published | %s |\n", p.Time.UTC().Format(time.RFC3339))
+	signed := "no"
+	if p.Signed {
+		signed = "yes, verify with `factory verify " + p.Ref() + "`"
+	}
+	fmt.Fprintf(&b, "| Signed | %s |\n", signed)
+	fmt.Fprintf(&b, "\nPull it by digest, the tag moves with rebuilds:\n\n```\ndocker pull %s\n```\n", p.Ref())
+	if len(assets) > 0 {
+		fmt.Fprintf(&b, "\nAssets:\n\n")
+		for _, a := range assets {
+			fmt.Fprintf(&b, "- `%s`: %s\n", a.Name, a.Kind)
+		}
+	}
+	return b.String()
+}
@@ -0,0 +1,240 @@
+package release
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"slices"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/gillouche/container-factory/internal/github"
+	ghmemory "github.com/gillouche/container-factory/internal/github/memory"
+	"github.com/gillouche/container-factory/internal/registry"
+	"github.com/gillouche/container-factory/internal/registry/memory"
+	"github.com/gillouche/container-factory/internal/registry/registrytest"
+)
+
+const (
+	testRepo      = "test/factory"
+	spdxStatement = `{"_type":"https://in-toto.io/Statement/v0.1","predicateType":"https://spdx.dev/Document","predicate":{"spdxVersion":"SPDX-2.3"}}`
+	slsaStatement = `{"_type":"https://in-toto.io/Statement/v0.1","predicateType":"https://slsa.dev/provenance/v0.2","predicate":{"builder":{"id":"test"}}}`
+)
+
+type staticSBOM string
+
+func (s staticSBOM) SBOM(context.Context, string) ([]byte, error) { return []byte(s), nil }
+
+// TestRecord records publishes in a clone of a local bare repository and
+// in a fake GitHub releases API, and checks the tags the remote received
+// and the releases and assets created.
+func TestRecord(t *testing.T) {
+	ctx := context.Background()
+	tmp := t.TempDir()
+	identity := []string{
+		"GIT_CONFIG_GLOBAL=" + os.DevNull, "GIT_CONFIG_NOSYSTEM=1",
+		"GIT_AUTHOR_NAME=test", "GIT_AUTHOR_EMAIL=test@localhost",
+		"GIT_COMMITTER_NAME=test", "GIT_COMMITTER_EMAIL=test@localhost",
+	}
+	remote := Git{Dir: filepath.Join(tmp, "remote.git"), Env: identity}
+	clone := Git{Dir: filepath.Join(tmp, "clone"), Env: identity}
+	revision := setupRepo(t, tmp, remote, clone)
+
+	repo := registrytest.Serve(t, memory.New())
+	client := &registry.Client{}
+	releases := &ghmemory.Releases{}
+	api := httptest.NewServer(releases)
+	defer api.Close()
+
+	rc := &Recorder{
+		Git:      clone,
+		GitHub:   &github.Client{API: api.URL},
+		Repo:     testRepo,
+		Registry: client,
+		Platform: registry.Platform{OS: "linux", Architecture: "amd64"},
+		SBOMs:    staticSBOM(`{"bomFormat":"CycloneDX"}`),
+	}
+	publish := func(variant, tag string, attested bool) Publish {
+		t.Helper()
+		ref, err := registrytest.PushImage(ctx, client, repo, tag)
+		if err == nil && attested {
+			ref, err = pushAttestedIndex(ctx, client, ref, tag)
+		}
+		if err != nil {
+			t.Fatal(err)
+		}
+		return Publish{
+			Image: "demo", Variant: variant, Dir: "images/demo", Repository: ref.Name(),
+			Digest: ref.Digest, Revision: revision, Time: time.Now().UTC(), Signed: true,
+		}
+	}
+	record := func(p Publish, tags, assets []string) {
+		t.Helper()
+		res, err := rc.Record(ctx, p)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if !slices.Equal(res.Tags, tags) {
+			t.Errorf("tagged %v, want %v", res.Tags, tags)
+		}
+		if !res.Created || !slices.Equal(res.Assets, assets) {
+			t.Errorf("release created %t with %v, want assets %v", res.Created, res.Assets, assets)
+		}
+	}
+
+	first := publish("1.0.0", "1.0.0", true)
+	record(first, []string{"demo/1.0.0", "images/demo/selftest/v1.0.0"}, []string{"demo-1.0.0.spdx.json", "demo-1.0.0.provenance.json"})
+	expectRemoteTag(t, remote, "demo/1.0.0", first)
+	expectRemoteTag(t, remote, "images/demo/selftest/v1.0.0", Publish{})
+	r := releases.Release(testRepo, "demo/1.0.0")
+	if r == nil {
+		t.Fatal("no release demo/1.0.0")
+	}
+	if data, _ := releases.Asset(r.ID, "demo-1.0.0.provenance.json"); !bytes.Equal(data, []byte(slsaStatement)) {
+		t.Errorf("provenance asset is %q, want %q", data, slsaStatement)
+	}
+
+	// Recording the same digest again changes nothing.
+	res, err := rc.Record(ctx, first)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if res.Changed() {
+		t.Errorf("recording the same digest again created %v and uploaded %v", res.Tags, res.Assets)
+	}
+
+	// A rebuild under a new digest gets the next tag, the first one stays.
+	rebuild := publish("1.0.0", "1.0.0-rebuild", true)
+	record(rebuild, []string{"demo/1.0.0+2"}, []string{"demo-1.0.0.spdx.json", "demo-1.0.0.provenance.json"})
+	expectRemoteTag(t, remote, "demo/1.0.0+2", rebuild)
+	expectRemoteTag(t, remote, "demo/1.0.0", first)
+
+	// Single-platform images have no attestations, the SBOM is generated.
+	record(publish("latest", "latest", false), []string{"demo/latest"}, []string{"demo-latest.cdx.json"})
+
+	rc.DryRun = true
+	record(publish("2.0.0", "2.0.0", true), []string{"demo/2.0.0", "images/demo/selftest/v2.0.0"}, []string{"demo-2.0.0.spdx.json", "demo-2.0.0.provenance.json"})
+	if out, _ := remote.Run(ctx, "tag", "--list", "demo/2.0.0"); out != "" || releases.Count(testRepo) != 3 {
+		t.Error("the dry run recorded the publish")
+	}
+}
+
+// setupRepo creates the bare remote and a clone holding one commit with an
+// image directory and a Go module under it, and returns the commit.
+func setupRepo(t *testing.T, tmp string, remote, clone Git) string {
+	t.Helper()
+	ctx := context.Background()
+	for _, args := range [][]string{
+		{"init", "--quiet", "--bare", remote.Dir},
+		{"init", "--quiet", clone.Dir},
+	} {
+		if _, err := (Git{Dir: tmp, Env: clone.Env}).Run(ctx, args...); err != nil {
+			t.Fatal(err)
+		}
+	}
+	files := map[string]string{
+		"images/demo/Dockerfile":      "FROM scratch\n",
+		"images/demo/selftest/go.mod": "module example.com/demo/selftest\n",
+	}
+	for name, content := range files {
+		path := filepath.Join(clone.Dir, name)
+		if err := os.MkdirAll(filepath.Dir(path), 0o755); err != nil {
+			t.Fatal(err)
+		}
+		if err := os.WriteFile(path, []byte(content), 0o644); err != nil {
+			t.Fatal(err)
+		}
+	}
+	for _, args := range [][]string{
+		{"add", "."},
+		{"commit", "--quiet", "--message", "Add demo"},
+		{"remote", "add", "origin", remote.Dir},
+		{"push", "--quiet", "origin", "HEAD"},
+	} {
+		if _, err := clone.Run(ctx, args...); err != nil {
+			t.Fatal(err)
+		}
+	}
+	out, err := clone.Run(ctx, "rev-parse", "HEAD")
+	if err != nil {
+		t.Fatal(err)
+	}
+	return strings.TrimSpace(out)
+}
+
+// pushAttestedIndex pushes, under tag, an index of the linux/amd64 image
+// with BuildKit SBOM and provenance attestations, and returns its digest
+// reference.
+func pushAttestedIndex(ctx context.Context, client *registry.Client, image registry.Ref, tag string) (registry.Ref, error) {
+	config, err := client.PutBlob(ctx, image, registry.MediaTypeEmpty, registry.EmptyConfig)
+	if err != nil {
+		return registry.Ref{}, err
+	}
+	attestation := registry.Manifest{SchemaVersion: 2, MediaType: registry.MediaTypeManifest, Config: config}
+	for _, s := range []struct{ predicate, statement string }{
+		{registry.PredicateSPDX, spdxStatement},
+		{"https://slsa.dev/provenance/v0.2", slsaStatement},
+	} {
+		layer, err := client.PutBlob(ctx, image, "application/vnd.in-toto+json", []byte(s.statement))
+		if err != nil {
+			return registry.Ref{}, err
+		}
+		layer.Annotations = map[string]string{registry.AnnotationPredicateType: s.predicate}
+		attestation.Layers = append(attestation.Layers, layer)
+	}
+	data, err := json.Marshal(attestation)
+	if err != nil {
+		return registry.Ref{}, err
+	}
+	att := image
+	att.Digest = registry.DigestOf(data)
+	if _, err := client.PutManifest(ctx, att, registry.MediaTypeManifest, data); err != nil {
+		return registry.Ref{}, err
+	}
+
+	index := registry.Index{SchemaVersion: 2, MediaType: registry.MediaTypeIndex, Manifests: []registry.Descriptor{
+		{MediaType: registry.MediaTypeManifest, Digest: image.Digest, Platform: &registry.Platform{OS: "linux", Architecture: "amd64"}},
+		{MediaType: registry.MediaTypeManifest, Digest: att.Digest, Size: int64(len(data)),
+			Platform: &registry.Platform{OS: "unknown", Architecture: "unknown"},
+			Annotations: map[string]string{
+				registry.AnnotationReferenceType:   registry.ReferenceTypeAttestation,
+				registry.AnnotationReferenceDigest: image.Digest,
+			}},
+	}}
+	if data, err = json.Marshal(index); err != nil {
+		return registry.Ref{}, err
+	}
+	ref := image
+	ref.Digest, ref.Tag = "", tag
+	digest, err := client.PutManifest(ctx, ref, registry.MediaTypeIndex, data)
+	ref.Tag, ref.Digest = "", digest
+	return ref, err
+}
+
+// expectRemoteTag checks that the remote has the annotated tag name and,
+// unless p is zero, that it records the digest and revision of p.
+func expectRemoteTag(t *testing.T, remote Git, name string, p Publish) {
+	t.Helper()
+	out, err := remote.Run(context.Background(), "for-each-ref", "--format=%(objecttype)%00%(*objectname)%00%(contents)", "refs/tags/"+name)
+	if err != nil {
+		t.Fatal(err)
+	}
+	fields := strings.SplitN(out, "\x00", 3)
+	if len(fields) != 3 || fields[0] != "tag" {
+		t.Errorf("remote has no annotated tag %s", name)
+		return
+	}
+	if p.Digest == "" {
+		return
+	}
+	if fields[1] != p.Revision {
+		t.Errorf("%s is on %s, want %s", name, fields[1], p.Revision)
+	}
+	if d := Field(fields[2], "Digest"); d != p.Digest {
+		t.Errorf("%s records digest %q, want %s", name, d, p.Digest)
+	}
+}
@@ -0,0 +1,197 @@
+// Package rescan re-checks the digests currently published under the
+// factory's tags against an up-to-date vulnerability database, so a CVE
+// disclosed after a build is noticed without waiting for the next rebuild.
+package rescan
+
+import (
+	"bytes"
+	"context"
+	"fmt"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"sort"
+	"strings"
+
+	"github.com/gillouche/container-factory/internal/vuln"
+)
+
+// Target is one published digest and the tags pointing to it.
+type Target struct {
+	Image      string   `json:"image"`
+	Repository string   `json:"repository"`
+	Digest     string   `json:"digest"`
+	Tags       []string `json:"tags"`
+	// Variants are the exact variant tags among Tags.
+	Variants []string `json:"variants"`
+}
+
+// Ref is the digest reference of the target.
+func (t Target) Ref() string { return t.Repository + "@" + t.Digest }
+
+// Scanner produces Trivy JSON reports.
+type Scanner interface {
+	UpdateDB(ctx context.Context) error
+	Scan(ctx context.Context, ref string) ([]byte, error)
+}
+
+// Trivy scans with the trivy CLI. The database is updated once per run and
+// every scan then reuses it.
+type Trivy struct {
+	Bin string
+	// Platform selects the image of a multi-arch reference (os/arch), the
+	// host's by default.
+	Platform string
+	// ListPackages adds every package to the report, not only the
+	// vulnerable ones.
+	ListPackages bool
+}
+
+func (t Trivy) bin() string {
+	if t.Bin != "" {
+		return t.Bin
+	}
+	return "trivy"
+}
+
+func (t Trivy) UpdateDB(ctx context.Context) error {
+	return run(exec.CommandContext(ctx, t.bin(), "image", "--quiet", "--download-db-only"))
+}
+
+func (t Trivy) Scan(ctx context.Context, ref string) ([]byte, error) {
+	args := []string{"image", "--quiet", "--skip-db-update", "--format", "json"}
+	if t.Platform != "" {
+		args = append(args, "--platform", t.Platform)
+	}
+	if t.ListPackages {
+		args = append(args, "--list-all-pkgs")
+	}
+	cmd := exec.CommandContext(ctx, t.bin(), append(args, ref)...)
+	var out bytes.Buffer
+	cmd.Stdout = &out
+	if err := run(cmd); err != nil {
+		return nil, err
+	}
+	return out.Bytes(), nil
+}
+
+// SBOM returns the CycloneDX SBOM of ref. It needs no vulnerability
+// database.
+func (t Trivy) SBOM(ctx context.Context, ref string) ([]byte, error) {
+	args := []string{"image", "--quiet", "--format", "cyclonedx"}
+	if t.Platform != "" {
+		args = append(args, "--platform", t.Platform)
+	}
+	cmd := exec.CommandContext(ctx, t.bin(), append(args, ref)...)
+	var out bytes.Buffer
+	cmd.Stdout = &out
+	if err := run(cmd); err != nil {
+		return nil, err
+	}
+	return out.Bytes(), nil
+}
+
+func run(cmd *exec.Cmd) error {
+	var stderr bytes.Buffer
+	cmd.Stderr = &stderr
+	if err := cmd.Run(); err != nil {
+		return fmt.Errorf("%s: %w: %s", strings.Join(cmd.Args[:2], " "), err, strings.TrimSpace(stderr.String()))
+	}
+	return nil
+}
+
+// Alert is a finding that was not in the previous scan of a digest.
+type Alert struct {
+	Image   string       `json:"image"`
+	Digest  string       `json:"digest"`
+	Tags    []string     `json:"tags"`
+	Finding vuln.Finding `json:"finding"`
+}
+
+// Store keeps the latest rescan of every digest under
+// <dir>/<image>/<algorithm>-<hex>.json and refreshes the per-variant reports
+// in scans, which the scorecard, digest and promotion checks read.
+type Store struct {
+	Dir   string
+	Scans string
+}
+
+func (s Store) path(t Target) string {
+	return filepath.Join(s.Dir, t.Image, strings.Replace(t.Digest, ":", "-", 1)+".json")
+}
+
+// Baseline returns the report new findings are measured against: the last
+// rescan of the digest, or else the build-time scan of a variant it is
+// published as. A digest never scanned before has no baseline.
+func (s Store) Baseline(t Target) *vuln.Report {
+	if r, err := vuln.Load(s.path(t)); err == nil {
+		return r
+	}
+	for _, v := range t.Variants {
+		if r, err := vuln.Load(vuln.Path(s.Scans, t.Image, v)); err == nil {
+			return r
+		}
+	}
+	return nil
+}
+
+// Save records the rescan of t.
+func (s Store) Save(t Target, data []byte) error {
+	paths := []string{s.path(t)}
+	for _, v := range t.Variants {
+		paths = append(paths, vuln.Path(s.Scans, t.Image, v))
+	}
+	for _, p := range paths {
+		if err := os.MkdirAll(filepath.Dir(p), 0o755); err != nil {
+			return err
+		}
+		if err := os.WriteFile(p, data, 0o644); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// Scan is the fresh report of a target, saved once its alerts have been
+// delivered.
+type Scan struct {
+	Target Target
+	Data   []byte
+}
+
+// Rescan scans every target and returns the new findings, most severe first.
+// Targets without a baseline raise no alerts, so the first run does not
+// report every known finding. Scan failures are returned per target and do
+// not stop the run.
+func Rescan(ctx context.Context, sc Scanner, store Store, targets []Target) ([]Alert, []Scan, map[string]error) {
+	var alerts []Alert
+	var scans []Scan
+	failed := map[string]error{}
+	for _, t := range targets {
+		data, err := sc.Scan(ctx, t.Ref())
+		if err != nil {
+			failed[t.Ref()] = err
+			continue
+		}
+		report, err := vuln.Parse(data)
+		if err != nil {
+			failed[t.Ref()] = err
+			continue
+		}
+		if base := store.Baseline(t); base != nil {
+			for _, f := range report.Since(base) {
+				alerts = append(alerts, Alert{Image: t.Image, Digest: t.Digest, Tags: t.Tags, Finding: f})
+			}
+		}
+		scans = append(scans, Scan{Target: t, Data: data})
+	}
+
+	rank := map[string]int{}
+	for i, s := range vuln.Severities {
+		rank[s] = i
+	}
+	sort.SliceStable(alerts, func(i, j int) bool {
+		return rank[alerts[i].Finding.Severity] < rank[alerts[j].Finding.Severity]
+	})
+	return alerts, scans, failed
+}
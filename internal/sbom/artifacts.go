@@ -0,0 +1,267 @@
+// Package sbom adds to image SBOMs the artifacts Dockerfiles install
+// outside package managers: release tarballs and zips, static binaries and
+// installers fetched with curl. Package-based generators miss them, or
+// guess at them from the files they find.
+//
+// The artifacts are declared by the downloads of the Dockerfile of the
+// image and of the factory images it is built FROM, with build args
+// expanded, and matched to the rules of ci/artifacts.json for their name,
+// version and purl. Only those whose files are found in the image layers
+// are added, with the digests of those files.
+package sbom
+
+import (
+	"encoding/json"
+	"fmt"
+	"net/url"
+	"os"
+	"path/filepath"
+	"regexp"
+	"sort"
+	"strconv"
+	"strings"
+
+	"github.com/gillouche/container-factory/internal/catalog"
+	"github.com/gillouche/container-factory/internal/dockerfile"
+	"github.com/gillouche/container-factory/internal/registry"
+)
+
+// DefaultArtifacts is where the artifact rules live relative to the repo
+// root.
+const DefaultArtifacts = "ci/artifacts.json"
+
+// Rule describes an artifact by the upstream URLs it is downloaded from.
+// URL, PURL, Installed and Files may use {version}, the version the URL
+// names; PURL may also use {url}, the upstream URL.
+type Rule struct {
+	Name string `json:"name"`
+	// URL is a glob of the upstream URLs, where * matches within a path
+	// segment: .../download/v{version}/buildx-v{version}.linux-*.
+	URL  string `json:"url"`
+	PURL string `json:"purl"`
+	// Installed is the path in the image of a download installed as is,
+	// whose digest is then the download's.
+	Installed string `json:"installed,omitempty"`
+	// Files are globs of the paths in the image of the files the download
+	// unpacks to.
+	Files []string `json:"files,omitempty"`
+
+	re *regexp.Regexp
+}
+
+func (r *Rule) compile() error {
+	switch {
+	case r.Name == "":
+		return fmt.Errorf("no name")
+	case !strings.Contains(r.URL, "{version}"):
+		return fmt.Errorf("url %q names no {version}", r.URL)
+	case r.PURL == "":
+		return fmt.Errorf("no purl")
+	case r.Installed == "" && len(r.Files) == 0:
+		return fmt.Errorf("neither installed nor files: nothing to find in images")
+	}
+	var b strings.Builder
+	b.WriteString("^")
+	for i, part := range strings.Split(r.URL, "{version}") {
+		if i > 0 {
+			b.WriteString(`([^/]+?)`)
+		}
+		globs := strings.Split(part, "*")
+		for j, g := range globs {
+			if j > 0 {
+				b.WriteString(`[^/]*`)
+			}
+			b.WriteString(regexp.QuoteMeta(g))
+		}
+	}
+	b.WriteString("$")
+	re, err := regexp.Compile(b.String())
+	if err != nil {
+		return err
+	}
+	r.re = re
+	return nil
+}
+
+// match returns the version u names, when u is a URL of r. Every
+// {version} of the glob must name the same one.
+func (r *Rule) match(u string) (string, bool) {
+	m := r.re.FindStringSubmatch(u)
+	if m == nil {
+		return "", false
+	}
+	for _, v := range m[2:] {
+		if v != m[1] {
+			return "", false
+		}
+	}
+	return m[1], true
+}
+
+// Artifacts is the artifact rule set.
+type Artifacts struct {
+	// Proxies maps the prefixes of proxied download URLs to the upstream
+	// prefixes they stand for.
+	Proxies map[string]string `json:"proxies"`
+	Rules   []Rule            `json:"artifacts"`
+}
+
+// LoadArtifacts reads and checks the rule set at path.
+func LoadArtifacts(path string) (*Artifacts, error) {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return nil, err
+	}
+	var a Artifacts
+	if err := json.Unmarshal(data, &a); err != nil {
+		return nil, fmt.Errorf("%s: %w", path, err)
+	}
+	seen := map[string]bool{}
+	for i := range a.Rules {
+		r := &a.Rules[i]
+		if err := r.compile(); err != nil {
+			return nil, fmt.Errorf("%s: artifact %q: %w", path, r.Name, err)
+		}
+		if seen[r.Name] {
+			return nil, fmt.Errorf("%s: duplicate artifact %q", path, r.Name)
+		}
+		seen[r.Name] = true
+	}
+	return &a, nil
+}
+
+// Upstream returns the URL u is a proxy of, u itself when it is not
+// proxied. The longest matching prefix wins.
+func (a *Artifacts) Upstream(u string) string {
+	best := ""
+	for prefix := range a.Proxies {
+		if strings.HasPrefix(u, prefix) && len(prefix) > len(best) {
+			best = prefix
+		}
+	}
+	if best == "" {
+		return u
+	}
+	return a.Proxies[best] + strings.TrimPrefix(u, best)
+}
+
+// Match returns the rule of the upstream URL u and the version it names.
+func (a *Artifacts) Match(u string) (*Rule, string, bool) {
+	for i := range a.Rules {
+		if v, ok := a.Rules[i].match(u); ok {
+			return &a.Rules[i], v, true
+		}
+	}
+	return nil, "", false
+}
+
+// Artifact is a download of a Dockerfile matched to its rule.
+type Artifact struct {
+	Rule    *Rule
+	Version string
+	// URL is the URL fetched, Upstream the one it stands for.
+	URL      string
+	Upstream string
+	// Sources are the Dockerfile lines downloading it:
+	// images/actions-runner/Dockerfile:30.
+	Sources []string
+	// Files are the files of the artifact found in the image.
+	Files []File
+	// SHA256 is the hex digest of the download, "" when unknown.
+	SHA256 string
+}
+
+// PURL is the package URL of a.
+func (a *Artifact) PURL() string {
+	return strings.NewReplacer("{version}", a.Version, "{url}", url.QueryEscape(a.Upstream)).Replace(a.Rule.PURL)
+}
+
+// patterns are the globs of the paths of a in the image.
+func (a *Artifact) patterns() []string {
+	var out []string
+	for _, p := range append([]string{a.Rule.Installed}, a.Rule.Files...) {
+		if p != "" {
+			out = append(out, strings.ReplaceAll(p, "{version}", a.Version))
+		}
+	}
+	return out
+}
+
+// Declared returns the artifacts the Dockerfile of img downloads in a
+// build of variant for platform, and those of the catalog images it is
+// built FROM, in the variant its FROM names. Downloads that cannot be
+// resolved or match no rule are described in skipped.
+func (a *Artifacts) Declared(cat *catalog.Catalog, img catalog.Image, variant string, platform registry.Platform) (arts []Artifact, skipped []string, err error) {
+	index := map[string]int{}
+	seen := map[string]bool{}
+	var visit func(img catalog.Image, variant string) error
+	visit = func(img catalog.Image, variant string) error {
+		if seen[img.Name+":"+variant] {
+			return nil
+		}
+		seen[img.Name+":"+variant] = true
+
+		file := filepath.Join(img.Dir, "Dockerfile")
+		ins, err := dockerfile.Parse(file)
+		if err != nil {
+			return err
+		}
+		for _, d := range dockerfile.Downloads(ins, dockerfile.BuildArgs(platform.String(), variant)) {
+			source := filepath.ToSlash(file) + ":" + strconv.Itoa(d.Line)
+			if len(d.Unresolved) > 0 {
+				skipped = append(skipped, fmt.Sprintf("%s: cannot resolve %s in %s", source, strings.Join(d.Unresolved, ", "), d.Raw))
+				continue
+			}
+			upstream := a.Upstream(d.URL)
+			rule, version, ok := a.Match(upstream)
+			if !ok {
+				skipped = append(skipped, fmt.Sprintf("%s: no artifact rule for %s", source, upstream))
+				continue
+			}
+			if i, ok := index[upstream]; ok {
+				arts[i].Sources = append(arts[i].Sources, source)
+				continue
+			}
+			index[upstream] = len(arts)
+			arts = append(arts, Artifact{Rule: rule, Version: version, URL: d.URL, Upstream: upstream, Sources: []string{source}})
+		}
+
+		for _, ref := range img.BaseRefs(variant) {
+			name, ok := cat.Owner(ref)
+			if !ok || name == img.Name {
+				continue
+			}
+			base, _ := cat.Lookup(name)
+			v, ok := baseVariant(base, ref)
+			if !ok {
+				skipped = append(skipped, fmt.Sprintf("%s: FROM %s: no variant of %s", file, ref, name))
+				continue
+			}
+			if err := visit(base, v); err != nil {
+				return err
+			}
+		}
+		return nil
+	}
+	if err := visit(img, variant); err != nil {
+		return nil, nil, err
+	}
+	sort.SliceStable(arts, func(i, j int) bool { return arts[i].Rule.Name < arts[j].Rule.Name })
+	return arts, skipped, nil
+}
+
+// baseVariant returns the variant of base a FROM reference names: its
+// tag, or the only variant of base.
+func baseVariant(base catalog.Image, ref string) (string, bool) {
+	if r, err := registry.ParseRef(ref); err == nil {
+		for _, v := range base.Variants {
+			if v == r.Tag {
+				return v, true
+			}
+		}
+	}
+	if len(base.Variants) == 1 {
+		return base.Variants[0], true
+	}
+	return "", false
+}
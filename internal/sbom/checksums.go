@@ -0,0 +1,102 @@
+package sbom
+
+import (
+	"context"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"io/fs"
+	"net/http"
+	"net/url"
+	"os"
+	"path/filepath"
+)
+
+// Checksums digests downloads unpacked in images, whose digest the image
+// cannot give, by fetching them. The digest of each URL is kept in the
+// file at Path: the URLs name a version and do not change.
+type Checksums struct {
+	Path string
+	HTTP *http.Client
+	// Login returns the credentials of a download host.
+	Login func(host string) (user, pass string, ok bool)
+
+	sums    map[string]string
+	changed bool
+}
+
+// Get returns the hex SHA-256 digest of the download at u.
+func (c *Checksums) Get(ctx context.Context, u string) (string, error) {
+	if c.sums == nil {
+		c.sums = map[string]string{}
+		if c.Path != "" {
+			data, err := os.ReadFile(c.Path)
+			switch {
+			case errors.Is(err, fs.ErrNotExist):
+			case err != nil:
+				return "", err
+			default:
+				if err := json.Unmarshal(data, &c.sums); err != nil {
+					return "", fmt.Errorf("%s: %w", c.Path, err)
+				}
+			}
+		}
+	}
+	if sum, ok := c.sums[u]; ok {
+		return sum, nil
+	}
+
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet, u, nil)
+	if err != nil {
+		return "", err
+	}
+	if c.Login != nil {
+		if parsed, err := url.Parse(u); err == nil {
+			if user, pass, ok := c.Login(parsed.Hostname()); ok {
+				req.SetBasicAuth(user, pass)
+			}
+		}
+	}
+	client := c.HTTP
+	if client == nil {
+		client = http.DefaultClient
+	}
+	resp, err := client.Do(req)
+	if err != nil {
+		return "", err
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode != http.StatusOK {
+		return "", fmt.Errorf("%s: %s", u, resp.Status)
+	}
+	h := sha256.New()
+	if _, err := io.Copy(h, resp.Body); err != nil {
+		return "", fmt.Errorf("%s: %w", u, err)
+	}
+	sum := hex.EncodeToString(h.Sum(nil))
+	c.sums[u] = sum
+	c.changed = true
+	return sum, nil
+}
+
+// Save writes the digests back to Path when new ones were fetched.
+func (c *Checksums) Save() error {
+	if !c.changed || c.Path == "" {
+		return nil
+	}
+	data, err := json.MarshalIndent(c.sums, "", "  ")
+	if err != nil {
+		return err
+	}
+	if err := os.MkdirAll(filepath.Dir(c.Path), 0o755); err != nil {
+		return err
+	}
+	if err := os.WriteFile(c.Path, append(data, '\n'), 0o644); err != nil {
+		return err
+	}
+	c.changed = false
+	return nil
+}
@@ -0,0 +1,148 @@
+package sbom
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+)
+
+// Properties of the components added to SBOMs.
+const (
+	// PropertyDownloadURL is the URL the artifact was fetched from, a
+	// proxy of its distribution URL.
+	PropertyDownloadURL = "container-factory:download-url"
+	// PropertyDeclaredIn is a Dockerfile line downloading the artifact.
+	PropertyDeclaredIn = "container-factory:declared-in"
+)
+
+// Enrich adds the artifacts of arts found in the image to the CycloneDX
+// SBOM bom, as application components with the files they installed as
+// evidence. Artifacts unpacked to several files get these as file
+// components of their own. A component of the same purl, as a generator
+// may have guessed, is replaced, keeping its bom-ref.
+func Enrich(bom []byte, arts []Artifact) ([]byte, error) {
+	dec := json.NewDecoder(bytes.NewReader(bom))
+	dec.UseNumber()
+	var doc map[string]any
+	if err := dec.Decode(&doc); err != nil {
+		return nil, fmt.Errorf("SBOM: %w", err)
+	}
+	if doc["bomFormat"] != "CycloneDX" {
+		return nil, fmt.Errorf("SBOM: not CycloneDX")
+	}
+	components, _ := doc["components"].([]any)
+
+	var added []string
+	for i := range arts {
+		a := &arts[i]
+		if len(a.Files) == 0 {
+			continue
+		}
+		c := component(a)
+		replaced := false
+		for j, existing := range components {
+			if e, ok := existing.(map[string]any); ok && e["purl"] == c["purl"] {
+				if ref, ok := e["bom-ref"]; ok {
+					c["bom-ref"] = ref
+				}
+				components[j] = c
+				replaced = true
+				break
+			}
+		}
+		if !replaced {
+			components = append(components, c)
+			added = append(added, c["bom-ref"].(string))
+		}
+	}
+	doc["components"] = components
+	dependOnAdded(doc, added)
+
+	var out bytes.Buffer
+	enc := json.NewEncoder(&out)
+	enc.SetEscapeHTML(false)
+	enc.SetIndent("", "  ")
+	if err := enc.Encode(doc); err != nil {
+		return nil, err
+	}
+	return out.Bytes(), nil
+}
+
+func component(a *Artifact) map[string]any {
+	purl := a.PURL()
+	c := map[string]any{
+		"bom-ref": purl,
+		"type":    "application",
+		"name":    a.Rule.Name,
+		"version": a.Version,
+		"purl":    purl,
+		"externalReferences": []any{
+			map[string]any{"type": "distribution", "url": a.Upstream},
+		},
+	}
+	if a.SHA256 != "" {
+		c["hashes"] = hashes(a.SHA256)
+	}
+	properties := []any{map[string]any{"name": PropertyDownloadURL, "value": a.URL}}
+	for _, s := range a.Sources {
+		properties = append(properties, map[string]any{"name": PropertyDeclaredIn, "value": s})
+	}
+	c["properties"] = properties
+
+	var occurrences, files []any
+	for _, f := range a.Files {
+		occurrences = append(occurrences, map[string]any{"location": f.Path})
+		files = append(files, map[string]any{
+			"bom-ref": purl + "#" + f.Path,
+			"type":    "file",
+			"name":    f.Path,
+			"hashes":  hashes(f.SHA256),
+		})
+	}
+	c["evidence"] = map[string]any{"occurrences": occurrences}
+	// A download installed as is is its own file: its digest is on the
+	// component.
+	if a.Rule.Installed == "" || len(a.Files) > 1 {
+		c["components"] = files
+	}
+	return c
+}
+
+func hashes(sha256 string) []any {
+	return []any{map[string]any{"alg": "SHA-256", "content": sha256}}
+}
+
+// dependOnAdded makes the image, the metadata component, depend on the
+// components of refs.
+func dependOnAdded(doc map[string]any, refs []string) {
+	if len(refs) == 0 {
+		return
+	}
+	metadata, _ := doc["metadata"].(map[string]any)
+	root, _ := metadata["component"].(map[string]any)
+	rootRef, _ := root["bom-ref"].(string)
+	if rootRef == "" {
+		return
+	}
+	deps, _ := doc["dependencies"].([]any)
+	var entry map[string]any
+	for _, d := range deps {
+		if e, ok := d.(map[string]any); ok && e["ref"] == rootRef {
+			entry = e
+			break
+		}
+	}
+	if entry == nil {
+		entry = map[string]any{"ref": rootRef}
+		deps = append(deps, entry)
+	}
+	dependsOn, _ := entry["dependsOn"].([]any)
+	for _, r := range refs {
+		dependsOn = append(dependsOn, r)
+	}
+	entry["dependsOn"] = dependsOn
+	for _, r := range refs {
+		deps = append(deps, map[string]any{"ref": r})
+	}
+	doc["dependencies"] = deps
+}
@@ -0,0 +1,131 @@
+package sbom
+
+import (
+	"context"
+	"fmt"
+	"io"
+	"strings"
+
+	"github.com/gillouche/container-factory/internal/catalog"
+	"github.com/gillouche/container-factory/internal/malware"
+	"github.com/gillouche/container-factory/internal/registry"
+)
+
+// Generator produces CycloneDX SBOMs of images.
+type Generator interface {
+	SBOM(ctx context.Context, ref string) ([]byte, error)
+}
+
+// Enricher adds the declared artifacts of catalog images to the SBOMs of
+// Base. It is itself a Generator.
+type Enricher struct {
+	Base      Generator
+	Catalog   *catalog.Catalog
+	Artifacts *Artifacts
+	// Registry reads the layers of the images of Platform.
+	Registry *registry.Client
+	Platform registry.Platform
+	// Checksums, when set, digests the downloads unpacked in images.
+	Checksums *Checksums
+	// Log receives the downloads that are not in the SBOM and why.
+	Log io.Writer
+}
+
+// SBOM returns the SBOM of ref from Base, with the artifacts of its image
+// added. Images that are not in the catalog, or not a variant of it, are
+// left as Base describes them.
+func (e *Enricher) SBOM(ctx context.Context, ref string) ([]byte, error) {
+	bom, err := e.Base.SBOM(ctx, ref)
+	if err != nil {
+		return nil, err
+	}
+	name, ok := e.Catalog.Owner(ref)
+	if !ok {
+		return bom, nil
+	}
+	img, _ := e.Catalog.Lookup(name)
+	r, err := registry.ParseRef(ref)
+	if err != nil {
+		return nil, err
+	}
+	variant, err := e.Variant(ctx, img, r)
+	if err != nil || variant == "" {
+		return bom, err
+	}
+	layers, err := malware.RegistryLayers(ctx, e.Registry, r, e.Platform)
+	if err != nil {
+		return nil, err
+	}
+	bom, _, err = e.Enrich(ctx, bom, img, variant, layers)
+	return bom, err
+}
+
+// Variant returns the variant of img ref is: its tag, or the variant
+// whose tag has its digest. "" when it is none.
+func (e *Enricher) Variant(ctx context.Context, img catalog.Image, ref registry.Ref) (string, error) {
+	for _, v := range img.Variants {
+		if v == ref.Tag {
+			return v, nil
+		}
+	}
+	if ref.Digest == "" {
+		return "", nil
+	}
+	for _, v := range img.Variants {
+		tagged := ref
+		tagged.Tag, tagged.Digest = v, ""
+		digest, err := e.Registry.Digest(ctx, tagged)
+		if registry.IsNotFound(err) {
+			continue
+		}
+		if err != nil {
+			return "", err
+		}
+		if digest == ref.Digest {
+			return v, nil
+		}
+	}
+	return "", nil
+}
+
+// Enrich adds to bom the artifacts of variant of img found in layers, and
+// returns them, those found or not.
+func (e *Enricher) Enrich(ctx context.Context, bom []byte, img catalog.Image, variant string, layers []malware.Layer) ([]byte, []Artifact, error) {
+	arts, skipped, err := e.Artifacts.Declared(e.Catalog, img, variant, e.Platform)
+	if err != nil {
+		return nil, nil, err
+	}
+	for _, s := range skipped {
+		e.logf("  [warn] %s %s: %s", img.Name, variant, s)
+	}
+	if len(arts) == 0 {
+		return bom, nil, nil
+	}
+	if err := Locate(layers, arts); err != nil {
+		return nil, nil, fmt.Errorf("%s %s: %w", img.Name, variant, err)
+	}
+	for i := range arts {
+		a := &arts[i]
+		if len(a.Files) == 0 {
+			e.logf("  [warn] %s %s: %s %s (%s) is not in the image", img.Name, variant, a.Rule.Name, a.Version, strings.Join(a.Sources, ", "))
+			continue
+		}
+		if a.SHA256 != "" || e.Checksums == nil {
+			continue
+		}
+		if a.SHA256, err = e.Checksums.Get(ctx, a.URL); err != nil {
+			e.logf("  [warn] %s %s: %s %s: no checksum: %v", img.Name, variant, a.Rule.Name, a.Version, err)
+		}
+	}
+	out, err := Enrich(bom, arts)
+	if err != nil {
+		return nil, nil, fmt.Errorf("%s %s: %w", img.Name, variant, err)
+	}
+	return out, arts, nil
+}
+
+func (e *Enricher) logf(format string, args ...any) {
+	if e.Log != nil {
+		fmt.Fprintf(e.Log, format+"\n", args...)
+	}
+}
@@ -0,0 +1,410 @@
+package sbom
+
+import (
+	"archive/tar"
+	"bytes"
+	"context"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"maps"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"os"
+	"path/filepath"
+	"slices"
+	"strings"
+	"sync/atomic"
+	"testing"
+
+	"github.com/gillouche/container-factory/internal/catalog"
+	"github.com/gillouche/container-factory/internal/malware"
+	"github.com/gillouche/container-factory/internal/registry"
+	"github.com/gillouche/container-factory/internal/registry/memory"
+	"github.com/gillouche/container-factory/internal/registry/registrytest"
+)
+
+const testArtifacts = `{
+    "proxies": {
+        "https://proxy.invalid/repository/github-releases/": "https://github.com/",
+        "https://proxy.invalid/repository/nixos-releases/": "https://releases.nixos.org/"
+    },
+    "artifacts": [
+        {"name": "actions-runner", "url": "https://github.com/actions/runner/releases/download/v{version}/actions-runner-linux-*-{version}.tar.gz",
+         "purl": "pkg:github/actions/runner@v{version}", "files": ["home/runner/bin/Runner.Listener", "home/runner/bin/Runner.Worker"]},
+        {"name": "docker-buildx", "url": "https://github.com/docker/buildx/releases/download/v{version}/buildx-v{version}.linux-*",
+         "purl": "pkg:github/docker/buildx@v{version}", "installed": "usr/local/lib/docker/cli-plugins/docker-buildx"},
+        {"name": "nix", "url": "https://releases.nixos.org/nix/nix-{version}/install",
+         "purl": "pkg:generic/nix@{version}?download_url={url}", "files": ["nix/store/*-nix-{version}/bin/nix"]}
+    ]
+}`
+
+const runnerDockerfile = `FROM example.invalid/wolfi:latest AS build
+ARG TARGETARCH
+ARG VERSION=2.331.0
+ARG BUILDX_VERSION=0.31.1
+ARG DOWNLOAD_PROXY=proxy.invalid/repository
+RUN RUNNER_ARCH="${TARGETARCH}" \
+    && if [ "$RUNNER_ARCH" = "amd64" ]; then RUNNER_ARCH="x64"; fi \
+    && curl -f -L -o runner.tar.gz "https://${DOWNLOAD_PROXY}/github-releases/actions/runner/releases/download/v${VERSION}/actions-runner-linux-${RUNNER_ARCH}-${VERSION}.tar.gz" \
+    && tar xzf runner.tar.gz
+RUN curl -f -L -o /usr/local/lib/docker/cli-plugins/docker-buildx \
+    "https://${DOWNLOAD_PROXY}/github-releases/docker/buildx/releases/download/v${BUILDX_VERSION}/buildx-v${BUILDX_VERSION}.linux-${TARGETARCH}"
+RUN curl -f -L -o /usr/local/bin/tool "https://example.invalid/tool-1.0"
+FROM example.invalid/wolfi:latest
+`
+
+const nixDockerfile = `ARG VERSION=2.331.0
+FROM %s:${VERSION}
+ARG NIX_VERSION=2.33.2
+ARG DOWNLOAD_PROXY=proxy.invalid/repository
+RUN curl -sSf -L "https://${DOWNLOAD_PROXY}/nixos-releases/nix/nix-${NIX_VERSION}/install" | sh -s -- --no-daemon
+`
+
+// baseSBOM is the SBOM of the generator, which already has a guess at buildx.
+const baseSBOM = `{"bomFormat":"CycloneDX","specVersion":"1.6","metadata":{"component":{"bom-ref":"image","type":"container"}},"components":[{"bom-ref":"guess","type":"application","name":"buildx","purl":"pkg:github/docker/buildx@v0.31.1"}],"dependencies":[{"ref":"image","dependsOn":["guess"]}]}`
+
+const (
+	listener = "listener binary"
+	worker   = "worker binary"
+	buildx   = "buildx binary"
+)
+
+var testPlatform = registry.Platform{OS: "linux", Architecture: "amd64"}
+
+type staticSBOM string
+
+func (s staticSBOM) SBOM(context.Context, string) ([]byte, error) { return []byte(s), nil }
+
+// fixture is a runner image and a runner-nix image built FROM it, pushed
+// to an in-memory registry, with a download server standing in for the
+// proxy.
+type fixture struct {
+	cat     *catalog.Catalog
+	arts    *Artifacts
+	client  *registry.Client
+	repo    string
+	fetched *atomic.Int32
+	dlHost  string
+	sums    string
+	log     bytes.Buffer
+
+	runner, nix, bare registry.Ref
+}
+
+func newFixture(t *testing.T) *fixture {
+	t.Helper()
+	tmp := t.TempDir()
+	f := &fixture{client: &registry.Client{}, fetched: &atomic.Int32{}, sums: filepath.Join(tmp, "checksums.json")}
+
+	downloads := map[string]string{
+		"/repository/github-releases/actions/runner/releases/download/v2.331.0/actions-runner-linux-x64-2.331.0.tar.gz": "runner tarball",
+		"/repository/nixos-releases/nix/nix-2.33.2/install":                                                             "nix installer",
+	}
+	dl := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, req *http.Request) {
+		body, ok := downloads[req.URL.Path]
+		if !ok {
+			http.NotFound(w, req)
+			return
+		}
+		f.fetched.Add(1)
+		w.Write([]byte(body))
+	}))
+	t.Cleanup(dl.Close)
+	u, _ := url.Parse(dl.URL)
+	f.dlHost = u.Host
+
+	f.repo = strings.TrimSuffix(registrytest.Serve(t, memory.New()), "/image")
+	runnerRepo, nixRepo := f.repo+"/runner", f.repo+"/runner-nix"
+
+	rules := filepath.Join(tmp, "artifacts.json")
+	writeFile(t, rules, testArtifacts)
+	var err error
+	if f.arts, err = LoadArtifacts(rules); err != nil {
+		t.Fatal(err)
+	}
+	f.cat = &catalog.Catalog{}
+	for _, img := range []struct{ name, repo, dockerfile string }{
+		{"runner", runnerRepo, runnerDockerfile},
+		{"runner-nix", nixRepo, fmt.Sprintf(nixDockerfile, runnerRepo)},
+	} {
+		dir := filepath.Join(tmp, "images", img.name)
+		writeFile(t, filepath.Join(dir, "Dockerfile"), img.dockerfile)
+		writeFile(t, filepath.Join(dir, "VARIANTS"), "2.331.0\n")
+		loaded, err := catalog.Load(dir)
+		if err != nil {
+			t.Fatal(err)
+		}
+		loaded.Repository = img.repo
+		f.cat.Images = append(f.cat.Images, loaded)
+	}
+
+	runnerLayers := []map[string]string{{
+		"home/runner/bin/Runner.Listener":                listener,
+		"home/runner/bin/Runner.Worker":                  worker,
+		"home/runner/config.sh":                          "#!/bin/sh",
+		"usr/local/lib/docker/cli-plugins/docker-buildx": buildx,
+	}}
+	nixLayers := append(slices.Clone(runnerLayers), map[string]string{
+		"nix/store/0123abcd-nix-2.33.2/bin/nix": "nix binary",
+		"home/runner/bin/.wh.Runner.Worker":     "",
+	})
+	f.runner = pushLayers(t, f.client, runnerRepo, "2.331.0", runnerLayers)
+	f.nix = pushLayers(t, f.client, nixRepo, "2.331.0", nixLayers)
+	// An image without the buildx plugin, whose download is then reported
+	// missing rather than added.
+	f.bare = pushLayers(t, f.client, runnerRepo, "bare", []map[string]string{{"home/runner/bin/Runner.Listener": listener}})
+	return f
+}
+
+func (f *fixture) image(t *testing.T, name string) catalog.Image {
+	t.Helper()
+	img, ok := f.cat.Lookup(name)
+	if !ok {
+		t.Fatalf("no image %s", name)
+	}
+	return img
+}
+
+func (f *fixture) enricher() *Enricher {
+	return &Enricher{
+		Base:      staticSBOM(baseSBOM),
+		Catalog:   f.cat,
+		Artifacts: f.arts,
+		Registry:  f.client,
+		Platform:  testPlatform,
+		Checksums: &Checksums{Path: f.sums, HTTP: &http.Client{Transport: redirect(f.dlHost)}},
+		Log:       &f.log,
+	}
+}
+
+func TestDeclared(t *testing.T) {
+	f := newFixture(t)
+	got, skipped, err := f.arts.Declared(f.cat, f.image(t, "runner-nix"), "2.331.0", testPlatform)
+	if err != nil {
+		t.Fatal(err)
+	}
+	var names []string
+	for _, a := range got {
+		names = append(names, a.Rule.Name+"@"+a.Version)
+	}
+	if want := "actions-runner@2.331.0 docker-buildx@0.31.1 nix@2.33.2"; strings.Join(names, " ") != want {
+		t.Fatalf("declared %v, want %s", names, want)
+	}
+	if want := "https://github.com/actions/runner/releases/download/v2.331.0/actions-runner-linux-x64-2.331.0.tar.gz"; got[0].Upstream != want {
+		t.Errorf("runner upstream %s, want %s", got[0].Upstream, want)
+	}
+	if len(skipped) != 1 || !strings.Contains(skipped[0], "no artifact rule for https://example.invalid/tool-1.0") {
+		t.Errorf("skipped %q, want the tool download", skipped)
+	}
+}
+
+// TestEnricher enriches the SBOM of the runner-nix image with the
+// downloads of its Dockerfile and of the runner one.
+func TestEnricher(t *testing.T) {
+	ctx := context.Background()
+	f := newFixture(t)
+	e := f.enricher()
+	data, err := e.SBOM(ctx, f.nix.String())
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := e.Checksums.Save(); err != nil {
+		t.Fatal(err)
+	}
+	bom := decodeBOM(t, data)
+	bom.expect(t, "pkg:github/docker/buildx@v0.31.1", "guess", digestOf(buildx), "/usr/local/lib/docker/cli-plugins/docker-buildx")
+	// The worker is deleted by the nix image: only the listener is left.
+	bom.expect(t, "pkg:github/actions/runner@v2.331.0", "", digestOf("runner tarball"), "/home/runner/bin/Runner.Listener")
+	nixPURL := "pkg:generic/nix@2.33.2?download_url=" + url.QueryEscape("https://releases.nixos.org/nix/nix-2.33.2/install")
+	bom.expect(t, nixPURL, "", digestOf("nix installer"), "/nix/store/0123abcd-nix-2.33.2/bin/nix")
+	if n := len(bom.Components); n != 3 {
+		t.Errorf("%d components, want 3", n)
+	}
+	deps := bom.dependsOn("image")
+	for _, ref := range []string{"guess", "pkg:github/actions/runner@v2.331.0", nixPURL} {
+		if !slices.Contains(deps, ref) {
+			t.Errorf("image depends on %v, want %s", deps, ref)
+		}
+	}
+
+	// The saved checksums spare the downloads of the next SBOMs.
+	before := f.fetched.Load()
+	if data, err = f.enricher().SBOM(ctx, f.runner.String()); err != nil {
+		t.Fatal(err)
+	}
+	if n := f.fetched.Load() - before; n != 0 {
+		t.Errorf("%d downloads fetched again", n)
+	}
+	bom = decodeBOM(t, data)
+	bom.expect(t, "pkg:github/actions/runner@v2.331.0", "", digestOf("runner tarball"),
+		"/home/runner/bin/Runner.Listener", "/home/runner/bin/Runner.Worker")
+}
+
+func TestEnricherNotInImage(t *testing.T) {
+	ctx := context.Background()
+	f := newFixture(t)
+	layers, err := malware.RegistryLayers(ctx, f.client, f.bare, testPlatform)
+	if err != nil {
+		t.Fatal(err)
+	}
+	data, _, err := f.enricher().Enrich(ctx, []byte(`{"bomFormat":"CycloneDX","components":[]}`), f.image(t, "runner"), "2.331.0", layers)
+	if err != nil {
+		t.Fatal(err)
+	}
+	bom := decodeBOM(t, data)
+	if len(bom.Components) != 1 || bom.Components[0].Name != "actions-runner" {
+		t.Errorf("components %v, want only actions-runner", bom.Components)
+	}
+	if log := f.log.String(); !strings.Contains(log, "docker-buildx 0.31.1 (") || !strings.Contains(log, "is not in the image") {
+		t.Errorf("missing buildx not reported: %q", log)
+	}
+}
+
+func TestEnricherUnknownImage(t *testing.T) {
+	f := newFixture(t)
+	data, err := f.enricher().SBOM(context.Background(), f.repo+"/other@"+f.nix.Digest)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if string(data) != baseSBOM {
+		t.Error("SBOM of an image outside the catalog was changed")
+	}
+}
+
+// pushLayers pushes an image of tar layers holding the given files, oldest
+// first, and returns its digest reference.
+func pushLayers(t *testing.T, client *registry.Client, repo, tag string, layers []map[string]string) registry.Ref {
+	t.Helper()
+	ctx := context.Background()
+	ref, err := registry.ParseRef(repo + ":" + tag)
+	if err != nil {
+		t.Fatal(err)
+	}
+	config, err := client.PutBlob(ctx, ref, "application/vnd.oci.image.config.v1+json",
+		[]byte(`{"architecture":"amd64","os":"linux","rootfs":{"type":"layers","diff_ids":[]}}`))
+	if err != nil {
+		t.Fatal(err)
+	}
+	var descs []string
+	for _, files := range layers {
+		var buf bytes.Buffer
+		tw := tar.NewWriter(&buf)
+		for _, name := range slices.Sorted(maps.Keys(files)) {
+			if err := tw.WriteHeader(&tar.Header{Name: name, Mode: 0o755, Size: int64(len(files[name])), Typeflag: tar.TypeReg}); err != nil {
+				t.Fatal(err)
+			}
+			tw.Write([]byte(files[name]))
+		}
+		if err := tw.Close(); err != nil {
+			t.Fatal(err)
+		}
+		layer, err := client.PutBlob(ctx, ref, "application/vnd.oci.image.layer.v1.tar", buf.Bytes())
+		if err != nil {
+			t.Fatal(err)
+		}
+		descs = append(descs, fmt.Sprintf(`{"mediaType":%q,"digest":%q,"size":%d}`, layer.MediaType, layer.Digest, layer.Size))
+	}
+	m := fmt.Sprintf(`{"schemaVersion":2,"mediaType":%q,"config":{"mediaType":%q,"digest":%q,"size":%d},"layers":[%s]}`,
+		registry.MediaTypeManifest, config.MediaType, config.Digest, config.Size, strings.Join(descs, ","))
+	digest, err := client.PutManifest(ctx, ref, registry.MediaTypeManifest, []byte(m))
+	if err != nil {
+		t.Fatal(err)
+	}
+	ref.Tag, ref.Digest = "", digest
+	return ref
+}
+
+// redirect sends every request to host, over plain HTTP, standing in for
+// the download proxy.
+type redirect string
+
+func (r redirect) RoundTrip(req *http.Request) (*http.Response, error) {
+	req = req.Clone(req.Context())
+	req.URL.Scheme, req.URL.Host = "http", string(r)
+	return http.DefaultTransport.RoundTrip(req)
+}
+
+func writeFile(t *testing.T, path, content string) {
+	t.Helper()
+	if err := os.MkdirAll(filepath.Dir(path), 0o755); err != nil {
+		t.Fatal(err)
+	}
+	if err := os.WriteFile(path, []byte(content), 0o644); err != nil {
+		t.Fatal(err)
+	}
+}
+
+func digestOf(s string) string {
+	sum := sha256.Sum256([]byte(s))
+	return hex.EncodeToString(sum[:])
+}
+
+// cdxBOM is the part of a CycloneDX SBOM the tests look at.
+type cdxBOM struct {
+	Components []struct {
+		BOMRef string `json:"bom-ref"`
+		Name   string `json:"name"`
+		PURL   string `json:"purl"`
+		Hashes []struct {
+			Content string `json:"content"`
+		} `json:"hashes"`
+		Evidence struct {
+			Occurrences []struct {
+				Location string `json:"location"`
+			} `json:"occurrences"`
+		} `json:"evidence"`
+	} `json:"components"`
+	Dependencies []struct {
+		Ref       string   `json:"ref"`
+		DependsOn []string `json:"dependsOn"`
+	} `json:"dependencies"`
+}
+
+func decodeBOM(t *testing.T, data []byte) *cdxBOM {
+	t.Helper()
+	var bom cdxBOM
+	if err := json.Unmarshal(data, &bom); err != nil {
+		t.Fatalf("SBOM: %v", err)
+	}
+	return &bom
+}
+
+// expect checks the component of purl: its bom-ref (the purl when ref is
+// ""), digest and the files found.
+func (b *cdxBOM) expect(t *testing.T, purl, ref, sha256 string, files ...string) {
+	t.Helper()
+	if ref == "" {
+		ref = purl
+	}
+	for _, c := range b.Components {
+		if c.PURL != purl {
+			continue
+		}
+		var locations []string
+		for _, o := range c.Evidence.Occurrences {
+			locations = append(locations, o.Location)
+		}
+		switch {
+		case c.BOMRef != ref:
+			t.Errorf("%s: bom-ref %s, want %s", purl, c.BOMRef, ref)
+		case len(c.Hashes) != 1 || c.Hashes[0].Content != sha256:
+			t.Errorf("%s: hashes %v, want %s", purl, c.Hashes, sha256)
+		case !slices.Equal(locations, files):
+			t.Errorf("%s: found at %v, want %v", purl, locations, files)
+		}
+		return
+	}
+	t.Errorf("no component %s", purl)
+}
+
+func (b *cdxBOM) dependsOn(ref string) []string {
+	for _, d := range b.Dependencies {
+		if d.Ref == ref {
+			return d.DependsOn
+		}
+	}
+	return nil
+}
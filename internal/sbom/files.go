@@ -0,0 +1,140 @@
+package sbom
+
+import (
+	"archive/tar"
+	"crypto/sha256"
+	"encoding/hex"
+	"fmt"
+	"io"
+	"path"
+	"sort"
+	"strings"
+
+	"github.com/gillouche/container-factory/internal/malware"
+	"github.com/gillouche/container-factory/internal/registry"
+)
+
+// File is a file of an artifact found in an image.
+type File struct {
+	// Path is absolute: /usr/bin/docker.
+	Path   string
+	Size   int64
+	SHA256 string
+}
+
+// Locate finds the files of arts in layers, oldest first, as the image
+// has them once every layer is applied, whiteouts included. The files of
+// an artifact installed as is give it its digest.
+func Locate(layers []malware.Layer, arts []Artifact) error {
+	var patterns []string
+	for i := range arts {
+		patterns = append(patterns, arts[i].patterns()...)
+	}
+	files := map[string]File{}
+	for _, l := range layers {
+		if err := applyLayer(l, patterns, files); err != nil {
+			return fmt.Errorf("layer %d (%s): %w", l.Index, l.Digest, err)
+		}
+	}
+
+	for i := range arts {
+		a := &arts[i]
+		a.Files = nil
+		for _, p := range a.patterns() {
+			for name, f := range files {
+				if ok, _ := path.Match(p, name); ok {
+					a.Files = append(a.Files, f)
+				}
+			}
+		}
+		sort.Slice(a.Files, func(i, j int) bool { return a.Files[i].Path < a.Files[j].Path })
+		if a.Rule.Installed != "" {
+			if f, ok := files[strings.ReplaceAll(a.Rule.Installed, "{version}", a.Version)]; ok {
+				a.SHA256 = f.SHA256
+			}
+		}
+	}
+	return nil
+}
+
+// applyLayer applies the layer l to files, the digests of the files
+// matching patterns by path relative to the root.
+func applyLayer(l malware.Layer, patterns []string, files map[string]File) error {
+	blob, err := l.Open()
+	if err != nil {
+		return err
+	}
+	defer blob.Close()
+	stream, err := registry.Uncompressed(blob)
+	if err != nil {
+		return err
+	}
+	defer stream.Close()
+
+	tr := tar.NewReader(stream)
+	for {
+		hdr, err := tr.Next()
+		if err == io.EOF {
+			return nil
+		}
+		if err != nil {
+			return err
+		}
+		name := strings.TrimPrefix(path.Clean("/"+hdr.Name), "/")
+		if name == "" {
+			continue
+		}
+		dir, base := path.Split(name)
+		if base == ".wh..wh..opq" {
+			removeTree(files, strings.TrimSuffix(dir, "/"), false)
+			continue
+		}
+		if target, ok := strings.CutPrefix(base, ".wh."); ok {
+			removeTree(files, dir+target, true)
+			continue
+		}
+		// Directories merge with the lower layers, anything else replaces
+		// what was there.
+		if hdr.Typeflag == tar.TypeDir {
+			delete(files, name)
+		} else {
+			removeTree(files, name, true)
+		}
+
+		if !wanted(patterns, name) {
+			continue
+		}
+		switch hdr.Typeflag {
+		case tar.TypeReg:
+			h := sha256.New()
+			if _, err := io.Copy(h, tr); err != nil {
+				return err
+			}
+			files[name] = File{Path: "/" + name, Size: hdr.Size, SHA256: hex.EncodeToString(h.Sum(nil))}
+		case tar.TypeLink:
+			if f, ok := files[strings.TrimPrefix(path.Clean("/"+hdr.Linkname), "/")]; ok {
+				f.Path = "/" + name
+				files[name] = f
+			}
+		}
+	}
+}
+
+// removeTree removes the files under dir, and dir itself when self is
+// set.
+func removeTree(files map[string]File, dir string, self bool) {
+	for name := range files {
+		if (self && name == dir) || strings.HasPrefix(name, dir+"/") || dir == "" {
+			delete(files, name)
+		}
+	}
+}
+
+func wanted(patterns []string, name string) bool {
+	for _, p := range patterns {
+		if ok, _ := path.Match(p, name); ok {
+			return true
+		}
+	}
+	return false
+}
@@ -0,0 +1,49 @@
+package scorecard
+
+import (
+	"encoding/json"
+	"fmt"
+	"io"
+	"strings"
+)
+
+// JSON writes the cards as an indented JSON document.
+func JSON(w io.Writer, cards []Card) error {
+	enc := json.NewEncoder(w)
+	enc.SetIndent("", "  ")
+	return enc.Encode(map[string]any{"variants": cards})
+}
+
+// Markdown writes a summary table followed by the per-variant breakdown.
+func Markdown(w io.Writer, cards []Card) error {
+	var b strings.Builder
+	b.WriteString("# Image health scorecard\n\n")
+	b.WriteString("| Image | Variant | Score | Grade |")
+	for _, name := range Dimensions {
+		fmt.Fprintf(&b, " %s |", name)
+	}
+	b.WriteString("\n|---|---|---:|:-:|" + strings.Repeat("---:|", len(Dimensions)) + "\n")
+	for _, c := range cards {
+		fmt.Fprintf(&b, "| %s | %s | %.0f | %s |", c.Image, c.Variant, c.Score, c.Grade)
+		for _, name := range Dimensions {
+			d := c.Dimension(name)
+			if d.Known {
+				fmt.Fprintf(&b, " %.0f |", d.Score)
+			} else {
+				b.WriteString(" n/a |")
+			}
+		}
+		b.WriteString("\n")
+	}
+
+	b.WriteString("\n## Breakdown\n")
+	for _, c := range cards {
+		fmt.Fprintf(&b, "\n### %s:%s — %.0f (%s)\n\n", c.Image, c.Variant, c.Score, c.Grade)
+		for _, d := range c.Dimensions {
+			fmt.Fprintf(&b, "- **%s** (weight %.0f): %s\n", d.Name, d.Weight, d.Detail)
+		}
+	}
+
+	_, err := io.WriteString(w, b.String())
+	return err
+}
@@ -0,0 +1,326 @@
+// Package scorecard combines build history, scan results and image metadata
+// into a single 0-100 health score per image variant.
+//
+// Each dimension is scored 0-100 on its own and the total is the weighted
+// mean of the dimensions that could be evaluated, so a missing scan report
+// or an image without an upstream EOL does not drag the score down.
+package scorecard
+
+import (
+	"fmt"
+	"math"
+	"sort"
+	"strings"
+	"time"
+
+	"github.com/gillouche/container-factory/internal/catalog"
+	"github.com/gillouche/container-factory/internal/ledger"
+	"github.com/gillouche/container-factory/internal/vuln"
+)
+
+// Dimension names, in report order.
+const (
+	Rebuild     = "rebuild"
+	Base        = "base"
+	CVEs        = "cves"
+	EOL         = "eol"
+	Size        = "size"
+	SupplyChain = "supply-chain"
+	Smoke       = "smoke"
+)
+
+var weights = map[string]float64{
+	Rebuild:     15,
+	Base:        15,
+	CVEs:        25,
+	EOL:         15,
+	Size:        10,
+	SupplyChain: 10,
+	Smoke:       10,
+}
+
+// Dimensions lists the dimension names in report order.
+var Dimensions = []string{Rebuild, Base, CVEs, EOL, Size, SupplyChain, Smoke}
+
+// Input is everything known about one image variant.
+type Input struct {
+	Image   catalog.Image
+	Variant string
+	History []ledger.Record
+	Scan    *vuln.Report
+	// EOL is the end-of-life date of the variant's release cycle, zero when
+	// the image has none.
+	EOL time.Time
+	// CurrentBases maps base references to the digest they resolve to now.
+	// Nil when base images were not checked.
+	CurrentBases map[string]string
+	SmokeChecks  int
+	// Quarantined counts the smoke checks whose failures are let through,
+	// which check nothing meanwhile.
+	Quarantined int
+	Now         time.Time
+}
+
+// Dimension is the score of one aspect of a variant.
+type Dimension struct {
+	Name   string  `json:"name"`
+	Weight float64 `json:"weight"`
+	Known  bool    `json:"known"`
+	Score  float64 `json:"score"`
+	Detail string  `json:"detail"`
+}
+
+// Card is the scored result for one image variant.
+type Card struct {
+	Image      string      `json:"image"`
+	Variant    string      `json:"variant"`
+	Score      float64     `json:"score"`
+	Grade      string      `json:"grade"`
+	Dimensions []Dimension `json:"dimensions"`
+}
+
+// Dimension returns the named dimension of the card.
+func (c Card) Dimension(name string) Dimension {
+	for _, d := range c.Dimensions {
+		if d.Name == name {
+			return d
+		}
+	}
+	return Dimension{Name: name}
+}
+
+// Evaluate scores one variant.
+func Evaluate(in Input) Card {
+	card := Card{Image: in.Image.Name, Variant: in.Variant}
+
+	// last is the latest successful build; published is the latest one
+	// that was pushed, which is where the attestations live.
+	var last, published *ledger.Record
+	for i := len(in.History) - 1; i >= 0 && published == nil; i-- {
+		r := &in.History[i]
+		if r.Status != ledger.StatusSuccess {
+			continue
+		}
+		if last == nil {
+			last = r
+		}
+		if r.Pushed {
+			published = r
+		}
+	}
+
+	card.Dimensions = []Dimension{
+		rebuild(in, last),
+		base(in, last),
+		cves(in),
+		eol(in),
+		size(in),
+		supplyChain(published),
+		smoke(in),
+	}
+
+	var total, weight float64
+	for i := range card.Dimensions {
+		d := &card.Dimensions[i]
+		d.Weight = weights[d.Name]
+		if !d.Known {
+			d.Detail = "n/a: " + d.Detail
+			continue
+		}
+		d.Score = math.Round(d.Score)
+		total += d.Score * d.Weight
+		weight += d.Weight
+	}
+	if weight > 0 {
+		card.Score = math.Round(total / weight)
+	}
+	card.Grade = grade(card.Score)
+	return card
+}
+
+// Sort orders cards worst first, so the images needing attention lead.
+func Sort(cards []Card) {
+	sort.SliceStable(cards, func(i, j int) bool {
+		if cards[i].Score != cards[j].Score {
+			return cards[i].Score < cards[j].Score
+		}
+		if cards[i].Image != cards[j].Image {
+			return cards[i].Image < cards[j].Image
+		}
+		return cards[i].Variant < cards[j].Variant
+	})
+}
+
+func rebuild(in Input, last *ledger.Record) Dimension {
+	d := Dimension{Name: Rebuild, Known: true}
+	if last == nil {
+		d.Detail = "never built successfully"
+		return d
+	}
+	days := in.Now.Sub(last.Time).Hours() / 24
+	d.Score = linear(days, 7, 60)
+	d.Detail = fmt.Sprintf("last successful build %.0f days ago", days)
+	return d
+}
+
+func base(in Input, last *ledger.Record) Dimension {
+	d := Dimension{Name: Base}
+	switch {
+	case last == nil || len(last.Bases) == 0:
+		d.Detail = "no base digests recorded"
+		return d
+	case in.CurrentBases == nil:
+		d.Detail = "base images not checked"
+		return d
+	}
+
+	stale, checked := 0, 0
+	for _, b := range last.Bases {
+		current, ok := in.CurrentBases[b.Ref]
+		if !ok {
+			continue
+		}
+		checked++
+		if current != b.Digest {
+			stale++
+		}
+	}
+	if checked == 0 {
+		d.Detail = "base images could not be resolved"
+		return d
+	}
+	d.Known = true
+	d.Score = 100 * float64(checked-stale) / float64(checked)
+	d.Detail = fmt.Sprintf("%d of %d base images moved since last build", stale, checked)
+	return d
+}
+
+func cves(in Input) Dimension {
+	d := Dimension{Name: CVEs}
+	if in.Scan == nil {
+		d.Detail = "no scan report"
+		return d
+	}
+	c := in.Scan.Counts()
+	penalty := 40*float64(c["CRITICAL"]) + 15*float64(c["HIGH"]) + 3*float64(c["MEDIUM"]) + 0.5*float64(c["LOW"])
+	d.Known = true
+	d.Score = math.Max(0, 100-penalty)
+	d.Detail = fmt.Sprintf("%d critical, %d high, %d medium, %d low", c["CRITICAL"], c["HIGH"], c["MEDIUM"], c["LOW"])
+	return d
+}
+
+func eol(in Input) Dimension {
+	d := Dimension{Name: EOL}
+	if in.EOL.IsZero() {
+		d.Detail = "no end-of-life date"
+		return d
+	}
+	days := in.EOL.Sub(in.Now).Hours() / 24
+	d.Known = true
+	d.Score = 100 - linear(days, 0, 365)
+	if days < 0 {
+		d.Detail = fmt.Sprintf("end of life since %s", in.EOL.Format(time.DateOnly))
+	} else {
+		d.Detail = fmt.Sprintf("end of life in %.0f days (%s)", days, in.EOL.Format(time.DateOnly))
+	}
+	return d
+}
+
+// size compares the latest image size with the oldest one built in the last
+// 90 days; growing by a quarter or more scores zero.
+func size(in Input) Dimension {
+	d := Dimension{Name: Size}
+	var sized []ledger.Record
+	for _, r := range in.History {
+		if r.Status == ledger.StatusSuccess && r.Size > 0 && in.Now.Sub(r.Time) <= 90*24*time.Hour {
+			sized = append(sized, r)
+		}
+	}
+	if len(sized) < 2 {
+		d.Detail = "not enough sized builds"
+		return d
+	}
+	first, latest := sized[0].Size, sized[len(sized)-1].Size
+	growth := float64(latest-first) / float64(first)
+	d.Known = true
+	d.Score = linear(growth, 0, 0.25)
+	d.Detail = fmt.Sprintf("%+.1f%% over 90 days (%s)", growth*100, humanBytes(latest))
+	return d
+}
+
+func supplyChain(last *ledger.Record) Dimension {
+	d := Dimension{Name: SupplyChain}
+	if last == nil {
+		d.Detail = "no published build"
+		return d
+	}
+	var missing []string
+	for _, a := range []struct {
+		name    string
+		present bool
+	}{{"signature", last.Signed}, {"sbom", last.SBOM}, {"provenance", last.Provenance}} {
+		if !a.present {
+			missing = append(missing, a.name)
+		}
+	}
+	d.Known = true
+	d.Score = 100 * float64(3-len(missing)) / 3
+	if len(missing) == 0 {
+		d.Detail = "signed, sbom and provenance attached"
+	} else {
+		d.Detail = "missing " + strings.Join(missing, ", ")
+	}
+	return d
+}
+
+func smoke(in Input) Dimension {
+	d := Dimension{Name: Smoke, Known: true}
+	if in.SmokeChecks == 0 {
+		d.Detail = "no test.sh"
+		return d
+	}
+	d.Score = 20 * math.Min(float64(max(in.SmokeChecks-in.Quarantined, 0)), 5)
+	d.Detail = fmt.Sprintf("%d smoke checks", in.SmokeChecks)
+	if in.Quarantined > 0 {
+		d.Detail += fmt.Sprintf(", %d quarantined", in.Quarantined)
+	}
+	return d
+}
+
+// linear maps x to 100 at or below good and 0 at or above bad.
+func linear(x, good, bad float64) float64 {
+	switch {
+	case x <= good:
+		return 100
+	case x >= bad:
+		return 0
+	}
+	return 100 * (bad - x) / (bad - good)
+}
+
+func grade(score float64) string {
+	switch {
+	case score >= 90:
+		return "A"
+	case score >= 75:
+		return "B"
+	case score >= 60:
+		return "C"
+	case score >= 40:
+		return "D"
+	}
+	return "F"
+}
+
+func humanBytes(n int64) string {
+	const unit = 1024
+	if n < unit {
+		return fmt.Sprintf("%d B", n)
+	}
+	div, exp := int64(unit), 0
+	for m := n / unit; m >= unit; m /= unit {
+		div *= unit
+		exp++
+	}
+	return fmt.Sprintf("%.1f %ciB", float64(n)/float64(div), "KMGTPE"[exp])
+}
@@ -0,0 +1,139 @@
+// Package secrets is the factory credential store. Credentials needed at build
+// time are declared in ci/factory.json and handed to BuildKit as secret
+// mounts, so they never end up in build args, the image config or the layer
+// history:
+//
+//	"secrets": [
+//	    {"id": "nexus-netrc", "type": "netrc", "host": "nexus.gillouche.homelab",
+//	     "user_env": "NEXUS_USERNAME", "password_env": "NEXUS_PASSWORD"}
+//	]
+//
+// Dockerfiles consume them with RUN --mount=type=secret,id=nexus-netrc.
+package secrets
+
+import (
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+
+	"github.com/gillouche/container-factory/internal/registry"
+)
+
+// ErrUnavailable means the credentials of a secret are not set in this
+// environment.
+var ErrUnavailable = errors.New("credentials not available")
+
+// Source describes where the value of a secret comes from.
+type Source struct {
+	ID string `json:"id"`
+	// Type is "netrc", "token" or "file".
+	Type string `json:"type"`
+	// Host is the netrc machine. When user_env or password_env are not set,
+	// the docker login of Host is used instead.
+	Host        string `json:"host,omitempty"`
+	UserEnv     string `json:"user_env,omitempty"`
+	PasswordEnv string `json:"password_env,omitempty"`
+	// Env names the environment variable holding a token.
+	Env string `json:"env,omitempty"`
+	// File is the path of a file secret, copied as is.
+	File string `json:"file,omitempty"`
+}
+
+// Value returns the content of the secret.
+func (s Source) Value() ([]byte, error) {
+	switch s.Type {
+	case "netrc":
+		user, pass := s.login()
+		if user == "" || pass == "" {
+			return nil, fmt.Errorf("%s: %w", s.ID, ErrUnavailable)
+		}
+		return fmt.Appendf(nil, "machine %s\nlogin %s\npassword %s\n", s.Host, user, pass), nil
+	case "token":
+		v := getenv(s.Env)
+		if v == "" {
+			return nil, fmt.Errorf("%s: %w", s.ID, ErrUnavailable)
+		}
+		return []byte(v), nil
+	case "file":
+		data, err := os.ReadFile(s.File)
+		if os.IsNotExist(err) {
+			return nil, fmt.Errorf("%s: %w", s.ID, ErrUnavailable)
+		}
+		return data, err
+	}
+	return nil, fmt.Errorf("%s: unknown secret type %q", s.ID, s.Type)
+}
+
+func (s Source) login() (user, pass string) {
+	user, pass = getenv(s.UserEnv), getenv(s.PasswordEnv)
+	if user == "" || pass == "" {
+		user, pass = registry.DockerCredentials(s.Host)
+	}
+	return user, pass
+}
+
+// Store is the set of configured secrets.
+type Store []Source
+
+// Lookup returns the source of the secret id.
+func (st Store) Lookup(id string) (Source, bool) {
+	for _, s := range st {
+		if s.ID == id {
+			return s, true
+		}
+	}
+	return Source{}, false
+}
+
+// Login returns the credentials of the first netrc secret of host, so tools
+// can reach the same servers as the builds.
+func (st Store) Login(host string) (user, pass string, ok bool) {
+	for _, s := range st {
+		if s.Type == "netrc" && s.Host == host {
+			if user, pass = s.login(); user != "" && pass != "" {
+				return user, pass, true
+			}
+		}
+	}
+	return "", "", false
+}
+
+// Mount is a secret written out for a build.
+type Mount struct {
+	ID   string
+	Path string
+}
+
+// Flag is the docker buildx build flag exposing the mount.
+func (m Mount) Flag() string {
+	return fmt.Sprintf("--secret=id=%s,src=%s", m.ID, m.Path)
+}
+
+// Provision writes the secret id to a file only the current user can read in
+// dir, which the caller removes once the build is done.
+func (st Store) Provision(dir, id string) (Mount, error) {
+	src, ok := st.Lookup(id)
+	if !ok {
+		return Mount{}, fmt.Errorf("%s: not in the credential store: %w", id, ErrUnavailable)
+	}
+	value, err := src.Value()
+	if err != nil {
+		return Mount{}, err
+	}
+	if err := os.MkdirAll(dir, 0o700); err != nil {
+		return Mount{}, err
+	}
+	path := filepath.Join(dir, id)
+	if err := os.WriteFile(path, value, 0o600); err != nil {
+		return Mount{}, err
+	}
+	return Mount{ID: id, Path: path}, nil
+}
+
+func getenv(name string) string {
+	if name == "" {
+		return ""
+	}
+	return os.Getenv(name)
+}
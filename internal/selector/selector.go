@@ -0,0 +1,200 @@
+// Package selector resolves image selector expressions, the shared way the
+// factory commands and make targets pick the images they work on.
+//
+// An expression is a list of terms separated by commas or spaces; the result
+// is the union of the terms. Each term is one or more conditions joined by &,
+// all of which must hold:
+//
+//	python-distroless        image name
+//	*-distroless             name glob
+//	family=distroless        LABELS entry (the value may be a glob)
+//	root=bootstrap           image root, set implicitly for every image
+//	all                      every image
+//
+// A term may be expanded along the build graph and may exclude images:
+//
+//	tls-bundle+              tls-bundle and every image built on it
+//	+actions-runner          actions-runner and the images it is built from
+//	!base=ubuntu             remove matches (applied after the other terms)
+//
+// Images are returned in build order: dependency level, then name.
+package selector
+
+import (
+	"fmt"
+	"path"
+	"sort"
+	"strings"
+
+	"github.com/gillouche/container-factory/internal/catalog"
+)
+
+type cond struct {
+	key     string // empty for the image name
+	pattern string
+}
+
+type term struct {
+	text       string
+	exclude    bool
+	deps       bool
+	dependents bool
+	conds      []cond
+}
+
+// Selector is a parsed expression.
+type Selector struct {
+	terms []term
+}
+
+// Parse parses a selector expression.
+func Parse(expr string) (*Selector, error) {
+	fields := strings.FieldsFunc(expr, func(r rune) bool { return r == ',' || r == ' ' || r == '\t' || r == '\n' })
+	if len(fields) == 0 {
+		return nil, fmt.Errorf("empty selector")
+	}
+
+	s := &Selector{}
+	for _, f := range fields {
+		t := term{text: f}
+		if strings.HasPrefix(f, "!") {
+			t.exclude, f = true, f[1:]
+		}
+		if strings.HasPrefix(f, "+") {
+			t.deps, f = true, f[1:]
+		}
+		if strings.HasSuffix(f, "+") {
+			t.dependents, f = true, f[:len(f)-1]
+		}
+		for _, c := range strings.Split(f, "&") {
+			key, pattern, ok := strings.Cut(c, "=")
+			if !ok {
+				key, pattern = "", c
+			}
+			if pattern == "" || (ok && key == "") {
+				return nil, fmt.Errorf("invalid selector term %q", t.text)
+			}
+			if _, err := path.Match(pattern, ""); err != nil {
+				return nil, fmt.Errorf("invalid selector term %q: %w", t.text, err)
+			}
+			if key == "name" {
+				key = ""
+			}
+			t.conds = append(t.conds, cond{key: key, pattern: pattern})
+		}
+		s.terms = append(s.terms, t)
+	}
+	return s, nil
+}
+
+// Resolve returns the images matching the selector in build order. A term
+// that matches no image is an error, so typos do not silently select nothing.
+func (s *Selector) Resolve(cat *catalog.Catalog) ([]catalog.Image, error) {
+	deps := cat.Deps()
+	levels, err := catalog.Levels(deps)
+	if err != nil {
+		return nil, err
+	}
+	dependents := cat.Dependents()
+
+	selected := map[string]bool{}
+	excluded := map[string]bool{}
+	onlyExclusions := true
+	for _, t := range s.terms {
+		matched := map[string]bool{}
+		for _, img := range cat.Images {
+			if t.match(img) {
+				matched[img.Name] = true
+			}
+		}
+		if len(matched) == 0 {
+			return nil, fmt.Errorf("selector %q matches no image", t.text)
+		}
+		if t.deps {
+			closure(matched, deps)
+		}
+		if t.dependents {
+			closure(matched, dependents)
+		}
+
+		target := selected
+		if t.exclude {
+			target = excluded
+		} else {
+			onlyExclusions = false
+		}
+		for name := range matched {
+			target[name] = true
+		}
+	}
+
+	// "!family=runner" on its own means everything except the runners.
+	if onlyExclusions {
+		for _, img := range cat.Images {
+			selected[img.Name] = true
+		}
+	}
+
+	var out []catalog.Image
+	for _, img := range cat.Images {
+		if selected[img.Name] && !excluded[img.Name] {
+			out = append(out, img)
+		}
+	}
+	sort.SliceStable(out, func(i, j int) bool {
+		if levels[out[i].Name] != levels[out[j].Name] {
+			return levels[out[i].Name] < levels[out[j].Name]
+		}
+		return out[i].Name < out[j].Name
+	})
+	return out, nil
+}
+
+// Select parses expr and resolves it against cat.
+func Select(cat *catalog.Catalog, expr string) ([]catalog.Image, error) {
+	s, err := Parse(expr)
+	if err != nil {
+		return nil, err
+	}
+	return s.Resolve(cat)
+}
+
+func (t term) match(img catalog.Image) bool {
+	for _, c := range t.conds {
+		var value string
+		switch {
+		case c.key == "" && c.pattern == "all":
+			continue
+		case c.key == "":
+			value = img.Name
+		default:
+			v, ok := img.Labels[c.key]
+			if !ok {
+				return false
+			}
+			value = v
+		}
+		if ok, _ := path.Match(c.pattern, value); !ok {
+			return false
+		}
+	}
+	return true
+}
+
+// closure adds everything reachable from set through edges.
+func closure(set map[string]bool, edges map[string][]string) {
+	queue := make([]string, 0, len(set))
+	for name := range set {
+		queue = append(queue, name)
+	}
+	for len(queue) > 0 {
+		name := queue[0]
+		queue = queue[1:]
+		for _, next := range edges[name] {
+			if !set[next] {
+				set[next] = true
+				queue = append(queue, next)
+			}
+		}
+	}
+}
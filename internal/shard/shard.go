@@ -0,0 +1,198 @@
+// Package shard packs the variants of each build level into a fixed number
+// of jobs, using the durations of past builds, so that a level takes as
+// long as its longest shard and no longer than it has to: a runner image
+// gets a job of its own while the distroless variants share one.
+package shard
+
+import (
+	"fmt"
+	"slices"
+	"sort"
+	"strings"
+	"time"
+
+	"github.com/gillouche/container-factory/internal/ledger"
+)
+
+// Build is one variant to build.
+type Build struct {
+	Image   string
+	Version string
+	// Runner is the runner label the build needs.
+	Runner   string
+	Estimate time.Duration
+}
+
+func (b Build) String() string { return b.Image + ":" + b.Version }
+
+// Shard is one job of a build level, building its variants in turn.
+type Shard struct {
+	Level  int
+	Index  int
+	Runner string
+	Builds []Build
+	// Estimate is the sum of the estimates of the builds.
+	Estimate time.Duration
+}
+
+// Name identifies the shard in the workflow, e.g. L2-1.
+func (s Shard) Name() string { return fmt.Sprintf("L%d-%d", s.Level, s.Index) }
+
+// Estimates predicts build durations from the ledger: the median of the
+// last Window builds of the variant, else of the image, else Default.
+type Estimates struct {
+	Window  int
+	Default time.Duration
+
+	variants map[string][]time.Duration
+	images   map[string][]time.Duration
+}
+
+// FromLedger collects the recorded durations of l.
+func FromLedger(l *ledger.Ledger, window int, def time.Duration) *Estimates {
+	e := &Estimates{Window: window, Default: def,
+		variants: map[string][]time.Duration{}, images: map[string][]time.Duration{}}
+	for _, r := range l.Records {
+		if r.Duration <= 0 {
+			continue
+		}
+		d := time.Duration(r.Duration * float64(time.Second))
+		key := r.Image + ":" + r.Variant
+		e.variants[key] = append(e.variants[key], d)
+		e.images[r.Image] = append(e.images[r.Image], d)
+	}
+	return e
+}
+
+// Estimate returns the expected duration of a build of image:version.
+func (e *Estimates) Estimate(image, version string) time.Duration {
+	if d, ok := median(e.variants[image+":"+version], e.Window); ok {
+		return d
+	}
+	if d, ok := median(e.images[image], e.Window); ok {
+		return d
+	}
+	return e.Default
+}
+
+// median of the last window durations (oldest first), all when window is 0.
+func median(ds []time.Duration, window int) (time.Duration, bool) {
+	if len(ds) == 0 {
+		return 0, false
+	}
+	if window > 0 && len(ds) > window {
+		ds = ds[len(ds)-window:]
+	}
+	s := slices.Clone(ds)
+	slices.Sort(s)
+	if len(s)%2 == 1 {
+		return s[len(s)/2], true
+	}
+	return (s[len(s)/2-1] + s[len(s)/2]) / 2, true
+}
+
+// Pack distributes the builds of a level over at most n shards, never
+// fewer than one per runner the builds need. Shards go to the runners in
+// proportion to their share of the work, then each runner's builds are
+// assigned longest first to its least loaded shard, which keeps the
+// longest shard of a runner within 4/3 of the best possible.
+func Pack(level int, builds []Build, n int) []Shard {
+	byRunner := map[string][]Build{}
+	var runners []string
+	for _, b := range builds {
+		if _, ok := byRunner[b.Runner]; !ok {
+			runners = append(runners, b.Runner)
+		}
+		byRunner[b.Runner] = append(byRunner[b.Runner], b)
+	}
+	sort.Strings(runners)
+
+	// One shard per runner, then the rest to the runner whose shards would
+	// otherwise carry the most work each.
+	alloc := map[string]int{}
+	for _, r := range runners {
+		alloc[r] = 1
+	}
+	for spare := n - len(runners); spare > 0; spare-- {
+		best := ""
+		var bestLoad time.Duration
+		for _, r := range runners {
+			if alloc[r] >= len(byRunner[r]) {
+				continue
+			}
+			if load := total(byRunner[r]) / time.Duration(alloc[r]); best == "" || load > bestLoad {
+				best, bestLoad = r, load
+			}
+		}
+		if best == "" {
+			break
+		}
+		alloc[best]++
+	}
+
+	var out []Shard
+	for _, r := range runners {
+		bs := slices.Clone(byRunner[r])
+		sort.SliceStable(bs, func(i, j int) bool {
+			if bs[i].Estimate != bs[j].Estimate {
+				return bs[i].Estimate > bs[j].Estimate
+			}
+			return bs[i].String() < bs[j].String()
+		})
+		shards := make([]Shard, alloc[r])
+		for _, b := range bs {
+			least := 0
+			for i := range shards {
+				if shards[i].Estimate < shards[least].Estimate {
+					least = i
+				}
+			}
+			shards[least].Builds = append(shards[least].Builds, b)
+			shards[least].Estimate += b.Estimate
+		}
+		for _, s := range shards {
+			if len(s.Builds) == 0 {
+				continue
+			}
+			s.Level, s.Runner = level, r
+			out = append(out, s)
+		}
+	}
+	sort.SliceStable(out, func(i, j int) bool { return out[i].Estimate > out[j].Estimate })
+	for i := range out {
+		out[i].Index = i + 1
+	}
+	return out
+}
+
+func total(bs []Build) time.Duration {
+	var t time.Duration
+	for _, b := range bs {
+		t += b.Estimate
+	}
+	return t
+}
+
+// WallTime is the expected duration of the shards of one or more levels:
+// the levels run one after the other, the shards of a level side by side.
+func WallTime(shards []Shard) time.Duration {
+	longest := map[int]time.Duration{}
+	for _, s := range shards {
+		longest[s.Level] = max(longest[s.Level], s.Estimate)
+	}
+	var t time.Duration
+	for _, d := range longest {
+		t += d
+	}
+	return t
+}
+
+// BuildList returns the space-separated image:version list of the shard,
+// the form the build workflow loops over.
+func (s Shard) BuildList() string {
+	names := make([]string, len(s.Builds))
+	for i, b := range s.Builds {
+		names[i] = b.String()
+	}
+	return strings.Join(names, " ")
+}
@@ -0,0 +1,250 @@
+package signing
+
+import (
+	"bytes"
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"math"
+)
+
+// The subset of CBOR (RFC 8949) COSE envelopes are made of: integers, byte
+// and text strings, arrays, maps and tags, all of definite length.
+
+// cborMap is a CBOR map in encoding order. Keys are int64 or string.
+type cborMap []cborEntry
+
+type cborEntry struct {
+	Key   any
+	Value any
+}
+
+// get returns the value of key.
+func (m cborMap) get(key any) (any, bool) {
+	for _, e := range m {
+		if e.Key == key {
+			return e.Value, true
+		}
+	}
+	return nil, false
+}
+
+// cborTag is a tagged item.
+type cborTag struct {
+	Number uint64
+	Value  any
+}
+
+const (
+	cborUint = iota
+	cborNegint
+	cborBytes
+	cborText
+	cborArray
+	cborMapType
+	cborTagType
+	cborSimple
+)
+
+func cborEncode(v any) ([]byte, error) {
+	var b bytes.Buffer
+	if err := cborWrite(&b, v); err != nil {
+		return nil, err
+	}
+	return b.Bytes(), nil
+}
+
+func cborWrite(b *bytes.Buffer, v any) error {
+	switch v := v.(type) {
+	case int:
+		return cborWrite(b, int64(v))
+	case int64:
+		if v < 0 {
+			cborHead(b, cborNegint, uint64(-1-v))
+		} else {
+			cborHead(b, cborUint, uint64(v))
+		}
+	case uint64:
+		cborHead(b, cborUint, v)
+	case []byte:
+		cborHead(b, cborBytes, uint64(len(v)))
+		b.Write(v)
+	case string:
+		cborHead(b, cborText, uint64(len(v)))
+		b.WriteString(v)
+	case []any:
+		cborHead(b, cborArray, uint64(len(v)))
+		for _, e := range v {
+			if err := cborWrite(b, e); err != nil {
+				return err
+			}
+		}
+	case cborMap:
+		cborHead(b, cborMapType, uint64(len(v)))
+		for _, e := range v {
+			if err := cborWrite(b, e.Key); err != nil {
+				return err
+			}
+			if err := cborWrite(b, e.Value); err != nil {
+				return err
+			}
+		}
+	case cborTag:
+		cborHead(b, cborTagType, v.Number)
+		return cborWrite(b, v.Value)
+	default:
+		return fmt.Errorf("cbor: cannot encode %T", v)
+	}
+	return nil
+}
+
+func cborHead(b *bytes.Buffer, major byte, n uint64) {
+	m := major << 5
+	switch {
+	case n < 24:
+		b.WriteByte(m | byte(n))
+	case n <= math.MaxUint8:
+		b.Write([]byte{m | 24, byte(n)})
+	case n <= math.MaxUint16:
+		b.WriteByte(m | 25)
+		b.Write(binary.BigEndian.AppendUint16(nil, uint16(n)))
+	case n <= math.MaxUint32:
+		b.WriteByte(m | 26)
+		b.Write(binary.BigEndian.AppendUint32(nil, uint32(n)))
+	default:
+		b.WriteByte(m | 27)
+		b.Write(binary.BigEndian.AppendUint64(nil, n))
+	}
+}
+
+// cborDecode decodes a single item filling all of data. Integers decode as
+// int64, maps as cborMap and tags as cborTag.
+func cborDecode(data []byte) (any, error) {
+	d := &cborDecoder{data: data}
+	v, err := d.item(0)
+	if err != nil {
+		return nil, err
+	}
+	if d.off != len(d.data) {
+		return nil, errors.New("cbor: trailing data")
+	}
+	return v, nil
+}
+
+type cborDecoder struct {
+	data []byte
+	off  int
+}
+
+// cborMaxDepth bounds the nesting of hostile input.
+const cborMaxDepth = 16
+
+func (d *cborDecoder) item(depth int) (any, error) {
+	if depth > cborMaxDepth {
+		return nil, errors.New("cbor: nested too deeply")
+	}
+	major, n, err := d.head()
+	if err != nil {
+		return nil, err
+	}
+	switch major {
+	case cborUint:
+		if n > math.MaxInt64 {
+			return nil, errors.New("cbor: integer overflow")
+		}
+		return int64(n), nil
+	case cborNegint:
+		if n > math.MaxInt64 {
+			return nil, errors.New("cbor: integer overflow")
+		}
+		return -1 - int64(n), nil
+	case cborBytes, cborText:
+		if n > uint64(len(d.data)-d.off) {
+			return nil, errors.New("cbor: truncated string")
+		}
+		s := d.data[d.off : d.off+int(n)]
+		d.off += int(n)
+		if major == cborText {
+			return string(s), nil
+		}
+		return bytes.Clone(s), nil
+	case cborArray:
+		if n > uint64(len(d.data)-d.off) {
+			return nil, errors.New("cbor: truncated array")
+		}
+		a := make([]any, 0, n)
+		for range n {
+			v, err := d.item(depth + 1)
+			if err != nil {
+				return nil, err
+			}
+			a = append(a, v)
+		}
+		return a, nil
+	case cborMapType:
+		if n > uint64(len(d.data)-d.off) {
+			return nil, errors.New("cbor: truncated map")
+		}
+		m := make(cborMap, 0, n)
+		for range n {
+			k, err := d.item(depth + 1)
+			if err != nil {
+				return nil, err
+			}
+			switch k.(type) {
+			case int64, string:
+			default:
+				return nil, fmt.Errorf("cbor: unsupported map key %T", k)
+			}
+			v, err := d.item(depth + 1)
+			if err != nil {
+				return nil, err
+			}
+			m = append(m, cborEntry{Key: k, Value: v})
+		}
+		return m, nil
+	case cborTagType:
+		v, err := d.item(depth + 1)
+		if err != nil {
+			return nil, err
+		}
+		return cborTag{Number: n, Value: v}, nil
+	}
+	return nil, errors.New("cbor: floats and simple values are not supported")
+}
+
+func (d *cborDecoder) head() (byte, uint64, error) {
+	if d.off >= len(d.data) {
+		return 0, 0, errors.New("cbor: unexpected end of data")
+	}
+	b := d.data[d.off]
+	d.off++
+	major, info := b>>5, b&0x1f
+	if major == cborSimple {
+		return major, 0, nil
+	}
+	size := 0
+	switch {
+	case info < 24:
+		return major, uint64(info), nil
+	case info == 24:
+		size = 1
+	case info == 25:
+		size = 2
+	case info == 26:
+		size = 4
+	case info == 27:
+		size = 8
+	default:
+		return 0, 0, errors.New("cbor: indefinite lengths are not supported")
+	}
+	if len(d.data)-d.off < size {
+		return 0, 0, errors.New("cbor: truncated header")
+	}
+	var n uint64
+	for _, c := range d.data[d.off : d.off+size] {
+		n = n<<8 | uint64(c)
+	}
+	d.off += size
+	return major, n, nil
+}
@@ -0,0 +1,116 @@
+package signing
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"strings"
+
+	"github.com/gillouche/container-factory/internal/registry"
+)
+
+// Media type and annotation of cosign signature layers.
+const (
+	MediaTypeSimpleSigning = "application/vnd.dev.cosign.simplesigning.v1+json"
+	AnnotationSignature    = "dev.cosignproject.cosign/signature"
+)
+
+// SignatureTag returns the tag cosign stores the signatures of digest under.
+func SignatureTag(digest string) string {
+	return strings.Replace(digest, ":", "-", 1) + ".sig"
+}
+
+// Signatures fetches the signatures attached to ref's digest. An image
+// without signatures yields none.
+func Signatures(ctx context.Context, c *registry.Client, ref registry.Ref) ([]Signature, error) {
+	m, err := signatureManifest(ctx, c, ref)
+	if err != nil || m == nil {
+		return nil, err
+	}
+	var sigs []Signature
+	for _, l := range m.Layers {
+		if l.MediaType != MediaTypeSimpleSigning {
+			continue
+		}
+		payload, err := c.Blob(ctx, ref, l.Digest)
+		if err != nil {
+			return nil, err
+		}
+		sigs = append(sigs, Signature{Payload: payload, Signature: l.Annotations[AnnotationSignature]})
+	}
+	return sigs, nil
+}
+
+// Attach adds sig to the signatures of ref's digest, keeping existing ones,
+// as cosign sign does.
+func Attach(ctx context.Context, c *registry.Client, ref registry.Ref, sig Signature) error {
+	m, err := signatureManifest(ctx, c, ref)
+	if err != nil {
+		return err
+	}
+	if m == nil {
+		m = &registry.Manifest{SchemaVersion: 2, MediaType: registry.MediaTypeManifest}
+	}
+
+	layer, err := c.PutBlob(ctx, ref, MediaTypeSimpleSigning, sig.Payload)
+	if err != nil {
+		return err
+	}
+	layer.Annotations = map[string]string{AnnotationSignature: sig.Signature}
+	for _, l := range m.Layers {
+		if l.Digest == layer.Digest && l.Annotations[AnnotationSignature] == sig.Signature {
+			return nil
+		}
+	}
+	m.Layers = append(m.Layers, layer)
+
+	// cosign writes a minimal image config listing the layers as diff IDs.
+	config := map[string]any{
+		"architecture": "",
+		"os":           "",
+		"config":       map[string]any{},
+		"rootfs":       map[string]any{"type": "layers", "diff_ids": diffIDs(m.Layers)},
+	}
+	data, err := json.Marshal(config)
+	if err != nil {
+		return err
+	}
+	if m.Config, err = c.PutBlob(ctx, ref, "application/vnd.oci.image.config.v1+json", data); err != nil {
+		return err
+	}
+
+	manifest, err := json.Marshal(m)
+	if err != nil {
+		return err
+	}
+	sigRef := registry.Ref{Registry: ref.Registry, Repository: ref.Repository, Tag: SignatureTag(ref.Digest)}
+	_, err = c.PutManifest(ctx, sigRef, registry.MediaTypeManifest, manifest)
+	return err
+}
+
+func signatureManifest(ctx context.Context, c *registry.Client, ref registry.Ref) (*registry.Manifest, error) {
+	if ref.Digest == "" {
+		return nil, fmt.Errorf("%s: signatures need a digest reference", ref)
+	}
+	sigRef := registry.Ref{Registry: ref.Registry, Repository: ref.Repository, Tag: SignatureTag(ref.Digest)}
+	data, _, _, err := c.Manifest(ctx, sigRef)
+	if registry.IsNotFound(err) {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+	var m registry.Manifest
+	if err := json.Unmarshal(data, &m); err != nil {
+		return nil, fmt.Errorf("%s: %w", sigRef, err)
+	}
+	return &m, nil
+}
+
+func diffIDs(layers []registry.Descriptor) []string {
+	ids := make([]string, len(layers))
+	for i, l := range layers {
+		ids[i] = l.Digest
+	}
+	return ids
+}
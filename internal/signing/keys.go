@@ -0,0 +1,341 @@
+// Package signing manages the factory's image signing keys and produces and
+// verifies cosign-compatible signatures with them.
+//
+// Public keys are listed in the trusted-keys file (ci/trusted-keys.json),
+// committed with the repository. Each key has a validity window bounding when
+// it may sign; rotating adds a new key and shortens the window of the old one
+// to an overlap period, during which signatures of both verify. A revoked key
+// invalidates every signature it made. Private keys stay out of the tree: in
+// $FACTORY_SIGNING_KEY (PEM, as in CI) or under <state>/keys.
+//
+// Images can also be signed in the Notary Project format (Notation), which
+// needs an X.509 certificate: each key carries a self-signed one covering
+// its window, and ci/notation/trustpolicy.json decides which signatures
+// verify.
+package signing
+
+import (
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/rand"
+	"crypto/sha256"
+	"crypto/x509"
+	"crypto/x509/pkix"
+	"encoding/hex"
+	"encoding/json"
+	"encoding/pem"
+	"errors"
+	"fmt"
+	"math/big"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+	"time"
+)
+
+// KeyEnv holds the PEM private key used for signing in CI.
+const KeyEnv = "FACTORY_SIGNING_KEY"
+
+// Key states reported by Status.
+const (
+	StatePending = "pending"
+	StateActive  = "active"
+	StateExpired = "expired"
+	StateRevoked = "revoked"
+)
+
+// TrustedKey is a public key allowed to sign images during its window.
+type TrustedKey struct {
+	ID        string     `json:"id"`
+	PublicKey string     `json:"public_key"`
+	NotBefore time.Time  `json:"not_before"`
+	NotAfter  time.Time  `json:"not_after"`
+	Revoked   *time.Time `json:"revoked,omitempty"`
+	Reason    string     `json:"revocation_reason,omitempty"`
+	// Certificate is the self-signed certificate of the key, in PEM, that
+	// Notation signatures carry.
+	Certificate string `json:"certificate,omitempty"`
+}
+
+// Status returns the state of the key at now.
+func (k TrustedKey) Status(now time.Time) string {
+	switch {
+	case k.Revoked != nil:
+		return StateRevoked
+	case now.Before(k.NotBefore):
+		return StatePending
+	case !now.Before(k.NotAfter):
+		return StateExpired
+	}
+	return StateActive
+}
+
+// Public parses the PEM public key.
+func (k TrustedKey) Public() (*ecdsa.PublicKey, error) {
+	block, _ := pem.Decode([]byte(k.PublicKey))
+	if block == nil {
+		return nil, fmt.Errorf("key %s: no PEM public key", k.ID)
+	}
+	pub, err := x509.ParsePKIXPublicKey(block.Bytes)
+	if err != nil {
+		return nil, fmt.Errorf("key %s: %w", k.ID, err)
+	}
+	ec, ok := pub.(*ecdsa.PublicKey)
+	if !ok {
+		return nil, fmt.Errorf("key %s: not an ECDSA key", k.ID)
+	}
+	return ec, nil
+}
+
+// Cert parses the certificate of the key.
+func (k TrustedKey) Cert() (*x509.Certificate, error) {
+	if k.Certificate == "" {
+		return nil, fmt.Errorf("key %s has no certificate, run `factory keys certify`", k.ID)
+	}
+	block, _ := pem.Decode([]byte(k.Certificate))
+	if block == nil || block.Type != "CERTIFICATE" {
+		return nil, fmt.Errorf("key %s: no PEM certificate", k.ID)
+	}
+	cert, err := x509.ParseCertificate(block.Bytes)
+	if err != nil {
+		return nil, fmt.Errorf("key %s: %w", k.ID, err)
+	}
+	return cert, nil
+}
+
+// TrustedKeys is the content of the trusted-keys file.
+type TrustedKeys struct {
+	Keys []TrustedKey `json:"keys"`
+}
+
+// LoadTrusted reads the trusted-keys file; a missing file yields no keys.
+func LoadTrusted(path string) (*TrustedKeys, error) {
+	t := &TrustedKeys{}
+	data, err := os.ReadFile(path)
+	if os.IsNotExist(err) {
+		return t, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+	if err := json.Unmarshal(data, t); err != nil {
+		return nil, fmt.Errorf("%s: %w", path, err)
+	}
+	return t, nil
+}
+
+// Save writes the trusted-keys file, oldest key first.
+func (t *TrustedKeys) Save(path string) error {
+	sort.SliceStable(t.Keys, func(i, j int) bool { return t.Keys[i].NotBefore.Before(t.Keys[j].NotBefore) })
+	data, err := json.MarshalIndent(t, "", "    ")
+	if err != nil {
+		return err
+	}
+	return os.WriteFile(path, append(data, '\n'), 0o644)
+}
+
+// Lookup returns the key with the given ID.
+func (t *TrustedKeys) Lookup(id string) (*TrustedKey, bool) {
+	for i := range t.Keys {
+		if t.Keys[i].ID == id {
+			return &t.Keys[i], true
+		}
+	}
+	return nil, false
+}
+
+// Add trusts pub from notBefore for validity.
+func (t *TrustedKeys) Add(pub *ecdsa.PublicKey, notBefore time.Time, validity time.Duration) (TrustedKey, error) {
+	der, err := x509.MarshalPKIXPublicKey(pub)
+	if err != nil {
+		return TrustedKey{}, err
+	}
+	k := TrustedKey{
+		ID:        KeyID(pub),
+		PublicKey: string(pem.EncodeToMemory(&pem.Block{Type: "PUBLIC KEY", Bytes: der})),
+		NotBefore: notBefore,
+		NotAfter:  notBefore.Add(validity),
+	}
+	if _, ok := t.Lookup(k.ID); ok {
+		return TrustedKey{}, fmt.Errorf("key %s is already trusted", k.ID)
+	}
+	t.Keys = append(t.Keys, k)
+	return k, nil
+}
+
+// Certify issues the certificate of the trusted key of key: self-signed,
+// valid for the window of the key and usable for code signing only.
+func (t *TrustedKeys) Certify(key *ecdsa.PrivateKey) (*TrustedKey, error) {
+	k, ok := t.Lookup(KeyID(&key.PublicKey))
+	if !ok {
+		return nil, fmt.Errorf("key %s is not trusted", KeyID(&key.PublicKey))
+	}
+	serial, err := rand.Int(rand.Reader, new(big.Int).Lsh(big.NewInt(1), 128))
+	if err != nil {
+		return nil, err
+	}
+	tmpl := &x509.Certificate{
+		SerialNumber:          serial,
+		Subject:               pkix.Name{CommonName: "container-factory " + k.ID, Organization: []string{"container-factory"}},
+		NotBefore:             k.NotBefore,
+		NotAfter:              k.NotAfter,
+		KeyUsage:              x509.KeyUsageDigitalSignature,
+		ExtKeyUsage:           []x509.ExtKeyUsage{x509.ExtKeyUsageCodeSigning},
+		BasicConstraintsValid: true,
+	}
+	der, err := x509.CreateCertificate(rand.Reader, tmpl, tmpl, &key.PublicKey, key)
+	if err != nil {
+		return nil, err
+	}
+	k.Certificate = string(pem.EncodeToMemory(&pem.Block{Type: "CERTIFICATE", Bytes: der}))
+	return k, nil
+}
+
+// Retire ends the window of every key active at now after overlap, so that
+// a newly added key takes over while existing signers catch up.
+func (t *TrustedKeys) Retire(now time.Time, overlap time.Duration, except string) {
+	end := now.Add(overlap)
+	for i := range t.Keys {
+		k := &t.Keys[i]
+		if k.ID != except && k.Status(now) == StateActive && k.NotAfter.After(end) {
+			k.NotAfter = end
+		}
+	}
+}
+
+// Revoke marks a key as revoked. Signatures it made no longer verify,
+// whenever they were made.
+func (t *TrustedKeys) Revoke(id, reason string, now time.Time) error {
+	k, ok := t.Lookup(id)
+	if !ok {
+		return fmt.Errorf("key %s is not trusted", id)
+	}
+	if k.Revoked != nil {
+		return fmt.Errorf("key %s was already revoked on %s", id, k.Revoked.Format(time.DateOnly))
+	}
+	k.Revoked, k.Reason = &now, reason
+	return nil
+}
+
+// ValidAt returns an error unless key id may sign at the given time:
+// trusted, not revoked and within its window.
+func (t *TrustedKeys) ValidAt(id string, at time.Time) error {
+	k, ok := t.Lookup(id)
+	if !ok {
+		return fmt.Errorf("key %s is not trusted", id)
+	}
+	switch k.Status(at) {
+	case StateRevoked:
+		return fmt.Errorf("key %s was revoked on %s: %s", k.ID, k.Revoked.Format(time.DateOnly), k.Reason)
+	case StatePending, StateExpired:
+		return fmt.Errorf("%s is outside the window of key %s (%s to %s)", at.UTC().Format(time.RFC3339),
+			k.ID, k.NotBefore.Format(time.DateOnly), k.NotAfter.Format(time.DateOnly))
+	}
+	return nil
+}
+
+// Current picks the signing key among the available private keys: the
+// active trusted key with the latest not_before, then the latest not_after,
+// which is the newest key right after a rotation.
+func (t *TrustedKeys) Current(now time.Time, private map[string]*ecdsa.PrivateKey) (*ecdsa.PrivateKey, TrustedKey, error) {
+	var best *TrustedKey
+	for i := range t.Keys {
+		k := &t.Keys[i]
+		if k.Status(now) != StateActive || private[k.ID] == nil {
+			continue
+		}
+		if best == nil || k.NotBefore.After(best.NotBefore) ||
+			k.NotBefore.Equal(best.NotBefore) && k.NotAfter.After(best.NotAfter) {
+			best = k
+		}
+	}
+	if best == nil {
+		return nil, TrustedKey{}, errors.New("no active trusted key with a private key available")
+	}
+	return private[best.ID], *best, nil
+}
+
+// KeyID identifies a public key by the first 16 hex digits of the SHA-256
+// of its DER encoding.
+func KeyID(pub *ecdsa.PublicKey) string {
+	der, err := x509.MarshalPKIXPublicKey(pub)
+	if err != nil {
+		return ""
+	}
+	sum := sha256.Sum256(der)
+	return hex.EncodeToString(sum[:8])
+}
+
+// Generate creates a P-256 key, the curve cosign uses.
+func Generate() (*ecdsa.PrivateKey, error) {
+	return ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+}
+
+// WritePrivate stores key as a PKCS#8 PEM file readable only by its owner and
+// returns its path.
+func WritePrivate(dir string, key *ecdsa.PrivateKey) (string, error) {
+	der, err := x509.MarshalPKCS8PrivateKey(key)
+	if err != nil {
+		return "", err
+	}
+	if err := os.MkdirAll(dir, 0o700); err != nil {
+		return "", err
+	}
+	path := filepath.Join(dir, KeyID(&key.PublicKey)+".pem")
+	data := pem.EncodeToMemory(&pem.Block{Type: "PRIVATE KEY", Bytes: der})
+	return path, os.WriteFile(path, data, 0o600)
+}
+
+// LoadPrivate returns the private keys available to this process, by key ID:
+// the one in $FACTORY_SIGNING_KEY and every *.pem file in dir.
+func LoadPrivate(dir string) (map[string]*ecdsa.PrivateKey, error) {
+	keys := map[string]*ecdsa.PrivateKey{}
+	var sources [][]byte
+	if v := os.Getenv(KeyEnv); v != "" {
+		sources = append(sources, []byte(v))
+	}
+	files, _ := filepath.Glob(filepath.Join(dir, "*.pem"))
+	for _, f := range files {
+		data, err := os.ReadFile(f)
+		if err != nil {
+			return nil, err
+		}
+		sources = append(sources, data)
+	}
+	for _, data := range sources {
+		key, err := parsePrivate(data)
+		if err != nil {
+			return nil, err
+		}
+		keys[KeyID(&key.PublicKey)] = key
+	}
+	return keys, nil
+}
+
+func parsePrivate(data []byte) (*ecdsa.PrivateKey, error) {
+	block, _ := pem.Decode(data)
+	if block == nil {
+		return nil, errors.New("signing key: no PEM block")
+	}
+	var key any
+	var err error
+	switch {
+	case block.Type == "EC PRIVATE KEY":
+		key, err = x509.ParseECPrivateKey(block.Bytes)
+	case block.Type == "PRIVATE KEY":
+		key, err = x509.ParsePKCS8PrivateKey(block.Bytes)
+	case strings.Contains(block.Type, "ENCRYPTED"):
+		return nil, fmt.Errorf("signing key: encrypted %s keys are not supported, export it as PKCS#8", block.Type)
+	default:
+		return nil, fmt.Errorf("signing key: unexpected PEM type %q", block.Type)
+	}
+	if err != nil {
+		return nil, fmt.Errorf("signing key: %w", err)
+	}
+	ec, ok := key.(*ecdsa.PrivateKey)
+	if !ok {
+		return nil, errors.New("signing key: not an ECDSA key")
+	}
+	return ec, nil
+}
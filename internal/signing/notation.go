@@ -0,0 +1,503 @@
+package signing
+
+import (
+	"context"
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/rand"
+	"crypto/sha256"
+	"crypto/x509"
+	"encoding/base64"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"math/big"
+	"slices"
+	"strings"
+	"time"
+
+	"github.com/gillouche/container-factory/internal/registry"
+)
+
+// Notary Project (Notation) signatures: a JWS or COSE envelope over a
+// payload naming the signed manifest, signed with the key of an X.509
+// certificate and stored as an OCI referrer of the manifest.
+
+// Media types and annotations of Notation signatures.
+const (
+	ArtifactTypeNotation     = "application/vnd.cncf.notary.signature"
+	MediaTypeJWS             = "application/jose+json"
+	MediaTypeCOSE            = "application/cose"
+	MediaTypeNotationPayload = "application/vnd.cncf.notary.payload.v1+json"
+	AnnotationThumbprints    = "io.cncf.notary.x509chain.thumbprint#S256"
+)
+
+// Signature formats, selected per image by its signature label.
+const (
+	FormatCosign       = "cosign"
+	FormatNotation     = "notation"
+	FormatNotationCOSE = "notation-cose"
+)
+
+// SigningAgent is recorded in the unprotected header of envelopes.
+const SigningAgent = "container-factory"
+
+const (
+	headerSigningScheme = "io.cncf.notary.signingScheme"
+	headerSigningTime   = "io.cncf.notary.signingTime"
+	headerSigningAgent  = "io.cncf.notary.signingAgent"
+	schemeX509          = "notary.x509"
+)
+
+// COSE header labels (RFC 9052, RFC 9360) and the tag of COSE_Sign1.
+const (
+	coseAlg         = 1
+	coseCrit        = 2
+	coseContentType = 3
+	coseX5Chain     = 33
+	coseES256       = -7
+	coseSign1Tag    = 18
+	cborEpochTag    = 1
+)
+
+// Formats parses a signature label, e.g. "cosign+notation". An empty label
+// is cosign alone.
+func Formats(label string) ([]string, error) {
+	if label == "" {
+		return []string{FormatCosign}, nil
+	}
+	var out []string
+	for _, f := range strings.Split(label, "+") {
+		switch f = strings.TrimSpace(f); f {
+		case FormatCosign, FormatNotation, FormatNotationCOSE:
+			if !slices.Contains(out, f) {
+				out = append(out, f)
+			}
+		default:
+			return nil, fmt.Errorf("unknown signature format %q (want %s, %s or %s)", f, FormatCosign, FormatNotation, FormatNotationCOSE)
+		}
+	}
+	return out, nil
+}
+
+// EnvelopeType returns the media type of the envelope of a Notation format.
+func EnvelopeType(format string) string {
+	if format == FormatNotationCOSE {
+		return MediaTypeCOSE
+	}
+	return MediaTypeJWS
+}
+
+// NotationPayload is the signed content of an envelope.
+type NotationPayload struct {
+	TargetArtifact registry.Descriptor `json:"targetArtifact"`
+}
+
+// Envelope is a decoded Notation signature envelope.
+type Envelope struct {
+	MediaType string
+	Payload   NotationPayload
+	// Certificates is the certificate chain, signing certificate first.
+	Certificates []*x509.Certificate
+	SigningTime  time.Time
+	// Signature is the raw ES256 signature (r || s).
+	Signature []byte
+	// signed is what Signature is computed over.
+	signed []byte
+}
+
+// Target returns the descriptor of the manifest ref's digest points to, the
+// subject of its Notation signatures.
+func Target(ctx context.Context, c *registry.Client, ref registry.Ref) (registry.Descriptor, error) {
+	data, mediaType, digest, err := c.Manifest(ctx, ref)
+	if err != nil {
+		return registry.Descriptor{}, err
+	}
+	if ref.Digest != "" && digest != ref.Digest {
+		return registry.Descriptor{}, fmt.Errorf("%s: registry returned %s", ref, digest)
+	}
+	return registry.Descriptor{MediaType: mediaType, Digest: digest, Size: int64(len(data))}, nil
+}
+
+// SignNotation signs target with key, whose certificate is cert, in an
+// envelope of mediaType (MediaTypeJWS or MediaTypeCOSE).
+func SignNotation(key *ecdsa.PrivateKey, cert *x509.Certificate, target registry.Descriptor, mediaType string, at time.Time) ([]byte, error) {
+	if pub, ok := cert.PublicKey.(*ecdsa.PublicKey); !ok || !pub.Equal(&key.PublicKey) {
+		return nil, errors.New("certificate does not match the signing key")
+	}
+	payload, err := json.Marshal(NotationPayload{TargetArtifact: registry.Descriptor{
+		MediaType: target.MediaType, Digest: target.Digest, Size: target.Size,
+	}})
+	if err != nil {
+		return nil, err
+	}
+	at = at.UTC().Truncate(time.Second)
+	switch mediaType {
+	case MediaTypeJWS:
+		return signJWS(key, cert, payload, at)
+	case MediaTypeCOSE:
+		return signCOSE(key, cert, payload, at)
+	}
+	return nil, fmt.Errorf("unsupported envelope type %q", mediaType)
+}
+
+// ParseEnvelope decodes an envelope of mediaType. It checks its structure,
+// not its signature: see Envelope.VerifyIntegrity.
+func ParseEnvelope(mediaType string, data []byte) (*Envelope, error) {
+	var env *Envelope
+	var err error
+	switch mediaType {
+	case MediaTypeJWS:
+		env, err = parseJWS(data)
+	case MediaTypeCOSE:
+		env, err = parseCOSE(data)
+	default:
+		return nil, fmt.Errorf("unsupported envelope type %q", mediaType)
+	}
+	if err != nil {
+		return nil, fmt.Errorf("%s envelope: %w", mediaType, err)
+	}
+	if len(env.Certificates) == 0 {
+		return nil, fmt.Errorf("%s envelope: no certificate chain", mediaType)
+	}
+	env.MediaType = mediaType
+	return env, nil
+}
+
+// VerifyIntegrity checks the signature of the envelope with the key of its
+// signing certificate.
+func (e *Envelope) VerifyIntegrity() error {
+	pub, ok := e.Certificates[0].PublicKey.(*ecdsa.PublicKey)
+	if !ok || pub.Curve != elliptic.P256() {
+		return errors.New("signing certificate is not an ECDSA P-256 key")
+	}
+	if len(e.Signature) != 64 {
+		return errors.New("malformed ES256 signature")
+	}
+	sum := sha256.Sum256(e.signed)
+	r := new(big.Int).SetBytes(e.Signature[:32])
+	s := new(big.Int).SetBytes(e.Signature[32:])
+	if !ecdsa.Verify(pub, sum[:], r, s) {
+		return errors.New("signature does not match the envelope")
+	}
+	return nil
+}
+
+// es256 signs data and returns r || s.
+func es256(key *ecdsa.PrivateKey, data []byte) ([]byte, error) {
+	sum := sha256.Sum256(data)
+	r, s, err := ecdsa.Sign(rand.Reader, key, sum[:])
+	if err != nil {
+		return nil, err
+	}
+	sig := make([]byte, 64)
+	r.FillBytes(sig[:32])
+	s.FillBytes(sig[32:])
+	return sig, nil
+}
+
+// JWS JSON serialization (flattened).
+
+type jwsEnvelope struct {
+	Payload   string    `json:"payload"`
+	Protected string    `json:"protected"`
+	Header    jwsHeader `json:"header"`
+	Signature string    `json:"signature"`
+}
+
+type jwsHeader struct {
+	X5C          []string `json:"x5c"`
+	SigningAgent string   `json:"io.cncf.notary.signingAgent,omitempty"`
+}
+
+type jwsProtected struct {
+	Alg           string    `json:"alg"`
+	Cty           string    `json:"cty"`
+	Crit          []string  `json:"crit"`
+	SigningScheme string    `json:"io.cncf.notary.signingScheme"`
+	SigningTime   time.Time `json:"io.cncf.notary.signingTime"`
+}
+
+func signJWS(key *ecdsa.PrivateKey, cert *x509.Certificate, payload []byte, at time.Time) ([]byte, error) {
+	protected, err := json.Marshal(jwsProtected{
+		Alg:           "ES256",
+		Cty:           MediaTypeNotationPayload,
+		Crit:          []string{headerSigningScheme},
+		SigningScheme: schemeX509,
+		SigningTime:   at,
+	})
+	if err != nil {
+		return nil, err
+	}
+	b64 := base64.RawURLEncoding
+	env := jwsEnvelope{
+		Payload:   b64.EncodeToString(payload),
+		Protected: b64.EncodeToString(protected),
+		Header:    jwsHeader{X5C: []string{base64.StdEncoding.EncodeToString(cert.Raw)}, SigningAgent: SigningAgent},
+	}
+	sig, err := es256(key, []byte(env.Protected+"."+env.Payload))
+	if err != nil {
+		return nil, err
+	}
+	env.Signature = b64.EncodeToString(sig)
+	return json.Marshal(env)
+}
+
+func parseJWS(data []byte) (*Envelope, error) {
+	var raw jwsEnvelope
+	if err := json.Unmarshal(data, &raw); err != nil {
+		return nil, err
+	}
+	b64 := base64.RawURLEncoding
+	protectedJSON, err := b64.DecodeString(raw.Protected)
+	if err != nil {
+		return nil, fmt.Errorf("protected header: %w", err)
+	}
+	var protected map[string]json.RawMessage
+	if err := json.Unmarshal(protectedJSON, &protected); err != nil {
+		return nil, fmt.Errorf("protected header: %w", err)
+	}
+	var h jwsProtected
+	if err := json.Unmarshal(protectedJSON, &h); err != nil {
+		return nil, fmt.Errorf("protected header: %w", err)
+	}
+	if h.Alg != "ES256" {
+		return nil, fmt.Errorf("unsupported algorithm %q", h.Alg)
+	}
+	if h.Cty != MediaTypeNotationPayload {
+		return nil, fmt.Errorf("unexpected content type %q", h.Cty)
+	}
+	if h.SigningScheme != schemeX509 || !slices.Contains(h.Crit, headerSigningScheme) {
+		return nil, fmt.Errorf("unsupported signing scheme %q", h.SigningScheme)
+	}
+	for _, c := range h.Crit {
+		if _, ok := protected[c]; !ok || c != headerSigningScheme && c != headerSigningTime {
+			return nil, fmt.Errorf("unsupported critical header %q", c)
+		}
+	}
+
+	env := &Envelope{SigningTime: h.SigningTime, signed: []byte(raw.Protected + "." + raw.Payload)}
+	payload, err := b64.DecodeString(raw.Payload)
+	if err != nil {
+		return nil, fmt.Errorf("payload: %w", err)
+	}
+	if err := json.Unmarshal(payload, &env.Payload); err != nil {
+		return nil, fmt.Errorf("payload: %w", err)
+	}
+	if env.Signature, err = b64.DecodeString(raw.Signature); err != nil {
+		return nil, fmt.Errorf("signature: %w", err)
+	}
+	for _, c := range raw.Header.X5C {
+		der, err := base64.StdEncoding.DecodeString(c)
+		if err != nil {
+			return nil, fmt.Errorf("x5c: %w", err)
+		}
+		cert, err := x509.ParseCertificate(der)
+		if err != nil {
+			return nil, fmt.Errorf("x5c: %w", err)
+		}
+		env.Certificates = append(env.Certificates, cert)
+	}
+	return env, nil
+}
+
+// COSE_Sign1 (RFC 9052).
+
+func signCOSE(key *ecdsa.PrivateKey, cert *x509.Certificate, payload []byte, at time.Time) ([]byte, error) {
+	protected, err := cborEncode(cborMap{
+		{coseAlg, coseES256},
+		{coseCrit, []any{headerSigningScheme}},
+		{coseContentType, MediaTypeNotationPayload},
+		{headerSigningScheme, schemeX509},
+		{headerSigningTime, cborTag{Number: cborEpochTag, Value: at.Unix()}},
+	})
+	if err != nil {
+		return nil, err
+	}
+	toSign, err := coseSigStructure(protected, payload)
+	if err != nil {
+		return nil, err
+	}
+	sig, err := es256(key, toSign)
+	if err != nil {
+		return nil, err
+	}
+	return cborEncode(cborTag{Number: coseSign1Tag, Value: []any{
+		protected,
+		cborMap{{coseX5Chain, []any{cert.Raw}}, {headerSigningAgent, SigningAgent}},
+		payload,
+		sig,
+	}})
+}
+
+// coseSigStructure is the Sig_structure a COSE_Sign1 signature covers.
+func coseSigStructure(protected, payload []byte) ([]byte, error) {
+	return cborEncode([]any{"Signature1", protected, []byte{}, payload})
+}
+
+func parseCOSE(data []byte) (*Envelope, error) {
+	v, err := cborDecode(data)
+	if err != nil {
+		return nil, err
+	}
+	if t, ok := v.(cborTag); ok {
+		if t.Number != coseSign1Tag {
+			return nil, fmt.Errorf("unexpected CBOR tag %d", t.Number)
+		}
+		v = t.Value
+	}
+	msg, ok := v.([]any)
+	if !ok || len(msg) != 4 {
+		return nil, errors.New("not a COSE_Sign1 message")
+	}
+	protected, ok1 := msg[0].([]byte)
+	unprotected, ok2 := msg[1].(cborMap)
+	payload, ok3 := msg[2].([]byte)
+	sig, ok4 := msg[3].([]byte)
+	if !ok1 || !ok2 || !ok3 || !ok4 {
+		return nil, errors.New("not a COSE_Sign1 message")
+	}
+
+	hv, err := cborDecode(protected)
+	if err != nil {
+		return nil, fmt.Errorf("protected header: %w", err)
+	}
+	h, ok := hv.(cborMap)
+	if !ok {
+		return nil, errors.New("protected header is not a map")
+	}
+	if alg, _ := h.get(int64(coseAlg)); alg != int64(coseES256) {
+		return nil, fmt.Errorf("unsupported algorithm %v", alg)
+	}
+	if cty, _ := h.get(int64(coseContentType)); cty != MediaTypeNotationPayload {
+		return nil, fmt.Errorf("unexpected content type %v", cty)
+	}
+	scheme, _ := h.get(headerSigningScheme)
+	crit, _ := h.get(int64(coseCrit))
+	critList, _ := crit.([]any)
+	if scheme != schemeX509 || !slices.Contains(critList, any(headerSigningScheme)) {
+		return nil, fmt.Errorf("unsupported signing scheme %v", scheme)
+	}
+	for _, c := range critList {
+		if _, ok := h.get(c); !ok || c != any(headerSigningScheme) && c != any(headerSigningTime) {
+			return nil, fmt.Errorf("unsupported critical header %v", c)
+		}
+	}
+
+	signed, err := coseSigStructure(protected, payload)
+	if err != nil {
+		return nil, err
+	}
+	env := &Envelope{Signature: sig, signed: signed}
+	if t, ok := h.get(headerSigningTime); ok {
+		if tag, ok := t.(cborTag); ok && tag.Number == cborEpochTag {
+			if secs, ok := tag.Value.(int64); ok {
+				env.SigningTime = time.Unix(secs, 0).UTC()
+			}
+		}
+	}
+	if err := json.Unmarshal(payload, &env.Payload); err != nil {
+		return nil, fmt.Errorf("payload: %w", err)
+	}
+
+	chain, _ := unprotected.get(int64(coseX5Chain))
+	var ders []any
+	switch c := chain.(type) {
+	case []byte:
+		ders = []any{c}
+	case []any:
+		ders = c
+	}
+	for _, d := range ders {
+		der, ok := d.([]byte)
+		if !ok {
+			return nil, errors.New("x5chain: not a certificate")
+		}
+		cert, err := x509.ParseCertificate(der)
+		if err != nil {
+			return nil, fmt.Errorf("x5chain: %w", err)
+		}
+		env.Certificates = append(env.Certificates, cert)
+	}
+	return env, nil
+}
+
+// Storage as OCI referrers.
+
+// AttachNotation stores envelope, signed with cert, as a referrer of
+// target in ref's repository.
+func AttachNotation(ctx context.Context, c *registry.Client, ref registry.Ref, target registry.Descriptor, mediaType string, envelope []byte, cert *x509.Certificate, at time.Time) error {
+	config, err := c.PutBlob(ctx, ref, registry.MediaTypeEmpty, registry.EmptyConfig)
+	if err != nil {
+		return err
+	}
+	layer, err := c.PutBlob(ctx, ref, mediaType, envelope)
+	if err != nil {
+		return err
+	}
+	sum := sha256.Sum256(cert.Raw)
+	thumbprints, err := json.Marshal([]string{hex.EncodeToString(sum[:])})
+	if err != nil {
+		return err
+	}
+	subject := registry.Descriptor{MediaType: target.MediaType, Digest: target.Digest, Size: target.Size}
+	m := &registry.Manifest{
+		SchemaVersion: 2,
+		MediaType:     registry.MediaTypeManifest,
+		ArtifactType:  ArtifactTypeNotation,
+		Config:        config,
+		Layers:        []registry.Descriptor{layer},
+		Subject:       &subject,
+		Annotations: map[string]string{
+			AnnotationThumbprints:              string(thumbprints),
+			"org.opencontainers.image.created": at.UTC().Format(time.RFC3339),
+		},
+	}
+	_, err = c.PutReferrer(ctx, ref, m)
+	return err
+}
+
+// NotationSignature is a Notation signature found for an image. Err is set
+// when the signature cannot be read.
+type NotationSignature struct {
+	Manifest string
+	Envelope *Envelope
+	Err      error
+}
+
+// NotationSignatures fetches the Notation signatures referring to ref's
+// digest.
+func NotationSignatures(ctx context.Context, c *registry.Client, ref registry.Ref) ([]NotationSignature, error) {
+	descs, err := c.Referrers(ctx, ref, ArtifactTypeNotation)
+	if err != nil {
+		return nil, err
+	}
+	var sigs []NotationSignature
+	for _, d := range descs {
+		mref := registry.Ref{Registry: ref.Registry, Repository: ref.Repository, Digest: d.Digest}
+		data, _, _, err := c.Manifest(ctx, mref)
+		if err != nil {
+			return nil, err
+		}
+		sig := NotationSignature{Manifest: d.Digest}
+		var m registry.Manifest
+		switch {
+		case json.Unmarshal(data, &m) != nil:
+			sig.Err = errors.New("invalid signature manifest")
+		case m.Subject == nil || m.Subject.Digest != ref.Digest:
+			sig.Err = errors.New("signature manifest is not about this image")
+		case len(m.Layers) != 1:
+			sig.Err = fmt.Errorf("signature manifest has %d layers, want 1", len(m.Layers))
+		}
+		if sig.Err == nil {
+			blob, err := c.Blob(ctx, ref, m.Layers[0].Digest)
+			if err != nil {
+				return nil, err
+			}
+			sig.Envelope, sig.Err = ParseEnvelope(m.Layers[0].MediaType, blob)
+		}
+		sigs = append(sigs, sig)
+	}
+	return sigs, nil
+}
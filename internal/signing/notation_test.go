@@ -0,0 +1,175 @@
+package signing_test
+
+import (
+	"context"
+	"crypto/ecdsa"
+	"slices"
+	"testing"
+	"time"
+
+	"github.com/gillouche/container-factory/internal/registry"
+	"github.com/gillouche/container-factory/internal/registry/memory"
+	"github.com/gillouche/container-factory/internal/registry/registrytest"
+	"github.com/gillouche/container-factory/internal/signing"
+)
+
+const factoryIdentity = "x509.subject: O=container-factory"
+
+// signed is an image signed in every format, and the registry it is in.
+type signed struct {
+	client  *registry.Client
+	repo    string
+	ref     registry.Ref
+	trusted *signing.TrustedKeys
+	target  registry.Descriptor
+	sigs    []signing.NotationSignature
+}
+
+// signImage pushes an image to an in-memory registry, with or without the
+// referrers API, and signs it in the cosign, Notation JWS and Notation
+// COSE formats with a key certified by a new set of trusted keys.
+func signImage(t *testing.T, referrers bool) *signed {
+	t.Helper()
+	ctx := context.Background()
+	reg := memory.New()
+	reg.Referrers = referrers
+	s := &signed{client: &registry.Client{}, repo: registrytest.Serve(t, reg), trusted: &signing.TrustedKeys{}}
+	var err error
+	if s.ref, err = registrytest.PushImage(ctx, s.client, s.repo, "1.0"); err != nil {
+		t.Fatal(err)
+	}
+
+	key, err := signing.Generate()
+	if err != nil {
+		t.Fatal(err)
+	}
+	now := time.Now().UTC().Truncate(time.Second)
+	if _, err := s.trusted.Add(&key.PublicKey, now.Add(-time.Hour), 24*time.Hour); err != nil {
+		t.Fatal(err)
+	}
+	k, err := s.trusted.Certify(key)
+	if err != nil {
+		t.Fatal(err)
+	}
+	sig, err := signing.Sign(key, s.ref.Name(), s.ref.Digest, now)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := signing.Attach(ctx, s.client, s.ref, sig); err != nil {
+		t.Fatal(err)
+	}
+	if s.target, err = signing.Target(ctx, s.client, s.ref); err != nil {
+		t.Fatal(err)
+	}
+	for _, f := range []string{signing.FormatNotation, signing.FormatNotationCOSE} {
+		signNotation(t, s, key, k, signing.EnvelopeType(f), now)
+	}
+	if s.sigs, err = signing.NotationSignatures(ctx, s.client, s.ref); err != nil {
+		t.Fatal(err)
+	}
+	return s
+}
+
+func signNotation(t *testing.T, s *signed, key *ecdsa.PrivateKey, k *signing.TrustedKey, mediaType string, at time.Time) {
+	t.Helper()
+	cert, err := k.Cert()
+	if err != nil {
+		t.Fatal(err)
+	}
+	envelope, err := signing.SignNotation(key, cert, s.target, mediaType, at)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := signing.AttachNotation(context.Background(), s.client, s.ref, s.target, mediaType, envelope, cert, at); err != nil {
+		t.Fatal(err)
+	}
+}
+
+// verify verifies every Notation signature of the image against target.
+func (s *signed) verify(nv *signing.NotationVerifier, target registry.Descriptor) []signing.Result {
+	var out []signing.Result
+	for _, sig := range s.sigs {
+		if sig.Err != nil {
+			out = append(out, signing.Result{Err: sig.Err})
+			continue
+		}
+		out = append(out, nv.Verify(sig.Envelope, s.ref.Name(), target))
+	}
+	return out
+}
+
+func notationVerifier(keys *signing.TrustedKeys, level, identity string) *signing.NotationVerifier {
+	rule := signing.TrustPolicyRule{
+		Name:              "test",
+		RegistryScopes:    []string{"*"},
+		TrustStores:       []string{"ca:" + signing.FactoryStore},
+		TrustedIdentities: []string{identity},
+	}
+	rule.SignatureVerification.Level = level
+	return &signing.NotationVerifier{
+		Policy: &signing.TrustPolicy{Version: "1.0", Policies: []signing.TrustPolicyRule{rule}},
+		Keys:   keys,
+	}
+}
+
+// TestSignatures signs an image in every format, with and without the
+// referrers API, and verifies the signatures found.
+func TestSignatures(t *testing.T) {
+	ctx := context.Background()
+	for _, referrers := range []bool{true, false} {
+		name := "referrers-api"
+		if !referrers {
+			name = "referrers-tag"
+		}
+		t.Run(name, func(t *testing.T) {
+			s := signImage(t, referrers)
+			cosign, err := signing.Signatures(ctx, s.client, s.ref)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if len(cosign) != 1 {
+				t.Fatalf("%d cosign signatures, want 1", len(cosign))
+			}
+			if res := s.trusted.Verify(cosign[0], s.ref.Name(), s.ref.Digest); res.Err != nil {
+				t.Errorf("cosign: %v", res.Err)
+			}
+			if len(s.sigs) != 2 {
+				t.Fatalf("%d Notation signatures, want 2", len(s.sigs))
+			}
+			var types []string
+			for i, res := range s.verify(notationVerifier(s.trusted, signing.LevelStrict, factoryIdentity), s.target) {
+				if res.Err != nil {
+					t.Errorf("Notation: %v", res.Err)
+				}
+				types = append(types, s.sigs[i].Envelope.MediaType)
+			}
+			slices.Sort(types)
+			if want := []string{signing.MediaTypeCOSE, signing.MediaTypeJWS}; !slices.Equal(types, want) {
+				t.Errorf("Notation envelopes %v, want %v", types, want)
+			}
+			descs, err := s.client.Referrers(ctx, s.ref, signing.ArtifactTypeNotation)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if len(descs) != 2 {
+				t.Errorf("%d Notation referrers, want 2", len(descs))
+			}
+
+			unsigned, err := registrytest.PushImage(ctx, s.client, s.repo, "2.0")
+			if err != nil {
+				t.Fatal(err)
+			}
+			cosign, err = signing.Signatures(ctx, s.client, unsigned)
+			if err != nil {
+				t.Fatal(err)
+			}
+			notation, err := signing.NotationSignatures(ctx, s.client, unsigned)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if len(cosign)+len(notation) != 0 {
+				t.Errorf("unsigned image has %d cosign and %d Notation signatures", len(cosign), len(notation))
+			}
+		})
+	}
+}
@@ -0,0 +1,131 @@
+package signing
+
+import (
+	"crypto/ecdsa"
+	"crypto/rand"
+	"crypto/sha256"
+	"encoding/base64"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"time"
+)
+
+// PayloadType is the critical type of cosign simple signing payloads.
+const PayloadType = "cosign container image signature"
+
+// Keys of the optional section the factory adds to the payload. They are
+// covered by the signature, so the signing time cannot be forged without the
+// key.
+const (
+	OptionalKeyID    = "factory.key-id"
+	OptionalSignedAt = "factory.signed-at"
+)
+
+// Payload is a cosign simple signing payload.
+type Payload struct {
+	Critical struct {
+		Identity struct {
+			DockerReference string `json:"docker-reference"`
+		} `json:"identity"`
+		Image struct {
+			DockerManifestDigest string `json:"docker-manifest-digest"`
+		} `json:"image"`
+		Type string `json:"type"`
+	} `json:"critical"`
+	Optional map[string]string `json:"optional,omitempty"`
+}
+
+// Signature is a payload with its base64 ASN.1 ECDSA signature.
+type Signature struct {
+	Payload   []byte
+	Signature string
+}
+
+// Sign signs the manifest digest of repository with key at the given time.
+func Sign(key *ecdsa.PrivateKey, repository, digest string, at time.Time) (Signature, error) {
+	var p Payload
+	p.Critical.Identity.DockerReference = repository
+	p.Critical.Image.DockerManifestDigest = digest
+	p.Critical.Type = PayloadType
+	p.Optional = map[string]string{
+		OptionalKeyID:    KeyID(&key.PublicKey),
+		OptionalSignedAt: at.UTC().Format(time.RFC3339),
+	}
+	payload, err := json.Marshal(p)
+	if err != nil {
+		return Signature{}, err
+	}
+	sum := sha256.Sum256(payload)
+	sig, err := ecdsa.SignASN1(rand.Reader, key, sum[:])
+	if err != nil {
+		return Signature{}, err
+	}
+	return Signature{Payload: payload, Signature: base64.StdEncoding.EncodeToString(sig)}, nil
+}
+
+// Result is the outcome of verifying one signature.
+type Result struct {
+	KeyID    string
+	SignedAt time.Time
+	Err      error
+	// Warnings are failed checks the trust policy only logs (Notation).
+	Warnings []string
+}
+
+// Verify checks that sig covers digest of repository and was made by a
+// trusted key, not revoked, within its validity window. The signing time is
+// the one the signature claims: callers check the key against a time the
+// signer does not control as well (see ValidAt).
+func (t *TrustedKeys) Verify(sig Signature, repository, digest string) Result {
+	var p Payload
+	if err := json.Unmarshal(sig.Payload, &p); err != nil {
+		return Result{Err: fmt.Errorf("invalid payload: %w", err)}
+	}
+	res := Result{KeyID: p.Optional[OptionalKeyID]}
+	if at, err := time.Parse(time.RFC3339, p.Optional[OptionalSignedAt]); err == nil {
+		res.SignedAt = at
+	}
+	raw, err := base64.StdEncoding.DecodeString(sig.Signature)
+	if err != nil {
+		res.Err = fmt.Errorf("invalid signature encoding: %w", err)
+		return res
+	}
+
+	// Signatures made outside the factory carry no key ID; try every key.
+	candidates := t.Keys
+	if k, ok := t.Lookup(res.KeyID); ok {
+		candidates = []TrustedKey{*k}
+	}
+	sum := sha256.Sum256(sig.Payload)
+	var key *TrustedKey
+	for _, k := range candidates {
+		pub, err := k.Public()
+		if err == nil && ecdsa.VerifyASN1(pub, sum[:], raw) {
+			key = &k
+			break
+		}
+	}
+	if key == nil {
+		res.Err = errors.New("not signed by a trusted key")
+		return res
+	}
+	res.KeyID = key.ID
+
+	switch {
+	case p.Critical.Type != PayloadType:
+		res.Err = fmt.Errorf("unexpected payload type %q", p.Critical.Type)
+	case p.Critical.Image.DockerManifestDigest != digest:
+		res.Err = fmt.Errorf("signature is for %s", p.Critical.Image.DockerManifestDigest)
+	case p.Critical.Identity.DockerReference != repository:
+		res.Err = fmt.Errorf("signature is for repository %s", p.Critical.Identity.DockerReference)
+	case key.Revoked != nil:
+		res.Err = fmt.Errorf("key %s was revoked on %s: %s", key.ID, key.Revoked.Format(time.DateOnly), key.Reason)
+	case res.SignedAt.IsZero():
+		res.Err = errors.New("signature has no signing time")
+	case res.SignedAt.Before(key.NotBefore) || !res.SignedAt.Before(key.NotAfter):
+		res.Err = fmt.Errorf("signed on %s, outside the window of key %s (%s to %s)", res.SignedAt.Format(time.DateOnly),
+			key.ID, key.NotBefore.Format(time.DateOnly), key.NotAfter.Format(time.DateOnly))
+	}
+	return res
+}
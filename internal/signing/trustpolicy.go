@@ -0,0 +1,374 @@
+package signing
+
+import (
+	"bytes"
+	"crypto/ecdsa"
+	"crypto/x509"
+	"crypto/x509/pkix"
+	"encoding/json"
+	"encoding/pem"
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+	"slices"
+	"strings"
+	"time"
+
+	"github.com/gillouche/container-factory/internal/registry"
+)
+
+// FactoryStore names the trust store made of the certificates of the
+// trusted-keys file, e.g. "ca:factory" in a trust policy.
+const FactoryStore = "factory"
+
+// Verification levels and the checks they enforce, as in the Notary
+// Project trust policy specification.
+const (
+	LevelStrict     = "strict"
+	LevelPermissive = "permissive"
+	LevelAudit      = "audit"
+	LevelSkip       = "skip"
+
+	CheckIntegrity          = "integrity"
+	CheckAuthenticity       = "authenticity"
+	CheckAuthenticTimestamp = "authenticTimestamp"
+	CheckExpiry             = "expiry"
+	CheckRevocation         = "revocation"
+
+	ActionEnforce = "enforce"
+	ActionLog     = "log"
+	ActionSkip    = "skip"
+)
+
+// levelActions maps each level to the action of each check.
+var levelActions = map[string]map[string]string{
+	LevelStrict: {CheckIntegrity: ActionEnforce, CheckAuthenticity: ActionEnforce,
+		CheckAuthenticTimestamp: ActionEnforce, CheckExpiry: ActionEnforce, CheckRevocation: ActionEnforce},
+	LevelPermissive: {CheckIntegrity: ActionEnforce, CheckAuthenticity: ActionEnforce,
+		CheckAuthenticTimestamp: ActionLog, CheckExpiry: ActionLog, CheckRevocation: ActionLog},
+	LevelAudit: {CheckIntegrity: ActionEnforce, CheckAuthenticity: ActionLog,
+		CheckAuthenticTimestamp: ActionLog, CheckExpiry: ActionLog, CheckRevocation: ActionLog},
+}
+
+// TrustPolicy is a Notation trust policy document.
+type TrustPolicy struct {
+	Version  string            `json:"version"`
+	Policies []TrustPolicyRule `json:"trustPolicies"`
+}
+
+// TrustPolicyRule says how the signatures of the repositories in its
+// scopes are verified.
+type TrustPolicyRule struct {
+	Name string `json:"name"`
+	// RegistryScopes are repositories (registry/path), or "*" alone for
+	// every repository no other policy names.
+	RegistryScopes        []string `json:"registryScopes"`
+	SignatureVerification struct {
+		Level    string            `json:"level"`
+		Override map[string]string `json:"override,omitempty"`
+	} `json:"signatureVerification"`
+	// TrustStores are type:name pairs, e.g. "ca:factory".
+	TrustStores []string `json:"trustStores,omitempty"`
+	// TrustedIdentities are "x509.subject: <DN>" entries the signing
+	// certificate must match, or "*" alone.
+	TrustedIdentities []string `json:"trustedIdentities,omitempty"`
+}
+
+// LoadTrustPolicy reads and validates a trust policy file.
+func LoadTrustPolicy(path string) (*TrustPolicy, error) {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return nil, err
+	}
+	var p TrustPolicy
+	if err := json.Unmarshal(data, &p); err != nil {
+		return nil, fmt.Errorf("%s: %w", path, err)
+	}
+	if err := p.validate(); err != nil {
+		return nil, fmt.Errorf("%s: %w", path, err)
+	}
+	return &p, nil
+}
+
+func (p *TrustPolicy) validate() error {
+	if p.Version != "1.0" {
+		return fmt.Errorf("unsupported trust policy version %q", p.Version)
+	}
+	names := map[string]bool{}
+	scopes := map[string]string{}
+	for _, r := range p.Policies {
+		if r.Name == "" || names[r.Name] {
+			return fmt.Errorf("policy names must be unique and not empty (%q)", r.Name)
+		}
+		names[r.Name] = true
+		for _, s := range r.RegistryScopes {
+			if s == "*" && len(r.RegistryScopes) > 1 {
+				return fmt.Errorf("policy %s: the * scope must be alone", r.Name)
+			}
+			if other, ok := scopes[s]; ok {
+				return fmt.Errorf("policies %s and %s share the scope %s", other, r.Name, s)
+			}
+			scopes[s] = r.Name
+		}
+		level := r.SignatureVerification.Level
+		if _, ok := levelActions[level]; !ok && level != LevelSkip {
+			return fmt.Errorf("policy %s: unknown level %q", r.Name, level)
+		}
+		for check, action := range r.SignatureVerification.Override {
+			if _, ok := levelActions[LevelStrict][check]; !ok || check == CheckIntegrity {
+				return fmt.Errorf("policy %s: cannot override %q", r.Name, check)
+			}
+			if action != ActionEnforce && action != ActionLog && action != ActionSkip {
+				return fmt.Errorf("policy %s: unknown action %q", r.Name, action)
+			}
+		}
+		if level == LevelSkip {
+			continue
+		}
+		if len(r.TrustStores) == 0 || len(r.TrustedIdentities) == 0 {
+			return fmt.Errorf("policy %s: trust stores and trusted identities are required", r.Name)
+		}
+		for _, ts := range r.TrustStores {
+			if typ, name, ok := strings.Cut(ts, ":"); !ok || name == "" || typ != "ca" && typ != "signingAuthority" {
+				return fmt.Errorf("policy %s: invalid trust store %q", r.Name, ts)
+			}
+		}
+		for _, id := range r.TrustedIdentities {
+			if id == "*" {
+				if len(r.TrustedIdentities) > 1 {
+					return fmt.Errorf("policy %s: the * identity must be alone", r.Name)
+				}
+				continue
+			}
+			if _, err := parseIdentity(id); err != nil {
+				return fmt.Errorf("policy %s: %w", r.Name, err)
+			}
+		}
+	}
+	return nil
+}
+
+// For returns the policy of repository: the one naming it, else the one
+// with the * scope.
+func (p *TrustPolicy) For(repository string) (*TrustPolicyRule, error) {
+	var wildcard *TrustPolicyRule
+	for i := range p.Policies {
+		r := &p.Policies[i]
+		if slices.Contains(r.RegistryScopes, repository) {
+			return r, nil
+		}
+		if slices.Contains(r.RegistryScopes, "*") {
+			wildcard = r
+		}
+	}
+	if wildcard == nil {
+		return nil, fmt.Errorf("no trust policy applies to %s", repository)
+	}
+	return wildcard, nil
+}
+
+func (r *TrustPolicyRule) action(check string) string {
+	if a, ok := r.SignatureVerification.Override[check]; ok {
+		return a
+	}
+	return levelActions[r.SignatureVerification.Level][check]
+}
+
+// identity is a distinguished name as attribute type to value.
+type identity map[string]string
+
+func parseIdentity(s string) (identity, error) {
+	dn, ok := strings.CutPrefix(s, "x509.subject:")
+	if !ok {
+		return nil, fmt.Errorf("unsupported trusted identity %q", s)
+	}
+	id := identity{}
+	for _, rdn := range strings.Split(dn, ",") {
+		k, v, ok := strings.Cut(rdn, "=")
+		k, v = strings.TrimSpace(k), strings.TrimSpace(v)
+		if !ok || k == "" || v == "" {
+			return nil, fmt.Errorf("invalid trusted identity %q", s)
+		}
+		id[strings.ToUpper(k)] = v
+	}
+	return id, nil
+}
+
+// matches reports whether every attribute of the identity is in name.
+func (id identity) matches(name pkix.Name) bool {
+	have := map[string][]string{
+		"CN": {name.CommonName}, "O": name.Organization, "OU": name.OrganizationalUnit,
+		"C": name.Country, "ST": name.Province, "L": name.Locality,
+	}
+	for k, v := range id {
+		if !slices.Contains(have[k], v) {
+			return false
+		}
+	}
+	return true
+}
+
+// NotationVerifier verifies Notation signatures with a trust policy.
+type NotationVerifier struct {
+	Policy *TrustPolicy
+	// Keys backs the factory trust store. Its validity windows and
+	// revocations apply to the signatures of its keys, as for cosign.
+	Keys *TrustedKeys
+	// StoreDir holds the other trust stores, as <type>/<name>/*.pem (the
+	// x509 layout of the notation CLI).
+	StoreDir string
+}
+
+// Verify checks that env signs target, pushed to repository, under the
+// policy of the repository. Checks the policy logs rather than enforces
+// are returned as warnings.
+func (v *NotationVerifier) Verify(env *Envelope, repository string, target registry.Descriptor) Result {
+	res := Result{SignedAt: env.SigningTime}
+	rule, err := v.Policy.For(repository)
+	if err != nil {
+		res.Err = err
+		return res
+	}
+	if rule.SignatureVerification.Level == LevelSkip {
+		res.Warnings = append(res.Warnings, fmt.Sprintf("not verified: policy %s skips verification", rule.Name))
+		return res
+	}
+	fail := func(check string, err error) bool {
+		switch rule.action(check) {
+		case ActionEnforce:
+			res.Err = fmt.Errorf("%s: %w", check, err)
+			return true
+		case ActionLog:
+			res.Warnings = append(res.Warnings, fmt.Sprintf("%s: %v", check, err))
+		}
+		return false
+	}
+
+	// Integrity is always enforced.
+	if err := env.VerifyIntegrity(); err != nil {
+		res.Err = fmt.Errorf("%s: %w", CheckIntegrity, err)
+		return res
+	}
+	if t := env.Payload.TargetArtifact; t.Digest != target.Digest || t.MediaType != target.MediaType || t.Size != target.Size {
+		res.Err = fmt.Errorf("%s: signature is for %s", CheckIntegrity, t.Digest)
+		return res
+	}
+
+	signer := env.Certificates[0]
+	if pub, ok := signer.PublicKey.(*ecdsa.PublicKey); ok {
+		res.KeyID = KeyID(pub)
+	}
+	root, key, err := v.anchor(rule, env.Certificates)
+	if err == nil {
+		err = v.trustedIdentity(rule, signer)
+	}
+	if err != nil && fail(CheckAuthenticity, err) {
+		return res
+	}
+
+	if res.SignedAt.IsZero() {
+		if fail(CheckAuthenticTimestamp, errors.New("signature has no signing time")) {
+			return res
+		}
+	} else if key != nil {
+		if res.SignedAt.Before(key.NotBefore) || !res.SignedAt.Before(key.NotAfter) {
+			err := fmt.Errorf("signed on %s, outside the window of key %s (%s to %s)", res.SignedAt.Format(time.DateOnly),
+				key.ID, key.NotBefore.Format(time.DateOnly), key.NotAfter.Format(time.DateOnly))
+			if fail(CheckAuthenticTimestamp, err) {
+				return res
+			}
+		}
+	} else if root != nil {
+		for _, c := range env.Certificates {
+			if res.SignedAt.Before(c.NotBefore) || res.SignedAt.After(c.NotAfter) {
+				if fail(CheckAuthenticTimestamp, fmt.Errorf("certificate %q was not valid when signing", c.Subject)) {
+					return res
+				}
+				break
+			}
+		}
+	}
+
+	if key != nil && key.Revoked != nil {
+		err := fmt.Errorf("key %s was revoked on %s: %s", key.ID, key.Revoked.Format(time.DateOnly), key.Reason)
+		if fail(CheckRevocation, err) {
+			return res
+		}
+	}
+	return res
+}
+
+// anchor checks that chain is signed in order and ends in a certificate of
+// the trust stores of rule, and returns that certificate and, for the
+// factory store, its trusted key.
+func (v *NotationVerifier) anchor(rule *TrustPolicyRule, chain []*x509.Certificate) (*x509.Certificate, *TrustedKey, error) {
+	for i := 0; i+1 < len(chain); i++ {
+		if err := chain[i].CheckSignatureFrom(chain[i+1]); err != nil {
+			return nil, nil, fmt.Errorf("certificate chain: %w", err)
+		}
+	}
+	last := chain[len(chain)-1]
+	for _, ts := range rule.TrustStores {
+		typ, name, _ := strings.Cut(ts, ":")
+		if name == FactoryStore && v.Keys != nil {
+			for i := range v.Keys.Keys {
+				k := &v.Keys.Keys[i]
+				if cert, err := k.Cert(); err == nil && bytes.Equal(cert.Raw, last.Raw) {
+					return cert, k, nil
+				}
+			}
+			continue
+		}
+		certs, err := loadStore(filepath.Join(v.StoreDir, typ, name))
+		if err != nil {
+			return nil, nil, err
+		}
+		for _, c := range certs {
+			if bytes.Equal(c.Raw, last.Raw) || last.CheckSignatureFrom(c) == nil {
+				return c, nil, nil
+			}
+		}
+	}
+	return nil, nil, fmt.Errorf("certificate %q is not in the trust stores of policy %s", last.Subject, rule.Name)
+}
+
+func (v *NotationVerifier) trustedIdentity(rule *TrustPolicyRule, signer *x509.Certificate) error {
+	for _, s := range rule.TrustedIdentities {
+		if s == "*" {
+			return nil
+		}
+		if id, err := parseIdentity(s); err == nil && id.matches(signer.Subject) {
+			return nil
+		}
+	}
+	return fmt.Errorf("%q is not a trusted identity of policy %s", signer.Subject, rule.Name)
+}
+
+// loadStore reads the PEM certificates of a trust store directory. A
+// missing store is empty.
+func loadStore(dir string) ([]*x509.Certificate, error) {
+	files, _ := filepath.Glob(filepath.Join(dir, "*"))
+	var certs []*x509.Certificate
+	for _, f := range files {
+		data, err := os.ReadFile(f)
+		if err != nil {
+			return nil, err
+		}
+		for {
+			var block *pem.Block
+			if block, data = pem.Decode(data); block == nil {
+				break
+			}
+			if block.Type != "CERTIFICATE" {
+				continue
+			}
+			c, err := x509.ParseCertificate(block.Bytes)
+			if err != nil {
+				return nil, fmt.Errorf("%s: %w", f, err)
+			}
+			certs = append(certs, c)
+		}
+	}
+	return certs, nil
+}
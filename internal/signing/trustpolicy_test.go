@@ -0,0 +1,80 @@
+package signing_test
+
+import (
+	"slices"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/gillouche/container-factory/internal/signing"
+)
+
+// TestNotationVerifier verifies the Notation signatures of an image under
+// policies and keys that must accept them, reject them or only warn.
+func TestNotationVerifier(t *testing.T) {
+	s := signImage(t, true)
+	revoked := cloneKeys(s.trusted)
+	revoked.Revoke(revoked.Keys[0].ID, "test", time.Now())
+	expired := cloneKeys(s.trusted)
+	expired.Keys[0].NotAfter = expired.Keys[0].NotBefore.Add(time.Minute)
+	tampered := s.target
+	tampered.Size++
+
+	tests := []struct {
+		name  string
+		nv    *signing.NotationVerifier
+		check string // the check failing, "" when none
+		warn  bool   // whether the check only warns
+	}{
+		{"strict", notationVerifier(s.trusted, signing.LevelStrict, factoryIdentity), "", false},
+		{"untrusted-identity", notationVerifier(s.trusted, signing.LevelStrict, "x509.subject: O=someone-else"), signing.CheckAuthenticity, false},
+		{"unknown-certificate", notationVerifier(&signing.TrustedKeys{}, signing.LevelStrict, "*"), signing.CheckAuthenticity, false},
+		{"revoked-strict", notationVerifier(revoked, signing.LevelStrict, "*"), signing.CheckRevocation, false},
+		{"revoked-permissive", notationVerifier(revoked, signing.LevelPermissive, "*"), signing.CheckRevocation, true},
+		{"outside-window", notationVerifier(expired, signing.LevelStrict, "*"), signing.CheckAuthenticTimestamp, false},
+		{"audit", notationVerifier(&signing.TrustedKeys{}, signing.LevelAudit, "*"), "", false},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			expect(t, s.verify(tt.nv, s.target), tt.check, tt.warn)
+		})
+	}
+
+	strict := notationVerifier(s.trusted, signing.LevelStrict, factoryIdentity)
+	t.Run("tampered-target", func(t *testing.T) {
+		expect(t, s.verify(strict, tampered), signing.CheckIntegrity, false)
+	})
+	t.Run("forged-signature", func(t *testing.T) {
+		var results []signing.Result
+		for _, sig := range s.sigs {
+			env := *sig.Envelope
+			env.Signature = slices.Clone(env.Signature)
+			env.Signature[0] ^= 1
+			results = append(results, strict.Verify(&env, s.ref.Name(), s.target))
+		}
+		expect(t, results, signing.CheckIntegrity, false)
+	})
+}
+
+// expect checks that every result passed, failed check or, when warn is
+// set, passed with a warning.
+func expect(t *testing.T, results []signing.Result, check string, warn bool) {
+	t.Helper()
+	if len(results) == 0 {
+		t.Fatal("no Notation signatures")
+	}
+	for _, r := range results {
+		switch {
+		case check == "" && r.Err != nil:
+			t.Error(r.Err)
+		case check != "" && !warn && (r.Err == nil || !strings.HasPrefix(r.Err.Error(), check+":")):
+			t.Errorf("want a %s failure, got %v", check, r.Err)
+		case warn && (r.Err != nil || len(r.Warnings) == 0):
+			t.Errorf("want a %s warning, got error %v and warnings %v", check, r.Err, r.Warnings)
+		}
+	}
+}
+
+func cloneKeys(t *signing.TrustedKeys) *signing.TrustedKeys {
+	return &signing.TrustedKeys{Keys: slices.Clone(t.Keys)}
+}
@@ -0,0 +1,176 @@
+package smoke
+
+import (
+	"fmt"
+	"math"
+	"sort"
+	"time"
+)
+
+// Stats is the record of one check of an image over the last runs.
+type Stats struct {
+	Image string `json:"image"`
+	Check string `json:"check"`
+	Name  string `json:"name"`
+	// Runs and Failures count runs by their first attempt.
+	Runs     int `json:"runs"`
+	Failures int `json:"failures"`
+	// Retried counts the runs where the check failed, then passed on a
+	// retry of the same image.
+	Retried int `json:"retried"`
+	// Z is the runs test statistic of the pass and fail sequences of the
+	// variants: around zero or above when failures are scattered as
+	// chance scatters them, strongly negative when they come in streaks,
+	// as when a check breaks and is fixed. Nil when the sequences tell
+	// nothing (no failures, or nothing else).
+	Z           *float64  `json:"z,omitempty"`
+	LastFailure time.Time `json:"last_failure,omitzero"`
+	Flaky       bool      `json:"flaky"`
+	Reason      string    `json:"reason,omitempty"`
+}
+
+// Analysis tells flaky checks from the history of their runs.
+type Analysis struct {
+	// Window is the number of most recent runs of a check looked at.
+	Window int
+	// MinRuns and MinFailures are what the runs test needs to flag a
+	// check; a failure passing on retry flags it regardless.
+	MinRuns     int
+	MinFailures int
+	// Z is the runs test statistic below which failures are taken to be
+	// in streaks, hence not flaky.
+	Z float64
+}
+
+// DefaultAnalysis flags checks whose failures in the last 50 runs are not
+// significantly streaky, at the 5% level.
+var DefaultAnalysis = Analysis{Window: 50, MinRuns: 8, MinFailures: 2, Z: -1.645}
+
+// run is the outcome of a check in one run of a smoke test.
+type run struct {
+	variant string
+	time    time.Time
+	failed  bool
+	retried bool
+}
+
+// Analyze returns the stats of every check of records, flaky ones first.
+func (a Analysis) Analyze(records []Record) []Stats {
+	type key struct{ image, check string }
+	type attempt struct {
+		n       int
+		outcome string
+		imageID string
+	}
+	names := map[key]string{}
+	runs := map[key]map[string]*run{}
+	attempts := map[key]map[string][]attempt{}
+	for _, r := range records {
+		k := key{r.Image, r.Check}
+		names[k] = r.Name
+		if runs[k] == nil {
+			runs[k] = map[string]*run{}
+			attempts[k] = map[string][]attempt{}
+		}
+		if runs[k][r.Run] == nil {
+			runs[k][r.Run] = &run{variant: r.Variant + " " + r.Platform, time: r.Time}
+		}
+		attempts[k][r.Run] = append(attempts[k][r.Run], attempt{r.Attempt, r.Outcome, r.ImageID})
+	}
+
+	var out []Stats
+	for k, byRun := range runs {
+		var list []*run
+		for id, ru := range byRun {
+			as := attempts[k][id]
+			sort.Slice(as, func(i, j int) bool { return as[i].n < as[j].n })
+			ru.failed = as[0].outcome == Fail
+			for i, f := range as {
+				if f.outcome != Fail {
+					continue
+				}
+				for _, p := range as[i+1:] {
+					if p.outcome == Pass && p.imageID == f.imageID {
+						ru.retried = true
+					}
+				}
+			}
+			list = append(list, ru)
+		}
+		sort.Slice(list, func(i, j int) bool { return list[i].time.Before(list[j].time) })
+		if a.Window > 0 && len(list) > a.Window {
+			list = list[len(list)-a.Window:]
+		}
+		out = append(out, a.stats(k.image, k.check, names[k], list))
+	}
+	sort.Slice(out, func(i, j int) bool {
+		if out[i].Flaky != out[j].Flaky {
+			return out[i].Flaky
+		}
+		if out[i].Image != out[j].Image {
+			return out[i].Image < out[j].Image
+		}
+		return out[i].Check < out[j].Check
+	})
+	return out
+}
+
+func (a Analysis) stats(image, check, name string, runs []*run) Stats {
+	s := Stats{Image: image, Check: check, Name: name, Runs: len(runs)}
+	sequences := map[string][]bool{}
+	for _, r := range runs {
+		if r.failed {
+			s.Failures++
+			s.LastFailure = r.time
+		}
+		if r.retried {
+			s.Retried++
+		}
+		sequences[r.variant] = append(sequences[r.variant], r.failed)
+	}
+	s.Z = runsTest(sequences)
+
+	switch {
+	case s.Retried > 0:
+		s.Flaky = true
+		s.Reason = fmt.Sprintf("failed then passed on the same image in %d of %d runs", s.Retried, s.Runs)
+	case s.Runs >= a.MinRuns && s.Failures >= a.MinFailures && s.Z != nil && *s.Z > a.Z:
+		s.Flaky = true
+		s.Reason = fmt.Sprintf("%d of %d runs failed, scattered rather than in streaks (z=%.2f)", s.Failures, s.Runs, *s.Z)
+	}
+	return s
+}
+
+// runsTest is the Wald-Wolfowitz runs test of independent pass/fail
+// sequences, pooled: the number of streaks observed against the number
+// expected if the outcomes were in random order, in standard deviations.
+// Nil when no sequence has both outcomes.
+func runsTest(sequences map[string][]bool) *float64 {
+	var observed, mean, variance float64
+	for _, seq := range sequences {
+		var fails float64
+		streaks := 0.0
+		for i, f := range seq {
+			if f {
+				fails++
+			}
+			if i == 0 || f != seq[i-1] {
+				streaks++
+			}
+		}
+		n := float64(len(seq))
+		passes := n - fails
+		if fails == 0 || passes == 0 {
+			continue
+		}
+		p := 2 * fails * passes
+		observed += streaks
+		mean += p/n + 1
+		variance += p * (p - n) / (n * n * (n - 1))
+	}
+	if variance == 0 {
+		return nil
+	}
+	z := (observed - mean) / math.Sqrt(variance)
+	return &z
+}
@@ -0,0 +1,41 @@
+package smoke
+
+import (
+	"strconv"
+	"testing"
+	"time"
+)
+
+// history is 40 hourly runs of the listener check up to testNow, failing
+// at the runs given.
+func history(fails ...int) []Record {
+	var out []Record
+	for i := range 40 {
+		outcome := Pass
+		for _, f := range fails {
+			if f == i {
+				outcome = Fail
+			}
+		}
+		out = append(out, Record{
+			Image: "runner", Variant: "2.331.0", Check: listener, Outcome: outcome,
+			Time: testNow.Add(time.Duration(i-40) * time.Hour), Run: strconv.Itoa(i), Attempt: 1,
+			ImageID: "sha256:" + strconv.Itoa(i),
+		})
+	}
+	return out
+}
+
+func TestAnalyzeScattered(t *testing.T) {
+	s := DefaultAnalysis.Analyze(history(3, 11, 17, 26, 33))
+	if len(s) != 1 || !s[0].Flaky || s[0].Failures != 5 {
+		t.Errorf("stats %+v, want flaky", s)
+	}
+}
+
+func TestAnalyzeStreak(t *testing.T) {
+	s := DefaultAnalysis.Analyze(history(20, 21, 22, 23, 24))
+	if len(s) != 1 || s[0].Flaky || s[0].Z == nil || *s[0].Z > -3 {
+		t.Errorf("stats %+v, want a streak, not flaky", s)
+	}
+}
@@ -0,0 +1,117 @@
+package smoke
+
+import (
+	"bufio"
+	"encoding/json"
+	"fmt"
+	"os"
+	"path/filepath"
+	"sort"
+	"time"
+)
+
+// Record is the outcome of one check in one attempt of a smoke test.
+type Record struct {
+	Image    string    `json:"image"`
+	Variant  string    `json:"variant"`
+	Platform string    `json:"platform,omitempty"`
+	Check    string    `json:"check"`
+	Name     string    `json:"name"`
+	Outcome  string    `json:"outcome"`
+	Detail   string    `json:"detail,omitempty"`
+	Time     time.Time `json:"time"`
+	// Run identifies the run the attempt belongs to; Attempt counts from
+	// 1 within it.
+	Run     string `json:"run"`
+	Attempt int    `json:"attempt"`
+	// ImageID is the ID of the image tested: attempts on the same ID had
+	// identical inputs.
+	ImageID string `json:"image_id,omitempty"`
+	// Quarantined is set on failures the quarantine let through.
+	Quarantined bool `json:"quarantined,omitempty"`
+}
+
+// History is the loaded outcomes, oldest first.
+type History struct {
+	Records []Record
+}
+
+// Load reads the history at path. A missing file is an empty history.
+func Load(path string) (*History, error) {
+	f, err := os.Open(path)
+	if os.IsNotExist(err) {
+		return &History{}, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+	defer f.Close()
+
+	h := &History{}
+	sc := bufio.NewScanner(f)
+	sc.Buffer(make([]byte, 0, 64*1024), 4*1024*1024)
+	for line := 1; sc.Scan(); line++ {
+		if len(sc.Bytes()) == 0 {
+			continue
+		}
+		var r Record
+		if err := json.Unmarshal(sc.Bytes(), &r); err != nil {
+			return nil, fmt.Errorf("%s:%d: %w", path, line, err)
+		}
+		h.Records = append(h.Records, r)
+	}
+	if err := sc.Err(); err != nil {
+		return nil, err
+	}
+	sort.SliceStable(h.Records, func(i, j int) bool { return h.Records[i].Time.Before(h.Records[j].Time) })
+	return h, nil
+}
+
+// Append adds records to the history at path, creating it if needed.
+func Append(path string, records ...Record) error {
+	if err := os.MkdirAll(filepath.Dir(path), 0o755); err != nil {
+		return err
+	}
+	f, err := os.OpenFile(path, os.O_CREATE|os.O_APPEND|os.O_WRONLY, 0o644)
+	if err != nil {
+		return err
+	}
+	for _, r := range records {
+		data, err := json.Marshal(r)
+		if err != nil {
+			f.Close()
+			return err
+		}
+		if _, err := f.Write(append(data, '\n')); err != nil {
+			f.Close()
+			return err
+		}
+	}
+	return f.Close()
+}
+
+// Records returns the records of attempts, as recorded for one run of
+// the smoke test of an image variant.
+func Records(image, variant, platform, run, imageID string, now time.Time, attempts []Attempt, q *Quarantine) []Record {
+	var out []Record
+	for i, a := range attempts {
+		for _, c := range a.Checks {
+			r := Record{
+				Image: image, Variant: variant, Platform: platform,
+				Check: c.ID, Name: c.Name, Outcome: c.Outcome, Detail: c.Detail,
+				Time: now, Run: run, Attempt: i + 1, ImageID: imageID,
+			}
+			if c.Outcome == Fail && q != nil {
+				_, r.Quarantined = q.Active(image, c.ID, now)
+			}
+			out = append(out, r)
+		}
+	}
+	return out
+}
+
+// Since returns the records at or after t.
+func (h *History) Since(t time.Time) []Record {
+	i := sort.Search(len(h.Records), func(i int) bool { return !h.Records[i].Time.Before(t) })
+	return h.Records[i:]
+}
@@ -0,0 +1,188 @@
+package smoke
+
+import (
+	"encoding/json"
+	"fmt"
+	"io"
+	"os"
+	"time"
+)
+
+// DefaultQuarantine is where the quarantine list lives relative to the
+// repo root.
+const DefaultQuarantine = "ci/quarantine.json"
+
+// MaxQuarantine is the longest an entry may last: a quarantined check is
+// fixed, or quarantined again on purpose.
+const MaxQuarantine = 30 * 24 * time.Hour
+
+// Entry quarantines a check of an image until a date: its failures are
+// reported but do not fail the build.
+type Entry struct {
+	Image string `json:"image"`
+	Check string `json:"check"`
+	// Reason says why, an issue link ideally.
+	Reason string `json:"reason"`
+	Since  string `json:"since"`
+	Until  string `json:"until"`
+
+	since, until time.Time
+}
+
+// Expires is the end of the last day of the entry.
+func (e Entry) Expires() time.Time { return e.until.Add(24 * time.Hour) }
+
+// Quarantine is the quarantine list.
+type Quarantine struct {
+	Checks []Entry `json:"checks"`
+}
+
+// LoadQuarantine reads and checks the quarantine list at path. A missing
+// file is an empty list.
+func LoadQuarantine(path string) (*Quarantine, error) {
+	data, err := os.ReadFile(path)
+	if os.IsNotExist(err) {
+		return &Quarantine{}, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+	var q Quarantine
+	if err := json.Unmarshal(data, &q); err != nil {
+		return nil, fmt.Errorf("%s: %w", path, err)
+	}
+	seen := map[string]bool{}
+	for i := range q.Checks {
+		e := &q.Checks[i]
+		if err := e.parse(); err != nil {
+			return nil, fmt.Errorf("%s: %s %s: %w", path, e.Image, e.Check, err)
+		}
+		key := e.Image + "/" + e.Check
+		if seen[key] {
+			return nil, fmt.Errorf("%s: %s quarantined twice", path, key)
+		}
+		seen[key] = true
+	}
+	return &q, nil
+}
+
+func (e *Entry) parse() error {
+	if e.Image == "" || e.Check == "" {
+		return fmt.Errorf("image and check are required")
+	}
+	if e.Check == Script {
+		return fmt.Errorf("%s is the whole smoke test, quarantine one of its checks", Script)
+	}
+	if e.Reason == "" {
+		return fmt.Errorf("no reason")
+	}
+	var err error
+	if e.since, err = time.Parse(time.DateOnly, e.Since); err != nil {
+		return fmt.Errorf("since: %w", err)
+	}
+	if e.until, err = time.Parse(time.DateOnly, e.Until); err != nil {
+		return fmt.Errorf("until: %w", err)
+	}
+	if e.until.Before(e.since) || e.until.Sub(e.since) > MaxQuarantine {
+		return fmt.Errorf("until %s must be within %d days of since %s", e.Until, int(MaxQuarantine.Hours()/24), e.Since)
+	}
+	return nil
+}
+
+// Active returns the entry of the check of image in force at t.
+func (q *Quarantine) Active(image, check string, t time.Time) (Entry, bool) {
+	for _, e := range q.Checks {
+		if e.Image == image && e.Check == check && !t.Before(e.since) && t.Before(e.Expires()) {
+			return e, true
+		}
+	}
+	return Entry{}, false
+}
+
+// Verdict reports the outcome of the attempts at a smoke test of image on
+// w and returns an error when it must fail the build: the last attempt
+// failed a check that is not quarantined at t, or a quarantined one that
+// stopped the test before its other checks ran.
+func (q *Quarantine) Verdict(w io.Writer, image string, attempts []Attempt, t time.Time) error {
+	last := attempts[len(attempts)-1]
+	if last.Passed {
+		if first := attempts[0].Failed(); first != nil {
+			fmt.Fprintf(w, "  [warn] %s failed, then passed on retry: %s\n", first.Name, first.Detail)
+		}
+		return nil
+	}
+	c := last.Failed()
+	e, ok := q.Active(image, c.ID, t)
+	if !ok {
+		return fmt.Errorf("%s failed (check %s): %s", c.Name, c.ID, c.Detail)
+	}
+	if last.Skipped > 0 {
+		return fmt.Errorf("%s failed (check %s, quarantined until %s) and the checks after it did not run (%d): %s",
+			c.Name, c.ID, e.Until, last.Skipped, c.Detail)
+	}
+	fmt.Fprintf(w, "  [warn] %s failed but is quarantined until %s (%s): %s\n", c.Name, e.Until, e.Reason, c.Detail)
+	return nil
+}
+
+// Expired returns the entries past their date at t, which
+// quarantine nothing any more and should be removed or renewed.
+func (q *Quarantine) Expired(t time.Time) []Entry {
+	var out []Entry
+	for _, e := range q.Checks {
+		if !t.Before(e.Expires()) {
+			out = append(out, e)
+		}
+	}
+	return out
+}
+
+// Of returns the entries of image.
+func (q *Quarantine) Of(image string) []Entry {
+	var out []Entry
+	for _, e := range q.Checks {
+		if e.Image == image {
+			out = append(out, e)
+		}
+	}
+	return out
+}
+
+// Status is where a quarantine entry stands.
+type Status struct {
+	Entry
+	Expired bool `json:"expired"`
+	// Runs counts the runs of the check since the entry began, Failures
+	// those it failed on its first attempt.
+	Runs        int       `json:"runs"`
+	Failures    int       `json:"failures"`
+	LastFailure time.Time `json:"last_failure,omitzero"`
+}
+
+// Liftable reports whether the check ran without failing since it was
+// quarantined, so the entry can go.
+func (s Status) Liftable() bool { return s.Runs > 0 && s.Failures == 0 }
+
+// Status returns where every entry stands at now given the records of the
+// history.
+func (q *Quarantine) Status(records []Record, now time.Time) []Status {
+	var out []Status
+	for _, e := range q.Checks {
+		s := Status{Entry: e, Expired: !now.Before(e.Expires())}
+		runs := map[string]bool{}
+		for _, r := range records {
+			if r.Image != e.Image || r.Check != e.Check || r.Time.Before(e.since) || r.Attempt != 1 {
+				continue
+			}
+			if !runs[r.Run] {
+				runs[r.Run] = true
+				s.Runs++
+			}
+			if r.Outcome == Fail {
+				s.Failures++
+				s.LastFailure = r.Time
+			}
+		}
+		out = append(out, s)
+	}
+	return out
+}
@@ -0,0 +1,101 @@
+package smoke
+
+import (
+	"io"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+// loadQuarantine loads a quarantine list holding the given entries.
+func loadQuarantine(t *testing.T, entries string) (*Quarantine, error) {
+	t.Helper()
+	path := filepath.Join(t.TempDir(), "quarantine.json")
+	if err := os.WriteFile(path, []byte(`{"checks": [`+entries+`]}`), 0o644); err != nil {
+		t.Fatal(err)
+	}
+	return LoadQuarantine(path)
+}
+
+// testQuarantine quarantines the listener check of runner from 2026-10-10
+// to 2026-10-24.
+func testQuarantine(t *testing.T) *Quarantine {
+	t.Helper()
+	q, err := loadQuarantine(t, `{"image": "runner", "check": "`+listener+
+		`", "reason": "times out on busy hosts", "since": "2026-10-10", "until": "2026-10-24"}`)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return q
+}
+
+func TestVerdictQuarantined(t *testing.T) {
+	q, err := loadQuarantine(t, `{"image": "runner", "check": "`+dockerCLI+
+		`", "reason": "flaky daemon", "since": "2026-10-10", "until": "2026-10-24"}`)
+	if err != nil {
+		t.Fatal(err)
+	}
+	attempts := runTestAt(t, 3, 5, 1)
+	if err := q.Verdict(io.Discard, "runner", attempts, testNow); err != nil {
+		t.Errorf("quarantined failure blocked: %v", err)
+	}
+	if q.Verdict(io.Discard, "other", attempts, testNow) == nil {
+		t.Error("quarantine of runner let a failure of another image through")
+	}
+	for _, r := range Records("runner", "2.331.0", "linux/amd64", "r1", "sha256:1", testNow, attempts, q) {
+		if r.Quarantined != (r.Outcome == Fail) {
+			t.Errorf("%s %s: quarantined %v", r.Check, r.Outcome, r.Quarantined)
+		}
+	}
+}
+
+// TestVerdictQuarantinedSkipping blocks a quarantined failure that stopped
+// the test before its last check: the image would publish untested.
+func TestVerdictQuarantinedSkipping(t *testing.T) {
+	err := testQuarantine(t).Verdict(io.Discard, "runner", runTest(t, 5, 1), testNow)
+	if err == nil || !strings.Contains(err.Error(), "the checks after it did not run (1)") {
+		t.Errorf("verdict %v, want the skipped check to block", err)
+	}
+}
+
+func TestVerdictExpired(t *testing.T) {
+	q := testQuarantine(t)
+	later := testNow.AddDate(0, 0, 8)
+	if q.Verdict(io.Discard, "runner", runTest(t, 5, 0), later) == nil {
+		t.Error("failure let through after the quarantine ended")
+	}
+	if st := q.Status(nil, later); len(st) != 1 || !st[0].Expired || len(q.Expired(later)) != 1 {
+		t.Errorf("status %+v not expired", st)
+	}
+	if _, ok := q.Active("runner", listener, testNow.AddDate(0, 0, 7)); !ok {
+		t.Error("quarantine over before the end of its last day")
+	}
+}
+
+func TestLoadQuarantineInvalid(t *testing.T) {
+	for name, entry := range map[string]string{
+		"no reason":  `"reason": "", "since": "2026-10-10", "until": "2026-10-24"`,
+		"too long":   `"reason": "x", "since": "2026-10-10", "until": "2026-12-24"`,
+		"backwards":  `"reason": "x", "since": "2026-10-10", "until": "2026-10-01"`,
+		"bad date":   `"reason": "x", "since": "10/10/2026", "until": "2026-10-24"`,
+		"whole test": `"reason": "x", "since": "2026-10-10", "until": "2026-10-24"}, {"image": "runner", "check": "test.sh", "reason": "x", "since": "2026-10-10", "until": "2026-10-24"`,
+		"duplicated": `"reason": "x", "since": "2026-10-10", "until": "2026-10-24"}, {"image": "runner", "check": "c", "reason": "x", "since": "2026-10-10", "until": "2026-10-24"`,
+	} {
+		if _, err := loadQuarantine(t, `{"image": "runner", "check": "c", `+entry+`}`); err == nil {
+			t.Errorf("%s: accepted", name)
+		}
+	}
+}
+
+func TestStatusLiftable(t *testing.T) {
+	q := testQuarantine(t)
+	st := q.Status(history(), testNow)
+	if len(st) != 1 || !st[0].Liftable() || st[0].Runs == 0 {
+		t.Errorf("status %+v, want liftable", st)
+	}
+	st = q.Status(history(38), testNow)
+	if len(st) != 1 || st[0].Liftable() || st[0].Failures != 1 {
+		t.Errorf("status %+v, want failing", st)
+	}
+}
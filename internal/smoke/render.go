@@ -0,0 +1,72 @@
+package smoke
+
+import (
+	"fmt"
+	"io"
+	"strings"
+	"time"
+)
+
+// Report is the flaky checks and the state of the quarantine.
+type Report struct {
+	Checks     []Stats  `json:"checks"`
+	Quarantine []Status `json:"quarantine"`
+}
+
+// Markdown writes the report as a markdown document.
+func (r *Report) Markdown(w io.Writer, q *Quarantine, now time.Time) error {
+	var b strings.Builder
+	b.WriteString("# Smoke checks\n")
+
+	fmt.Fprintf(&b, "\n## Flaky (%d)\n\n", len(r.Checks))
+	if len(r.Checks) == 0 {
+		b.WriteString("No flaky checks.\n")
+	} else {
+		b.WriteString("| Image | Check | Runs | Failures | Retried | z | Quarantine | Why |\n")
+		b.WriteString("|---|---|---:|---:|---:|---:|---|---|\n")
+		for _, s := range r.Checks {
+			z := "n/a"
+			if s.Z != nil {
+				z = fmt.Sprintf("%.2f", *s.Z)
+			}
+			quarantine := "no"
+			if e, ok := q.Active(s.Image, s.Check, now); ok {
+				quarantine = "until " + e.Until
+			}
+			why := s.Reason
+			if why == "" {
+				why = "not flaky"
+			}
+			fmt.Fprintf(&b, "| %s | %s | %d | %d | %d | %s | %s | %s |\n",
+				s.Image, s.Check, s.Runs, s.Failures, s.Retried, z, quarantine, why)
+		}
+	}
+
+	fmt.Fprintf(&b, "\n## Quarantined (%d)\n\n", len(r.Quarantine))
+	if len(r.Quarantine) == 0 {
+		b.WriteString("No quarantined checks.\n")
+	} else {
+		b.WriteString("| Image | Check | Until | Runs | Failures | State | Reason |\n")
+		b.WriteString("|---|---|---|---:|---:|---|---|\n")
+		for _, s := range r.Quarantine {
+			fmt.Fprintf(&b, "| %s | %s | %s | %d | %d | %s | %s |\n",
+				s.Image, s.Check, s.Until, s.Runs, s.Failures, s.State(), s.Reason)
+		}
+	}
+
+	_, err := io.WriteString(w, b.String())
+	return err
+}
+
+// State sums up the entry: expired, can be lifted, or still failing.
+func (s Status) State() string {
+	switch {
+	case s.Expired:
+		return "expired, failures block again"
+	case s.Liftable():
+		return "no failures, can be lifted"
+	case s.Failures > 0:
+		return fmt.Sprintf("failing, last %s", s.LastFailure.Format(time.DateOnly))
+	}
+	return "no runs yet"
+}
@@ -0,0 +1,181 @@
+// Package smoke runs the test.sh smoke tests of images check by check,
+// keeps the outcome of every check across runs, tells flaky checks from
+// broken ones and lets failures of quarantined checks through.
+//
+// Smoke tests announce their checks with progress lines
+// (echo "[4/9] Verifying Runner.Listener starts correctly...") and stop at
+// the first failure. A run that exits zero passed every check it
+// announced; one that fails failed the last check announced and the
+// following ones, up to the total of the progress line, did not run. A
+// test without progress lines is a single check, test.sh.
+package smoke
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"os/exec"
+	"regexp"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// Check outcomes.
+const (
+	Pass = "pass"
+	Fail = "fail"
+)
+
+// Script is the ID of the check of a test without progress lines, and of
+// a failure before the first one.
+const Script = "test.sh"
+
+// Check is the outcome of one check of a run.
+type Check struct {
+	// ID is derived from Name: verifying-runner-listener-starts-correctly.
+	ID      string
+	Name    string
+	Outcome string
+	// Detail is the last FAIL line of a failed check, or its last line.
+	Detail string
+}
+
+// Attempt is one run of a smoke test.
+type Attempt struct {
+	Checks []Check
+	Passed bool
+	// Skipped counts the checks announced after the failed one, which did
+	// not run.
+	Skipped  int
+	Duration time.Duration
+}
+
+// Failed returns the check the attempt failed at, nil when it passed.
+func (a *Attempt) Failed() *Check {
+	for i := range a.Checks {
+		if a.Checks[i].Outcome == Fail {
+			return &a.Checks[i]
+		}
+	}
+	return nil
+}
+
+var (
+	progress = regexp.MustCompile(`^\[(\d+)/(\d+)\]\s+(.+?)\.*$`)
+	nonWord  = regexp.MustCompile(`[^a-z0-9]+`)
+)
+
+// ID returns the check ID of a check name.
+func ID(name string) string {
+	return strings.Trim(nonWord.ReplaceAllString(strings.ToLower(name), "-"), "-")
+}
+
+// Parse returns the attempt of a run from its output, and whether it
+// exited zero.
+func Parse(output []byte, passed bool) Attempt {
+	var checks []Check
+	var lines []string
+	var n, total int
+	for _, line := range strings.Split(string(output), "\n") {
+		line = strings.TrimRight(line, "\r")
+		if m := progress.FindStringSubmatch(strings.TrimSpace(line)); m != nil {
+			n, _ = strconv.Atoi(m[1])
+			total, _ = strconv.Atoi(m[2])
+			checks = append(checks, Check{ID: ID(m[3]), Name: m[3], Outcome: Pass})
+			lines = nil
+			continue
+		}
+		if strings.TrimSpace(line) != "" {
+			lines = append(lines, strings.TrimSpace(line))
+		}
+	}
+	if len(checks) == 0 {
+		checks = []Check{{ID: Script, Name: "smoke test", Outcome: Pass}}
+	}
+	a := Attempt{Checks: checks, Passed: passed}
+	if !passed {
+		last := &checks[len(checks)-1]
+		last.Outcome = Fail
+		last.Detail = detail(lines)
+		a.Skipped = max(total-n, 0)
+	}
+	return a
+}
+
+// detail is the last FAIL line of the output of a check, else its last
+// line.
+func detail(lines []string) string {
+	for i := len(lines) - 1; i >= 0; i-- {
+		if strings.HasPrefix(lines[i], "FAIL") {
+			return lines[i]
+		}
+	}
+	if len(lines) > 0 {
+		return lines[len(lines)-1]
+	}
+	return ""
+}
+
+// Runner runs a smoke test.
+type Runner struct {
+	// Script is the test.sh, run with bash and Args (the image reference
+	// and its version).
+	Script string
+	Args   []string
+	// Env is added to the environment of the test.
+	Env []string
+	// Output receives the output of the test as it runs.
+	Output io.Writer
+	// Retries is how many times a failed run is run again. A check that
+	// fails then passes on the same image is flaky.
+	Retries int
+	Bin     string
+}
+
+// Run runs the test until it passes or Retries is exhausted and returns
+// every attempt. An error is returned only when the test could not run.
+func (r *Runner) Run(ctx context.Context) ([]Attempt, error) {
+	var attempts []Attempt
+	for i := 0; i <= r.Retries; i++ {
+		a, err := r.attempt(ctx)
+		if err != nil {
+			return attempts, err
+		}
+		attempts = append(attempts, a)
+		if a.Passed {
+			break
+		}
+	}
+	return attempts, nil
+}
+
+func (r *Runner) attempt(ctx context.Context) (Attempt, error) {
+	bin := r.Bin
+	if bin == "" {
+		bin = "bash"
+	}
+	cmd := exec.CommandContext(ctx, bin, append([]string{r.Script}, r.Args...)...)
+	cmd.Env = append(os.Environ(), r.Env...)
+	var out bytes.Buffer
+	w := io.Writer(&out)
+	if r.Output != nil {
+		w = io.MultiWriter(&out, r.Output)
+	}
+	cmd.Stdout, cmd.Stderr = w, w
+	start := time.Now()
+	err := cmd.Run()
+	var exit *exec.ExitError
+	if err != nil && !errors.As(err, &exit) {
+		return Attempt{}, fmt.Errorf("%s: %w", r.Script, err)
+	}
+	if ctx.Err() != nil {
+		return Attempt{}, fmt.Errorf("%s: %w", r.Script, ctx.Err())
+	}
+	a := Parse(out.Bytes(), err == nil)
+	a.Duration = time.Since(start)
+	return a, nil
+}
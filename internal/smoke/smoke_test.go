@@ -0,0 +1,123 @@
+package smoke
+
+import (
+	"context"
+	"io"
+	"os"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"testing"
+	"time"
+)
+
+// testScript is a test.sh in the style of the image ones: three checks,
+// check $FAIL_AT failing while the file $FAIL_FILE holds a positive count,
+// which each run decrements.
+const testScript = `set -euo pipefail
+fail_at() {
+    n=$(cat "$FAIL_FILE" 2>/dev/null || echo 0)
+    if [ "$FAIL_AT" = "$1" ] && [ "$n" -gt 0 ]; then
+        echo $((n - 1)) > "$FAIL_FILE"
+        echo "FAIL: $2"
+        exit 1
+    fi
+}
+echo "[1/3] Verifying image starts..."
+echo "  started $1 $2"
+echo "[2/3] Verifying Runner.Listener starts correctly..."
+fail_at 2 "Runner.Listener --help timed out"
+echo "[3/3] Verifying docker CLI..."
+fail_at 3 "docker not found"
+`
+
+// The second and the last check of the test script.
+const (
+	listener  = "verifying-runner-listener-starts-correctly"
+	dockerCLI = "verifying-docker-cli"
+)
+
+var testNow = time.Date(2026, 10, 17, 12, 0, 0, 0, time.UTC)
+
+// runTest runs the test script with the listener check failing its first
+// fails runs.
+func runTest(t *testing.T, fails, retries int) []Attempt {
+	t.Helper()
+	return runTestAt(t, 2, fails, retries)
+}
+
+// runTestAt runs the test script with check at failing its first fails
+// runs.
+func runTestAt(t *testing.T, at, fails, retries int) []Attempt {
+	t.Helper()
+	dir := t.TempDir()
+	script, failFile := filepath.Join(dir, "test.sh"), filepath.Join(dir, "fail")
+	if err := os.WriteFile(script, []byte(testScript), 0o755); err != nil {
+		t.Fatal(err)
+	}
+	if err := os.WriteFile(failFile, []byte(strconv.Itoa(fails)), 0o644); err != nil {
+		t.Fatal(err)
+	}
+	r := &Runner{Script: script, Args: []string{"runner:test", "2.331.0"},
+		Env: []string{"FAIL_FILE=" + failFile, "FAIL_AT=" + strconv.Itoa(at)}, Retries: retries}
+	attempts, err := r.Run(context.Background())
+	if err != nil {
+		t.Fatal(err)
+	}
+	return attempts
+}
+
+func TestRunPass(t *testing.T) {
+	attempts := runTest(t, 0, 1)
+	if len(attempts) != 1 || !attempts[0].Passed {
+		t.Fatalf("%d attempts, want 1 passing", len(attempts))
+	}
+	var ids []string
+	for _, c := range attempts[0].Checks {
+		if c.Outcome != Pass {
+			t.Errorf("%s: %s", c.ID, c.Outcome)
+		}
+		ids = append(ids, c.ID)
+	}
+	if want := "verifying-image-starts " + listener + " " + dockerCLI; strings.Join(ids, " ") != want {
+		t.Errorf("checks %v, want %s", ids, want)
+	}
+	if err := (&Quarantine{}).Verdict(io.Discard, "runner", attempts, testNow); err != nil {
+		t.Error(err)
+	}
+}
+
+func TestRunFailure(t *testing.T) {
+	attempts := runTest(t, 5, 1)
+	if len(attempts) != 2 {
+		t.Fatalf("%d attempts, want 2", len(attempts))
+	}
+	f := attempts[1].Failed()
+	if f == nil || f.ID != listener || f.Detail != "FAIL: Runner.Listener --help timed out" {
+		t.Errorf("failed check %+v", f)
+	}
+	if n := len(attempts[1].Checks); n != 2 || attempts[1].Skipped != 1 {
+		t.Errorf("%d checks recorded, %d skipped, want the 2 that ran and 1 skipped", n, attempts[1].Skipped)
+	}
+	if (&Quarantine{}).Verdict(io.Discard, "runner", attempts, testNow) == nil {
+		t.Error("failure let through")
+	}
+}
+
+func TestRunRetry(t *testing.T) {
+	attempts := runTest(t, 1, 1)
+	if len(attempts) != 2 || attempts[0].Passed || !attempts[1].Passed {
+		t.Fatalf("%d attempts, want a failure then a pass", len(attempts))
+	}
+	q := &Quarantine{}
+	if err := q.Verdict(io.Discard, "runner", attempts, testNow); err != nil {
+		t.Error(err)
+	}
+	records := Records("runner", "2.331.0", "linux/amd64", "r1", "sha256:1", testNow, attempts, q)
+	for _, s := range DefaultAnalysis.Analyze(records) {
+		if s.Check == listener && s.Flaky && s.Retried == 1 {
+			return
+		}
+	}
+	t.Error("listener check not flagged flaky")
+}
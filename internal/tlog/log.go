@@ -0,0 +1,277 @@
+// Package tlog is the factory's local transparency log. Every signature and
+// tag promotion is appended as an entry to a Merkle tree (RFC 6962 hashing);
+// the tree head is signed with the factory signing key, and inclusion proofs
+// show that a signature was logged without trusting whoever holds the log.
+//
+// The log lives in <state>/tlog: entries.jsonl holds one entry per line, the
+// line bytes being the leaf data, and head.json the latest signed tree head.
+package tlog
+
+import (
+	"bufio"
+	"bytes"
+	"crypto/ecdsa"
+	"crypto/rand"
+	"crypto/sha256"
+	"encoding/base64"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+	"time"
+
+	"github.com/gillouche/container-factory/internal/signing"
+)
+
+// Entry kinds.
+const (
+	KindSignature = "signature"
+	KindPromotion = "promotion"
+)
+
+// Entry is one logged event.
+type Entry struct {
+	Kind       string    `json:"kind"`
+	Time       time.Time `json:"time"`
+	Repository string    `json:"repository"`
+	Digest     string    `json:"digest"`
+	// Tag is the tag moved by a promotion.
+	Tag string `json:"tag,omitempty"`
+	// KeyID and Signature identify a logged signature.
+	KeyID     string `json:"key_id,omitempty"`
+	Signature string `json:"signature,omitempty"`
+}
+
+// TreeHead is a signed commitment to the first Size entries of the log.
+type TreeHead struct {
+	Size      int       `json:"size"`
+	RootHash  string    `json:"root_hash"`
+	Time      time.Time `json:"time"`
+	KeyID     string    `json:"key_id"`
+	Signature string    `json:"signature"`
+}
+
+func (h TreeHead) message() []byte {
+	return fmt.Appendf(nil, "factory-tlog\n%d\n%s\n%s\n", h.Size, h.RootHash, h.Time.UTC().Format(time.RFC3339))
+}
+
+// Verify checks the tree head signature against the trusted keys. A head
+// signed by a revoked key, or outside the window of its key, is rejected.
+func (h TreeHead) Verify(trusted *signing.TrustedKeys) error {
+	if err := trusted.ValidAt(h.KeyID, h.Time); err != nil {
+		return fmt.Errorf("tree head: %w", err)
+	}
+	k, _ := trusted.Lookup(h.KeyID)
+	pub, err := k.Public()
+	if err != nil {
+		return err
+	}
+	sig, err := base64.StdEncoding.DecodeString(h.Signature)
+	if err != nil {
+		return fmt.Errorf("tree head signature: %w", err)
+	}
+	sum := sha256.Sum256(h.message())
+	if !ecdsa.VerifyASN1(pub, sum[:], sig) {
+		return errors.New("invalid tree head signature")
+	}
+	return nil
+}
+
+// Proof shows that an entry is included in a signed tree head.
+type Proof struct {
+	Index  int      `json:"index"`
+	Entry  Entry    `json:"entry"`
+	Leaf   string   `json:"leaf"`
+	Hashes []string `json:"hashes"`
+	Head   TreeHead `json:"head"`
+}
+
+// Verify checks the proof and the tree head it refers to.
+func (p Proof) Verify(trusted *signing.TrustedKeys) error {
+	if err := p.Head.Verify(trusted); err != nil {
+		return err
+	}
+	leaf, err := base64.StdEncoding.DecodeString(p.Leaf)
+	if err != nil {
+		return fmt.Errorf("leaf: %w", err)
+	}
+	var e Entry
+	if err := json.Unmarshal(leaf, &e); err != nil || !sameEntry(e, p.Entry) {
+		return errors.New("leaf does not encode the entry")
+	}
+	root, err := hex.DecodeString(p.Head.RootHash)
+	if err != nil {
+		return fmt.Errorf("root hash: %w", err)
+	}
+	hashes := make([][]byte, len(p.Hashes))
+	for i, h := range p.Hashes {
+		if hashes[i], err = hex.DecodeString(h); err != nil {
+			return fmt.Errorf("proof hash: %w", err)
+		}
+	}
+	return VerifyInclusion(p.Index, p.Head.Size, LeafHash(leaf), hashes, root)
+}
+
+// Log is the transparency log stored in a directory.
+type Log struct {
+	dir     string
+	entries []Entry
+	leaves  [][]byte
+	raw     [][]byte
+}
+
+// Open loads the log in dir; a missing directory is an empty log.
+func Open(dir string) (*Log, error) {
+	l := &Log{dir: dir}
+	f, err := os.Open(l.entriesPath())
+	if os.IsNotExist(err) {
+		return l, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+	defer f.Close()
+
+	sc := bufio.NewScanner(f)
+	sc.Buffer(nil, 1<<20)
+	for sc.Scan() {
+		line := bytes.Clone(sc.Bytes())
+		var e Entry
+		if err := json.Unmarshal(line, &e); err != nil {
+			return nil, fmt.Errorf("%s:%d: %w", l.entriesPath(), len(l.entries)+1, err)
+		}
+		l.entries = append(l.entries, e)
+		l.leaves = append(l.leaves, LeafHash(line))
+		l.raw = append(l.raw, line)
+	}
+	return l, sc.Err()
+}
+
+func (l *Log) entriesPath() string { return filepath.Join(l.dir, "entries.jsonl") }
+
+func (l *Log) headPath() string { return filepath.Join(l.dir, "head.json") }
+
+// Size is the number of entries.
+func (l *Log) Size() int { return len(l.entries) }
+
+// Entries returns the entries in log order.
+func (l *Log) Entries() []Entry { return l.entries }
+
+// Append adds an entry and returns its index. Entries are written with a
+// single O_APPEND write so concurrent builds sharing the state directory do
+// not interleave; the index is the entry's position once written.
+func (l *Log) Append(e Entry) (int, error) {
+	if e.Time.IsZero() {
+		e.Time = time.Now().UTC()
+	}
+	line, err := json.Marshal(e)
+	if err != nil {
+		return 0, err
+	}
+	if err := os.MkdirAll(l.dir, 0o755); err != nil {
+		return 0, err
+	}
+	f, err := os.OpenFile(l.entriesPath(), os.O_APPEND|os.O_CREATE|os.O_WRONLY, 0o644)
+	if err != nil {
+		return 0, err
+	}
+	if _, err := f.Write(append(line, '\n')); err != nil {
+		f.Close()
+		return 0, err
+	}
+	if err := f.Close(); err != nil {
+		return 0, err
+	}
+
+	fresh, err := Open(l.dir)
+	if err != nil {
+		return 0, err
+	}
+	*l = *fresh
+	for i := len(l.raw) - 1; i >= 0; i-- {
+		if bytes.Equal(l.raw[i], line) {
+			return i, nil
+		}
+	}
+	return 0, errors.New("appended entry not found in the log")
+}
+
+// Sign signs the head of the current tree and saves it as the latest head.
+func (l *Log) Sign(key *ecdsa.PrivateKey) (TreeHead, error) {
+	h := TreeHead{
+		Size:     l.Size(),
+		RootHash: hex.EncodeToString(RootHash(l.leaves)),
+		Time:     time.Now().UTC().Truncate(time.Second),
+		KeyID:    signing.KeyID(&key.PublicKey),
+	}
+	sum := sha256.Sum256(h.message())
+	sig, err := ecdsa.SignASN1(rand.Reader, key, sum[:])
+	if err != nil {
+		return TreeHead{}, err
+	}
+	h.Signature = base64.StdEncoding.EncodeToString(sig)
+
+	// An older head never replaces a newer one written by a concurrent build.
+	if cur, err := l.Head(); err == nil && cur.Size > h.Size {
+		return h, nil
+	}
+	data, err := json.MarshalIndent(h, "", "  ")
+	if err != nil {
+		return TreeHead{}, err
+	}
+	tmp := l.headPath() + ".tmp"
+	if err := os.WriteFile(tmp, data, 0o644); err != nil {
+		return TreeHead{}, err
+	}
+	return h, os.Rename(tmp, l.headPath())
+}
+
+// Head returns the latest signed tree head.
+func (l *Log) Head() (TreeHead, error) {
+	var h TreeHead
+	data, err := os.ReadFile(l.headPath())
+	if err != nil {
+		return h, err
+	}
+	if err := json.Unmarshal(data, &h); err != nil {
+		return h, fmt.Errorf("%s: %w", l.headPath(), err)
+	}
+	return h, nil
+}
+
+// Prove returns the inclusion proof of entry index in the tree of head.
+func (l *Log) Prove(index int, head TreeHead) (Proof, error) {
+	if head.Size > l.Size() {
+		return Proof{}, fmt.Errorf("tree head of size %d is ahead of the log (%d entries)", head.Size, l.Size())
+	}
+	if got := hex.EncodeToString(RootHash(l.leaves[:head.Size])); got != head.RootHash {
+		return Proof{}, fmt.Errorf("log does not match its tree head at size %d: entries were altered", head.Size)
+	}
+	hashes, err := InclusionProof(index, l.leaves[:head.Size])
+	if err != nil {
+		return Proof{}, err
+	}
+	p := Proof{Index: index, Entry: l.entries[index], Leaf: base64.StdEncoding.EncodeToString(l.raw[index]), Head: head}
+	for _, h := range hashes {
+		p.Hashes = append(p.Hashes, hex.EncodeToString(h))
+	}
+	return p, nil
+}
+
+// Find returns the index of the first entry equal to e, ignoring its time.
+func (l *Log) Find(e Entry) (int, bool) {
+	for i, x := range l.entries {
+		if sameEntry(x, Entry{Kind: e.Kind, Repository: e.Repository, Digest: e.Digest, Tag: e.Tag,
+			KeyID: e.KeyID, Signature: e.Signature, Time: x.Time}) {
+			return i, true
+		}
+	}
+	return 0, false
+}
+
+func sameEntry(a, b Entry) bool {
+	return a.Kind == b.Kind && a.Repository == b.Repository && a.Digest == b.Digest && a.Tag == b.Tag &&
+		a.KeyID == b.KeyID && a.Signature == b.Signature && a.Time.Equal(b.Time)
+}
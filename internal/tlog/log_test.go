@@ -0,0 +1,65 @@
+package tlog
+
+import (
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/gillouche/container-factory/internal/signing"
+)
+
+// TestTreeHeadWindow accepts a tree head only when its key was trusted,
+// not revoked and within its window at the time of the head.
+func TestTreeHeadWindow(t *testing.T) {
+	key, err := signing.Generate()
+	if err != nil {
+		t.Fatal(err)
+	}
+	l, err := Open(t.TempDir())
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, err := l.Append(Entry{Kind: KindPromotion, Repository: "registry.test/go", Tag: "latest", Digest: "sha256:1"}); err != nil {
+		t.Fatal(err)
+	}
+	h, err := l.Sign(key)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	day := 24 * time.Hour
+	tests := []struct {
+		name      string
+		notBefore time.Time
+		validity  time.Duration
+		revoked   bool
+		want      string
+	}{
+		{"active", h.Time.Add(-day), 2 * day, false, ""},
+		{"expired", h.Time.Add(-2 * day), day, false, "outside the window"},
+		{"pending", h.Time.Add(day), day, false, "outside the window"},
+		{"revoked", h.Time.Add(-day), 2 * day, true, "revoked"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			trusted := &signing.TrustedKeys{}
+			k, err := trusted.Add(&key.PublicKey, tt.notBefore, tt.validity)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if tt.revoked {
+				trusted.Revoke(k.ID, "compromised", h.Time)
+			}
+			err = h.Verify(trusted)
+			switch {
+			case tt.want == "" && err != nil:
+				t.Errorf("rejected: %v", err)
+			case tt.want != "" && (err == nil || !strings.Contains(err.Error(), tt.want)):
+				t.Errorf("error %v, want %q", err, tt.want)
+			}
+		})
+	}
+	if err := h.Verify(&signing.TrustedKeys{}); err == nil {
+		t.Error("accepted a tree head of an untrusted key")
+	}
+}
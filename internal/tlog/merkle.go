@@ -0,0 +1,101 @@
+package tlog
+
+import (
+	"bytes"
+	"crypto/sha256"
+	"errors"
+	"fmt"
+)
+
+// Hashes follow RFC 6962: leaves and interior nodes are domain separated so
+// a leaf cannot be passed off as a subtree.
+
+// LeafHash returns the hash of a log entry.
+func LeafHash(data []byte) []byte {
+	h := sha256.New()
+	h.Write([]byte{0x00})
+	h.Write(data)
+	return h.Sum(nil)
+}
+
+func nodeHash(left, right []byte) []byte {
+	h := sha256.New()
+	h.Write([]byte{0x01})
+	h.Write(left)
+	h.Write(right)
+	return h.Sum(nil)
+}
+
+// RootHash returns the Merkle tree hash of the leaf hashes.
+func RootHash(leaves [][]byte) []byte {
+	switch len(leaves) {
+	case 0:
+		sum := sha256.Sum256(nil)
+		return sum[:]
+	case 1:
+		return leaves[0]
+	}
+	k := split(len(leaves))
+	return nodeHash(RootHash(leaves[:k]), RootHash(leaves[k:]))
+}
+
+// InclusionProof returns the audit path of leaf m in the tree of leaves.
+func InclusionProof(m int, leaves [][]byte) ([][]byte, error) {
+	if m < 0 || m >= len(leaves) {
+		return nil, fmt.Errorf("leaf %d out of range (tree size %d)", m, len(leaves))
+	}
+	return path(m, leaves), nil
+}
+
+func path(m int, leaves [][]byte) [][]byte {
+	if len(leaves) <= 1 {
+		return nil
+	}
+	k := split(len(leaves))
+	if m < k {
+		return append(path(m, leaves[:k]), RootHash(leaves[k:]))
+	}
+	return append(path(m-k, leaves[k:]), RootHash(leaves[:k]))
+}
+
+// VerifyInclusion checks that leaf is at index of a tree of size with the
+// given root, following RFC 9162 section 2.1.3.2.
+func VerifyInclusion(index, size int, leaf []byte, proof [][]byte, root []byte) error {
+	if index < 0 || index >= size {
+		return fmt.Errorf("leaf %d out of range (tree size %d)", index, size)
+	}
+	fn, sn := index, size-1
+	r := leaf
+	for _, p := range proof {
+		if sn == 0 {
+			return errors.New("inclusion proof too long")
+		}
+		if fn&1 == 1 || fn == sn {
+			r = nodeHash(p, r)
+			for fn&1 == 0 && fn != 0 {
+				fn >>= 1
+				sn >>= 1
+			}
+		} else {
+			r = nodeHash(r, p)
+		}
+		fn >>= 1
+		sn >>= 1
+	}
+	if sn != 0 {
+		return errors.New("inclusion proof too short")
+	}
+	if !bytes.Equal(r, root) {
+		return errors.New("inclusion proof does not match the root hash")
+	}
+	return nil
+}
+
+// split returns the largest power of two smaller than n.
+func split(n int) int {
+	k := 1
+	for k<<1 < n {
+		k <<= 1
+	}
+	return k
+}
@@ -0,0 +1,230 @@
+package upstream
+
+import (
+	"context"
+	"fmt"
+	"io"
+	"net/http"
+	"net/url"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+
+	"github.com/gillouche/container-factory/internal/catalog"
+	"github.com/gillouche/container-factory/internal/dockerfile"
+	"github.com/gillouche/container-factory/internal/github"
+	"github.com/gillouche/container-factory/internal/registry"
+)
+
+// Update is a newer upstream version of a variant, in the format of the
+// check-pinned-deps report.
+type Update struct {
+	File           string `json:"file"`
+	CurrentVersion string `json:"current_version"`
+	LatestVersion  string `json:"latest_version"`
+	Type           string `json:"type"`
+	RawRef         string `json:"raw_ref"`
+}
+
+// Warning is an update that was held back.
+type Warning struct {
+	File   string `json:"file"`
+	Image  string `json:"image"`
+	Reason string `json:"reason"`
+	Type   string `json:"type"`
+}
+
+// Report is the result of a check.
+type Report struct {
+	Updates  []Update  `json:"updates"`
+	Warnings []Warning `json:"warnings"`
+}
+
+// Checker looks for upstream versions of the variants listed in
+// ci/upstream_config.json and, unless SkipArtifacts is set, proposes a
+// version only when every file the Dockerfile downloads for it can be
+// retrieved for each of the image's platforms.
+type Checker struct {
+	GitHub   *github.Client
+	Registry *registry.Client
+	HTTP     *http.Client
+	// Login returns the credentials of a download host.
+	Login         func(host string) (user, pass string, ok bool)
+	SkipArtifacts bool
+	// Log receives progress messages.
+	Log io.Writer
+}
+
+// Check checks every source of cfg. Images are looked up in cat by the
+// directory of their VARIANTS file.
+func (c *Checker) Check(ctx context.Context, cfg map[string]Source, cat *catalog.Catalog) *Report {
+	report := &Report{Updates: []Update{}, Warnings: []Warning{}}
+	files := make([]string, 0, len(cfg))
+	for f := range cfg {
+		files = append(files, f)
+	}
+	sort.Strings(files)
+
+	for _, file := range files {
+		current, err := readVersions(file)
+		if err != nil || len(current) == 0 {
+			continue
+		}
+		c.logf("Checking %s (%d versions)...", file, len(current))
+
+		available, err := Available(ctx, cfg[file], c.GitHub, c.Registry)
+		if err != nil {
+			c.logf("  %v", err)
+		}
+		if len(available) == 0 {
+			c.logf("  No upstream versions found.")
+			continue
+		}
+		c.logf("  Found %d upstream tags.", len(available))
+
+		img, hasImage := imageOf(cat, file)
+		minors := map[int]map[int]bool{}
+		for _, cv := range current {
+			v := ParseVersion(cv)
+			if minors[v.part(0)] == nil {
+				minors[v.part(0)] = map[int]bool{}
+			}
+			minors[v.part(0)][v.part(1)] = true
+		}
+
+		for _, cv := range current {
+			strict := len(minors[ParseVersion(cv).part(0)]) > 1
+			latest := Latest(cv, available, strict, cfg[file].TagTemplate)
+			if latest == "" || latest == cv {
+				c.logf("  %s is up-to-date", cv)
+				continue
+			}
+			if !c.SkipArtifacts && hasImage {
+				if reason := c.artifacts(ctx, img, latest); reason != "" {
+					c.logf("  Holding %s -> %s: %s", cv, latest, reason)
+					report.Warnings = append(report.Warnings, Warning{
+						File:   file,
+						Image:  img.Name + ":" + latest,
+						Reason: reason,
+						Type:   "artifact_unavailable",
+					})
+					continue
+				}
+			}
+			c.logf("  Found update: %s -> %s", cv, latest)
+			report.Updates = append(report.Updates, Update{
+				File:           file,
+				CurrentVersion: cv,
+				LatestVersion:  latest,
+				Type:           "variant_update",
+				RawRef:         cv,
+			})
+		}
+	}
+	return report
+}
+
+// artifacts checks the downloads of img built at version for every platform
+// and describes the downloads that failed, or returns "".
+func (c *Checker) artifacts(ctx context.Context, img catalog.Image, version string) string {
+	ins, err := dockerfile.Parse(filepath.Join(img.Dir, "Dockerfile"))
+	if err != nil {
+		return err.Error()
+	}
+	var problems []string
+	checked := map[string]bool{}
+	for _, platform := range img.Platforms {
+		for _, d := range dockerfile.Downloads(ins, dockerfile.BuildArgs(platform, version)) {
+			if len(d.Unresolved) > 0 {
+				if checked[d.Raw] {
+					continue
+				}
+				checked[d.Raw] = true
+				c.logf("  [warn] %s line %d: cannot resolve %s in %s", img.Name, d.Line, strings.Join(d.Unresolved, ", "), d.Raw)
+				continue
+			}
+			if checked[d.URL] {
+				continue
+			}
+			checked[d.URL] = true
+			if err := c.fetchable(ctx, d.URL); err != nil {
+				problems = append(problems, fmt.Sprintf("%s (%s): %v", d.URL, platform, err))
+			}
+		}
+	}
+	return strings.Join(problems, "\n")
+}
+
+// fetchable asks for the headers of u, falling back to the first byte for
+// servers that do not answer HEAD.
+func (c *Checker) fetchable(ctx context.Context, u string) error {
+	err := c.request(ctx, http.MethodHead, u)
+	if err != nil {
+		err = c.request(ctx, http.MethodGet, u)
+	}
+	return err
+}
+
+func (c *Checker) request(ctx context.Context, method, u string) error {
+	req, err := http.NewRequestWithContext(ctx, method, u, nil)
+	if err != nil {
+		return err
+	}
+	if method == http.MethodGet {
+		req.Header.Set("Range", "bytes=0-0")
+	}
+	if c.Login != nil {
+		if parsed, err := url.Parse(u); err == nil {
+			if user, pass, ok := c.Login(parsed.Hostname()); ok {
+				req.SetBasicAuth(user, pass)
+			}
+		}
+	}
+	client := c.HTTP
+	if client == nil {
+		client = http.DefaultClient
+	}
+	resp, err := client.Do(req)
+	if err != nil {
+		return err
+	}
+	io.Copy(io.Discard, io.LimitReader(resp.Body, 1<<10))
+	resp.Body.Close()
+	if resp.StatusCode != http.StatusOK && resp.StatusCode != http.StatusPartialContent {
+		return fmt.Errorf("%s", resp.Status)
+	}
+	return nil
+}
+
+func (c *Checker) logf(format string, args ...any) {
+	if c.Log != nil {
+		fmt.Fprintf(c.Log, format+"\n", args...)
+	}
+}
+
+// readVersions returns the non-empty lines of a VARIANTS file.
+func readVersions(path string) ([]string, error) {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return nil, err
+	}
+	var versions []string
+	for _, line := range strings.Split(string(data), "\n") {
+		if line = strings.TrimSpace(line); line != "" {
+			versions = append(versions, line)
+		}
+	}
+	return versions, nil
+}
+
+// imageOf returns the image whose directory holds file.
+func imageOf(cat *catalog.Catalog, file string) (catalog.Image, bool) {
+	dir := filepath.Clean(filepath.Dir(file))
+	for _, img := range cat.Images {
+		if filepath.Clean(img.Dir) == dir {
+			return img, true
+		}
+	}
+	return catalog.Image{}, false
+}
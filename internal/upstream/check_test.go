@@ -0,0 +1,124 @@
+package upstream
+
+import (
+	"bytes"
+	"context"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"slices"
+	"strings"
+	"sync"
+	"testing"
+
+	"github.com/gillouche/container-factory/internal/catalog"
+)
+
+// downloads serves the files of a release mirror, answering HEAD or, for
+// the paths in noHead, only ranged GETs, and records the requests.
+type downloads struct {
+	files  map[string]bool
+	noHead map[string]bool
+
+	mu       sync.Mutex
+	requests []string
+	auth     []string
+}
+
+func (d *downloads) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	d.mu.Lock()
+	d.requests = append(d.requests, r.Method+" "+r.URL.Path)
+	if user, pass, ok := r.BasicAuth(); ok {
+		d.auth = append(d.auth, user+":"+pass)
+	}
+	d.mu.Unlock()
+	switch {
+	case !d.files[r.URL.Path]:
+		http.NotFound(w, r)
+	case r.Method == http.MethodHead && d.noHead[r.URL.Path]:
+		w.WriteHeader(http.StatusMethodNotAllowed)
+	case r.Method == http.MethodGet && r.Header.Get("Range") == "bytes=0-0":
+		w.WriteHeader(http.StatusPartialContent)
+		w.Write([]byte("x"))
+	case r.Method == http.MethodHead:
+	default:
+		w.WriteHeader(http.StatusBadRequest)
+	}
+}
+
+// testImage writes an image whose Dockerfile downloads from host.
+func testImage(t *testing.T, host string, platforms ...string) catalog.Image {
+	t.Helper()
+	dir := t.TempDir()
+	dockerfile := `FROM scratch
+ARG TARGETARCH
+ARG VERSION=1.0.0
+ARG MIRROR=` + host + `
+RUN curl -fsSL -o /tool.tar.gz "http://${MIRROR}/tool/v${VERSION}/tool-linux-${TARGETARCH}.tar.gz" \
+    && curl -fsSL -o /tool.sha256 "http://${MIRROR}/tool/v${VERSION}/SHA256SUMS" \
+    && curl -fsSL -o /extra "http://${MIRROR}/extra/${EXTRA_VERSION}/extra"
+`
+	if err := os.WriteFile(filepath.Join(dir, "Dockerfile"), []byte(dockerfile), 0o644); err != nil {
+		t.Fatal(err)
+	}
+	return catalog.Image{Name: "tool", Dir: dir, Platforms: platforms}
+}
+
+func TestArtifacts(t *testing.T) {
+	d := &downloads{
+		files: map[string]bool{
+			"/tool/v1.0.0/tool-linux-amd64.tar.gz": true,
+			"/tool/v1.0.0/tool-linux-arm64.tar.gz": true,
+			"/tool/v1.0.0/SHA256SUMS":              true,
+			"/tool/v2.0.0/tool-linux-amd64.tar.gz": true,
+			"/tool/v2.0.0/SHA256SUMS":              true,
+		},
+		noHead: map[string]bool{"/tool/v1.0.0/SHA256SUMS": true},
+	}
+	srv := httptest.NewServer(d)
+	defer srv.Close()
+	host := strings.TrimPrefix(srv.URL, "http://")
+	var log bytes.Buffer
+	c := &Checker{
+		Login: func(h string) (string, string, bool) {
+			return "reader", "secret", h == strings.Split(host, ":")[0]
+		},
+		Log: &log,
+	}
+	ctx := context.Background()
+	img := testImage(t, host, "linux/amd64", "linux/arm64")
+
+	// Every file of every platform is there: the checksums only answer a
+	// ranged GET.
+	if problems := c.artifacts(ctx, img, "1.0.0"); problems != "" {
+		t.Errorf("1.0.0: %s", problems)
+	}
+	want := []string{
+		"HEAD /tool/v1.0.0/tool-linux-amd64.tar.gz",
+		"HEAD /tool/v1.0.0/SHA256SUMS",
+		"GET /tool/v1.0.0/SHA256SUMS",
+		"HEAD /tool/v1.0.0/tool-linux-arm64.tar.gz",
+	}
+	if !slices.Equal(d.requests, want) {
+		t.Errorf("requests %v, want %v", d.requests, want)
+	}
+	if len(d.auth) != len(d.requests) || d.auth[0] != "reader:secret" {
+		t.Errorf("credentials %v, want the login of the host on every request", d.auth)
+	}
+	if !strings.Contains(log.String(), "cannot resolve EXTRA_VERSION") || strings.Count(log.String(), "cannot resolve") != 1 {
+		t.Errorf("log %q, want one warning about the unresolved download", log.String())
+	}
+
+	// 2.0.0 has no arm64 build.
+	problems := c.artifacts(ctx, img, "2.0.0")
+	wantProblem := "http://" + host + "/tool/v2.0.0/tool-linux-arm64.tar.gz (linux/arm64): 404 Not Found"
+	if problems != wantProblem {
+		t.Errorf("2.0.0: problems %q, want %q", problems, wantProblem)
+	}
+
+	// An amd64-only image does not need it.
+	if problems := c.artifacts(ctx, testImage(t, host, "linux/amd64"), "2.0.0"); problems != "" {
+		t.Errorf("2.0.0 for amd64: %s", problems)
+	}
+}
@@ -0,0 +1,57 @@
+package upstream
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"os"
+
+	"github.com/gillouche/container-factory/internal/github"
+	"github.com/gillouche/container-factory/internal/registry"
+)
+
+// Source is an entry of ci/upstream_config.json, keyed by VARIANTS file.
+type Source struct {
+	// Type is "github_release" or "docker_hub".
+	Type   string `json:"source"`
+	Repo   string `json:"repo,omitempty"`
+	Prefix string `json:"prefix,omitempty"`
+	Image  string `json:"image,omitempty"`
+	// TagTemplate extracts the version from a tag, e.g. "{version}-slim-trixie".
+	TagTemplate string `json:"tag_template,omitempty"`
+}
+
+// LoadConfig reads ci/upstream_config.json; a missing file has no sources.
+func LoadConfig(path string) (map[string]Source, error) {
+	data, err := os.ReadFile(path)
+	if os.IsNotExist(err) {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+	var cfg map[string]Source
+	if err := json.Unmarshal(data, &cfg); err != nil {
+		return nil, fmt.Errorf("%s: %w", path, err)
+	}
+	return cfg, nil
+}
+
+// Available returns the upstream versions (or tags) of a source.
+func Available(ctx context.Context, src Source, gh *github.Client, reg *registry.Client) ([]string, error) {
+	switch src.Type {
+	case "github_release":
+		prefix := src.Prefix
+		if prefix == "" {
+			prefix = "v"
+		}
+		return gh.Releases(ctx, src.Repo, prefix)
+	case "docker_hub":
+		ref, err := registry.ParseRef(src.Image)
+		if err != nil {
+			return nil, err
+		}
+		return reg.Tags(ctx, ref)
+	}
+	return nil, fmt.Errorf("unknown upstream source %q", src.Type)
+}
@@ -0,0 +1,106 @@
+// Package upstream finds newer upstream releases of the image variants listed
+// in ci/upstream_config.json.
+package upstream
+
+import (
+	"regexp"
+	"sort"
+	"strconv"
+	"strings"
+)
+
+var (
+	digits   = regexp.MustCompile(`\d+`)
+	unstable = regexp.MustCompile(`[a-zA-Z]`)
+)
+
+// Version is the numeric components of a version string.
+type Version []int
+
+// ParseVersion extracts the numeric components of s, so "v2.331.0" is
+// [2 331 0].
+func ParseVersion(s string) Version {
+	var v Version
+	for _, d := range digits.FindAllString(s, -1) {
+		n, _ := strconv.Atoi(d)
+		v = append(v, n)
+	}
+	return v
+}
+
+func (v Version) part(i int) int {
+	if i < len(v) {
+		return v[i]
+	}
+	return 0
+}
+
+// Compare orders versions component by component; a version that is a
+// prefix of another sorts first.
+func (v Version) Compare(o Version) int {
+	for i := 0; i < len(v) && i < len(o); i++ {
+		if v[i] != o[i] {
+			if v[i] < o[i] {
+				return -1
+			}
+			return 1
+		}
+	}
+	return len(v) - len(o)
+}
+
+// Latest returns the highest available version that updates current within
+// its major version (and minor version when strictMinor is set, because the
+// image tracks several minors of one major). Tags are matched against
+// tagTemplate, e.g. "{version}-slim-trixie", when set; pre-releases (any
+// letter in the version) are ignored. It returns "" when current is up to
+// date.
+func Latest(current string, available []string, strictMinor bool, tagTemplate string) string {
+	curr := ParseVersion(current)
+	if len(curr) == 0 {
+		return ""
+	}
+	var pattern *regexp.Regexp
+	if tagTemplate != "" {
+		quoted := regexp.QuoteMeta(tagTemplate)
+		pattern = regexp.MustCompile("^" + strings.Replace(quoted, regexp.QuoteMeta("{version}"), "(.*)", 1) + "$")
+	}
+
+	var candidates []string
+	for _, tag := range available {
+		clean := tag
+		if pattern != nil {
+			m := pattern.FindStringSubmatch(tag)
+			if m == nil {
+				continue
+			}
+			clean = m[1]
+		}
+		if unstable.MatchString(clean) {
+			continue
+		}
+		v := ParseVersion(clean)
+		if len(v) == 0 || v.Compare(curr) <= 0 || v.part(0) != curr.part(0) {
+			continue
+		}
+		if strictMinor && v.part(1) != curr.part(1) {
+			continue
+		}
+		candidates = append(candidates, clean)
+	}
+	if len(candidates) == 0 {
+		return ""
+	}
+	sort.SliceStable(candidates, func(i, j int) bool {
+		return ParseVersion(candidates[i]).Compare(ParseVersion(candidates[j])) > 0
+	})
+	latest := candidates[0]
+	if latest == current {
+		return ""
+	}
+	// Keep a local "v" prefix when the source strips it.
+	if strings.HasPrefix(current, "v") && !strings.HasPrefix(latest, "v") {
+		latest = "v" + latest
+	}
+	return latest
+}
@@ -0,0 +1,116 @@
+// Package vendoring keeps hosted copies of the external base images builds
+// are made FROM. Bases are pulled through proxy caches (Docker Hub, gcr.io,
+// Chainguard); once upstream deletes a digest the proxy eventually drops it
+// too, and the builds that used it can no longer be reproduced. Vendored
+// copies are stored by digest, so they never move.
+package vendoring
+
+import (
+	"context"
+	"sort"
+	"strings"
+
+	"github.com/gillouche/container-factory/internal/config"
+	"github.com/gillouche/container-factory/internal/registry"
+)
+
+// Base is one digest of an external base image.
+type Base struct {
+	// Ref is the reference as written in the FROM line, build args expanded.
+	Ref    string
+	Digest string
+	// Images lists the images built from it.
+	Images []string
+}
+
+// Set collects bases, merging the images of identical digests.
+type Set struct {
+	bases map[string]*Base
+}
+
+// Add records that image was built from ref at digest.
+func (s *Set) Add(ref, digest, image string) {
+	if s.bases == nil {
+		s.bases = map[string]*Base{}
+	}
+	key := ref + "@" + digest
+	b, ok := s.bases[key]
+	if !ok {
+		b = &Base{Ref: ref, Digest: digest}
+		s.bases[key] = b
+	}
+	for _, name := range b.Images {
+		if name == image {
+			return
+		}
+	}
+	b.Images = append(b.Images, image)
+}
+
+// List returns the bases ordered by reference and digest.
+func (s *Set) List() []Base {
+	out := make([]Base, 0, len(s.bases))
+	for _, b := range s.bases {
+		sort.Strings(b.Images)
+		out = append(out, *b)
+	}
+	sort.Slice(out, func(i, j int) bool {
+		if out[i].Ref != out[j].Ref {
+			return out[i].Ref < out[j].Ref
+		}
+		return out[i].Digest < out[j].Digest
+	})
+	return out
+}
+
+// Tag is the tag a vendored digest is kept under, so registry cleanup
+// policies for untagged manifests leave it alone.
+func Tag(digest string) string {
+	return strings.Replace(digest, ":", "-", 1)
+}
+
+// Location returns where the digest of ref is vendored.
+func Location(cfg *config.Config, ref, digest string) (registry.Ref, error) {
+	r, err := registry.ParseRef(ref)
+	if err != nil {
+		return registry.Ref{}, err
+	}
+	loc, err := registry.ParseRef(cfg.VendorRepo(r.Repository) + ":" + Tag(digest))
+	if err != nil {
+		return registry.Ref{}, err
+	}
+	return loc, nil
+}
+
+// Vendor copies the base to its location unless it is already there, and
+// reports whether it copied it.
+func Vendor(ctx context.Context, c *registry.Client, cfg *config.Config, b Base) (registry.Ref, bool, error) {
+	dst, err := Location(cfg, b.Ref, b.Digest)
+	if err != nil {
+		return registry.Ref{}, false, err
+	}
+	if d, err := c.Digest(ctx, dst); err == nil && d == b.Digest {
+		return dst, false, nil
+	} else if err != nil && !registry.IsNotFound(err) {
+		return dst, false, err
+	}
+	src, err := registry.ParseRef(b.Ref)
+	if err != nil {
+		return dst, false, err
+	}
+	src.Tag, src.Digest = "", b.Digest
+	_, err = c.Copy(ctx, src, dst, nil)
+	return dst, err == nil, err
+}
+
+// ContextName is the name BuildKit looks a FROM reference up by in the
+// named build contexts: the reference without a :latest tag.
+func ContextName(ref string) string {
+	return strings.TrimSuffix(ref, ":latest")
+}
+
+// ContextFlag is the docker buildx build flag replacing the FROM reference
+// ref by its vendored copy at loc.
+func ContextFlag(ref string, loc registry.Ref, digest string) string {
+	return "--build-context=" + ContextName(ref) + "=docker-image://" + loc.Name() + "@" + digest
+}
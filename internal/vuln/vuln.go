@@ -0,0 +1,113 @@
+// Package vuln reads the JSON reports written by `trivy image --format json`.
+package vuln
+
+import (
+	"encoding/json"
+	"os"
+	"path/filepath"
+	"time"
+)
+
+// Severities in decreasing order, as reported by Trivy.
+var Severities = []string{"CRITICAL", "HIGH", "MEDIUM", "LOW", "UNKNOWN"}
+
+// Finding is one vulnerability affecting one package.
+type Finding struct {
+	ID        string `json:"id"`
+	Package   string `json:"package"`
+	Installed string `json:"installed"`
+	Fixed     string `json:"fixed,omitempty"`
+	Severity  string `json:"severity"`
+	Target    string `json:"target"`
+}
+
+// Report is a scan of one image.
+type Report struct {
+	Artifact  string
+	CreatedAt time.Time
+	Findings  []Finding
+	// Packages is the number of packages found, only known for scans
+	// listing every package (trivy --list-all-pkgs).
+	Packages int
+}
+
+// Path returns where the report of an image variant is kept in dir.
+func Path(dir, image, variant string) string {
+	return filepath.Join(dir, image, variant+".json")
+}
+
+// Load reads a Trivy JSON report.
+func Load(path string) (*Report, error) {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return nil, err
+	}
+	return Parse(data)
+}
+
+// Parse parses a Trivy JSON report.
+func Parse(data []byte) (*Report, error) {
+	var raw struct {
+		ArtifactName string    `json:"ArtifactName"`
+		CreatedAt    time.Time `json:"CreatedAt"`
+		Results      []struct {
+			Target          string            `json:"Target"`
+			Packages        []json.RawMessage `json:"Packages"`
+			Vulnerabilities []struct {
+				VulnerabilityID  string `json:"VulnerabilityID"`
+				PkgName          string `json:"PkgName"`
+				InstalledVersion string `json:"InstalledVersion"`
+				FixedVersion     string `json:"FixedVersion"`
+				Severity         string `json:"Severity"`
+			} `json:"Vulnerabilities"`
+		} `json:"Results"`
+	}
+	if err := json.Unmarshal(data, &raw); err != nil {
+		return nil, err
+	}
+
+	r := &Report{Artifact: raw.ArtifactName, CreatedAt: raw.CreatedAt}
+	for _, res := range raw.Results {
+		r.Packages += len(res.Packages)
+		for _, v := range res.Vulnerabilities {
+			r.Findings = append(r.Findings, Finding{
+				ID:        v.VulnerabilityID,
+				Package:   v.PkgName,
+				Installed: v.InstalledVersion,
+				Fixed:     v.FixedVersion,
+				Severity:  v.Severity,
+				Target:    res.Target,
+			})
+		}
+	}
+	return r, nil
+}
+
+// Counts returns the number of findings per severity.
+func (r *Report) Counts() map[string]int {
+	counts := map[string]int{}
+	for _, f := range r.Findings {
+		counts[f.Severity]++
+	}
+	return counts
+}
+
+// Since returns the findings of r that are not in prev, matched by
+// vulnerability ID and package.
+func (r *Report) Since(prev *Report) []Finding {
+	seen := map[string]bool{}
+	if prev != nil {
+		for _, f := range prev.Findings {
+			seen[f.ID+"/"+f.Package] = true
+		}
+	}
+	var out []Finding
+	for _, f := range r.Findings {
+		key := f.ID + "/" + f.Package
+		if !seen[key] {
+			seen[key] = true
+			out = append(out, f)
+		}
+	}
+	return out
+}
@@ -0,0 +1,7 @@
+module github.com/gillouche/container-factory/tests/go
+
+go 1.25
+
+require github.com/gillouche/container-factory/images/go-distroless/selftest v0.0.0
+
+replace github.com/gillouche/container-factory/images/go-distroless/selftest => ../../images/go-distroless/selftest
@@ -3,16 +3,19 @@ package main
 import (
 	"fmt"
 	"os"
+
+	"github.com/gillouche/container-factory/images/go-distroless/selftest"
 )
 
+// The smoke test runs the fixture with --self-test, which performs the
+// checks go-distroless consumers get from the selftest package.
 func main() {
-	// Verify non-root execution
-	uid := os.Getuid()
-	if uid == 0 {
-		fmt.Fprintf(os.Stderr, "Container must not run as root (got uid=%d)\n", uid)
+	selftest.Hook(selftest.Config{})
+
+	if err := selftest.SelfTest(selftest.Config{}); err != nil {
+		fmt.Fprintln(os.Stderr, err)
 		os.Exit(1)
 	}
-
-	fmt.Printf("Running as uid: %d\n", uid)
+	fmt.Printf("Running as uid: %d\n", os.Getuid())
 	fmt.Println("All smoke test assertions passed.")
 }